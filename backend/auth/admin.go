@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	adminEmailsEnvVar = "PGWEB_ADMIN_EMAILS"
+)
+
+// IsAdmin reports whether the user is a platform administrator.
+// Administrators are listed by email in PGWEB_ADMIN_EMAILS (comma-separated, case-insensitive).
+func IsAdmin(user *UserSessionInfo) bool {
+	if user == nil || user.Email == "" {
+		return false
+	}
+	for _, email := range strings.Split(os.Getenv(adminEmailsEnvVar), ",") {
+		if email = strings.TrimSpace(email); email != "" && strings.EqualFold(email, user.Email) {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminMiddleware aborts with 403 Forbidden unless the session user is an administrator.
+// It must run after the authentication middlewares.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userInfo := GetUserFromSession(c)
+		if userInfo == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized. Please log in."})
+			return
+		}
+		if !IsAdmin(userInfo) {
+			log.Printf("AdminMiddleware: User %s is not an administrator. Aborting request.", userInfo.InternalUserID)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Administrator access required"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,112 @@
+package dbutils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	pq "github.com/lib/pq"
+)
+
+// AdoptedRole is an existing login role mapped to a managed PG user during adoption.
+// ConnectionLimit and ValidUntil are filled in from pg_roles.
+type AdoptedRole struct {
+	Name            string
+	PermissionLevel string // "read" or "write"
+	ConnectionLimit int
+	ValidUntil      *time.Time
+}
+
+var (
+	// ErrAdoptionTargetNotFound is returned when the database or a login role to adopt does not exist.
+	ErrAdoptionTargetNotFound = errors.New("adoption target not found")
+	// ErrAdoptionTargetInvalid is returned when the database or a login role cannot be adopted.
+	ErrAdoptionTargetInvalid = errors.New("adoption target invalid")
+)
+
+// AdoptPostgresDatabase brings an existing database under management: it creates the read and write
+// roles with the grants CreatePostgresDatabase sets up and grants each adopted login role its level role.
+// Data, existing objects and existing privileges are left untouched. CONNECT is only revoked from PUBLIC
+// if revokePublicConnect is set, since unmapped roles may still rely on it.
+// Everything is validated before the first change; role details are written back into roles.
+func AdoptPostgresDatabase(pgAdminDSN, dbName string, roles []AdoptedRole, revokePublicConnect bool) error {
+	safeDBName, err := sanitizeIdentifier(dbName)
+	if err != nil {
+		return fmt.Errorf("%w: invalid database name '%s': %v", ErrAdoptionTargetInvalid, dbName, err)
+	}
+
+	adminDB, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer adminDB.Close()
+
+	var isTemplate bool
+	err = adminDB.QueryRow("SELECT datistemplate FROM pg_database WHERE datname = $1", safeDBName).Scan(&isTemplate)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: database '%s' does not exist", ErrAdoptionTargetNotFound, safeDBName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check if database '%s' exists: %w", safeDBName, err)
+	}
+	if isTemplate || safeDBName == "postgres" {
+		return fmt.Errorf("%w: database '%s' cannot be adopted", ErrAdoptionTargetInvalid, safeDBName)
+	}
+
+	for i := range roles {
+		role := &roles[i]
+		if _, err := sanitizeIdentifier(role.Name); err != nil {
+			return fmt.Errorf("%w: invalid PostgreSQL username '%s': %v", ErrAdoptionTargetInvalid, role.Name, err)
+		}
+		if role.PermissionLevel != "read" && role.PermissionLevel != "write" {
+			return fmt.Errorf("%w: invalid permission level '%s' for role '%s'", ErrAdoptionTargetInvalid, role.PermissionLevel, role.Name)
+		}
+		var canLogin, superuser bool
+		var validUntil sql.NullTime
+		err := adminDB.QueryRow(`SELECT rolcanlogin, rolsuper, rolconnlimit, NULLIF(rolvaliduntil, 'infinity') FROM pg_roles WHERE rolname = $1`, role.Name).
+			Scan(&canLogin, &superuser, &role.ConnectionLimit, &validUntil)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: role '%s' does not exist", ErrAdoptionTargetNotFound, role.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to look up role '%s': %w", role.Name, err)
+		}
+		if !canLogin || superuser {
+			return fmt.Errorf("%w: role '%s' must be a non-superuser login role", ErrAdoptionTargetInvalid, role.Name)
+		}
+		if validUntil.Valid {
+			role.ValidUntil = &validUntil.Time
+		}
+	}
+
+	targetDB, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, safeDBName))
+	if err != nil {
+		return fmt.Errorf("failed to connect to database %s to adopt it: %w", safeDBName, err)
+	}
+	defer targetDB.Close()
+
+	// The managed roles are configured on the public schema, which older databases may have dropped.
+	if _, err := targetDB.Exec("CREATE SCHEMA IF NOT EXISTS public"); err != nil {
+		return fmt.Errorf("failed to ensure public schema exists: %w", err)
+	}
+	if err := EnsureDatabaseRoles(pgAdminDSN, safeDBName, nil); err != nil {
+		return err
+	}
+
+	if revokePublicConnect {
+		log.Printf("Revoking default public access on adopted database %s", safeDBName)
+		if _, err := targetDB.Exec(fmt.Sprintf("REVOKE CONNECT ON DATABASE %s FROM PUBLIC", pq.QuoteIdentifier(safeDBName))); err != nil {
+			return fmt.Errorf("failed to revoke CONNECT on database from PUBLIC: %w", err)
+		}
+	}
+
+	for _, role := range roles {
+		if err := GrantRoleToUser(pgAdminDSN, safeDBName, fmt.Sprintf("%s_%s", safeDBName, role.PermissionLevel), role.Name); err != nil {
+			return err
+		}
+	}
+	log.Printf("Database %s adopted with %d login role(s).", safeDBName, len(roles))
+	return nil
+}
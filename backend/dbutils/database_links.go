@@ -0,0 +1,222 @@
+package dbutils
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	pq "github.com/lib/pq"
+)
+
+// DatabaseLink describes a postgres_fdw foreign server in a target database that exposes a schema
+// of a source database of the same cluster as foreign tables in a local schema.
+type DatabaseLink struct {
+	ServerName   string // Name of the foreign server in the target database
+	SourceDB     string
+	TargetDB     string
+	Host         string // How the cluster reaches itself
+	Port         int
+	Username     string // Read-only login role on the source the user mapping connects as
+	Password     string
+	RemoteSchema string
+	LocalSchema  string
+	Tables       []string // Tables to import; all tables of the remote schema if empty
+}
+
+// ValidateLinkTables checks the table names to import from the remote schema.
+func ValidateLinkTables(tables []string) error {
+	seen := make(map[string]bool)
+	for _, table := range tables {
+		if _, err := sanitizeIdentifier(table); err != nil {
+			return fmt.Errorf("invalid table '%s': %w", table, err)
+		}
+		if seen[table] {
+			return fmt.Errorf("table '%s' is listed twice", table)
+		}
+		seen[table] = true
+	}
+	return nil
+}
+
+// GrantDatabaseLinkSourceAccess lets the login role of a link read only the linked schema of the
+// source database: CONNECT on the database, USAGE on the schema and SELECT on the linked tables.
+// The role is created with the "custom" permission level, so it has no other access.
+func GrantDatabaseLinkSourceAccess(pgAdminDSN, sourceDB, username, schema string, tables []string) error {
+	for _, name := range append([]string{sourceDB, username, schema}, tables...) {
+		if _, err := sanitizeIdentifier(name); err != nil {
+			return fmt.Errorf("invalid database link identifier: %w", err)
+		}
+	}
+	db, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, sourceDB))
+	if err != nil {
+		return fmt.Errorf("failed to connect to source database %s: %w", sourceDB, err)
+	}
+	defer db.Close()
+
+	for _, stmt := range linkSourceGrantStatements(sourceDB, username, schema, tables) {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to grant link role %s access to %s.%s: %w", username, sourceDB, schema, err)
+		}
+	}
+	return nil
+}
+
+// linkSourceGrantStatements renders the grants of GrantDatabaseLinkSourceAccess.
+func linkSourceGrantStatements(sourceDB, username, schema string, tables []string) []string {
+	role, qSchema := pq.QuoteIdentifier(username), pq.QuoteIdentifier(schema)
+	statements := []string{
+		fmt.Sprintf("GRANT CONNECT ON DATABASE %s TO %s", pq.QuoteIdentifier(sourceDB), role),
+		fmt.Sprintf("GRANT USAGE ON SCHEMA %s TO %s", qSchema, role),
+	}
+	if len(tables) == 0 {
+		return append(statements, fmt.Sprintf("GRANT SELECT ON ALL TABLES IN SCHEMA %s TO %s", qSchema, role))
+	}
+	quoted := make([]string, len(tables))
+	for i, t := range tables {
+		quoted[i] = qSchema + "." + pq.QuoteIdentifier(t)
+	}
+	return append(statements, fmt.Sprintf("GRANT SELECT ON TABLE %s TO %s", strings.Join(quoted, ", "), role))
+}
+
+// CreateDatabaseLink installs postgres_fdw in the target database, creates the foreign server with user
+// mappings for the target's read and write roles, and imports the remote schema into a new local schema
+// that those roles can query. On failure everything created so far is dropped again.
+func CreateDatabaseLink(pgAdminDSN string, l DatabaseLink) error {
+	log.Printf("Attempting to create database link %s from %s.%s into %s.%s", l.ServerName, l.SourceDB, l.RemoteSchema, l.TargetDB, l.LocalSchema)
+	for _, name := range append([]string{l.ServerName, l.SourceDB, l.TargetDB, l.Username, l.RemoteSchema, l.LocalSchema}, l.Tables...) {
+		if _, err := sanitizeIdentifier(name); err != nil {
+			return fmt.Errorf("invalid database link identifier: %w", err)
+		}
+	}
+	db, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, l.TargetDB))
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database %s: %w", l.TargetDB, err)
+	}
+	defer db.Close()
+
+	server, schema := pq.QuoteIdentifier(l.ServerName), pq.QuoteIdentifier(l.LocalSchema)
+	readRole, writeRole := pq.QuoteIdentifier(l.TargetDB+"_read"), pq.QuoteIdentifier(l.TargetDB+"_write")
+	importStmt := fmt.Sprintf("IMPORT FOREIGN SCHEMA %s FROM SERVER %s INTO %s", pq.QuoteIdentifier(l.RemoteSchema), server, schema)
+	if len(l.Tables) > 0 {
+		quoted := make([]string, len(l.Tables))
+		for i, t := range l.Tables {
+			quoted[i] = pq.QuoteIdentifier(t)
+		}
+		importStmt = fmt.Sprintf("IMPORT FOREIGN SCHEMA %s LIMIT TO (%s) FROM SERVER %s INTO %s",
+			pq.QuoteIdentifier(l.RemoteSchema), strings.Join(quoted, ", "), server, schema)
+	}
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS postgres_fdw",
+		fmt.Sprintf("CREATE SERVER %s FOREIGN DATA WRAPPER postgres_fdw OPTIONS (host %s, port %s, dbname %s)",
+			server, pq.QuoteLiteral(l.Host), pq.QuoteLiteral(fmt.Sprint(l.Port)), pq.QuoteLiteral(l.SourceDB)),
+		// User mappings are looked up by the current role, not its memberships. Write users run as the
+		// write role by default; read users must SET ROLE to the read role to use the link.
+		fmt.Sprintf("CREATE USER MAPPING FOR %s SERVER %s OPTIONS (user %s, password %s)",
+			readRole, server, pq.QuoteLiteral(l.Username), pq.QuoteLiteral(l.Password)),
+		fmt.Sprintf("CREATE USER MAPPING FOR %s SERVER %s OPTIONS (user %s, password %s)",
+			writeRole, server, pq.QuoteLiteral(l.Username), pq.QuoteLiteral(l.Password)),
+		fmt.Sprintf("CREATE SCHEMA %s", schema),
+		fmt.Sprintf("GRANT USAGE ON SCHEMA %s TO %s, %s", schema, readRole, writeRole),
+		importStmt,
+		fmt.Sprintf("GRANT SELECT ON ALL TABLES IN SCHEMA %s TO %s, %s", schema, readRole, writeRole),
+	}
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			log.Printf("Failed to create database link %s: %v. Attempting cleanup.", l.ServerName, err)
+			if dropErr := DropDatabaseLink(pgAdminDSN, l.TargetDB, l.ServerName, l.LocalSchema); dropErr != nil {
+				log.Printf("CRITICAL: Failed to create database link AND failed to clean up: %v. Manual cleanup for %s.", dropErr, l.ServerName)
+			}
+			return fmt.Errorf("failed to create database link %s: %w", l.ServerName, err)
+		}
+	}
+	log.Printf("Database link %s created in %s.", l.ServerName, l.TargetDB)
+	return nil
+}
+
+// DropDatabaseLink drops the local schema with its foreign tables and the foreign server with its
+// user mapping from the target database. Missing objects are skipped.
+func DropDatabaseLink(pgAdminDSN, targetDB, serverName, localSchema string) error {
+	for _, name := range []string{targetDB, serverName, localSchema} {
+		if _, err := sanitizeIdentifier(name); err != nil {
+			return fmt.Errorf("invalid database link identifier: %w", err)
+		}
+	}
+	db, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, targetDB))
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database %s: %w", targetDB, err)
+	}
+	defer db.Close()
+
+	for _, stmt := range []string{
+		fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", pq.QuoteIdentifier(localSchema)),
+		fmt.Sprintf("DROP SERVER IF EXISTS %s CASCADE", pq.QuoteIdentifier(serverName)),
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to drop database link %s: %w", serverName, err)
+		}
+	}
+	log.Printf("Database link %s dropped from %s.", serverName, targetDB)
+	return nil
+}
+
+// SetDatabaseLinkPassword updates the password of a link's user mappings after its login role's password changed.
+func SetDatabaseLinkPassword(pgAdminDSN, targetDB, serverName, password string) error {
+	for _, name := range []string{targetDB, serverName} {
+		if _, err := sanitizeIdentifier(name); err != nil {
+			return fmt.Errorf("invalid database link identifier: %w", err)
+		}
+	}
+	db, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, targetDB))
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database %s: %w", targetDB, err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT usename FROM pg_user_mappings WHERE srvname = $1", serverName)
+	if err != nil {
+		return fmt.Errorf("failed to list user mappings of database link %s: %w", serverName, err)
+	}
+	var mappings []string
+	for rows.Next() {
+		var user string
+		if err := rows.Scan(&user); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan user mapping of database link %s: %w", serverName, err)
+		}
+		if user == "public" {
+			mappings = append(mappings, "PUBLIC") // Links created before mappings were per role
+		} else {
+			mappings = append(mappings, pq.QuoteIdentifier(user))
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate user mappings of database link %s: %w", serverName, err)
+	}
+	for _, user := range mappings {
+		stmt := fmt.Sprintf("ALTER USER MAPPING FOR %s SERVER %s OPTIONS (SET password %s)", user, pq.QuoteIdentifier(serverName), pq.QuoteLiteral(password))
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to update user mapping of database link %s: %w", serverName, err)
+		}
+	}
+	return nil
+}
+
+// SchemaExists reports whether a schema exists in a database.
+func SchemaExists(pgAdminDSN, dbName, schemaName string) (bool, error) {
+	safeDBName, err := sanitizeIdentifier(dbName)
+	if err != nil {
+		return false, fmt.Errorf("invalid database name '%s': %w", dbName, err)
+	}
+	db, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, safeDBName))
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to database %s: %w", safeDBName, err)
+	}
+	defer db.Close()
+
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM pg_namespace WHERE nspname = $1)", schemaName).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check if schema %s exists in %s: %w", schemaName, safeDBName, err)
+	}
+	return exists, nil
+}
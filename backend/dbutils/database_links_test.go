@@ -0,0 +1,36 @@
+package dbutils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateLinkTables(t *testing.T) {
+	for _, tables := range [][]string{nil, {"orders"}, {"orders", "order_items"}} {
+		if err := ValidateLinkTables(tables); err != nil {
+			t.Errorf("ValidateLinkTables(%q) error = %v", tables, err)
+		}
+	}
+	for _, tables := range [][]string{{"Orders"}, {"sales.orders"}, {"orders", "orders"}, {"x;drop"}} {
+		if err := ValidateLinkTables(tables); err == nil {
+			t.Errorf("ValidateLinkTables(%q) succeeded, want error", tables)
+		}
+	}
+}
+
+func TestLinkSourceGrantStatements(t *testing.T) {
+	got := linkSourceGrantStatements("shop", "shop__link_1a2b3c4d", "sales", []string{"orders", "order_items"})
+	want := []string{
+		`GRANT CONNECT ON DATABASE "shop" TO "shop__link_1a2b3c4d"`,
+		`GRANT USAGE ON SCHEMA "sales" TO "shop__link_1a2b3c4d"`,
+		`GRANT SELECT ON TABLE "sales"."orders", "sales"."order_items" TO "shop__link_1a2b3c4d"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("linkSourceGrantStatements() = %q, want %q", got, want)
+	}
+
+	got = linkSourceGrantStatements("shop", "shop__link_1a2b3c4d", "sales", nil)
+	if last := got[len(got)-1]; last != `GRANT SELECT ON ALL TABLES IN SCHEMA "sales" TO "shop__link_1a2b3c4d"` {
+		t.Errorf("linkSourceGrantStatements() without tables ends with %q, want all tables of the schema", last)
+	}
+}
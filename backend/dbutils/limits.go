@@ -0,0 +1,54 @@
+package dbutils
+
+import (
+	"fmt"
+	"log"
+
+	"pgweb-backend/models"
+
+	pq "github.com/lib/pq"
+)
+
+// ApplyPostgresUserLimits sets the connection limit and session timeouts of a PostgreSQL login role
+// via ALTER ROLE. Timeouts of 0 are reset to the server default.
+func ApplyPostgresUserLimits(pgAdminDSN, targetDbName, pgUserName string, limits models.PGUserLimits) error {
+	safePgUserName, err := sanitizeIdentifier(pgUserName)
+	if err != nil {
+		return fmt.Errorf("invalid PostgreSQL username '%s': %w", pgUserName, err)
+	}
+
+	db, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, targetDbName))
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database %s to apply user limits: %w", targetDbName, err)
+	}
+	defer db.Close()
+
+	role := pq.QuoteIdentifier(safePgUserName)
+	if _, err := db.Exec(fmt.Sprintf("ALTER ROLE %s CONNECTION LIMIT %d", role, limits.ConnectionLimit)); err != nil {
+		return fmt.Errorf("failed to set connection limit for user %s: %w", safePgUserName, err)
+	}
+
+	timeouts := []struct {
+		name  string
+		value int
+	}{
+		{"statement_timeout", limits.StatementTimeout},
+		{"idle_in_transaction_session_timeout", limits.IdleInTransactionSessionTimeout},
+		{"lock_timeout", limits.LockTimeout},
+	}
+	for _, t := range timeouts {
+		var alterSQL string
+		if t.value > 0 {
+			alterSQL = fmt.Sprintf("ALTER ROLE %s SET %s = %d", role, t.name, t.value)
+		} else {
+			alterSQL = fmt.Sprintf("ALTER ROLE %s RESET %s", role, t.name)
+		}
+		if _, err := db.Exec(alterSQL); err != nil {
+			return fmt.Errorf("failed to set %s for user %s: %w", t.name, safePgUserName, err)
+		}
+	}
+
+	log.Printf("Limits applied to user %s: connection_limit=%d statement_timeout=%dms idle_in_transaction_session_timeout=%dms lock_timeout=%dms",
+		safePgUserName, limits.ConnectionLimit, limits.StatementTimeout, limits.IdleInTransactionSessionTimeout, limits.LockTimeout)
+	return nil
+}
@@ -0,0 +1,191 @@
+package dbutils
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+
+	pq "github.com/lib/pq"
+)
+
+// Lock is a lock held or awaited by a session, from pg_locks.
+type Lock struct {
+	LockType    string   `json:"lock_type"` // e.g. "relation", "transactionid", "tuple", "advisory"
+	Mode        string   `json:"mode"`      // e.g. "AccessExclusiveLock", "RowExclusiveLock"
+	Relation    string   `json:"relation"`  // Schema-qualified if not on the search path; empty for non-relation locks
+	Granted     bool     `json:"granted"`
+	WaitSeconds *float64 `json:"wait_seconds"` // How long an ungranted lock has been awaited
+}
+
+// LockSession is a session that is blocked by or blocks another session, with its locks and
+// the sessions it blocks nested below it.
+type LockSession struct {
+	Session
+	BlockedBy   []int         `json:"blocked_by"`   // PIDs from pg_blocking_pids(), which may belong to other databases
+	WaitSeconds *float64      `json:"wait_seconds"` // Longest wait among the session's ungranted locks
+	Locks       []Lock        `json:"locks"`
+	Blocked     []LockSession `json:"blocked"`
+}
+
+// GetDatabaseBlockingTree returns the blocking chains among the client backends connected to dbName. Each
+// root is a session that blocks others without being blocked within the database; sessions blocked by
+// several others appear under each of them.
+func GetDatabaseBlockingTree(pgAdminDSN, dbName string) ([]LockSession, error) {
+	safeDBName, err := sanitizeIdentifier(dbName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database name '%s': %w", dbName, err)
+	}
+	// Relation OIDs only resolve to names in their own database, so the query runs there.
+	db, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, safeDBName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database %s: %w", safeDBName, err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT ` + sessionColumns + `, pg_blocking_pids(pid) FROM pg_stat_activity
+		WHERE datname = current_database() AND backend_type = 'client backend' AND pid <> pg_backend_pid()`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pg_stat_activity: %w", err)
+	}
+	defer rows.Close()
+	var sessions []LockSession
+	for rows.Next() {
+		var blockedBy pq.Int64Array
+		s, err := scanSession(rows, &blockedBy)
+		if err != nil {
+			return nil, err
+		}
+		ls := LockSession{Session: s, BlockedBy: []int{}, Locks: []Lock{}, Blocked: []LockSession{}}
+		for _, pid := range blockedBy {
+			ls.BlockedBy = append(ls.BlockedBy, int(pid))
+		}
+		sessions = append(sessions, ls)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate sessions: %w", err)
+	}
+
+	sessions = blockingSessions(sessions)
+	if len(sessions) == 0 {
+		return []LockSession{}, nil
+	}
+	pids := make([]int64, len(sessions))
+	index := make(map[int]int, len(sessions))
+	for i, s := range sessions {
+		pids[i] = int64(s.PID)
+		index[s.PID] = i
+	}
+	lockRows, err := db.Query(`SELECT l.pid, l.locktype, l.mode, l.granted,
+		CASE WHEN l.relation IS NOT NULL AND l.database IN (0, (SELECT oid FROM pg_database WHERE datname = current_database()))
+			THEN l.relation::regclass::text ELSE '' END,
+		EXTRACT(EPOCH FROM now() - l.waitstart)::float8
+		FROM pg_locks l
+		WHERE l.pid = ANY($1) AND NOT (l.granted AND l.locktype = 'virtualxid')
+		ORDER BY l.pid, l.granted, l.locktype, l.mode`, pq.Array(pids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pg_locks: %w", err)
+	}
+	defer lockRows.Close()
+	for lockRows.Next() {
+		var pid int
+		var l Lock
+		var wait sql.NullFloat64
+		if err := lockRows.Scan(&pid, &l.LockType, &l.Mode, &l.Granted, &l.Relation, &wait); err != nil {
+			return nil, fmt.Errorf("failed to scan lock: %w", err)
+		}
+		i, ok := index[pid]
+		if !ok {
+			continue
+		}
+		if wait.Valid && !l.Granted {
+			l.WaitSeconds = &wait.Float64
+			if s := &sessions[i]; s.WaitSeconds == nil || wait.Float64 > *s.WaitSeconds {
+				s.WaitSeconds = &wait.Float64
+			}
+		}
+		sessions[i].Locks = append(sessions[i].Locks, l)
+	}
+	if err := lockRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate locks: %w", err)
+	}
+	return BuildBlockingTree(sessions), nil
+}
+
+// blockingSessions keeps the sessions that are blocked or block another session.
+func blockingSessions(sessions []LockSession) []LockSession {
+	blockers := make(map[int]bool)
+	for _, s := range sessions {
+		for _, pid := range s.BlockedBy {
+			blockers[pid] = true
+		}
+	}
+	var involved []LockSession
+	for _, s := range sessions {
+		if len(s.BlockedBy) > 0 || blockers[s.PID] {
+			involved = append(involved, s)
+		}
+	}
+	return involved
+}
+
+// BuildBlockingTree nests blocked sessions under the sessions blocking them. Roots are sessions not
+// blocked by any session in the list, ordered by PID; if sessions only block each other in a cycle
+// (a deadlock not yet detected), the lowest PID of the cycle becomes a root.
+func BuildBlockingTree(sessions []LockSession) []LockSession {
+	byPID := make(map[int]LockSession, len(sessions))
+	children := make(map[int][]int)
+	for _, s := range sessions {
+		byPID[s.PID] = s
+	}
+	for _, s := range sessions {
+		for _, blocker := range s.BlockedBy {
+			if _, ok := byPID[blocker]; ok {
+				children[blocker] = append(children[blocker], s.PID)
+			}
+		}
+	}
+	pids := make([]int, 0, len(sessions))
+	for pid := range byPID {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	for _, c := range children {
+		sort.Ints(c)
+	}
+
+	reached := make(map[int]bool)
+	var build func(pid int, path map[int]bool) LockSession
+	build = func(pid int, path map[int]bool) LockSession {
+		reached[pid] = true
+		node := byPID[pid]
+		node.Blocked = []LockSession{}
+		path[pid] = true
+		for _, child := range children[pid] {
+			if !path[child] {
+				node.Blocked = append(node.Blocked, build(child, path))
+			}
+		}
+		delete(path, pid)
+		return node
+	}
+
+	roots := []LockSession{}
+	for _, pid := range pids {
+		rooted := true
+		for _, blocker := range byPID[pid].BlockedBy {
+			if _, ok := byPID[blocker]; ok {
+				rooted = false
+				break
+			}
+		}
+		if rooted {
+			roots = append(roots, build(pid, map[int]bool{}))
+		}
+	}
+	for _, pid := range pids {
+		if !reached[pid] {
+			roots = append(roots, build(pid, map[int]bool{}))
+		}
+	}
+	return roots
+}
@@ -0,0 +1,53 @@
+package dbutils
+
+import (
+	"reflect"
+	"testing"
+)
+
+// treePIDs flattens a blocking tree to "pid(children...)" form for comparison.
+func treePIDs(nodes []LockSession) []any {
+	out := []any{}
+	for _, n := range nodes {
+		out = append(out, n.PID)
+		if len(n.Blocked) > 0 {
+			out = append(out, treePIDs(n.Blocked))
+		}
+	}
+	return out
+}
+
+func lockSession(pid int, blockedBy ...int) LockSession {
+	return LockSession{Session: Session{PID: pid}, BlockedBy: blockedBy}
+}
+
+func TestBlockingSessions(t *testing.T) {
+	got := blockingSessions([]LockSession{lockSession(1), lockSession(2, 1), lockSession(3), lockSession(4, 99)})
+	var pids []int
+	for _, s := range got {
+		pids = append(pids, s.PID)
+	}
+	if want := []int{1, 2, 4}; !reflect.DeepEqual(pids, want) {
+		t.Errorf("blockingSessions() PIDs = %v, want %v", pids, want)
+	}
+}
+
+func TestBuildBlockingTree(t *testing.T) {
+	tests := []struct {
+		name     string
+		sessions []LockSession
+		want     []any
+	}{
+		{"empty", nil, []any{}},
+		{"chain", []LockSession{lockSession(3, 2), lockSession(2, 1), lockSession(1)}, []any{1, []any{2, []any{3}}}},
+		{"fan out", []LockSession{lockSession(1), lockSession(3, 1), lockSession(2, 1)}, []any{1, []any{2, 3}}},
+		{"two blockers", []LockSession{lockSession(1), lockSession(2), lockSession(3, 1, 2)}, []any{1, []any{3}, 2, []any{3}}},
+		{"blocker in another database", []LockSession{lockSession(5, 99), lockSession(6, 5)}, []any{5, []any{6}}},
+		{"cycle", []LockSession{lockSession(7, 8), lockSession(8, 7), lockSession(9, 8)}, []any{7, []any{8, []any{9}}}},
+	}
+	for _, tt := range tests {
+		if got := treePIDs(BuildBlockingTree(tt.sessions)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: BuildBlockingTree() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package dbutils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	pq "github.com/lib/pq"
+)
+
+// ReplicationTable is a table published by a logical replication.
+type ReplicationTable struct {
+	Schema string
+	Table  string
+}
+
+// String returns the schema-qualified table name.
+func (t ReplicationTable) String() string {
+	return t.Schema + "." + t.Table
+}
+
+func (t ReplicationTable) quoted() string {
+	return pq.QuoteIdentifier(t.Schema) + "." + pq.QuoteIdentifier(t.Table)
+}
+
+// LogicalReplication describes a publication on a source database streamed into a subscription on a
+// target database of the same cluster.
+type LogicalReplication struct {
+	Name     string // Name of the publication, replication slot and subscription
+	SourceDB string
+	TargetDB string
+	RoleName string // Login role with REPLICATION the subscription connects as
+	Tables   []ReplicationTable
+	ConnHost string // How the cluster reaches itself for the subscription connection
+	ConnPort int
+}
+
+// SubscriptionTableState is the synchronization state of a table in a subscription.
+type SubscriptionTableState struct {
+	Table string `json:"table"`
+	State string `json:"state"` // "init", "data_copy", "finished_copy", "synchronized" or "ready"
+}
+
+// SubscriptionStatus is the state of a subscription from pg_subscription, pg_stat_subscription and
+// pg_subscription_rel, plus the lag of its replication slot on the source.
+type SubscriptionStatus struct {
+	Enabled            bool                     `json:"enabled"`
+	WorkerPID          *int                     `json:"worker_pid"` // Null when the apply worker is not running
+	ReceivedLSN        *string                  `json:"received_lsn"`
+	LatestEndLSN       *string                  `json:"latest_end_lsn"`
+	LastMsgReceiptTime *time.Time               `json:"last_msg_receipt_time"`
+	LatestEndTime      *time.Time               `json:"latest_end_time"`
+	SlotActive         bool                     `json:"slot_active"`
+	SlotLagBytes       *int64                   `json:"slot_lag_bytes"` // WAL the subscription has not confirmed yet
+	Tables             []SubscriptionTableState `json:"tables"`
+}
+
+// subscriptionTableStates maps pg_subscription_rel.srsubstate to readable names.
+var subscriptionTableStates = map[string]string{
+	"i": "init", "d": "data_copy", "f": "finished_copy", "s": "synchronized", "r": "ready",
+}
+
+// ErrUnsupportedServerVersion is returned when a feature needs a newer PostgreSQL server.
+var ErrUnsupportedServerVersion = errors.New("unsupported PostgreSQL server version")
+
+// requireServerVersion returns ErrUnsupportedServerVersion if the server is older than minVersion
+// (in server_version_num form, e.g. 160000).
+func requireServerVersion(pgAdminDSN string, minVersion int, feature string) error {
+	db, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer db.Close()
+	var version int
+	if err := db.QueryRow("SELECT current_setting('server_version_num')::int").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read server version: %w", err)
+	}
+	if version < minVersion {
+		return fmt.Errorf("%w: %s requires PostgreSQL %d or later", ErrUnsupportedServerVersion, feature, minVersion/10000)
+	}
+	return nil
+}
+
+// ParseReplicationTables validates "schema.table" names; a name without a schema is in public.
+func ParseReplicationTables(names []string) ([]ReplicationTable, error) {
+	if len(names) == 0 {
+		return nil, errors.New("at least one table is required")
+	}
+	seen := make(map[string]bool)
+	tables := make([]ReplicationTable, 0, len(names))
+	for _, name := range names {
+		schema, table, ok := strings.Cut(name, ".")
+		if !ok {
+			schema, table = "public", name
+		}
+		if _, err := sanitizeIdentifier(schema); err != nil {
+			return nil, fmt.Errorf("invalid schema in table '%s': %w", name, err)
+		}
+		if _, err := sanitizeIdentifier(table); err != nil {
+			return nil, fmt.Errorf("invalid table '%s': %w", name, err)
+		}
+		t := ReplicationTable{Schema: schema, Table: table}
+		if seen[t.String()] {
+			return nil, fmt.Errorf("table '%s' is listed twice", t)
+		}
+		seen[t.String()] = true
+		tables = append(tables, t)
+	}
+	return tables, nil
+}
+
+// MissingTables returns the tables that do not exist in a database.
+func MissingTables(pgAdminDSN, dbName string, tables []ReplicationTable) ([]string, error) {
+	safeDBName, err := sanitizeIdentifier(dbName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database name '%s': %w", dbName, err)
+	}
+	db, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, safeDBName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database %s: %w", safeDBName, err)
+	}
+	defer db.Close()
+
+	var missing []string
+	for _, t := range tables {
+		var exists bool
+		err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE n.nspname = $1 AND c.relname = $2 AND c.relkind IN ('r', 'p'))`, t.Schema, t.Table).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check table %s in database %s: %w", t, safeDBName, err)
+		}
+		if !exists {
+			missing = append(missing, t.String())
+		}
+	}
+	return missing, nil
+}
+
+// subscriptionConnInfo renders the libpq connection string the subscription uses to reach the source.
+func subscriptionConnInfo(r LogicalReplication, password string) string {
+	quote := func(v string) string { return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'" }
+	return fmt.Sprintf("host=%s port=%d dbname=%s user=%s password=%s",
+		quote(r.ConnHost), r.ConnPort, quote(r.SourceDB), quote(r.RoleName), quote(password))
+}
+
+// CreateLogicalReplication creates the replication role, publication and slot on the source database and
+// the subscription on the target database, which copies the existing rows and then streams changes.
+// Source and target share the cluster, so the slot is created up front: CREATE SUBSCRIPTION would otherwise
+// wait for itself. On failure everything created so far is dropped again.
+func CreateLogicalReplication(pgAdminDSN string, r LogicalReplication) error {
+	log.Printf("Attempting to create logical replication %s from %s to %s", r.Name, r.SourceDB, r.TargetDB)
+	for _, name := range []string{r.Name, r.SourceDB, r.TargetDB, r.RoleName} {
+		if _, err := sanitizeIdentifier(name); err != nil {
+			return fmt.Errorf("invalid logical replication identifier: %w", err)
+		}
+	}
+	// Only PostgreSQL 16 lets a non-superuser own a subscription and apply changes as the table owner.
+	if err := requireServerVersion(pgAdminDSN, 160000, "logical replication"); err != nil {
+		return err
+	}
+	password, err := generatePolicyPassword()
+	if err != nil {
+		return fmt.Errorf("failed to generate password for replication role %s: %w", r.RoleName, err)
+	}
+
+	err = func() error {
+		sourceDB, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, r.SourceDB))
+		if err != nil {
+			return fmt.Errorf("failed to connect to source database %s: %w", r.SourceDB, err)
+		}
+		defer sourceDB.Close()
+
+		createRole := fmt.Sprintf("CREATE ROLE %s WITH LOGIN REPLICATION NOSUPERUSER NOCREATEDB NOCREATEROLE PASSWORD %s",
+			pq.QuoteIdentifier(r.RoleName), pq.QuoteLiteral(password))
+		if err := execPasswordStatement(sourceDB, createRole); err != nil {
+			return fmt.Errorf("failed to create replication role %s: %w", r.RoleName, err)
+		}
+		statements := []string{fmt.Sprintf("GRANT CONNECT ON DATABASE %s TO %s", pq.QuoteIdentifier(r.SourceDB), pq.QuoteIdentifier(r.RoleName))}
+		schemas := make(map[string]bool)
+		quotedTables := make([]string, len(r.Tables))
+		for i, t := range r.Tables {
+			if !schemas[t.Schema] {
+				schemas[t.Schema] = true
+				statements = append(statements, fmt.Sprintf("GRANT USAGE ON SCHEMA %s TO %s", pq.QuoteIdentifier(t.Schema), pq.QuoteIdentifier(r.RoleName)))
+			}
+			statements = append(statements, fmt.Sprintf("GRANT SELECT ON TABLE %s TO %s", t.quoted(), pq.QuoteIdentifier(r.RoleName)))
+			quotedTables[i] = t.quoted()
+		}
+		statements = append(statements, fmt.Sprintf("CREATE PUBLICATION %s FOR TABLE %s", pq.QuoteIdentifier(r.Name), strings.Join(quotedTables, ", ")))
+		for _, stmt := range statements {
+			if _, err := sourceDB.Exec(stmt); err != nil {
+				return fmt.Errorf("failed to set up publication on %s: %w", r.SourceDB, err)
+			}
+		}
+		if _, err := sourceDB.Exec("SELECT pg_create_logical_replication_slot($1, 'pgoutput')", r.Name); err != nil {
+			return fmt.Errorf("failed to create replication slot %s: %w", r.Name, err)
+		}
+
+		targetDB, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, r.TargetDB))
+		if err != nil {
+			return fmt.Errorf("failed to connect to target database %s: %w", r.TargetDB, err)
+		}
+		defer targetDB.Close()
+		// The subscription is created disabled and handed to the target's write role before its apply worker
+		// starts, so tenant triggers and defaults never run as the superuser creating it. With
+		// run_as_owner = false, changes are applied as the table owner, which is that write role too.
+		createSubscription := fmt.Sprintf("CREATE SUBSCRIPTION %s CONNECTION %s PUBLICATION %s WITH (create_slot = false, slot_name = %s, enabled = false, run_as_owner = false)",
+			pq.QuoteIdentifier(r.Name), pq.QuoteLiteral(subscriptionConnInfo(r, password)), pq.QuoteIdentifier(r.Name), pq.QuoteLiteral(r.Name))
+		for _, stmt := range []string{
+			createSubscription,
+			fmt.Sprintf("ALTER SUBSCRIPTION %s OWNER TO %s", pq.QuoteIdentifier(r.Name), pq.QuoteIdentifier(r.TargetDB+"_write")),
+			fmt.Sprintf("ALTER SUBSCRIPTION %s ENABLE", pq.QuoteIdentifier(r.Name)),
+		} {
+			if _, err := targetDB.Exec(stmt); err != nil {
+				return fmt.Errorf("failed to create subscription on %s: %w", r.TargetDB, err)
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		log.Printf("Failed to create logical replication %s: %v. Attempting cleanup.", r.Name, err)
+		if dropErr := DropLogicalReplication(pgAdminDSN, r); dropErr != nil {
+			log.Printf("CRITICAL: Failed to create logical replication AND failed to clean up: %v. Manual cleanup for %s.", dropErr, r.Name)
+		}
+		return err
+	}
+	log.Printf("Logical replication %s created from %s to %s with %d table(s).", r.Name, r.SourceDB, r.TargetDB, len(r.Tables))
+	return nil
+}
+
+// DropLogicalReplication drops the subscription, slot, publication and replication role of a logical
+// replication. Objects that do not exist are skipped, so it also cleans up partial creations.
+func DropLogicalReplication(pgAdminDSN string, r LogicalReplication) error {
+	log.Printf("Attempting to drop logical replication %s from %s to %s", r.Name, r.SourceDB, r.TargetDB)
+	for _, name := range []string{r.Name, r.SourceDB, r.TargetDB, r.RoleName} {
+		if _, err := sanitizeIdentifier(name); err != nil {
+			return fmt.Errorf("invalid logical replication identifier: %w", err)
+		}
+	}
+
+	targetDB, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, r.TargetDB))
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database %s: %w", r.TargetDB, err)
+	}
+	defer targetDB.Close()
+	var subscriptionExists bool
+	if err := targetDB.QueryRow(`SELECT EXISTS(SELECT 1 FROM pg_subscription
+		WHERE subname = $1 AND subdbid = (SELECT oid FROM pg_database WHERE datname = current_database()))`, r.Name).Scan(&subscriptionExists); err != nil {
+		return fmt.Errorf("failed to look up subscription %s: %w", r.Name, err)
+	}
+	if subscriptionExists {
+		// Detach the slot so DROP SUBSCRIPTION does not connect back to the source; the slot is dropped below.
+		for _, stmt := range []string{
+			fmt.Sprintf("ALTER SUBSCRIPTION %s DISABLE", pq.QuoteIdentifier(r.Name)),
+			fmt.Sprintf("ALTER SUBSCRIPTION %s SET (slot_name = NONE)", pq.QuoteIdentifier(r.Name)),
+			fmt.Sprintf("DROP SUBSCRIPTION %s", pq.QuoteIdentifier(r.Name)),
+		} {
+			if _, err := targetDB.Exec(stmt); err != nil {
+				return fmt.Errorf("failed to drop subscription %s: %w", r.Name, err)
+			}
+		}
+	}
+
+	sourceDB, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, r.SourceDB))
+	if err != nil {
+		return fmt.Errorf("failed to connect to source database %s: %w", r.SourceDB, err)
+	}
+	defer sourceDB.Close()
+	// The apply worker may take a moment to exit after DISABLE and release the slot.
+	for attempt := 1; ; attempt++ {
+		_, err := sourceDB.Exec("SELECT pg_drop_replication_slot(slot_name) FROM pg_replication_slots WHERE slot_name = $1", r.Name)
+		if err == nil {
+			break
+		}
+		if attempt == 5 {
+			return fmt.Errorf("failed to drop replication slot %s: %w", r.Name, err)
+		}
+		time.Sleep(time.Second)
+	}
+	if _, err := sourceDB.Exec(fmt.Sprintf("DROP PUBLICATION IF EXISTS %s", pq.QuoteIdentifier(r.Name))); err != nil {
+		return fmt.Errorf("failed to drop publication %s: %w", r.Name, err)
+	}
+	var roleExists bool
+	if err := sourceDB.QueryRow("SELECT EXISTS(SELECT 1 FROM pg_roles WHERE rolname = $1)", r.RoleName).Scan(&roleExists); err != nil {
+		return fmt.Errorf("failed to look up replication role %s: %w", r.RoleName, err)
+	}
+	if roleExists {
+		if _, err := sourceDB.Exec(fmt.Sprintf("DROP OWNED BY %s", pq.QuoteIdentifier(r.RoleName))); err != nil {
+			log.Printf("Warning: could not drop privileges owned by %s: %v", r.RoleName, err)
+		}
+		if _, err := sourceDB.Exec(fmt.Sprintf("DROP ROLE %s", pq.QuoteIdentifier(r.RoleName))); err != nil {
+			return fmt.Errorf("failed to drop replication role %s: %w", r.RoleName, err)
+		}
+	}
+	log.Printf("Logical replication %s dropped.", r.Name)
+	return nil
+}
+
+// GetSubscriptionStatus returns the status of a logical replication's subscription, or sql.ErrNoRows
+// if the subscription does not exist.
+func GetSubscriptionStatus(pgAdminDSN string, r LogicalReplication) (*SubscriptionStatus, error) {
+	safeTargetDB, err := sanitizeIdentifier(r.TargetDB)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database name '%s': %w", r.TargetDB, err)
+	}
+	targetDB, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, safeTargetDB))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to target database %s: %w", safeTargetDB, err)
+	}
+	defer targetDB.Close()
+
+	status := &SubscriptionStatus{Tables: []SubscriptionTableState{}}
+	var subID int64
+	var pid sql.NullInt64
+	var receivedLSN, latestEndLSN sql.NullString
+	var lastMsg, latestEnd sql.NullTime
+	err = targetDB.QueryRow(`SELECT s.oid, s.subenabled, st.pid, st.received_lsn::text, st.latest_end_lsn::text, st.last_msg_receipt_time, st.latest_end_time
+		FROM pg_subscription s
+		LEFT JOIN pg_stat_subscription st ON st.subid = s.oid AND st.relid IS NULL
+		WHERE s.subname = $1 AND s.subdbid = (SELECT oid FROM pg_database WHERE datname = current_database())`, r.Name).
+		Scan(&subID, &status.Enabled, &pid, &receivedLSN, &latestEndLSN, &lastMsg, &latestEnd)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("failed to query subscription %s: %w", r.Name, err)
+	}
+	if pid.Valid {
+		p := int(pid.Int64)
+		status.WorkerPID = &p
+	}
+	if receivedLSN.Valid {
+		status.ReceivedLSN = &receivedLSN.String
+	}
+	if latestEndLSN.Valid {
+		status.LatestEndLSN = &latestEndLSN.String
+	}
+	if lastMsg.Valid {
+		status.LastMsgReceiptTime = &lastMsg.Time
+	}
+	if latestEnd.Valid {
+		status.LatestEndTime = &latestEnd.Time
+	}
+
+	rows, err := targetDB.Query(`SELECT n.nspname || '.' || c.relname, sr.srsubstate FROM pg_subscription_rel sr
+		JOIN pg_class c ON c.oid = sr.srrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE sr.srsubid = $1 ORDER BY 1`, subID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tables of subscription %s: %w", r.Name, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, state string
+		if err := rows.Scan(&table, &state); err != nil {
+			return nil, fmt.Errorf("failed to scan subscription table: %w", err)
+		}
+		if name, ok := subscriptionTableStates[state]; ok {
+			state = name
+		}
+		status.Tables = append(status.Tables, SubscriptionTableState{Table: table, State: state})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate subscription tables: %w", err)
+	}
+
+	var lag sql.NullInt64
+	err = targetDB.QueryRow(`SELECT active, pg_wal_lsn_diff(pg_current_wal_lsn(), confirmed_flush_lsn)::bigint
+		FROM pg_replication_slots WHERE slot_name = $1`, r.Name).Scan(&status.SlotActive, &lag)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to query replication slot %s: %w", r.Name, err)
+	}
+	if lag.Valid {
+		status.SlotLagBytes = &lag.Int64
+	}
+	return status, nil
+}
@@ -0,0 +1,32 @@
+package dbutils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseReplicationTables(t *testing.T) {
+	tables, err := ParseReplicationTables([]string{"orders", "sales.invoices"})
+	if err != nil {
+		t.Fatalf("ParseReplicationTables() error = %v", err)
+	}
+	want := []ReplicationTable{{"public", "orders"}, {"sales", "invoices"}}
+	if !reflect.DeepEqual(tables, want) {
+		t.Errorf("ParseReplicationTables() = %v, want %v", tables, want)
+	}
+
+	for _, names := range [][]string{nil, {"Orders"}, {"a.b.c"}, {"public.orders", "orders"}, {"x;drop"}} {
+		if _, err := ParseReplicationTables(names); err == nil {
+			t.Errorf("ParseReplicationTables(%q) succeeded, want error", names)
+		}
+	}
+}
+
+func TestSubscriptionConnInfo(t *testing.T) {
+	r := LogicalReplication{SourceDB: "shop", RoleName: "shop__repl_1a2b3c4d", ConnHost: "localhost", ConnPort: 5432}
+	got := subscriptionConnInfo(r, `pa'ss\word`)
+	want := `host='localhost' port=5432 dbname='shop' user='shop__repl_1a2b3c4d' password='pa\'ss\\word'`
+	if got != want {
+		t.Errorf("subscriptionConnInfo() = %q, want %q", got, want)
+	}
+}
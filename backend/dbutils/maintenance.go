@@ -0,0 +1,178 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"pgweb-backend/models"
+
+	pq "github.com/lib/pq"
+)
+
+// MaintenanceOptions selects a maintenance operation and its options.
+type MaintenanceOptions struct {
+	Operation    string // "vacuum", "analyze" or "reindex"
+	Full         bool   // VACUUM FULL
+	Concurrently bool   // REINDEX CONCURRENTLY
+}
+
+// MaintenanceStatement is a maintenance command and what it runs on.
+type MaintenanceStatement struct {
+	Target string // "schema.table", or the database name for the whole database
+	SQL    string
+}
+
+// MaintenanceProgress is the progress of the running maintenance command as reported by pg_stat_progress_*.
+type MaintenanceProgress struct {
+	Relation    string `json:"relation"`
+	Phase       string `json:"phase"`
+	BlocksTotal int64  `json:"blocks_total"`
+	BlocksDone  int64  `json:"blocks_done"`
+}
+
+// Validate checks the operation and that its options apply to it.
+func (o MaintenanceOptions) Validate() error {
+	switch o.Operation {
+	case "vacuum", "analyze", "reindex":
+	default:
+		return fmt.Errorf("operation must be one of vacuum, analyze or reindex")
+	}
+	if o.Full && o.Operation != "vacuum" {
+		return errors.New("full only applies to vacuum")
+	}
+	if o.Concurrently && o.Operation != "reindex" {
+		return errors.New("concurrently only applies to reindex")
+	}
+	return nil
+}
+
+// MaintenanceStatements returns the commands for a maintenance operation: one per table, or a single
+// command for the whole database if no tables are given.
+func MaintenanceStatements(dbName string, o MaintenanceOptions, tables []ReplicationTable) []MaintenanceStatement {
+	command := map[string]string{"vacuum": "VACUUM", "analyze": "ANALYZE", "reindex": "REINDEX"}[o.Operation]
+	switch {
+	case o.Full:
+		command += " (FULL)"
+	case o.Concurrently && len(tables) == 0:
+		command += " DATABASE CONCURRENTLY"
+	case o.Concurrently:
+		command += " TABLE CONCURRENTLY"
+	case o.Operation == "reindex" && len(tables) == 0:
+		command += " DATABASE"
+	case o.Operation == "reindex":
+		command += " TABLE"
+	}
+
+	if len(tables) == 0 {
+		stmt := command
+		if o.Operation == "reindex" {
+			stmt += " " + pq.QuoteIdentifier(dbName)
+		}
+		return []MaintenanceStatement{{Target: dbName, SQL: stmt}}
+	}
+	statements := make([]MaintenanceStatement, 0, len(tables))
+	for _, t := range tables {
+		statements = append(statements, MaintenanceStatement{Target: t.String(), SQL: command + " " + t.quoted()})
+	}
+	return statements
+}
+
+// RunMaintenance runs maintenance commands one after another on a single connection to dbName. report
+// is called with the connection's backend PID before the first command and after each command with the
+// results so far. A failed command does not stop the remaining ones; an error is returned if any failed.
+func RunMaintenance(pgAdminDSN, dbName string, statements []MaintenanceStatement, report func(pid int, results []models.MaintenanceResult)) ([]models.MaintenanceResult, error) {
+	safeDBName, err := sanitizeIdentifier(dbName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database name '%s': %w", dbName, err)
+	}
+	db, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, safeDBName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database %s: %w", safeDBName, err)
+	}
+	defer db.Close()
+
+	// VACUUM and REINDEX CONCURRENTLY cannot run in a transaction, and progress is looked up by PID,
+	// so every command runs outside a transaction on the same connection.
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open connection to database %s: %w", safeDBName, err)
+	}
+	defer conn.Close()
+	var pid int
+	if err := conn.QueryRowContext(ctx, "SELECT pg_backend_pid()").Scan(&pid); err != nil {
+		return nil, fmt.Errorf("failed to get backend PID: %w", err)
+	}
+
+	results := []models.MaintenanceResult{}
+	report(pid, results)
+	failed := 0
+	for _, stmt := range statements {
+		start := time.Now()
+		_, err := conn.ExecContext(ctx, stmt.SQL)
+		result := models.MaintenanceResult{Target: stmt.Target, DurationMS: time.Since(start).Milliseconds()}
+		if err != nil {
+			log.Printf("Maintenance command %q on %s failed: %v", stmt.SQL, safeDBName, err)
+			result.Error = err.Error()
+			failed++
+		}
+		results = append(results, result)
+		report(pid, results)
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d maintenance commands failed", failed, len(statements))
+	}
+	return results, nil
+}
+
+// GetMaintenanceProgress returns the progress of the maintenance command running on backend pid in dbName,
+// or sql.ErrNoRows if it reports none (e.g. between commands).
+func GetMaintenanceProgress(pgAdminDSN, dbName string, o MaintenanceOptions, pid int) (*MaintenanceProgress, error) {
+	safeDBName, err := sanitizeIdentifier(dbName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database name '%s': %w", dbName, err)
+	}
+	query := `SELECT relid::regclass::text, phase, heap_blks_total, heap_blks_scanned FROM pg_stat_progress_vacuum WHERE pid = $1`
+	switch {
+	case o.Full: // VACUUM FULL rewrites the table and reports like CLUSTER
+		query = `SELECT relid::regclass::text, phase, heap_blks_total, heap_blks_scanned FROM pg_stat_progress_cluster WHERE pid = $1`
+	case o.Operation == "analyze":
+		query = `SELECT relid::regclass::text, phase, sample_blks_total, sample_blks_scanned FROM pg_stat_progress_analyze WHERE pid = $1`
+	case o.Operation == "reindex":
+		query = `SELECT relid::regclass::text, phase, blocks_total, blocks_done FROM pg_stat_progress_create_index WHERE pid = $1`
+	}
+
+	db, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, safeDBName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database %s: %w", safeDBName, err)
+	}
+	defer db.Close()
+
+	p := &MaintenanceProgress{}
+	if err := db.QueryRow(query, pid).Scan(&p.Relation, &p.Phase, &p.BlocksTotal, &p.BlocksDone); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("failed to query maintenance progress: %w", err)
+	}
+	return p, nil
+}
+
+// BackendRunning reports whether a server process with the given PID is still running.
+func BackendRunning(pgAdminDSN string, pid int) (bool, error) {
+	db, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer db.Close()
+
+	var running bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM pg_stat_activity WHERE pid = $1)", pid).Scan(&running); err != nil {
+		return false, fmt.Errorf("failed to check backend %d: %w", pid, err)
+	}
+	return running, nil
+}
@@ -0,0 +1,49 @@
+package dbutils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMaintenanceOptionsValidate(t *testing.T) {
+	valid := []MaintenanceOptions{
+		{Operation: "vacuum"}, {Operation: "vacuum", Full: true}, {Operation: "analyze"},
+		{Operation: "reindex"}, {Operation: "reindex", Concurrently: true},
+	}
+	for _, o := range valid {
+		if err := o.Validate(); err != nil {
+			t.Errorf("%+v.Validate() error = %v", o, err)
+		}
+	}
+	invalid := []MaintenanceOptions{
+		{Operation: "cluster"}, {Operation: "analyze", Full: true}, {Operation: "vacuum", Concurrently: true}, {Operation: "reindex", Full: true},
+	}
+	for _, o := range invalid {
+		if err := o.Validate(); err == nil {
+			t.Errorf("%+v.Validate() succeeded, want error", o)
+		}
+	}
+}
+
+func TestMaintenanceStatements(t *testing.T) {
+	tables := []ReplicationTable{{"public", "orders"}, {"sales", "invoices"}}
+	tests := []struct {
+		opts   MaintenanceOptions
+		tables []ReplicationTable
+		want   []MaintenanceStatement
+	}{
+		{MaintenanceOptions{Operation: "vacuum"}, nil, []MaintenanceStatement{{"shop", "VACUUM"}}},
+		{MaintenanceOptions{Operation: "vacuum", Full: true}, tables[:1], []MaintenanceStatement{{"public.orders", `VACUUM (FULL) "public"."orders"`}}},
+		{MaintenanceOptions{Operation: "analyze"}, tables, []MaintenanceStatement{
+			{"public.orders", `ANALYZE "public"."orders"`}, {"sales.invoices", `ANALYZE "sales"."invoices"`},
+		}},
+		{MaintenanceOptions{Operation: "reindex"}, nil, []MaintenanceStatement{{"shop", `REINDEX DATABASE "shop"`}}},
+		{MaintenanceOptions{Operation: "reindex", Concurrently: true}, nil, []MaintenanceStatement{{"shop", `REINDEX DATABASE CONCURRENTLY "shop"`}}},
+		{MaintenanceOptions{Operation: "reindex", Concurrently: true}, tables[1:], []MaintenanceStatement{{"sales.invoices", `REINDEX TABLE CONCURRENTLY "sales"."invoices"`}}},
+	}
+	for _, tt := range tests {
+		if got := MaintenanceStatements("shop", tt.opts, tt.tables); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("MaintenanceStatements(%+v, %v) = %v, want %v", tt.opts, tt.tables, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package dbutils
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	pq "github.com/lib/pq"
+)
+
+// SetPostgresUserValidUntil sets the VALID UNTIL of a PostgreSQL user's password.
+// A nil validUntil removes the expiry.
+func SetPostgresUserValidUntil(pgAdminDSN, targetDbName, pgUserName string, validUntil *time.Time) error {
+	safePgUserName, err := sanitizeIdentifier(pgUserName)
+	if err != nil {
+		return fmt.Errorf("invalid PostgreSQL username '%s': %w", pgUserName, err)
+	}
+
+	db, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, targetDbName))
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database %s to set password expiry: %w", targetDbName, err)
+	}
+	defer db.Close()
+
+	expiry := "infinity"
+	if validUntil != nil {
+		expiry = validUntil.UTC().Format(time.RFC3339)
+	}
+	alterSQL := fmt.Sprintf("ALTER ROLE %s VALID UNTIL %s", pq.QuoteIdentifier(safePgUserName), pq.QuoteLiteral(expiry))
+	if _, err := db.Exec(alterSQL); err != nil {
+		return fmt.Errorf("failed to set password expiry for user %s: %w", safePgUserName, err)
+	}
+	log.Printf("Password expiry for user %s set to %s.", safePgUserName, expiry)
+	return nil
+}
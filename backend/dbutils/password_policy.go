@@ -0,0 +1,169 @@
+package dbutils
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// PasswordPolicy describes the requirements for caller-supplied PostgreSQL passwords.
+type PasswordPolicy struct {
+	MinLength      int
+	MaxLength      int
+	MinCharClasses int             // Of lowercase, uppercase, digits and symbols
+	DenyList       map[string]bool // Lowercased passwords that are always rejected
+}
+
+// defaultPasswordDenyList holds common passwords rejected even without a deny-list file.
+var defaultPasswordDenyList = []string{
+	"password", "password1", "password123", "passw0rd", "p@ssw0rd", "123456789012", "qwertyuiop",
+	"qwerty123456", "letmein12345", "welcome12345", "changeme1234", "administrator", "postgres1234",
+}
+
+// LoadPasswordPolicy reads the password policy from the environment:
+// PGWEB_PASSWORD_MIN_LENGTH (default 12), PGWEB_PASSWORD_MAX_LENGTH (default 128),
+// PGWEB_PASSWORD_MIN_CHAR_CLASSES (default 3) and PGWEB_PASSWORD_DENYLIST_FILE
+// (optional file with one denied password per line).
+func LoadPasswordPolicy() PasswordPolicy {
+	readInt := func(envVar string, def, min, max int) int {
+		if v := os.Getenv(envVar); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n >= min && n <= max {
+				return n
+			}
+			log.Printf("Warning: ignoring invalid value for %s: %q", envVar, v)
+		}
+		return def
+	}
+	policy := PasswordPolicy{
+		MinLength:      readInt("PGWEB_PASSWORD_MIN_LENGTH", 12, 1, 1024),
+		MaxLength:      readInt("PGWEB_PASSWORD_MAX_LENGTH", 128, 1, 1024),
+		MinCharClasses: readInt("PGWEB_PASSWORD_MIN_CHAR_CLASSES", 3, 0, 4),
+		DenyList:       make(map[string]bool),
+	}
+	if policy.MaxLength < policy.MinLength {
+		policy.MaxLength = policy.MinLength
+	}
+	for _, p := range defaultPasswordDenyList {
+		policy.DenyList[p] = true
+	}
+	if path := os.Getenv("PGWEB_PASSWORD_DENYLIST_FILE"); path != "" {
+		if err := loadPasswordDenyList(path, policy.DenyList); err != nil {
+			log.Printf("Warning: failed to load password deny-list %s: %v", path, err)
+		}
+	}
+	return policy
+}
+
+func loadPasswordDenyList(path string, denyList map[string]bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			denyList[strings.ToLower(line)] = true
+		}
+	}
+	return scanner.Err()
+}
+
+// isPrehashedPassword reports whether PostgreSQL would store password as a hash rather than hash it:
+// "md5" followed by 32 hex digits, or a SCRAM-SHA-256 verifier.
+func isPrehashedPassword(password string) bool {
+	if hexPart, ok := strings.CutPrefix(strings.ToLower(password), "md5"); ok && len(hexPart) == 32 {
+		if strings.Trim(hexPart, "0123456789abcdef") == "" {
+			return true
+		}
+	}
+	return strings.HasPrefix(strings.ToUpper(password), "SCRAM-SHA-256$")
+}
+
+// Validate checks a caller-supplied password for pgUserName against the policy.
+func (p PasswordPolicy) Validate(password, pgUserName string) error {
+	// A hash would be stored as given, bypassing the checks below and the SCRAM-only storage.
+	if isPrehashedPassword(password) {
+		return fmt.Errorf("password must not be an MD5 hash or SCRAM verifier")
+	}
+	length := len([]rune(password))
+	if length < p.MinLength || length > p.MaxLength {
+		return fmt.Errorf("password must be between %d and %d characters", p.MinLength, p.MaxLength)
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case !unicode.IsPrint(r) || unicode.IsSpace(r):
+			return fmt.Errorf("password must not contain whitespace or control characters")
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+	if classes < p.MinCharClasses {
+		return fmt.Errorf("password must contain at least %d of: lowercase letters, uppercase letters, digits, symbols", p.MinCharClasses)
+	}
+
+	lowered := strings.ToLower(password)
+	if p.DenyList[lowered] {
+		return fmt.Errorf("password is too common")
+	}
+	if pgUserName != "" && strings.Contains(lowered, strings.ToLower(pgUserName)) {
+		return fmt.Errorf("password must not contain the username")
+	}
+	return nil
+}
+
+// generatePolicyPassword returns a random password that passes the password policy. Its length is the
+// default length, raised to the policy minimum and capped at the policy maximum. Random passwords can
+// miss a character class, so they are regenerated until one passes.
+func generatePolicyPassword() (string, error) {
+	policy := LoadPasswordPolicy()
+	length := max(passwordLength, policy.MinLength)
+	length = min(length, policy.MaxLength)
+	for attempt := 0; attempt < 100; attempt++ {
+		password, err := generateStrongPassword(length)
+		if err != nil {
+			return "", err
+		}
+		if policy.Validate(password, "") == nil {
+			return password, nil
+		}
+	}
+	return "", fmt.Errorf("failed to generate a password that satisfies the password policy")
+}
+
+// execPasswordStatement runs a CREATE USER or ALTER USER statement carrying a password with
+// password_encryption forced to scram-sha-256, so an MD5 hash is never stored regardless of
+// the server default. SET LOCAL requires the statement to run in the same transaction.
+func execPasswordStatement(db *sql.DB, stmt string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("SET LOCAL password_encryption = 'scram-sha-256'"); err != nil {
+		return fmt.Errorf("failed to enforce scram-sha-256 password encryption: %w", err)
+	}
+	if _, err := tx.Exec(stmt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,49 @@
+package dbutils
+
+import "testing"
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 12, MaxLength: 64, MinCharClasses: 3, DenyList: map[string]bool{"password1234!": true}}
+
+	tests := []struct {
+		name      string
+		password  string
+		expectErr bool
+	}{
+		{"valid", "Correct-Horse-42", false},
+		{"too short", "Ab1!", true},
+		{"too long", "Aa1!aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", true},
+		{"too few classes", "alllowercase12", true},
+		{"denied case-insensitive", "PASSWORD1234!", true},
+		{"contains username", "xApp_User_99!", true},
+		{"whitespace", "Correct Horse 42", true},
+		{"md5 hash", "md5" + "0123456789abcdef0123456789abcdef", true},
+		{"md5 hash upper case", "MD5" + "0123456789ABCDEF0123456789ABCDEF", true},
+		{"md5 prefix only", "md5-Correct-Horse-42", false},
+		{"scram verifier", "SCRAM-SHA-256$4096:c2FsdHNhbHQ=$c3RvcmVka2V5c3RvcmVka2V5=:c2VydmVya2V5c2VydmVya2V5=", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(tt.password, "app_user")
+			if (err != nil) != tt.expectErr {
+				t.Errorf("Validate(%q) error = %v, expectErr %v", tt.password, err, tt.expectErr)
+			}
+		})
+	}
+}
+
+func TestGeneratePasswordSatisfiesPolicy(t *testing.T) {
+	t.Setenv("PGWEB_PASSWORD_MIN_LENGTH", "20")
+	t.Setenv("PGWEB_PASSWORD_MIN_CHAR_CLASSES", "4")
+	policy := LoadPasswordPolicy()
+	for i := 0; i < 50; i++ {
+		password, err := GeneratePassword()
+		if err != nil {
+			t.Fatalf("GeneratePassword() error = %v", err)
+		}
+		if err := policy.Validate(password, ""); err != nil {
+			t.Fatalf("GeneratePassword() = %q, which fails the policy: %v", password, err)
+		}
+	}
+}
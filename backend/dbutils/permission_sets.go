@@ -0,0 +1,293 @@
+package dbutils
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"pgweb-backend/models"
+
+	pq "github.com/lib/pq"
+)
+
+var (
+	// Privileges accepted for each grant object type. Schema grants accept the
+	// schema privileges themselves plus table privileges, which are applied to
+	// every existing table in the schema and to tables the write role creates later.
+	schemaPrivileges = map[string]bool{"USAGE": true, "CREATE": true}
+	tablePrivileges  = map[string]bool{"SELECT": true, "INSERT": true, "UPDATE": true, "DELETE": true, "TRUNCATE": true, "REFERENCES": true, "TRIGGER": true}
+	columnPrivileges = map[string]bool{"SELECT": true, "INSERT": true, "UPDATE": true, "REFERENCES": true}
+)
+
+// Permission set names become part of a cluster-wide role name (<db>_ps_<name>), so keep them short.
+var permissionSetNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,30}$`)
+
+// ValidPermissionSetName reports whether name is an acceptable permission set name: 2-31 lowercase
+// alphanumerics and underscores starting with a letter, without "__" (the login role separator), and
+// not "read" or "write".
+func ValidPermissionSetName(name string) bool {
+	return permissionSetNamePattern.MatchString(name) && !strings.Contains(name, roleNamespaceSeparator) && name != "read" && name != "write"
+}
+
+// PermissionSetRoleName returns the NOLOGIN role name backing a permission set.
+func PermissionSetRoleName(dbName, setName string) string {
+	return fmt.Sprintf("%s_ps_%s", dbName, setName)
+}
+
+// ValidatePermissionGrants checks that every grant is well-formed and only uses
+// privileges that make sense for its object type. Privileges are normalized to upper case.
+func ValidatePermissionGrants(grants []models.PermissionGrant) error {
+	if len(grants) == 0 {
+		return fmt.Errorf("at least one grant is required")
+	}
+	for i := range grants {
+		g := &grants[i]
+		if _, err := sanitizeIdentifier(g.Schema); err != nil {
+			return fmt.Errorf("grant %d: invalid schema: %w", i, err)
+		}
+		if len(g.Privileges) == 0 {
+			return fmt.Errorf("grant %d: at least one privilege is required", i)
+		}
+		for j, p := range g.Privileges {
+			g.Privileges[j] = strings.ToUpper(strings.TrimSpace(p))
+		}
+
+		var allowed map[string]bool
+		switch g.ObjectType {
+		case "schema":
+			if g.Table != "" || len(g.Columns) > 0 {
+				return fmt.Errorf("grant %d: schema grants must not specify a table or columns", i)
+			}
+		case "table":
+			if _, err := sanitizeIdentifier(g.Table); err != nil {
+				return fmt.Errorf("grant %d: invalid table: %w", i, err)
+			}
+			if len(g.Columns) > 0 {
+				return fmt.Errorf("grant %d: table grants must not specify columns", i)
+			}
+			allowed = tablePrivileges
+		case "column":
+			if _, err := sanitizeIdentifier(g.Table); err != nil {
+				return fmt.Errorf("grant %d: invalid table: %w", i, err)
+			}
+			if len(g.Columns) == 0 {
+				return fmt.Errorf("grant %d: column grants require at least one column", i)
+			}
+			for _, col := range g.Columns {
+				if _, err := sanitizeIdentifier(col); err != nil {
+					return fmt.Errorf("grant %d: invalid column: %w", i, err)
+				}
+			}
+			allowed = columnPrivileges
+		default:
+			return fmt.Errorf("grant %d: object_type must be one of schema, table, column", i)
+		}
+
+		for _, p := range g.Privileges {
+			if g.ObjectType == "schema" {
+				if !schemaPrivileges[p] && !tablePrivileges[p] {
+					return fmt.Errorf("grant %d: privilege %s is not allowed on a schema", i, p)
+				}
+				continue
+			}
+			if !allowed[p] {
+				return fmt.Errorf("grant %d: privilege %s is not allowed on a %s", i, p, g.ObjectType)
+			}
+		}
+	}
+	return nil
+}
+
+// CreatePermissionSetRole creates a NOLOGIN role for a permission set and applies its grants.
+// The role is created next to the _read/_write roles of the database. On failure the role is dropped.
+func CreatePermissionSetRole(pgAdminDSN, dbName, roleName string, grants []models.PermissionGrant) error {
+	log.Printf("Attempting to create permission set role %s for database %s", roleName, dbName)
+	safeDBName, err := sanitizeIdentifier(dbName)
+	if err != nil {
+		return fmt.Errorf("invalid database name '%s': %w", dbName, err)
+	}
+	safeRoleName, err := sanitizeIdentifier(roleName)
+	if err != nil {
+		return fmt.Errorf("invalid permission set role name '%s': %w", roleName, err)
+	}
+	if err := ValidatePermissionGrants(grants); err != nil {
+		return err
+	}
+
+	db, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, safeDBName))
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database %s for permission set creation: %w", safeDBName, err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(fmt.Sprintf("CREATE ROLE %s NOLOGIN", pq.QuoteIdentifier(safeRoleName))); err != nil {
+		return fmt.Errorf("failed to create permission set role %s: %w", safeRoleName, err)
+	}
+
+	_, err = db.Exec(fmt.Sprintf("GRANT CONNECT ON DATABASE %s TO %s", pq.QuoteIdentifier(safeDBName), pq.QuoteIdentifier(safeRoleName)))
+	if err == nil {
+		err = applyPermissionGrants(db, safeDBName, safeRoleName, grants)
+	}
+	if err != nil {
+		log.Printf("Failed to apply grant for permission set role %s: %v. Attempting to drop role.", safeRoleName, err)
+		if dropErr := dropPermissionSetRole(db, safeRoleName); dropErr != nil {
+			log.Printf("CRITICAL: Failed to apply grant AND failed to drop role: %v. Manual cleanup for role %s.", dropErr, safeRoleName)
+		}
+		return fmt.Errorf("failed to apply grant for permission set role %s: %w", safeRoleName, err)
+	}
+
+	log.Printf("Permission set role %s created for database %s with %d grant(s).", safeRoleName, safeDBName, len(grants))
+	return nil
+}
+
+// applyPermissionGrants applies the grants of a permission set role in the connected database.
+// ALTER DEFAULT PRIVILEGES FOR ROLE requires membership in the write role.
+func applyPermissionGrants(db *sql.DB, dbName, roleName string, grants []models.PermissionGrant) error {
+	statements := permissionGrantStatements(dbName+"_write", roleName, grants)
+	return withRoleMembership(db, dbName+"_write", func() error {
+		for _, stmt := range statements {
+			if _, err := db.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// permissionGrantStatements renders the GRANT and ALTER DEFAULT PRIVILEGES statements for a set of
+// validated grants. writeRole is the role that owns objects created by write users.
+func permissionGrantStatements(writeRole, roleName string, grants []models.PermissionGrant) []string {
+	role := pq.QuoteIdentifier(roleName)
+	var statements []string
+	for _, g := range grants {
+		schema := pq.QuoteIdentifier(g.Schema)
+		switch g.ObjectType {
+		case "schema":
+			var schemaPrivs, tablePrivs []string
+			for _, p := range g.Privileges {
+				if schemaPrivileges[p] {
+					schemaPrivs = append(schemaPrivs, p)
+				} else {
+					tablePrivs = append(tablePrivs, p)
+				}
+			}
+			if len(schemaPrivs) == 0 {
+				schemaPrivs = []string{"USAGE"}
+			}
+			statements = append(statements, fmt.Sprintf("GRANT %s ON SCHEMA %s TO %s", strings.Join(schemaPrivs, ", "), schema, role))
+			if len(tablePrivs) > 0 {
+				privs := strings.Join(tablePrivs, ", ")
+				statements = append(statements,
+					fmt.Sprintf("GRANT %s ON ALL TABLES IN SCHEMA %s TO %s", privs, schema, role),
+					fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA %s GRANT %s ON TABLES TO %s", pq.QuoteIdentifier(writeRole), schema, privs, role),
+				)
+			}
+		case "table":
+			statements = append(statements,
+				fmt.Sprintf("GRANT USAGE ON SCHEMA %s TO %s", schema, role),
+				fmt.Sprintf("GRANT %s ON TABLE %s.%s TO %s", strings.Join(g.Privileges, ", "), schema, pq.QuoteIdentifier(g.Table), role),
+			)
+		case "column":
+			cols := make([]string, len(g.Columns))
+			for i, col := range g.Columns {
+				cols[i] = pq.QuoteIdentifier(col)
+			}
+			colList := strings.Join(cols, ", ")
+			privs := make([]string, len(g.Privileges))
+			for i, p := range g.Privileges {
+				privs[i] = fmt.Sprintf("%s (%s)", p, colList)
+			}
+			statements = append(statements,
+				fmt.Sprintf("GRANT USAGE ON SCHEMA %s TO %s", schema, role),
+				fmt.Sprintf("GRANT %s ON TABLE %s.%s TO %s", strings.Join(privs, ", "), schema, pq.QuoteIdentifier(g.Table), role),
+			)
+		}
+	}
+	return statements
+}
+
+// withRoleMembership temporarily grants role to the admin user for the duration of fn,
+// mirroring how CreatePostgresDatabase sets default privileges for the write role.
+func withRoleMembership(db *sql.DB, role string, fn func() error) error {
+	var currentUser string
+	if err := db.QueryRow("SELECT current_user").Scan(&currentUser); err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+	if _, err := db.Exec(fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(role), pq.QuoteIdentifier(currentUser))); err != nil {
+		return fmt.Errorf("failed to grant role %s to admin user '%s': %w", role, currentUser, err)
+	}
+	defer func() {
+		if _, err := db.Exec(fmt.Sprintf("REVOKE %s FROM %s", pq.QuoteIdentifier(role), pq.QuoteIdentifier(currentUser))); err != nil {
+			log.Printf("Warning: failed to revoke role %s from admin user '%s': %v", role, currentUser, err)
+		}
+	}()
+	return fn()
+}
+
+// DeletePermissionSetRole drops a permission set role and all privileges granted to it.
+func DeletePermissionSetRole(pgAdminDSN, dbName, roleName string) error {
+	log.Printf("Attempting to delete permission set role %s from database %s", roleName, dbName)
+	safeDBName, err := sanitizeIdentifier(dbName)
+	if err != nil {
+		return fmt.Errorf("invalid database name '%s': %w", dbName, err)
+	}
+	safeRoleName, err := sanitizeIdentifier(roleName)
+	if err != nil {
+		return fmt.Errorf("invalid permission set role name '%s': %w", roleName, err)
+	}
+
+	db, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, safeDBName))
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database %s for permission set deletion: %w", safeDBName, err)
+	}
+	defer db.Close()
+
+	if err := dropPermissionSetRole(db, safeRoleName); err != nil {
+		return err
+	}
+	log.Printf("Permission set role %s deleted from database %s.", safeRoleName, safeDBName)
+	return nil
+}
+
+// dropPermissionSetRole removes privileges and default privileges held by the role in the
+// connected database before dropping it.
+func dropPermissionSetRole(db *sql.DB, roleName string) error {
+	if _, err := db.Exec(fmt.Sprintf("DROP OWNED BY %s", pq.QuoteIdentifier(roleName))); err != nil {
+		log.Printf("Warning: could not drop privileges owned by %s: %v", roleName, err)
+	}
+	if _, err := db.Exec(fmt.Sprintf("DROP ROLE IF EXISTS %s", pq.QuoteIdentifier(roleName))); err != nil {
+		return fmt.Errorf("failed to drop permission set role %s: %w", roleName, err)
+	}
+	return nil
+}
+
+// GrantPermissionSetToUser grants a permission set role to a PostgreSQL login role.
+func GrantPermissionSetToUser(pgAdminDSN, dbName, roleName, pgUserName string) error {
+	return GrantRoleToUser(pgAdminDSN, dbName, roleName, pgUserName)
+}
+
+// RevokePermissionSetFromUser revokes a permission set role from a PostgreSQL login role.
+func RevokePermissionSetFromUser(pgAdminDSN, dbName, roleName, pgUserName string) error {
+	safeRoleName, err := sanitizeIdentifier(roleName)
+	if err != nil {
+		return fmt.Errorf("invalid permission set role name '%s': %w", roleName, err)
+	}
+	safePgUserName, err := sanitizeIdentifier(pgUserName)
+	if err != nil {
+		return fmt.Errorf("invalid PostgreSQL username '%s': %w", pgUserName, err)
+	}
+
+	db, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, dbName))
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database %s to revoke permission set: %w", dbName, err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(fmt.Sprintf("REVOKE %s FROM %s", pq.QuoteIdentifier(safeRoleName), pq.QuoteIdentifier(safePgUserName))); err != nil {
+		return fmt.Errorf("failed to revoke permission set role %s from user %s: %w", safeRoleName, safePgUserName, err)
+	}
+	log.Printf("Permission set role %s revoked from user %s.", safeRoleName, safePgUserName)
+	return nil
+}
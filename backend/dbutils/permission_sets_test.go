@@ -0,0 +1,56 @@
+package dbutils
+
+import (
+	"reflect"
+	"testing"
+
+	"pgweb-backend/models"
+)
+
+func TestValidatePermissionGrants(t *testing.T) {
+	tests := []struct {
+		name    string
+		grants  []models.PermissionGrant
+		wantErr bool
+	}{
+		{"no grants", nil, true},
+		{"schema usage", []models.PermissionGrant{{ObjectType: "schema", Schema: "sales", Privileges: []string{"USAGE"}}}, false},
+		{"schema with table privileges", []models.PermissionGrant{{ObjectType: "schema", Schema: "sales", Privileges: []string{"select", " insert "}}}, false},
+		{"schema with table", []models.PermissionGrant{{ObjectType: "schema", Schema: "sales", Table: "orders", Privileges: []string{"SELECT"}}}, true},
+		{"schema with unknown privilege", []models.PermissionGrant{{ObjectType: "schema", Schema: "sales", Privileges: []string{"ALL"}}}, true},
+		{"table", []models.PermissionGrant{{ObjectType: "table", Schema: "sales", Table: "orders", Privileges: []string{"SELECT", "UPDATE"}}}, false},
+		{"table without name", []models.PermissionGrant{{ObjectType: "table", Schema: "sales", Privileges: []string{"SELECT"}}}, true},
+		{"table with columns", []models.PermissionGrant{{ObjectType: "table", Schema: "sales", Table: "orders", Columns: []string{"id"}, Privileges: []string{"SELECT"}}}, true},
+		{"table with schema privilege", []models.PermissionGrant{{ObjectType: "table", Schema: "sales", Table: "orders", Privileges: []string{"USAGE"}}}, true},
+		{"column", []models.PermissionGrant{{ObjectType: "column", Schema: "sales", Table: "orders", Columns: []string{"id", "total"}, Privileges: []string{"SELECT"}}}, false},
+		{"column without columns", []models.PermissionGrant{{ObjectType: "column", Schema: "sales", Table: "orders", Privileges: []string{"SELECT"}}}, true},
+		{"column with delete", []models.PermissionGrant{{ObjectType: "column", Schema: "sales", Table: "orders", Columns: []string{"id"}, Privileges: []string{"DELETE"}}}, true},
+		{"invalid column", []models.PermissionGrant{{ObjectType: "column", Schema: "sales", Table: "orders", Columns: []string{"id; drop"}, Privileges: []string{"SELECT"}}}, true},
+		{"invalid schema", []models.PermissionGrant{{ObjectType: "schema", Schema: "Sales", Privileges: []string{"USAGE"}}}, true},
+		{"no privileges", []models.PermissionGrant{{ObjectType: "schema", Schema: "sales"}}, true},
+		{"unknown object type", []models.PermissionGrant{{ObjectType: "sequence", Schema: "sales", Privileges: []string{"USAGE"}}}, true},
+		{"second grant invalid", []models.PermissionGrant{
+			{ObjectType: "schema", Schema: "sales", Privileges: []string{"USAGE"}},
+			{ObjectType: "table", Schema: "sales", Table: "orders", Privileges: []string{"CREATE"}},
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePermissionGrants(tt.grants)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePermissionGrants() error = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidatePermissionGrantsNormalizesPrivileges(t *testing.T) {
+	grants := []models.PermissionGrant{{ObjectType: "table", Schema: "sales", Table: "orders", Privileges: []string{" select", "Update "}}}
+	if err := ValidatePermissionGrants(grants); err != nil {
+		t.Fatalf("ValidatePermissionGrants() error = %v", err)
+	}
+	if want := []string{"SELECT", "UPDATE"}; !reflect.DeepEqual(grants[0].Privileges, want) {
+		t.Errorf("privileges = %q, want %q", grants[0].Privileges, want)
+	}
+}
@@ -0,0 +1,195 @@
+package dbutils
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// HBAUserRules are the network access rules of a login role on its database.
+type HBAUserRules struct {
+	Database     string
+	Role         string
+	AllowedCIDRs []string // Empty allows every address
+	RequireSSL   bool
+	CertAuth     bool // The role holds active client certificates
+}
+
+const (
+	hbaSectionBegin = "# BEGIN pgweb managed section. Generated by pgweb; changes are overwritten."
+	hbaSectionEnd   = "# END pgweb managed section"
+)
+
+// ErrInvalidHBA is returned when PostgreSQL rejects the written pg_hba.conf.
+var ErrInvalidHBA = errors.New("pg_hba.conf rejected by PostgreSQL")
+
+// NormalizeCIDRs validates addresses and networks for pg_hba.conf and returns them in canonical
+// network form. A bare IP address is treated as a single-host network.
+func NormalizeCIDRs(cidrs []string) ([]string, error) {
+	seen := make(map[string]bool)
+	normalized := make([]string, 0, len(cidrs))
+	for _, raw := range cidrs {
+		value := strings.TrimSpace(raw)
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address '%s'", raw)
+			}
+			if ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR '%s'", raw)
+		}
+		if cidr := network.String(); !seen[cidr] {
+			seen[cidr] = true
+			normalized = append(normalized, cidr)
+		}
+	}
+	return normalized, nil
+}
+
+// hbaQuote double-quotes a database or role name in pg_hba.conf, so names such as "all", "replication",
+// "sameuser" or "samerole" are matched literally instead of as keywords. Managed names are sanitized
+// identifiers and never contain double quotes.
+func hbaQuote(name string) string {
+	return `"` + name + `"`
+}
+
+// HBAUserLines returns the pg_hba.conf lines enforcing a role's rules: a scram-sha-256 line per allowed
+// network, followed by a line rejecting TCP connections of the role from anywhere else. A role with
+// client certificates gets a hostssl cert line per allowed network first, so SSL connections from
+// those networks authenticate with the certificate.
+func HBAUserLines(r HBAUserRules) []string {
+	connType := "host"
+	if r.RequireSSL {
+		connType = "hostssl"
+	}
+	cidrs := r.AllowedCIDRs
+	if len(cidrs) == 0 {
+		cidrs = []string{"all"}
+	}
+	database, role := hbaQuote(r.Database), hbaQuote(r.Role)
+	lines := make([]string, 0, 2*len(cidrs)+1)
+	if r.CertAuth {
+		for _, cidr := range cidrs {
+			lines = append(lines, fmt.Sprintf("hostssl %s %s %s cert", database, role, cidr))
+		}
+	}
+	for _, cidr := range cidrs {
+		lines = append(lines, fmt.Sprintf("%s %s %s %s scram-sha-256", connType, database, role, cidr))
+	}
+	return append(lines, fmt.Sprintf("host all %s all reject", role))
+}
+
+// RenderManagedHBASection renders the managed section of pg_hba.conf with the rules of each role, sorted by role.
+func RenderManagedHBASection(rules []HBAUserRules) string {
+	sorted := append([]HBAUserRules{}, rules...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Role < sorted[j].Role })
+
+	var b strings.Builder
+	b.WriteString(hbaSectionBegin + "\n")
+	for _, r := range sorted {
+		for _, line := range HBAUserLines(r) {
+			b.WriteString(line + "\n")
+		}
+	}
+	b.WriteString(hbaSectionEnd + "\n")
+	return b.String()
+}
+
+// ReplaceManagedHBASection replaces the managed section of a pg_hba.conf. Without one, the section is
+// inserted at the top so its rules take precedence over the operator's.
+func ReplaceManagedHBASection(content, section string) string {
+	begin := strings.Index(content, hbaSectionBegin)
+	if begin < 0 {
+		return section + content
+	}
+	end := strings.Index(content[begin:], hbaSectionEnd)
+	if end < 0 {
+		return section + content
+	}
+	end += begin + len(hbaSectionEnd)
+	if end < len(content) && content[end] == '\n' {
+		end++
+	}
+	return content[:begin] + section + content[end:]
+}
+
+// hbaFileErrors returns the errors PostgreSQL reports for the pg_hba.conf currently on disk.
+func hbaFileErrors(pgAdminDSN string) ([]string, error) {
+	db, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT line_number, error FROM pg_hba_file_rules WHERE error IS NOT NULL ORDER BY line_number")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pg_hba_file_rules: %w", err)
+	}
+	defer rows.Close()
+	var errs []string
+	for rows.Next() {
+		var line *int
+		var msg string
+		if err := rows.Scan(&line, &msg); err != nil {
+			return nil, fmt.Errorf("failed to scan pg_hba_file_rules: %w", err)
+		}
+		if line != nil {
+			msg = fmt.Sprintf("line %d: %s", *line, msg)
+		}
+		errs = append(errs, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate pg_hba_file_rules: %w", err)
+	}
+	return errs, nil
+}
+
+// ApplyManagedHBASection writes section into the pg_hba.conf at path, checks the file with
+// pg_hba_file_rules and reloads the server configuration. If PostgreSQL reports errors, the previous
+// file is restored and an error wrapping ErrInvalidHBA is returned. It returns false if nothing changed.
+func ApplyManagedHBASection(pgAdminDSN, path, section string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	previous, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	changed, err := WriteFileAtomically(path, ReplaceManagedHBASection(string(previous), section), info.Mode().Perm())
+	if err != nil || !changed {
+		return false, err
+	}
+
+	errs, err := hbaFileErrors(pgAdminDSN)
+	if err == nil && len(errs) > 0 {
+		err = fmt.Errorf("%w: %s", ErrInvalidHBA, strings.Join(errs, "; "))
+	}
+	if err != nil {
+		if _, restoreErr := WriteFileAtomically(path, string(previous), info.Mode().Perm()); restoreErr != nil {
+			log.Printf("CRITICAL: failed to restore %s after a rejected update: %v", path, restoreErr)
+		}
+		return false, err
+	}
+
+	db, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("SELECT pg_reload_conf()"); err != nil {
+		return false, fmt.Errorf("failed to reload server configuration: %w", err)
+	}
+	return true, nil
+}
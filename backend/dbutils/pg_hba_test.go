@@ -0,0 +1,82 @@
+package dbutils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeCIDRs(t *testing.T) {
+	got, err := NormalizeCIDRs([]string{"10.1.2.3/8", " 192.168.0.7 ", "2001:db8::1", "10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("NormalizeCIDRs() error = %v", err)
+	}
+	want := []string{"10.0.0.0/8", "192.168.0.7/32", "2001:db8::1/128"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NormalizeCIDRs() = %v, want %v", got, want)
+	}
+
+	for _, cidr := range []string{"", "all", "10.0.0.0/33", "host.example.com", "10.0.0.0/8 trust"} {
+		if _, err := NormalizeCIDRs([]string{cidr}); err == nil {
+			t.Errorf("NormalizeCIDRs(%q) succeeded, want error", cidr)
+		}
+	}
+}
+
+func TestHBAUserLines(t *testing.T) {
+	got := HBAUserLines(HBAUserRules{Database: "shop", Role: "shop__app", AllowedCIDRs: []string{"10.0.0.0/8", "192.168.0.7/32"}})
+	want := []string{
+		`host "shop" "shop__app" 10.0.0.0/8 scram-sha-256`,
+		`host "shop" "shop__app" 192.168.0.7/32 scram-sha-256`,
+		`host all "shop__app" all reject`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("HBAUserLines() = %q, want %q", got, want)
+	}
+
+	got = HBAUserLines(HBAUserRules{Database: "shop", Role: "shop__app", RequireSSL: true})
+	want = []string{`hostssl "shop" "shop__app" all scram-sha-256`, `host all "shop__app" all reject`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("HBAUserLines() with SSL only = %q, want %q", got, want)
+	}
+
+	got = HBAUserLines(HBAUserRules{Database: "shop", Role: "shop__app", AllowedCIDRs: []string{"10.0.0.0/8", "192.168.0.7/32"}, CertAuth: true})
+	want = []string{
+		`hostssl "shop" "shop__app" 10.0.0.0/8 cert`,
+		`hostssl "shop" "shop__app" 192.168.0.7/32 cert`,
+		`host "shop" "shop__app" 10.0.0.0/8 scram-sha-256`,
+		`host "shop" "shop__app" 192.168.0.7/32 scram-sha-256`,
+		`host all "shop__app" all reject`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("HBAUserLines() with certificates = %q, want %q", got, want)
+	}
+
+	got = HBAUserLines(HBAUserRules{Database: "replication", Role: "all", AllowedCIDRs: []string{"10.0.0.0/8"}})
+	want = []string{`host "replication" "all" 10.0.0.0/8 scram-sha-256`, `host all "all" all reject`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("HBAUserLines() with keyword names = %q, want %q", got, want)
+	}
+}
+
+func TestReplaceManagedHBASection(t *testing.T) {
+	operator := "local all all peer\nhost all all 0.0.0.0/0 scram-sha-256\n"
+	section := RenderManagedHBASection([]HBAUserRules{
+		{Database: "shop", Role: "shop__web", RequireSSL: true},
+		{Database: "shop", Role: "shop__app", AllowedCIDRs: []string{"10.0.0.0/8"}},
+	})
+	if !strings.Contains(section, `"shop__app" 10.0.0.0/8`) || strings.Index(section, "shop__app") > strings.Index(section, "shop__web") {
+		t.Errorf("RenderManagedHBASection() = %q, want roles sorted", section)
+	}
+
+	inserted := ReplaceManagedHBASection(operator, section)
+	if inserted != section+operator {
+		t.Errorf("ReplaceManagedHBASection() without section = %q, want section prepended", inserted)
+	}
+
+	empty := RenderManagedHBASection(nil)
+	replaced := ReplaceManagedHBASection("# header\n"+inserted, empty)
+	if replaced != "# header\n"+empty+operator {
+		t.Errorf("ReplaceManagedHBASection() = %q, want section replaced in place", replaced)
+	}
+}
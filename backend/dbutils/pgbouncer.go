@@ -0,0 +1,151 @@
+package dbutils
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	pq "github.com/lib/pq"
+)
+
+// PgBouncerDatabase is an entry of the PgBouncer [databases] section.
+// A nil PoolSize or empty PoolMode leaves PgBouncer's default in place.
+type PgBouncerDatabase struct {
+	Name     string
+	Host     string
+	Port     int
+	PoolSize *int
+	PoolMode string
+}
+
+// pgBouncerHeader marks generated files so they are not edited by hand.
+const pgBouncerHeader = "; Generated by pgweb. Changes are overwritten.\n"
+
+// quotePgBouncerValue quotes a connection string value if it contains characters PgBouncer would split on.
+func quotePgBouncerValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " '\\\t=") {
+		return value
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// RenderPgBouncerDatabases renders a [databases] section, meant to be %include'd by pgbouncer.ini,
+// with one entry per database sorted by name.
+func RenderPgBouncerDatabases(databases []PgBouncerDatabase) string {
+	sorted := append([]PgBouncerDatabase{}, databases...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	var b strings.Builder
+	b.WriteString(pgBouncerHeader)
+	b.WriteString("[databases]\n")
+	for _, d := range sorted {
+		fmt.Fprintf(&b, "%s = host=%s port=%d dbname=%s", d.Name, quotePgBouncerValue(d.Host), d.Port, quotePgBouncerValue(d.Name))
+		if d.PoolSize != nil {
+			fmt.Fprintf(&b, " pool_size=%d", *d.PoolSize)
+		}
+		if d.PoolMode != "" {
+			fmt.Fprintf(&b, " pool_mode=%s", d.PoolMode)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// RenderPgBouncerAuthFile renders an auth_file with the password hash of each role, sorted by role name.
+func RenderPgBouncerAuthFile(hashes map[string]string) string {
+	roles := make([]string, 0, len(hashes))
+	for role := range hashes {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+
+	quote := func(s string) string { return `"` + strings.ReplaceAll(s, `"`, `""`) + `"` }
+	var b strings.Builder
+	b.WriteString(pgBouncerHeader)
+	for _, role := range roles {
+		b.WriteString(quote(role) + " " + quote(hashes[role]) + "\n")
+	}
+	return b.String()
+}
+
+// GetRolePasswordHashes returns the stored SCRAM or MD5 password of each named role that has one.
+// Reading pg_authid requires superuser privileges.
+func GetRolePasswordHashes(pgAdminDSN string, roleNames []string) (map[string]string, error) {
+	hashes := make(map[string]string)
+	if len(roleNames) == 0 {
+		return hashes, nil
+	}
+	db, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT rolname, rolpassword FROM pg_authid WHERE rolname = ANY($1) AND rolpassword IS NOT NULL", pq.Array(roleNames))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query role passwords: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var role, hash string
+		if err := rows.Scan(&role, &hash); err != nil {
+			return nil, fmt.Errorf("failed to scan role password: %w", err)
+		}
+		hashes[role] = hash
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate role passwords: %w", err)
+	}
+	return hashes, nil
+}
+
+// WriteFileAtomically replaces path with content through a temporary file in the same directory,
+// so readers never see a partial file. It returns false without writing if the content is unchanged.
+func WriteFileAtomically(path, content string, perm os.FileMode) (bool, error) {
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, []byte(content)) {
+		return false, nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return false, fmt.Errorf("failed to create temporary file for %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return false, fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return false, fmt.Errorf("failed to set permissions of %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return false, fmt.Errorf("failed to sync %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return false, fmt.Errorf("failed to close %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return false, fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// ReloadPgBouncer runs RELOAD on the PgBouncer admin console so it rereads its configuration.
+// The admin console only speaks the simple query protocol, so the connection is not pinged.
+func ReloadPgBouncer(adminConsoleDSN string) error {
+	db, err := sql.Open("postgres", adminConsoleDSN)
+	if err != nil {
+		return fmt.Errorf("failed to open PgBouncer admin console connection: %w", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("RELOAD"); err != nil {
+		return fmt.Errorf("failed to reload PgBouncer: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package dbutils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenderPgBouncerDatabases(t *testing.T) {
+	poolSize := 20
+	got := RenderPgBouncerDatabases([]PgBouncerDatabase{
+		{Name: "shop", Host: "postgres", Port: 5432, PoolSize: &poolSize, PoolMode: "transaction"},
+		{Name: "blog", Host: "postgres", Port: 5432},
+	})
+	want := pgBouncerHeader + "[databases]\n" +
+		"blog = host=postgres port=5432 dbname=blog\n" +
+		"shop = host=postgres port=5432 dbname=shop pool_size=20 pool_mode=transaction\n"
+	if got != want {
+		t.Errorf("RenderPgBouncerDatabases() = %q, want %q", got, want)
+	}
+}
+
+func TestRenderPgBouncerAuthFile(t *testing.T) {
+	got := RenderPgBouncerAuthFile(map[string]string{"shop__app": "SCRAM-SHA-256$4096:abc", "blog__x": `md5"q`})
+	want := pgBouncerHeader + "\"blog__x\" \"md5\"\"q\"\n\"shop__app\" \"SCRAM-SHA-256$4096:abc\"\n"
+	if got != want {
+		t.Errorf("RenderPgBouncerAuthFile() = %q, want %q", got, want)
+	}
+}
+
+func TestWriteFileAtomically(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "databases.ini")
+	if changed, err := WriteFileAtomically(path, "a", 0o600); err != nil || !changed {
+		t.Fatalf("first write = %t, %v, want true, nil", changed, err)
+	}
+	if changed, err := WriteFileAtomically(path, "a", 0o600); err != nil || changed {
+		t.Fatalf("unchanged write = %t, %v, want false, nil", changed, err)
+	}
+	if changed, err := WriteFileAtomically(path, "b", 0o600); err != nil || !changed {
+		t.Fatalf("changed write = %t, %v, want true, nil", changed, err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "b" {
+		t.Errorf("file content = %q, want %q", content, "b")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
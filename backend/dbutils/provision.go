@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"log"
 	"math/big"
-	"os"
 	"regexp"
 	"strings"
 	"sync"
@@ -25,7 +24,7 @@ var (
 	// PostgreSQL serializes CREATE DATABASE through template1; concurrent calls
 	// can fail with "source database template1 is being accessed by other users".
 	// Serialize in-process so a single app instance never issues two concurrent
-	// CREATE DATABASE statements.
+	// CREATE DATABASE statements; an advisory lock covers other replicas.
 	createDatabaseMu sync.Mutex
 )
 
@@ -107,10 +106,8 @@ func getSpecificDatabaseDSN(generalDSN, dbName string) string {
 }
 
 // CreatePostgresDatabase creates a new database and enables pgvector extension.
+// It fails if the database already exists; use ProvisionDatabase to resume a failed run.
 func CreatePostgresDatabase(pgAdminDSN, dbName string) error {
-	createDatabaseMu.Lock()
-	defer createDatabaseMu.Unlock()
-
 	log.Printf("Attempting to create database: %s", dbName)
 	safeDBName, err := sanitizeIdentifier(dbName)
 	if err != nil {
@@ -120,217 +117,16 @@ func CreatePostgresDatabase(pgAdminDSN, dbName string) error {
 	// The handler should ensure `dbName` is already globally unique and valid before calling this.
 	// This sanitization is a safeguard.
 
-	adminDB, err := connectToDB(pgAdminDSN)
+	exists, err := PostgresDatabaseExists(pgAdminDSN, safeDBName)
 	if err != nil {
-		return fmt.Errorf("failed to connect to admin database: %w", err)
-	}
-	defer adminDB.Close()
-
-	var exists bool
-	// Parameterized query for checking database existence
-	err = adminDB.QueryRow("SELECT EXISTS(SELECT 1 FROM pg_database WHERE datname = $1)", safeDBName).Scan(&exists)
-	if err != nil {
-		return fmt.Errorf("failed to check if database '%s' exists: %w", safeDBName, err)
+		return err
 	}
 	if exists {
 		return fmt.Errorf("database '%s' already exists", safeDBName)
 	}
 
-	log.Printf("Executing CREATE DATABASE %s", safeDBName)
-	// Identifiers like database names cannot be parameterized directly in CREATE DATABASE.
-	// Sanitize rigorously and use fmt.Sprintf.
-	_, err = adminDB.Exec(fmt.Sprintf("CREATE DATABASE %s", pq.QuoteIdentifier(safeDBName)))
-	if err != nil {
-		return fmt.Errorf("failed to execute CREATE DATABASE %s: %w", safeDBName, err)
-	}
-	log.Printf("Database %s created successfully.", safeDBName)
-
-	newDbDSN := getSpecificDatabaseDSN(pgAdminDSN, safeDBName)
-	log.Printf("Connecting to new database %s using DSN: %s", safeDBName, newDbDSN)
-
-	newDB, err := connectToDB(newDbDSN)
-	if err != nil {
-		log.Printf("Failed to connect to newly created database %s. Attempting to drop it.", safeDBName)
-		_, dropErr := adminDB.Exec(fmt.Sprintf("DROP DATABASE %s", pq.QuoteIdentifier(safeDBName))) // Sanitize again
-		if dropErr != nil {
-			log.Printf("CRITICAL: Failed to connect to new DB AND failed to drop it: %v. Manual cleanup for %s.", dropErr, safeDBName)
-		} else {
-			log.Printf("Successfully dropped database %s after failing to connect to it.", safeDBName)
-		}
-		return fmt.Errorf("failed to connect to newly created database '%s': %w", safeDBName, err)
-	}
-	defer newDB.Close()
-
-	// Harden the database by revoking default privileges from PUBLIC, as per PGDOC.md.
-	log.Printf("Revoking default public access on database %s", safeDBName)
-	if _, err := newDB.Exec(fmt.Sprintf("REVOKE CONNECT ON DATABASE %s FROM PUBLIC", pq.QuoteIdentifier(safeDBName))); err != nil {
-		return fmt.Errorf("failed to revoke CONNECT on database from PUBLIC: %w", err)
-	}
-	// GRANT USAGE, CREATE ON SCHEMA public TO PUBLIC is needed for extensions created by admin.
-	// The CREATE permission is only for extension creation, not for regular users.
-	// After extensions are created, we revoke CREATE from PUBLIC (see below).
-	if _, err := newDB.Exec("GRANT USAGE, CREATE ON SCHEMA public TO PUBLIC"); err != nil {
-		return fmt.Errorf("failed to grant USAGE, CREATE on public schema to PUBLIC: %w", err)
-	}
-
-	// Always create uuid-ossp extension
-	log.Printf("Creating uuid-ossp extension in database %s", safeDBName)
-	_, err = newDB.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\"")
-	if err != nil {
-		log.Printf("Failed to create uuid-ossp extension in %s. Attempting to drop it. Error: %v", safeDBName, err)
-		_, dropErr := adminDB.Exec(fmt.Sprintf("DROP DATABASE %s", pq.QuoteIdentifier(safeDBName))) // Sanitize again
-		if dropErr != nil {
-			log.Printf("CRITICAL: Failed to create extension AND failed to drop DB: %v. Manual cleanup for %s.", dropErr, safeDBName)
-		} else {
-			log.Printf("Successfully dropped database %s after failing to create extension.", safeDBName)
-		}
-		return fmt.Errorf("failed to create uuid-ossp extension in database '%s': %w", safeDBName, err)
-	}
-	log.Printf("uuid-ossp extension created successfully in %s.", safeDBName)
-
-	// Always create vector extension
-	log.Printf("Creating vector extension in database %s", safeDBName)
-	_, err = newDB.Exec("CREATE EXTENSION IF NOT EXISTS vector")
-	if err != nil {
-		log.Printf("Failed to create vector extension in %s. Attempting to drop it. Error: %v", safeDBName, err)
-		_, dropErr := adminDB.Exec(fmt.Sprintf("DROP DATABASE %s", pq.QuoteIdentifier(safeDBName))) // Sanitize again
-		if dropErr != nil {
-			log.Printf("CRITICAL: Failed to create extension AND failed to drop DB: %v. Manual cleanup for %s.", dropErr, safeDBName)
-		} else {
-			log.Printf("Successfully dropped database %s after failing to create extension.", safeDBName)
-		}
-		return fmt.Errorf("failed to create vector extension in database '%s': %w", safeDBName, err)
-	}
-	log.Printf("vector extension created successfully in %s.", safeDBName)
-
-	// Create other allowed extensions from environment variable
-	allowedExtensionsStr := os.Getenv("PGWEB_ALLOWED_EXTENSIONS")
-	if allowedExtensionsStr != "" {
-		extensions := strings.Split(allowedExtensionsStr, ",")
-		for _, ext := range extensions {
-			ext = strings.TrimSpace(ext)
-			if ext == "" {
-				continue
-			}
-			log.Printf("Creating extension %s in database %s", ext, safeDBName)
-			_, err = newDB.Exec(fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS %s", pq.QuoteIdentifier(ext)))
-			if err != nil {
-				log.Printf("Failed to create extension %s in %s. Error: %v", ext, safeDBName, err)
-				// Do not drop the database for non-critical extensions, just log the error.
-			} else {
-				log.Printf("Extension %s created successfully in %s.", ext, safeDBName)
-			}
-		}
-	}
-
-	// Revoke CREATE from PUBLIC after all extensions are created.
-	// We only grant CREATE to PUBLIC temporarily for extension creation (line 163).
-	// The write role will get CREATE directly via line 270.
-	if _, err := newDB.Exec("REVOKE CREATE ON SCHEMA public FROM PUBLIC"); err != nil {
-		log.Printf("Warning: failed to revoke CREATE on public schema from PUBLIC: %v", err)
-	}
-
-	// Create read and write roles for the database
-	readRole := fmt.Sprintf("%s_read", safeDBName)
-	writeRole := fmt.Sprintf("%s_write", safeDBName)
-
-	log.Printf("Creating role %s for database %s", readRole, safeDBName)
-	_, err = newDB.Exec(fmt.Sprintf("CREATE ROLE %s", pq.QuoteIdentifier(readRole)))
-	if err != nil {
-		return fmt.Errorf("failed to create read role %s: %w", readRole, err)
-	}
-
-	log.Printf("Creating role %s for database %s", writeRole, safeDBName)
-	_, err = newDB.Exec(fmt.Sprintf("CREATE ROLE %s", pq.QuoteIdentifier(writeRole)))
-	if err != nil {
-		return fmt.Errorf("failed to create write role %s: %w", writeRole, err)
-	}
-
-	// Grant CONNECT on the database to both roles
-	_, err = newDB.Exec(fmt.Sprintf("GRANT CONNECT ON DATABASE %s TO %s, %s", pq.QuoteIdentifier(safeDBName), pq.QuoteIdentifier(readRole), pq.QuoteIdentifier(writeRole)))
-	if err != nil {
-		return fmt.Errorf("failed to grant CONNECT to roles: %w", err)
-	}
-
-	// Grant CREATE on the database to the write role, allowing extension creation.
-	_, err = newDB.Exec(fmt.Sprintf("GRANT CREATE ON DATABASE %s TO %s", pq.QuoteIdentifier(safeDBName), pq.QuoteIdentifier(writeRole)))
-	if err != nil {
-		return fmt.Errorf("failed to grant CREATE on database to write role: %w", err)
-	}
-
-	// --- Schema and Role Permissions ---
-
-	// Grant basic USAGE on the public schema to both roles.
-	_, err = newDB.Exec(fmt.Sprintf("GRANT USAGE ON SCHEMA public TO %s, %s", pq.QuoteIdentifier(readRole), pq.QuoteIdentifier(writeRole)))
-	if err != nil {
-		return fmt.Errorf("failed to grant USAGE on public schema to roles: %w", err)
-	}
-
-	// Grant CREATE permission on the public schema to the write role, so it can create tables.
-	_, err = newDB.Exec(fmt.Sprintf("GRANT CREATE ON SCHEMA public TO %s", pq.QuoteIdentifier(writeRole)))
-	if err != nil {
-		return fmt.Errorf("failed to grant CREATE on public schema to write role %s: %w", writeRole, err)
-	}
-
-	// Grant privileges on existing objects (none at this point, but good practice).
-	_, err = newDB.Exec(fmt.Sprintf("GRANT SELECT ON ALL TABLES IN SCHEMA public TO %s", pq.QuoteIdentifier(readRole)))
-	if err != nil {
-		return fmt.Errorf("failed to grant SELECT on existing public tables to read role %s: %w", readRole, err)
-	}
-	_, err = newDB.Exec(fmt.Sprintf("GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO %s", pq.QuoteIdentifier(readRole)))
-	if err != nil {
-		return fmt.Errorf("failed to grant SELECT on existing public sequences to read role %s: %w", readRole, err)
-	}
-	_, err = newDB.Exec(fmt.Sprintf("GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO %s", pq.QuoteIdentifier(writeRole)))
-	if err != nil {
-		return fmt.Errorf("failed to grant ALL on existing public tables to write role %s: %w", writeRole, err)
-	}
-	_, err = newDB.Exec(fmt.Sprintf("GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO %s", pq.QuoteIdentifier(writeRole)))
-	if err != nil {
-		return fmt.Errorf("failed to grant ALL on existing public sequences to write role %s: %w", writeRole, err)
-	}
-
-	// --- Default Privileges for Future Objects ---
-	var currentUser string
-	err = newDB.QueryRow("SELECT current_user").Scan(&currentUser)
-	if err != nil {
-		return fmt.Errorf("failed to get current user to set default privileges: %w", err)
-	}
-
-	log.Printf("Temporarily granting role %s to admin user %s to set default privileges", writeRole, currentUser)
-	_, err = newDB.Exec(fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(writeRole), pq.QuoteIdentifier(currentUser)))
-	if err != nil {
-		return fmt.Errorf("failed to grant write role to admin user '%s': %w", currentUser, err)
-	}
-
-	// For objects created by writeRole, grant SELECT to PUBLIC.
-	// This is safe because only authenticated roles can connect to the database.
-	_, err = newDB.Exec(fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA public GRANT SELECT ON TABLES TO PUBLIC", pq.QuoteIdentifier(writeRole)))
-	if err != nil {
-		return fmt.Errorf("failed to set default SELECT on tables for PUBLIC: %w", err)
-	}
-	_, err = newDB.Exec(fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA public GRANT SELECT ON SEQUENCES TO PUBLIC", pq.QuoteIdentifier(writeRole)))
-	if err != nil {
-		return fmt.Errorf("failed to set default SELECT on sequences for PUBLIC: %w", err)
-	}
-
-	// Grant write-level privileges only to the write role.
-	_, err = newDB.Exec(fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA public GRANT INSERT, UPDATE, DELETE, TRUNCATE ON TABLES TO %s", pq.QuoteIdentifier(writeRole), pq.QuoteIdentifier(writeRole)))
-	if err != nil {
-		return fmt.Errorf("failed to set default write privileges on tables for write role: %w", err)
-	}
-	_, err = newDB.Exec(fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA public GRANT UPDATE ON SEQUENCES TO %s", pq.QuoteIdentifier(writeRole), pq.QuoteIdentifier(writeRole)))
-	if err != nil {
-		return fmt.Errorf("failed to set default write privileges on sequences for write role: %w", err)
-	}
-
-	log.Printf("Revoking role %s from admin user %s", writeRole, currentUser)
-	_, err = newDB.Exec(fmt.Sprintf("REVOKE %s FROM %s", pq.QuoteIdentifier(writeRole), pq.QuoteIdentifier(currentUser)))
-	if err != nil {
-		log.Printf("Warning: failed to revoke write role from admin user '%s': %v", currentUser, err)
-	}
-
-	return nil
+	_, err = ProvisionDatabase(pgAdminDSN, safeDBName, "", nil)
+	return err
 }
 
 // CreateApplicationUsersTable creates the application_users table if it doesn't exist.
@@ -359,8 +155,15 @@ func CreateApplicationUsersTable(appDbDSN string) error {
 	return nil
 }
 
-// CreatePostgresUser creates a new PostgreSQL user with specified permissions.
+// CreatePostgresUser creates a new PostgreSQL user with specified permissions and a generated password.
 func CreatePostgresUser(pgAdminDSN, targetDbName, pgUserName, permissionLevel string) (string, error) {
+	return CreatePostgresUserWithPassword(pgAdminDSN, targetDbName, pgUserName, permissionLevel, "")
+}
+
+// CreatePostgresUserWithPassword creates a new PostgreSQL user with specified permissions.
+// If password is empty a strong password is generated. Callers must validate supplied
+// passwords against the PasswordPolicy beforehand.
+func CreatePostgresUserWithPassword(pgAdminDSN, targetDbName, pgUserName, permissionLevel, password string) (string, error) {
 	log.Printf("Attempting to create user %s for database %s with permission %s", pgUserName, targetDbName, permissionLevel)
 
 	safePgUserName, err := sanitizeIdentifier(pgUserName)
@@ -369,9 +172,12 @@ func CreatePostgresUser(pgAdminDSN, targetDbName, pgUserName, permissionLevel st
 	}
 	// As with dbName, handler should ensure pgUserName is valid and unique within the target DB.
 
-	generatedPassword, err := generateStrongPassword(passwordLength)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate password for user %s: %w", safePgUserName, err)
+	generatedPassword := password
+	if generatedPassword == "" {
+		generatedPassword, err = generatePolicyPassword()
+		if err != nil {
+			return "", fmt.Errorf("failed to generate password for user %s: %w", safePgUserName, err)
+		}
 	}
 
 	targetDbDSN := getSpecificDatabaseDSN(pgAdminDSN, targetDbName)
@@ -387,12 +193,18 @@ func CreatePostgresUser(pgAdminDSN, targetDbName, pgUserName, permissionLevel st
 	// The pq driver's QuoteLiteral function handles proper escaping.
 	quotedPassword := pq.QuoteLiteral(generatedPassword)
 	createUserSQL := fmt.Sprintf("CREATE USER %s WITH PASSWORD %s NOSUPERUSER NOCREATEDB NOCREATEROLE", pq.QuoteIdentifier(safePgUserName), quotedPassword)
-	_, err = db.Exec(createUserSQL)
+	err = execPasswordStatement(db, createUserSQL)
 	if err != nil {
 		return "", fmt.Errorf("failed to create user %s: %w", safePgUserName, err)
 	}
 	log.Printf("User %s created.", safePgUserName)
 
+	// Custom users get no base role; access comes only from permission sets granted afterwards.
+	if permissionLevel == "custom" {
+		log.Printf("User %s created without base role; permission sets must be granted separately.", safePgUserName)
+		return generatedPassword, nil
+	}
+
 	// Grant the appropriate role to the user
 	var roleName string
 	switch permissionLevel {
@@ -447,17 +259,28 @@ func CreatePostgresUser(pgAdminDSN, targetDbName, pgUserName, permissionLevel st
 	return generatedPassword, nil
 }
 
-// RegeneratePostgresUserPassword generates a new password for a PostgreSQL user.
-func RegeneratePostgresUserPassword(pgAdminDSN, targetDbName, pgUserName string) (string, error) {
+// GeneratePassword returns a random password that passes the password policy, for callers that
+// must store the password before applying it with SetPostgresUserPassword.
+func GeneratePassword() (string, error) {
+	return generatePolicyPassword()
+}
+
+// SetPostgresUserPassword sets the password of a PostgreSQL user. If password is empty a
+// strong password is generated. Callers must validate supplied passwords against the
+// PasswordPolicy beforehand.
+func SetPostgresUserPassword(pgAdminDSN, targetDbName, pgUserName, password string) (string, error) {
 	log.Printf("Attempting to regenerate password for user %s on database %s", pgUserName, targetDbName)
 	safePgUserName, err := sanitizeIdentifier(pgUserName)
 	if err != nil {
 		return "", fmt.Errorf("invalid PostgreSQL username '%s' for password regeneration: %w", pgUserName, err)
 	}
 
-	newGeneratedPassword, err := generateStrongPassword(passwordLength)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate new password for user %s: %w", safePgUserName, err)
+	newGeneratedPassword := password
+	if newGeneratedPassword == "" {
+		newGeneratedPassword, err = generatePolicyPassword()
+		if err != nil {
+			return "", fmt.Errorf("failed to generate new password for user %s: %w", safePgUserName, err)
+		}
 	}
 
 	targetDbDSN := getSpecificDatabaseDSN(pgAdminDSN, targetDbName)
@@ -473,7 +296,7 @@ func RegeneratePostgresUserPassword(pgAdminDSN, targetDbName, pgUserName string)
 	quotedPassword := pq.QuoteLiteral(newGeneratedPassword)
 	alterUserSQL := fmt.Sprintf("ALTER USER %s WITH PASSWORD %s", pq.QuoteIdentifier(safePgUserName), quotedPassword)
 
-	_, err = db.Exec(alterUserSQL)
+	err = execPasswordStatement(db, alterUserSQL)
 	if err != nil {
 		return "", fmt.Errorf("failed to alter user %s password: %w", safePgUserName, err)
 	}
@@ -523,8 +346,9 @@ func DeletePostgresUser(pgAdminDSN, targetDbName, pgUserName string) error {
 	return nil
 }
 
-// SoftDeletePostgresDatabase revokes user privileges on a database.
-func SoftDeletePostgresDatabase(pgAdminDSN, dbName string, pgUsers []models.ManagedPGUser) error {
+// SoftDeletePostgresDatabase revokes user privileges on a database. setRoles are the permission set
+// roles recorded for the database.
+func SoftDeletePostgresDatabase(pgAdminDSN, dbName string, pgUsers []models.ManagedPGUser, setRoles []string) error {
 	log.Printf("Attempting to soft delete database (revoke access): %s", dbName)
 	safeDBName, err := sanitizeIdentifier(dbName)
 	if err != nil {
@@ -545,6 +369,19 @@ func SoftDeletePostgresDatabase(pgAdminDSN, dbName string, pgUsers []models.Mana
 	}
 	defer adminDB.Close()
 
+	// Permission set roles carry their own CONNECT privilege, so revoke it from them as well. Only the
+	// recorded roles are touched: another database's name may start with "<db>_ps_".
+	for _, roleName := range setRoles {
+		safeRoleName, err := sanitizeIdentifier(roleName)
+		if err != nil {
+			log.Printf("Skipping permission set role %s due to invalid name for soft delete: %v", roleName, err)
+			continue
+		}
+		if _, err := adminDB.Exec(fmt.Sprintf("REVOKE CONNECT ON DATABASE %s FROM %s", pq.QuoteIdentifier(safeDBName), pq.QuoteIdentifier(safeRoleName))); err != nil {
+			log.Printf("Warning: Failed to revoke connect for permission set role %s on %s: %v", safeRoleName, safeDBName, err)
+		}
+	}
+
 	for _, user := range pgUsers {
 		safeUsername, err := sanitizeIdentifier(user.PGUsername)
 		if err != nil {
@@ -0,0 +1,322 @@
+package dbutils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	pq "github.com/lib/pq"
+)
+
+// Provisioning step statuses reported to a ProvisioningProgress callback.
+const (
+	StepRunning   = "running"
+	StepCompleted = "completed"
+	StepFailed    = "failed"
+)
+
+// ProvisioningProgress is called when a provisioning step starts (stepErr is nil) and when it
+// completes or fails.
+type ProvisioningProgress func(step, status string, stepErr error)
+
+// provisioner carries the connections shared by the steps of one provisioning run.
+type provisioner struct {
+	pgAdminDSN string
+	dbName     string
+	target     *sql.DB // Connection to the database being provisioned, opened on first use
+}
+
+func (p *provisioner) targetDB() (*sql.DB, error) {
+	if p.target == nil {
+		db, err := connectToDB(getSpecificDatabaseDSN(p.pgAdminDSN, p.dbName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to database '%s': %w", p.dbName, err)
+		}
+		p.target = db
+	}
+	return p.target, nil
+}
+
+func (p *provisioner) close() {
+	if p.target != nil {
+		p.target.Close()
+	}
+}
+
+// provisioningStep is one idempotent step of database provisioning: running it again after a
+// partial or complete run converges to the same state.
+type provisioningStep struct {
+	name string
+	run  func(p *provisioner) error
+}
+
+var provisioningSteps = []provisioningStep{
+	{"create_database", (*provisioner).createDatabase},
+	{"harden_database", (*provisioner).hardenDatabase},
+	{"create_extensions", (*provisioner).createExtensions},
+	{"create_roles", func(p *provisioner) error {
+		db, err := p.targetDB()
+		if err != nil {
+			return err
+		}
+		return createDatabaseRoles(db, p.dbName)
+	}},
+	{"grant_database_privileges", func(p *provisioner) error {
+		db, err := p.targetDB()
+		if err != nil {
+			return err
+		}
+		return grantDatabasePrivileges(db, p.dbName)
+	}},
+	{"configure_public_schema", func(p *provisioner) error {
+		db, err := p.targetDB()
+		if err != nil {
+			return err
+		}
+		return configureSchemaPrivileges(db, "public", p.dbName+"_read", p.dbName+"_write")
+	}},
+}
+
+// ProvisioningStepNames returns the names of the provisioning steps in execution order.
+func ProvisioningStepNames() []string {
+	names := make([]string, len(provisioningSteps))
+	for i, step := range provisioningSteps {
+		names[i] = step.name
+	}
+	return names
+}
+
+// ProvisionDatabase runs the provisioning steps for dbName in order, starting at fromStep
+// (empty for the first step). It stops at the first failing step and returns its name with the
+// error. Every step is idempotent, so a failed run can be resumed from the failed step.
+func ProvisionDatabase(pgAdminDSN, dbName, fromStep string, progress ProvisioningProgress) (string, error) {
+	safeDBName, err := sanitizeIdentifier(dbName)
+	if err != nil {
+		return "", fmt.Errorf("invalid database name '%s': %w", dbName, err)
+	}
+	start := 0
+	if fromStep != "" {
+		start = -1
+		for i, step := range provisioningSteps {
+			if step.name == fromStep {
+				start = i
+				break
+			}
+		}
+		if start < 0 {
+			return "", fmt.Errorf("unknown provisioning step '%s'", fromStep)
+		}
+	}
+	if progress == nil {
+		progress = func(string, string, error) {}
+	}
+
+	p := &provisioner{pgAdminDSN: pgAdminDSN, dbName: safeDBName}
+	defer p.close()
+	for _, step := range provisioningSteps[start:] {
+		log.Printf("Provisioning database %s: running step %s", safeDBName, step.name)
+		progress(step.name, StepRunning, nil)
+		if err := step.run(p); err != nil {
+			log.Printf("Provisioning database %s: step %s failed: %v", safeDBName, step.name, err)
+			progress(step.name, StepFailed, err)
+			return step.name, err
+		}
+		progress(step.name, StepCompleted, nil)
+	}
+	log.Printf("Database %s provisioned successfully.", safeDBName)
+	return "", nil
+}
+
+// PostgresDatabaseExists reports whether a database named dbName exists in the cluster.
+func PostgresDatabaseExists(pgAdminDSN, dbName string) (bool, error) {
+	adminDB, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer adminDB.Close()
+	var exists bool
+	if err := adminDB.QueryRow("SELECT EXISTS(SELECT 1 FROM pg_database WHERE datname = $1)", dbName).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check if database '%s' exists: %w", dbName, err)
+	}
+	return exists, nil
+}
+
+// createDatabaseLockKey is the cluster-wide advisory lock serializing CREATE DATABASE.
+const createDatabaseLockKey int64 = 0x706777656200 // "pgweb\x00"
+
+// createDatabase creates the database unless it already exists from an earlier attempt.
+// PostgreSQL serializes CREATE DATABASE through template1, so concurrent calls can fail with
+// "source database template1 is being accessed by other users". createDatabaseMu serializes
+// calls within this process and an advisory lock serializes them across backend replicas.
+func (p *provisioner) createDatabase() error {
+	createDatabaseMu.Lock()
+	defer createDatabaseMu.Unlock()
+
+	adminDB, err := connectToDB(p.pgAdminDSN)
+	if err != nil {
+		return fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer adminDB.Close()
+
+	// The advisory lock belongs to the session, so everything runs on one connection.
+	ctx := context.Background()
+	conn, err := adminDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire admin connection: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", createDatabaseLockKey); err != nil {
+		return fmt.Errorf("failed to take CREATE DATABASE lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", createDatabaseLockKey); err != nil {
+			log.Printf("Warning: failed to release CREATE DATABASE lock: %v", err)
+		}
+	}()
+
+	var exists bool
+	if err := conn.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM pg_database WHERE datname = $1)", p.dbName).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check if database '%s' exists: %w", p.dbName, err)
+	}
+	if exists {
+		log.Printf("Database %s already exists; skipping CREATE DATABASE", p.dbName)
+		return nil
+	}
+
+	// Identifiers like database names cannot be parameterized directly in CREATE DATABASE.
+	// Sanitize rigorously and use fmt.Sprintf.
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE %s", pq.QuoteIdentifier(p.dbName))); err != nil {
+		return fmt.Errorf("failed to execute CREATE DATABASE %s: %w", p.dbName, err)
+	}
+	log.Printf("Database %s created successfully.", p.dbName)
+	return nil
+}
+
+// hardenDatabase revokes default privileges from PUBLIC, as per PGDOC.md.
+func (p *provisioner) hardenDatabase() error {
+	db, err := p.targetDB()
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(fmt.Sprintf("REVOKE CONNECT ON DATABASE %s FROM PUBLIC", pq.QuoteIdentifier(p.dbName))); err != nil {
+		return fmt.Errorf("failed to revoke CONNECT on database from PUBLIC: %w", err)
+	}
+	if _, err := db.Exec("GRANT USAGE ON SCHEMA public TO PUBLIC"); err != nil {
+		return fmt.Errorf("failed to grant USAGE on public schema to PUBLIC: %w", err)
+	}
+	return nil
+}
+
+// createExtensions creates uuid-ossp, vector, the extensions in PGWEB_ALLOWED_EXTENSIONS and, if
+// PGWEB_PG_STAT_STATEMENTS is enabled, pg_stat_statements.
+// CREATE on the public schema is granted to PUBLIC only while extensions are created.
+func (p *provisioner) createExtensions() error {
+	db, err := p.targetDB()
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec("GRANT CREATE ON SCHEMA public TO PUBLIC"); err != nil {
+		return fmt.Errorf("failed to grant CREATE on public schema to PUBLIC: %w", err)
+	}
+	defer func() {
+		// The write role gets CREATE directly in configure_public_schema.
+		if _, err := db.Exec("REVOKE CREATE ON SCHEMA public FROM PUBLIC"); err != nil {
+			log.Printf("Warning: failed to revoke CREATE on public schema from PUBLIC: %v", err)
+		}
+	}()
+
+	for _, ext := range []string{"uuid-ossp", "vector"} {
+		if _, err := db.Exec(fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS %s", pq.QuoteIdentifier(ext))); err != nil {
+			return fmt.Errorf("failed to create %s extension in database '%s': %w", ext, p.dbName, err)
+		}
+		log.Printf("%s extension created successfully in %s.", ext, p.dbName)
+	}
+
+	for _, ext := range strings.Split(os.Getenv("PGWEB_ALLOWED_EXTENSIONS"), ",") {
+		ext = strings.TrimSpace(ext)
+		if ext == "" {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS %s", pq.QuoteIdentifier(ext))); err != nil {
+			// Optional extensions are not critical, just log the error.
+			log.Printf("Failed to create extension %s in %s. Error: %v", ext, p.dbName, err)
+		} else {
+			log.Printf("Extension %s created successfully in %s.", ext, p.dbName)
+		}
+	}
+
+	if PgStatStatementsEnabled() {
+		// Statistics are only collected with pg_stat_statements in shared_preload_libraries; without it
+		// query insights report the extension as unavailable, so a failure is not critical either.
+		if _, err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_stat_statements"); err != nil {
+			log.Printf("Failed to create extension pg_stat_statements in %s. Error: %v", p.dbName, err)
+		} else {
+			log.Printf("Extension pg_stat_statements created successfully in %s.", p.dbName)
+		}
+	}
+	return nil
+}
+
+// createDatabaseRoles creates the read and write roles of a database unless they already exist. An
+// existing role that can log in is someone's login role, not a database role, and is never adopted.
+func createDatabaseRoles(db *sql.DB, dbName string) error {
+	for _, role := range []string{dbName + "_read", dbName + "_write"} {
+		var canLogin sql.NullBool
+		if err := db.QueryRow("SELECT (SELECT rolcanlogin FROM pg_roles WHERE rolname = $1)", role).Scan(&canLogin); err != nil {
+			return fmt.Errorf("failed to check if role %s exists: %w", role, err)
+		}
+		if canLogin.Valid && canLogin.Bool {
+			return fmt.Errorf("role %s already exists as a login role", role)
+		}
+		if canLogin.Valid {
+			continue
+		}
+		log.Printf("Creating role %s for database %s", role, dbName)
+		if _, err := db.Exec(fmt.Sprintf("CREATE ROLE %s", pq.QuoteIdentifier(role))); err != nil {
+			return fmt.Errorf("failed to create role %s: %w", role, err)
+		}
+	}
+	return nil
+}
+
+// grantDatabasePrivileges grants CONNECT to the read and write roles and CREATE (for extensions) to the write role.
+func grantDatabasePrivileges(db *sql.DB, dbName string) error {
+	readRole, writeRole := dbName+"_read", dbName+"_write"
+	if _, err := db.Exec(fmt.Sprintf("GRANT CONNECT ON DATABASE %s TO %s, %s", pq.QuoteIdentifier(dbName), pq.QuoteIdentifier(readRole), pq.QuoteIdentifier(writeRole))); err != nil {
+		return fmt.Errorf("failed to grant CONNECT to roles: %w", err)
+	}
+	if _, err := db.Exec(fmt.Sprintf("GRANT CREATE ON DATABASE %s TO %s", pq.QuoteIdentifier(dbName), pq.QuoteIdentifier(writeRole))); err != nil {
+		return fmt.Errorf("failed to grant CREATE on database to write role: %w", err)
+	}
+	return nil
+}
+
+// RollbackDatabaseProvisioning removes everything a (partial) provisioning run created: the
+// database and its read and write roles. It must only be used for databases that never became active.
+func RollbackDatabaseProvisioning(pgAdminDSN, dbName string) error {
+	safeDBName, err := sanitizeIdentifier(dbName)
+	if err != nil {
+		return fmt.Errorf("invalid database name '%s': %w", dbName, err)
+	}
+	adminDB, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer adminDB.Close()
+
+	// Dropping the database first also drops the privileges the roles hold inside it.
+	log.Printf("Rolling back provisioning of database %s", safeDBName)
+	if _, err := adminDB.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %s", pq.QuoteIdentifier(safeDBName))); err != nil {
+		return fmt.Errorf("failed to drop database %s: %w", safeDBName, err)
+	}
+	for _, role := range []string{safeDBName + "_read", safeDBName + "_write"} {
+		if _, err := adminDB.Exec(fmt.Sprintf("DROP ROLE IF EXISTS %s", pq.QuoteIdentifier(role))); err != nil {
+			return fmt.Errorf("failed to drop role %s: %w", role, err)
+		}
+	}
+	log.Printf("Provisioning of database %s rolled back.", safeDBName)
+	return nil
+}
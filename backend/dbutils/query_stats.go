@@ -0,0 +1,128 @@
+package dbutils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"pgweb-backend/models"
+
+	pq "github.com/lib/pq"
+)
+
+// ErrPgStatStatementsUnavailable is returned when pg_stat_statements is not installed in a database or
+// not loaded by the server.
+var ErrPgStatStatementsUnavailable = errors.New("pg_stat_statements is not enabled for this database")
+
+// queryStatsOrders maps the sort keys of query statistics to pg_stat_statements columns.
+var queryStatsOrders = map[string]string{
+	"total_time": "total_exec_time",
+	"mean_time":  "mean_exec_time",
+	"calls":      "calls",
+	"rows":       "rows",
+}
+
+// PgStatStatementsEnabled reports whether provisioning creates the pg_stat_statements extension
+// (PGWEB_PG_STAT_STATEMENTS). The server must also have it in shared_preload_libraries.
+func PgStatStatementsEnabled() bool {
+	return os.Getenv("PGWEB_PG_STAT_STATEMENTS") == "true"
+}
+
+// ValidQueryStatsOrder reports whether orderBy is a sort key accepted by GetQueryStats:
+// "total_time", "mean_time", "calls" or "rows".
+func ValidQueryStatsOrder(orderBy string) bool {
+	_, ok := queryStatsOrders[orderBy]
+	return ok
+}
+
+// connectToQueryStatsDB connects to dbName and checks that pg_stat_statements is installed there.
+func connectToQueryStatsDB(pgAdminDSN, dbName string) (*sql.DB, error) {
+	safeDBName, err := sanitizeIdentifier(dbName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database name '%s': %w", dbName, err)
+	}
+	db, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, safeDBName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database %s: %w", safeDBName, err)
+	}
+	var installed bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM pg_extension WHERE extname = 'pg_stat_statements')").Scan(&installed); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to check for pg_stat_statements in %s: %w", safeDBName, err)
+	}
+	if !installed {
+		db.Close()
+		return nil, ErrPgStatStatementsUnavailable
+	}
+	return db, nil
+}
+
+// queryStatsError maps the error raised when pg_stat_statements is installed but not preloaded
+// (object_not_in_prerequisite_state) to ErrPgStatStatementsUnavailable.
+func queryStatsError(action string, err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "55000" {
+		return ErrPgStatStatementsUnavailable
+	}
+	return fmt.Errorf("failed to %s: %w", action, err)
+}
+
+// GetQueryStats returns the pg_stat_statements totals of dbName and its top limit statements, ordered by
+// orderBy (see ValidQueryStatsOrder) descending. The counters are cumulative since the last reset.
+func GetQueryStats(pgAdminDSN, dbName, orderBy string, limit int) (*models.QueryStatsSnapshot, error) {
+	column, ok := queryStatsOrders[orderBy]
+	if !ok {
+		return nil, fmt.Errorf("invalid query statistics order '%s'", orderBy)
+	}
+	db, err := connectToQueryStatsDB(pgAdminDSN, dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	// The view covers the whole cluster; dbid restricts it to this database.
+	const inDatabase = `dbid = (SELECT oid FROM pg_database WHERE datname = current_database())`
+	stats := &models.QueryStatsSnapshot{CapturedAt: time.Now(), Queries: []models.QueryStatsEntry{}}
+	err = db.QueryRow(`SELECT count(*), COALESCE(sum(calls), 0)::bigint, COALESCE(sum(total_exec_time), 0)::float8, COALESCE(sum(rows), 0)::bigint
+		FROM pg_stat_statements WHERE `+inDatabase).Scan(&stats.QueryCount, &stats.Calls, &stats.TotalTimeMS, &stats.Rows)
+	if err != nil {
+		return nil, queryStatsError("query pg_stat_statements totals", err)
+	}
+
+	rows, err := db.Query(`SELECT s.queryid, COALESCE(r.rolname, ''), COALESCE(s.query, ''), s.calls, s.total_exec_time, s.rows, s.mean_exec_time
+		FROM pg_stat_statements s LEFT JOIN pg_roles r ON r.oid = s.userid
+		WHERE s.`+inDatabase+` AND s.queryid IS NOT NULL
+		ORDER BY s.`+column+` DESC, s.queryid LIMIT $1`, limit)
+	if err != nil {
+		return nil, queryStatsError("query pg_stat_statements", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e models.QueryStatsEntry
+		if err := rows.Scan(&e.QueryID, &e.PGUsername, &e.Query, &e.Calls, &e.TotalTimeMS, &e.Rows, &e.MeanTimeMS); err != nil {
+			return nil, fmt.Errorf("failed to scan query statistics: %w", err)
+		}
+		stats.Queries = append(stats.Queries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate query statistics: %w", err)
+	}
+	return stats, nil
+}
+
+// ResetQueryStats discards the pg_stat_statements counters of dbName, leaving other databases untouched.
+func ResetQueryStats(pgAdminDSN, dbName string) error {
+	db, err := connectToQueryStatsDB(pgAdminDSN, dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// 0 matches every role and every statement.
+	if _, err := db.Exec("SELECT pg_stat_statements_reset(0, oid, 0) FROM pg_database WHERE datname = current_database()"); err != nil {
+		return queryStatsError("reset pg_stat_statements", err)
+	}
+	return nil
+}
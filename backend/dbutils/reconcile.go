@@ -0,0 +1,342 @@
+package dbutils
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"pgweb-backend/models"
+
+	"github.com/google/uuid"
+	pq "github.com/lib/pq"
+)
+
+// CatalogRole is a role as seen in pg_roles.
+type CatalogRole struct {
+	CanLogin  bool
+	Superuser bool
+}
+
+// ClusterCatalog is a snapshot of the parts of the PostgreSQL catalog the application manages.
+type ClusterCatalog struct {
+	Databases       map[string]bool            // Non-template databases from pg_database
+	Roles           map[string]CatalogRole     // From pg_roles
+	Members         map[string]map[string]bool // Role name -> names of its direct members (pg_auth_members)
+	ConnectGrantees map[string]map[string]bool // Database name -> roles granted CONNECT directly
+}
+
+// ManagedDatabaseState is what the application database records for one managed database.
+type ManagedDatabaseState struct {
+	Database       models.ManagedDatabase
+	PGUsers        []models.ManagedPGUser
+	PermissionSets []models.PermissionSet
+	Assignments    map[uuid.UUID][]string // PG user ID -> assigned permission set names
+}
+
+// LoadClusterCatalog reads databases, roles, role memberships and CONNECT grants from the cluster.
+func LoadClusterCatalog(pgAdminDSN string) (*ClusterCatalog, error) {
+	db, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to admin database for catalog snapshot: %w", err)
+	}
+	defer db.Close()
+
+	catalog := &ClusterCatalog{
+		Databases:       make(map[string]bool),
+		Roles:           make(map[string]CatalogRole),
+		Members:         make(map[string]map[string]bool),
+		ConnectGrantees: make(map[string]map[string]bool),
+	}
+
+	rows, err := db.Query("SELECT datname FROM pg_database WHERE NOT datistemplate")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan database row: %w", err)
+		}
+		catalog.Databases[name] = true
+	}
+	rows.Close()
+
+	rows, err = db.Query("SELECT rolname, rolcanlogin, rolsuper FROM pg_roles")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		var role CatalogRole
+		if err := rows.Scan(&name, &role.CanLogin, &role.Superuser); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan role row: %w", err)
+		}
+		catalog.Roles[name] = role
+	}
+	rows.Close()
+
+	rows, err = db.Query(`SELECT r.rolname, m.rolname FROM pg_auth_members am
+		JOIN pg_roles r ON r.oid = am.roleid
+		JOIN pg_roles m ON m.oid = am.member`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list role memberships: %w", err)
+	}
+	for rows.Next() {
+		var role, member string
+		if err := rows.Scan(&role, &member); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan role membership row: %w", err)
+		}
+		if catalog.Members[role] == nil {
+			catalog.Members[role] = make(map[string]bool)
+		}
+		catalog.Members[role][member] = true
+	}
+	rows.Close()
+
+	rows, err = db.Query(`SELECT d.datname, r.rolname FROM pg_database d
+		CROSS JOIN LATERAL aclexplode(d.datacl) a
+		JOIN pg_roles r ON r.oid = a.grantee
+		WHERE a.privilege_type = 'CONNECT' AND NOT d.datistemplate`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list CONNECT grants: %w", err)
+	}
+	for rows.Next() {
+		var dbName, role string
+		if err := rows.Scan(&dbName, &role); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan CONNECT grant row: %w", err)
+		}
+		if catalog.ConnectGrantees[dbName] == nil {
+			catalog.ConnectGrantees[dbName] = make(map[string]bool)
+		}
+		catalog.ConnectGrantees[dbName][role] = true
+	}
+	rows.Close()
+
+	return catalog, nil
+}
+
+// FindCatalogDrift compares the application's records with the catalog and returns the differences.
+// Databases named in ignoreDatabases (and "postgres") are never reported as orphans.
+func FindCatalogDrift(catalog *ClusterCatalog, states []ManagedDatabaseState, ignoreDatabases map[string]bool) []models.ReconciliationFinding {
+	var findings []models.ReconciliationFinding
+	managedNames := make(map[string]bool)
+	recordedSetRoles := make(map[string]bool) // Permission set roles of every managed database
+	for _, state := range states {
+		for _, ps := range state.PermissionSets {
+			recordedSetRoles[ps.PGRoleName] = true
+		}
+	}
+
+	for i := range states {
+		state := &states[i]
+		dbName := state.Database.PGDatabaseName
+		dbID := state.Database.DatabaseID
+		managedNames[dbName] = true
+		readRole, writeRole := dbName+"_read", dbName+"_write"
+
+		managedLogins := make(map[string]bool)
+		for _, u := range state.PGUsers {
+			managedLogins[u.PGUsername] = true
+		}
+
+		switch state.Database.Status {
+		case "active":
+			if !catalog.Databases[dbName] {
+				findings = append(findings, models.ReconciliationFinding{
+					Kind: "missing_database", DatabaseName: dbName, DatabaseID: &dbID,
+					Detail: "managed database does not exist in the cluster",
+				})
+				continue
+			}
+			for _, role := range []string{readRole, writeRole} {
+				if _, ok := catalog.Roles[role]; !ok {
+					findings = append(findings, models.ReconciliationFinding{
+						Kind: "missing_role", DatabaseName: dbName, RoleName: role, DatabaseID: &dbID,
+						Detail: "database role does not exist", Repairable: true,
+					})
+				}
+			}
+
+			setRoles := make(map[string]string) // Permission set name -> role name
+			for _, ps := range state.PermissionSets {
+				setRoles[ps.Name] = ps.PGRoleName
+				if _, ok := catalog.Roles[ps.PGRoleName]; !ok {
+					findings = append(findings, models.ReconciliationFinding{
+						Kind: "missing_role", DatabaseName: dbName, RoleName: ps.PGRoleName, DatabaseID: &dbID,
+						Detail: fmt.Sprintf("role of permission set %q does not exist", ps.Name), Repairable: true,
+					})
+				}
+			}
+
+			for _, u := range state.PGUsers {
+				if u.Status != "active" {
+					continue
+				}
+				pgUserID := u.PGUserID
+				if _, ok := catalog.Roles[u.PGUsername]; !ok {
+					findings = append(findings, models.ReconciliationFinding{
+						Kind: "missing_role", DatabaseName: dbName, RoleName: u.PGUsername, DatabaseID: &dbID, PGUserID: &pgUserID,
+						Detail: "login role of managed PG user does not exist; recreate or delete the PG user",
+					})
+					continue
+				}
+				expected := []string{}
+				switch u.PermissionLevel {
+				case "read":
+					expected = append(expected, readRole)
+				case "write":
+					expected = append(expected, writeRole)
+				}
+				for _, setName := range state.Assignments[u.PGUserID] {
+					if role, ok := setRoles[setName]; ok {
+						expected = append(expected, role)
+					}
+				}
+				for _, role := range expected {
+					if _, ok := catalog.Roles[role]; ok && !catalog.Members[role][u.PGUsername] {
+						findings = append(findings, models.ReconciliationFinding{
+							Kind: "missing_membership", DatabaseName: dbName, RoleName: role, DatabaseID: &dbID, PGUserID: &pgUserID,
+							Detail: fmt.Sprintf("%s is not a member of %s", u.PGUsername, role), Repairable: true,
+						})
+					}
+				}
+			}
+
+			// Permission set roles without a record, e.g. left behind by a failed deletion. Another managed
+			// database's name may start with "<db>_ps_", so roles recorded for, or named after, another
+			// database are skipped. These are only reported: dropping a role by its name alone is unsafe.
+			for _, role := range sortedKeys(catalog.Roles) {
+				setName, ok := strings.CutPrefix(role, PermissionSetRoleName(dbName, ""))
+				if !ok || !ValidPermissionSetName(setName) || recordedSetRoles[role] || permissionSetRoleOwner(role, states) != dbName {
+					continue
+				}
+				findings = append(findings, models.ReconciliationFinding{
+					Kind: "orphan_role", DatabaseName: dbName, RoleName: role, DatabaseID: &dbID,
+					Detail: "permission set role has no permission set record",
+				})
+			}
+
+			// Login roles that were given access to this database outside the application.
+			for _, role := range []string{readRole, writeRole} {
+				for _, member := range sortedKeys(catalog.Members[role]) {
+					if r := catalog.Roles[member]; r.CanLogin && !r.Superuser && !managedLogins[member] {
+						findings = append(findings, models.ReconciliationFinding{
+							Kind: "orphan_login_role", DatabaseName: dbName, RoleName: member, DatabaseID: &dbID,
+							Detail: fmt.Sprintf("login role is a member of %s but is not a managed PG user", role),
+						})
+					}
+				}
+			}
+
+		case "soft_deleted":
+			if !catalog.Databases[dbName] {
+				continue
+			}
+			for _, u := range state.PGUsers {
+				pgUserID := u.PGUserID
+				if catalog.ConnectGrantees[dbName][u.PGUsername] || catalog.Members[readRole][u.PGUsername] || catalog.Members[writeRole][u.PGUsername] {
+					findings = append(findings, models.ReconciliationFinding{
+						Kind: "stale_access", DatabaseName: dbName, RoleName: u.PGUsername, DatabaseID: &dbID, PGUserID: &pgUserID,
+						Detail: "PG user of a soft-deleted database still has CONNECT or role membership", Repairable: true,
+					})
+				}
+			}
+		}
+	}
+
+	for _, dbName := range sortedKeys(catalog.Databases) {
+		if managedNames[dbName] || ignoreDatabases[dbName] || dbName == "postgres" {
+			continue
+		}
+		findings = append(findings, models.ReconciliationFinding{
+			Kind: "orphan_database", DatabaseName: dbName,
+			Detail: "database exists in the cluster but is not managed",
+		})
+	}
+	return findings
+}
+
+// permissionSetRoleOwner returns the name of the managed database whose permission set role prefix
+// (<db>_ps_) is the longest match for role, or "" if there is none.
+func permissionSetRoleOwner(role string, states []ManagedDatabaseState) string {
+	owner := ""
+	for _, state := range states {
+		name := state.Database.PGDatabaseName
+		if strings.HasPrefix(role, PermissionSetRoleName(name, "")) && len(name) > len(owner) {
+			owner = name
+		}
+	}
+	return owner
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// EnsureDatabaseRoles creates the read and write roles of a database if they are missing and
+// (re)applies the grants CreatePostgresDatabase sets up, for public and the given schemas.
+// All statements are idempotent, so it is safe to run on a correctly configured database.
+func EnsureDatabaseRoles(pgAdminDSN, dbName string, schemas []string) error {
+	safeDBName, err := sanitizeIdentifier(dbName)
+	if err != nil {
+		return fmt.Errorf("invalid database name '%s': %w", dbName, err)
+	}
+	db, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, safeDBName))
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database %s to ensure roles: %w", safeDBName, err)
+	}
+	defer db.Close()
+
+	if err := createDatabaseRoles(db, safeDBName); err != nil {
+		return err
+	}
+	if err := grantDatabasePrivileges(db, safeDBName); err != nil {
+		return err
+	}
+	readRole, writeRole := safeDBName+"_read", safeDBName+"_write"
+	for _, schema := range append([]string{"public"}, schemas...) {
+		safeSchema, err := sanitizeIdentifier(schema)
+		if err != nil {
+			return fmt.Errorf("invalid schema name '%s': %w", schema, err)
+		}
+		if err := configureSchemaPrivileges(db, safeSchema, readRole, writeRole); err != nil {
+			return err
+		}
+	}
+	log.Printf("Roles and grants ensured for database %s.", safeDBName)
+	return nil
+}
+
+// GrantRoleToUser grants membership in a database role (read, write or permission set role) to a PG user.
+func GrantRoleToUser(pgAdminDSN, dbName, roleName, pgUserName string) error {
+	safeRoleName, err := sanitizeIdentifier(roleName)
+	if err != nil {
+		return fmt.Errorf("invalid role name '%s': %w", roleName, err)
+	}
+	safePgUserName, err := sanitizeIdentifier(pgUserName)
+	if err != nil {
+		return fmt.Errorf("invalid PostgreSQL username '%s': %w", pgUserName, err)
+	}
+
+	db, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, dbName))
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database %s to grant role: %w", dbName, err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(safeRoleName), pq.QuoteIdentifier(safePgUserName))); err != nil {
+		return fmt.Errorf("failed to grant role %s to user %s: %w", safeRoleName, safePgUserName, err)
+	}
+	log.Printf("Role %s granted to user %s.", safeRoleName, safePgUserName)
+	return nil
+}
@@ -0,0 +1,85 @@
+package dbutils
+
+import (
+	"testing"
+
+	"pgweb-backend/models"
+
+	"github.com/google/uuid"
+)
+
+func TestFindCatalogDrift(t *testing.T) {
+	activeID, deletedID := uuid.New(), uuid.New()
+	alice, bob := uuid.New(), uuid.New()
+	states := []ManagedDatabaseState{
+		{
+			Database: models.ManagedDatabase{DatabaseID: activeID, PGDatabaseName: "app", Status: "active"},
+			PGUsers: []models.ManagedPGUser{
+				{PGUserID: alice, PGUsername: "alice", PermissionLevel: "write", Status: "active"},
+				{PGUserID: bob, PGUsername: "bob", PermissionLevel: "read", Status: "active"},
+			},
+		},
+		{
+			Database: models.ManagedDatabase{DatabaseID: deletedID, PGDatabaseName: "old", Status: "soft_deleted"},
+			PGUsers:  []models.ManagedPGUser{{PGUserID: uuid.New(), PGUsername: "carol", PermissionLevel: "read", Status: "active"}},
+		},
+		{
+			Database: models.ManagedDatabase{DatabaseID: uuid.New(), PGDatabaseName: "gone", Status: "active"},
+		},
+		{
+			// Its permission set roles start with "app_ps_" but belong to this database.
+			Database:       models.ManagedDatabase{DatabaseID: uuid.New(), PGDatabaseName: "app_ps_x", Status: "soft_deleted"},
+			PermissionSets: []models.PermissionSet{{Name: "sales", PGRoleName: "app_ps_x_ps_sales"}},
+		},
+	}
+	catalog := &ClusterCatalog{
+		Databases: map[string]bool{"app": true, "old": true, "postgres": true, "pgweb": true, "stray": true},
+		Roles: map[string]CatalogRole{
+			"app_write":         {},
+			"app_ps_tmp":        {},
+			"app_ps_z":          {}, // Not a valid permission set name
+			"app_ps_x_ps_sales": {},
+			"app_ps_x_ps_lost":  {},
+			"alice":             {CanLogin: true},
+			"mallory":           {CanLogin: true},
+			"carol":             {CanLogin: true},
+			"old_read":          {},
+			"postgres":          {CanLogin: true, Superuser: true},
+		},
+		Members: map[string]map[string]bool{
+			"app_write": {"mallory": true, "postgres": true},
+			"old_read":  {"carol": true},
+		},
+		ConnectGrantees: map[string]map[string]bool{},
+	}
+
+	findings := FindCatalogDrift(catalog, states, map[string]bool{"pgweb": true})
+
+	expected := map[string]string{ // kind/role or database -> expected repairability
+		"missing_role/app_read":        "repairable",
+		"missing_role/bob":             "report",
+		"missing_membership/app_write": "repairable",
+		"orphan_role/app_ps_tmp":       "report",
+		"orphan_login_role/mallory":    "report",
+		"stale_access/carol":           "repairable",
+		"missing_database/gone":        "report",
+		"orphan_database/stray":        "report",
+	}
+	if len(findings) != len(expected) {
+		t.Errorf("got %d findings, want %d: %+v", len(findings), len(expected), findings)
+	}
+	for _, f := range findings {
+		key := f.Kind + "/" + f.RoleName
+		if f.RoleName == "" {
+			key = f.Kind + "/" + f.DatabaseName
+		}
+		want, ok := expected[key]
+		if !ok {
+			t.Errorf("unexpected finding %s: %+v", key, f)
+			continue
+		}
+		if f.Repairable != (want == "repairable") {
+			t.Errorf("finding %s: Repairable = %t, want %s", key, f.Repairable, want)
+		}
+	}
+}
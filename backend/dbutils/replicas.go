@@ -0,0 +1,53 @@
+package dbutils
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// ReplicaStatus is the replication state of a standby as seen from the primary in pg_stat_replication.
+// The standby's address is not included, as the status is shown to every database owner.
+type ReplicaStatus struct {
+	ApplicationName  string   `json:"application_name"`
+	State            string   `json:"state"`              // e.g. "streaming", "catchup"
+	SyncState        string   `json:"sync_state"`         // "async", "potential", "sync" or "quorum"
+	ReplayLagSeconds *float64 `json:"replay_lag_seconds"` // Null when the standby has caught up and no WAL was written since
+	ReplayLagBytes   int64    `json:"replay_lag_bytes"`   // WAL written on the primary but not yet replayed
+}
+
+// GetReplicaStatuses returns the physical standbys streaming from the primary behind pgAdminDSN.
+// Logical replication senders are left out: they serve subscriptions of individual databases.
+func GetReplicaStatuses(pgAdminDSN string) ([]ReplicaStatus, error) {
+	db, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT r.application_name, r.state, r.sync_state,
+		EXTRACT(EPOCH FROM r.replay_lag)::float8, COALESCE(pg_wal_lsn_diff(pg_current_wal_lsn(), r.replay_lsn), 0)::bigint
+		FROM pg_stat_replication r
+		WHERE NOT EXISTS (SELECT 1 FROM pg_replication_slots s WHERE s.active_pid = r.pid AND s.slot_type = 'logical')
+		ORDER BY r.application_name, r.pid`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pg_stat_replication: %w", err)
+	}
+	defer rows.Close()
+
+	statuses := []ReplicaStatus{}
+	for rows.Next() {
+		var s ReplicaStatus
+		var lag sql.NullFloat64
+		if err := rows.Scan(&s.ApplicationName, &s.State, &s.SyncState, &lag, &s.ReplayLagBytes); err != nil {
+			return nil, fmt.Errorf("failed to scan replica status: %w", err)
+		}
+		if lag.Valid {
+			s.ReplayLagSeconds = &lag.Float64
+		}
+		statuses = append(statuses, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate replica statuses: %w", err)
+	}
+	return statuses, nil
+}
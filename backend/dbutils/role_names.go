@@ -0,0 +1,74 @@
+package dbutils
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	pq "github.com/lib/pq"
+)
+
+// roleNamespaceSeparator separates the database name from the display name in a login role name.
+// Database roles use a single underscore ("<db>_read", "<db>_ps_<set>"). Names cannot collide as long
+// as database and permission set names never contain "__" and display names never end like a database
+// role ("_read", "_write", "_ps_<set>"); see ReservedRoleSuffix.
+const roleNamespaceSeparator = "__"
+
+// NamespacedRoleName returns the cluster-wide login role name of a PG user, e.g. "shop__app" for
+// the user "app" of the database "shop". Callers must check the result fits in 63 characters.
+func NamespacedRoleName(dbName, displayName string) string {
+	return dbName + roleNamespaceSeparator + displayName
+}
+
+// ReservedRoleSuffix reports whether a display name ends like the name of a database role, so that its
+// login role could be mistaken for a database role of a database named like its own.
+func ReservedRoleSuffix(displayName string) bool {
+	return strings.HasSuffix(displayName, "_read") || strings.HasSuffix(displayName, "_write") || strings.Contains(displayName, "_ps_")
+}
+
+// PostgresRoleExists reports whether a role with the given name exists anywhere in the cluster.
+func PostgresRoleExists(pgAdminDSN, roleName string) (bool, error) {
+	db, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer db.Close()
+
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM pg_roles WHERE rolname = $1)", roleName).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check if role %s exists: %w", roleName, err)
+	}
+	return exists, nil
+}
+
+// RenamePostgresUser renames a login role. Memberships, grants, per-database settings and owned objects
+// follow the role. PostgreSQL clears MD5 passwords on rename, since the role name is their salt; it
+// reports passwordCleared if the password was MD5 or its type could not be read, so the caller can set a new one.
+func RenamePostgresUser(pgAdminDSN, oldName, newName string) (passwordCleared bool, err error) {
+	safeOldName, err := sanitizeIdentifier(oldName)
+	if err != nil {
+		return false, fmt.Errorf("invalid PostgreSQL username '%s': %w", oldName, err)
+	}
+	safeNewName, err := sanitizeIdentifier(newName)
+	if err != nil {
+		return false, fmt.Errorf("invalid PostgreSQL username '%s': %w", newName, err)
+	}
+	db, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer db.Close()
+
+	// Reading pg_authid needs superuser; without it, assume the password is lost.
+	passwordCleared = true
+	if err := db.QueryRow("SELECT COALESCE(rolpassword LIKE 'md5%', false) FROM pg_authid WHERE rolname = $1", safeOldName).Scan(&passwordCleared); err != nil {
+		log.Printf("Warning: could not read password type of role %s, assuming it is cleared by the rename: %v", safeOldName, err)
+		passwordCleared = true
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER ROLE %s RENAME TO %s", pq.QuoteIdentifier(safeOldName), pq.QuoteIdentifier(safeNewName))); err != nil {
+		return false, fmt.Errorf("failed to rename role %s to %s: %w", safeOldName, safeNewName, err)
+	}
+	log.Printf("Role %s renamed to %s.", safeOldName, safeNewName)
+	return passwordCleared, nil
+}
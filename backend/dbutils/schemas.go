@@ -0,0 +1,173 @@
+package dbutils
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	pq "github.com/lib/pq"
+)
+
+// configureSchemaPrivileges grants the read and write roles of a database access to a schema
+// and sets default privileges so objects created later by the write role are readable.
+// This is applied to public on database creation and to every schema created via CreateDatabaseSchema.
+func configureSchemaPrivileges(db *sql.DB, schema, readRole, writeRole string) error {
+	qSchema := pq.QuoteIdentifier(schema)
+	qRead := pq.QuoteIdentifier(readRole)
+	qWrite := pq.QuoteIdentifier(writeRole)
+
+	// Grant basic USAGE on the schema to both roles.
+	if _, err := db.Exec(fmt.Sprintf("GRANT USAGE ON SCHEMA %s TO %s, %s", qSchema, qRead, qWrite)); err != nil {
+		return fmt.Errorf("failed to grant USAGE on %s schema to roles: %w", schema, err)
+	}
+
+	// Grant CREATE permission on the schema to the write role, so it can create tables.
+	if _, err := db.Exec(fmt.Sprintf("GRANT CREATE ON SCHEMA %s TO %s", qSchema, qWrite)); err != nil {
+		return fmt.Errorf("failed to grant CREATE on %s schema to write role %s: %w", schema, writeRole, err)
+	}
+
+	// Grant privileges on existing objects.
+	if _, err := db.Exec(fmt.Sprintf("GRANT SELECT ON ALL TABLES IN SCHEMA %s TO %s", qSchema, qRead)); err != nil {
+		return fmt.Errorf("failed to grant SELECT on existing %s tables to read role %s: %w", schema, readRole, err)
+	}
+	if _, err := db.Exec(fmt.Sprintf("GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA %s TO %s", qSchema, qRead)); err != nil {
+		return fmt.Errorf("failed to grant SELECT on existing %s sequences to read role %s: %w", schema, readRole, err)
+	}
+	if _, err := db.Exec(fmt.Sprintf("GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA %s TO %s", qSchema, qWrite)); err != nil {
+		return fmt.Errorf("failed to grant ALL on existing %s tables to write role %s: %w", schema, writeRole, err)
+	}
+	if _, err := db.Exec(fmt.Sprintf("GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA %s TO %s", qSchema, qWrite)); err != nil {
+		return fmt.Errorf("failed to grant ALL on existing %s sequences to write role %s: %w", schema, writeRole, err)
+	}
+
+	// --- Default Privileges for Future Objects ---
+	// Setting default privileges FOR ROLE requires temporary membership in the write role.
+	return withRoleMembership(db, writeRole, func() error {
+		// For objects created by writeRole, grant SELECT to PUBLIC.
+		// This is safe because only authenticated roles can connect to the database.
+		if _, err := db.Exec(fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA %s GRANT SELECT ON TABLES TO PUBLIC", qWrite, qSchema)); err != nil {
+			return fmt.Errorf("failed to set default SELECT on %s tables for PUBLIC: %w", schema, err)
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA %s GRANT SELECT ON SEQUENCES TO PUBLIC", qWrite, qSchema)); err != nil {
+			return fmt.Errorf("failed to set default SELECT on %s sequences for PUBLIC: %w", schema, err)
+		}
+
+		// Grant write-level privileges only to the write role.
+		if _, err := db.Exec(fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA %s GRANT INSERT, UPDATE, DELETE, TRUNCATE ON TABLES TO %s", qWrite, qSchema, qWrite)); err != nil {
+			return fmt.Errorf("failed to set default write privileges on %s tables for write role: %w", schema, err)
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA %s GRANT UPDATE ON SEQUENCES TO %s", qWrite, qSchema, qWrite)); err != nil {
+			return fmt.Errorf("failed to set default write privileges on %s sequences for write role: %w", schema, err)
+		}
+		return nil
+	})
+}
+
+// CreateDatabaseSchema creates a schema in a managed database and applies the same
+// read/write role privileges that public receives in CreatePostgresDatabase.
+func CreateDatabaseSchema(pgAdminDSN, dbName, schemaName string) error {
+	log.Printf("Attempting to create schema %s in database %s", schemaName, dbName)
+	safeDBName, err := sanitizeIdentifier(dbName)
+	if err != nil {
+		return fmt.Errorf("invalid database name '%s': %w", dbName, err)
+	}
+	safeSchemaName, err := sanitizeIdentifier(schemaName)
+	if err != nil {
+		return fmt.Errorf("invalid schema name '%s': %w", schemaName, err)
+	}
+
+	db, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, safeDBName))
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database %s for schema creation: %w", safeDBName, err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(fmt.Sprintf("CREATE SCHEMA %s", pq.QuoteIdentifier(safeSchemaName))); err != nil {
+		return fmt.Errorf("failed to create schema %s: %w", safeSchemaName, err)
+	}
+
+	if err := configureSchemaPrivileges(db, safeSchemaName, safeDBName+"_read", safeDBName+"_write"); err != nil {
+		log.Printf("Failed to configure privileges on schema %s: %v. Attempting to drop it.", safeSchemaName, err)
+		if _, dropErr := db.Exec(fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", pq.QuoteIdentifier(safeSchemaName))); dropErr != nil {
+			log.Printf("CRITICAL: Failed to configure schema AND failed to drop it: %v. Manual cleanup for schema %s in %s.", dropErr, safeSchemaName, safeDBName)
+		}
+		return err
+	}
+
+	log.Printf("Schema %s created in database %s.", safeSchemaName, safeDBName)
+	return nil
+}
+
+// DropDatabaseSchema drops a schema from a managed database. Without cascade the drop
+// fails if the schema still contains objects.
+func DropDatabaseSchema(pgAdminDSN, dbName, schemaName string, cascade bool) error {
+	log.Printf("Attempting to drop schema %s from database %s (cascade: %t)", schemaName, dbName, cascade)
+	safeDBName, err := sanitizeIdentifier(dbName)
+	if err != nil {
+		return fmt.Errorf("invalid database name '%s': %w", dbName, err)
+	}
+	safeSchemaName, err := sanitizeIdentifier(schemaName)
+	if err != nil {
+		return fmt.Errorf("invalid schema name '%s': %w", schemaName, err)
+	}
+	if safeSchemaName == "public" {
+		return fmt.Errorf("the public schema cannot be dropped")
+	}
+
+	db, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, safeDBName))
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database %s for schema deletion: %w", safeDBName, err)
+	}
+	defer db.Close()
+
+	dropSQL := fmt.Sprintf("DROP SCHEMA IF EXISTS %s", pq.QuoteIdentifier(safeSchemaName))
+	if cascade {
+		dropSQL += " CASCADE"
+	}
+	if _, err := db.Exec(dropSQL); err != nil {
+		return fmt.Errorf("failed to drop schema %s: %w", safeSchemaName, err)
+	}
+
+	log.Printf("Schema %s dropped from database %s.", safeSchemaName, safeDBName)
+	return nil
+}
+
+// SetUserSearchPath sets the search_path of a PostgreSQL user for one database.
+// An empty schema list resets the user to the server default.
+func SetUserSearchPath(pgAdminDSN, dbName, pgUserName string, schemas []string) error {
+	safeDBName, err := sanitizeIdentifier(dbName)
+	if err != nil {
+		return fmt.Errorf("invalid database name '%s': %w", dbName, err)
+	}
+	safePgUserName, err := sanitizeIdentifier(pgUserName)
+	if err != nil {
+		return fmt.Errorf("invalid PostgreSQL username '%s': %w", pgUserName, err)
+	}
+	quoted := make([]string, len(schemas))
+	for i, schema := range schemas {
+		safeSchema, err := sanitizeIdentifier(schema)
+		if err != nil {
+			return fmt.Errorf("invalid schema name '%s': %w", schema, err)
+		}
+		quoted[i] = pq.QuoteIdentifier(safeSchema)
+	}
+
+	db, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, safeDBName))
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database %s to set search_path: %w", safeDBName, err)
+	}
+	defer db.Close()
+
+	var alterSQL string
+	if len(quoted) == 0 {
+		alterSQL = fmt.Sprintf("ALTER ROLE %s IN DATABASE %s RESET search_path", pq.QuoteIdentifier(safePgUserName), pq.QuoteIdentifier(safeDBName))
+	} else {
+		alterSQL = fmt.Sprintf("ALTER ROLE %s IN DATABASE %s SET search_path TO %s", pq.QuoteIdentifier(safePgUserName), pq.QuoteIdentifier(safeDBName), strings.Join(quoted, ", "))
+	}
+	if _, err := db.Exec(alterSQL); err != nil {
+		return fmt.Errorf("failed to set search_path for user %s: %w", safePgUserName, err)
+	}
+	log.Printf("search_path for user %s in database %s set to %v.", safePgUserName, safeDBName, schemas)
+	return nil
+}
@@ -0,0 +1,121 @@
+package dbutils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	pq "github.com/lib/pq"
+)
+
+// Session is a client backend connected to a database, from pg_stat_activity.
+type Session struct {
+	PID                int        `json:"pid"`
+	Username           string     `json:"username"`
+	ApplicationName    string     `json:"application_name"`
+	ClientAddr         string     `json:"client_addr"` // Empty for Unix-socket connections
+	State              string     `json:"state"`       // e.g. "active", "idle", "idle in transaction"
+	Query              string     `json:"query"`       // Current or last query
+	WaitEventType      string     `json:"wait_event_type"`
+	WaitEvent          string     `json:"wait_event"`
+	BackendStart       time.Time  `json:"backend_start"`
+	XactStart          *time.Time `json:"xact_start"`
+	QueryStart         *time.Time `json:"query_start"`
+	ConnectionSeconds  float64    `json:"connection_seconds"`
+	TransactionSeconds *float64   `json:"transaction_seconds"` // Null outside a transaction
+	QuerySeconds       *float64   `json:"query_seconds"`       // Time since the current or last query started
+	StateSeconds       *float64   `json:"state_seconds"`       // Time in the current state
+}
+
+// sessionColumns are the pg_stat_activity columns scanned by scanSession.
+const sessionColumns = `pid, COALESCE(usename, ''), application_name, COALESCE(host(client_addr), ''), COALESCE(state, ''),
+	COALESCE(query, ''), COALESCE(wait_event_type, ''), COALESCE(wait_event, ''), backend_start, xact_start, query_start,
+	EXTRACT(EPOCH FROM now() - backend_start)::float8, EXTRACT(EPOCH FROM now() - xact_start)::float8,
+	EXTRACT(EPOCH FROM now() - query_start)::float8, EXTRACT(EPOCH FROM now() - state_change)::float8`
+
+// scanSession scans the sessionColumns of a row followed by any extra columns.
+func scanSession(rows *sql.Rows, extra ...any) (Session, error) {
+	var s Session
+	var xactStart, queryStart sql.NullTime
+	var xactSeconds, querySeconds, stateSeconds sql.NullFloat64
+	dest := append([]any{&s.PID, &s.Username, &s.ApplicationName, &s.ClientAddr, &s.State, &s.Query, &s.WaitEventType, &s.WaitEvent,
+		&s.BackendStart, &xactStart, &queryStart, &s.ConnectionSeconds, &xactSeconds, &querySeconds, &stateSeconds}, extra...)
+	if err := rows.Scan(dest...); err != nil {
+		return s, fmt.Errorf("failed to scan session: %w", err)
+	}
+	if xactStart.Valid {
+		s.XactStart = &xactStart.Time
+	}
+	if queryStart.Valid {
+		s.QueryStart = &queryStart.Time
+	}
+	if xactSeconds.Valid {
+		s.TransactionSeconds = &xactSeconds.Float64
+	}
+	if querySeconds.Valid {
+		s.QuerySeconds = &querySeconds.Float64
+	}
+	if stateSeconds.Valid {
+		s.StateSeconds = &stateSeconds.Float64
+	}
+	return s, nil
+}
+
+// GetDatabaseSessions returns the client backends connected to dbName, longest-running transactions first.
+func GetDatabaseSessions(pgAdminDSN, dbName string) ([]Session, error) {
+	db, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT `+sessionColumns+` FROM pg_stat_activity
+		WHERE datname = $1 AND backend_type = 'client backend' AND pid <> pg_backend_pid()
+		ORDER BY xact_start NULLS LAST, backend_start`, dbName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pg_stat_activity: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// SignalSession cancels the current query of a backend, or terminates the backend, if it is connected to
+// dbName as one of roles. The check and the signal are a single statement, so a reused PID is never
+// signalled. It returns the backend's role and whether the signal was sent, or sql.ErrNoRows if no such
+// backend exists.
+func SignalSession(pgAdminDSN, dbName string, pid int, roles []string, terminate bool) (string, bool, error) {
+	db, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer db.Close()
+
+	signal := "pg_cancel_backend"
+	if terminate {
+		signal = "pg_terminate_backend"
+	}
+	var role string
+	var sent bool
+	err = db.QueryRow(`SELECT usename, `+signal+`(pid) FROM pg_stat_activity
+		WHERE pid = $1 AND datname = $2 AND usename = ANY($3) AND backend_type = 'client backend'`, pid, dbName, pq.Array(roles)).Scan(&role, &sent)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false, sql.ErrNoRows
+		}
+		return "", false, fmt.Errorf("failed to signal backend %d: %w", pid, err)
+	}
+	return role, sent, nil
+}
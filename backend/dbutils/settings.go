@@ -0,0 +1,121 @@
+package dbutils
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	pq "github.com/lib/pq"
+)
+
+// settingNamePattern matches PostgreSQL setting names, including custom ones like "pg_stat_statements.track".
+var settingNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\.[a-z_][a-z0-9_]*)?$`)
+
+// GetDatabaseSettingOverrides returns the settings configured for all roles of a database with
+// ALTER DATABASE ... SET, as recorded in pg_db_role_setting, keyed by lowercase setting name.
+func GetDatabaseSettingOverrides(pgAdminDSN, dbName string) (map[string]string, error) {
+	db, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer db.Close()
+
+	var config []string
+	err = db.QueryRow(`SELECT COALESCE(s.setconfig, '{}') FROM pg_database d
+		LEFT JOIN pg_db_role_setting s ON s.setdatabase = d.oid AND s.setrole = 0
+		WHERE d.datname = $1`, dbName).Scan(pq.Array(&config))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read settings of database %s: %w", dbName, err)
+	}
+	overrides := make(map[string]string, len(config))
+	for _, entry := range config {
+		if name, value, ok := strings.Cut(entry, "="); ok {
+			overrides[strings.ToLower(name)] = value
+		}
+	}
+	return overrides, nil
+}
+
+// GetServerSettings returns the current value of each named setting on the server, with its unit,
+// keyed by lowercase setting name. Settings the server does not know are omitted.
+func GetServerSettings(pgAdminDSN string, names []string) (map[string]string, error) {
+	db, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT lower(name), current_setting(name) FROM pg_settings WHERE lower(name) = ANY($1)", pq.Array(names))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query server settings: %w", err)
+	}
+	defer rows.Close()
+	settings := make(map[string]string, len(names))
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan server setting: %w", err)
+		}
+		settings[name] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate server settings: %w", err)
+	}
+	return settings, nil
+}
+
+// TimeZoneExists reports whether the server knows a time zone name, e.g. "Europe/Berlin".
+func TimeZoneExists(pgAdminDSN, name string) (bool, error) {
+	db, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer db.Close()
+
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM pg_timezone_names WHERE lower(name) = lower($1))", name).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to look up time zone %s: %w", name, err)
+	}
+	return exists, nil
+}
+
+// ApplyDatabaseSettings sets settings for all sessions of a database via ALTER DATABASE ... SET in a
+// single transaction. A nil value resets the setting to the server default. Values must be validated
+// by the caller; they take effect for new sessions.
+func ApplyDatabaseSettings(pgAdminDSN, dbName string, settings map[string]*string) error {
+	safeDBName, err := sanitizeIdentifier(dbName)
+	if err != nil {
+		return fmt.Errorf("invalid database name '%s': %w", dbName, err)
+	}
+	db, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	qDB := pq.QuoteIdentifier(safeDBName)
+	for name, value := range settings {
+		if !settingNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid setting name '%s'", name)
+		}
+		alterSQL := fmt.Sprintf("ALTER DATABASE %s RESET %s", qDB, name)
+		if value != nil {
+			alterSQL = fmt.Sprintf("ALTER DATABASE %s SET %s = %s", qDB, name, pq.QuoteLiteral(*value))
+		}
+		if _, err := tx.Exec(alterSQL); err != nil {
+			return fmt.Errorf("failed to set %s for database %s: %w", name, safeDBName, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit settings of database %s: %w", safeDBName, err)
+	}
+	log.Printf("Applied %d setting(s) to database %s", len(settings), safeDBName)
+	return nil
+}
@@ -0,0 +1,166 @@
+package dbutils
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"pgweb-backend/models"
+
+	pq "github.com/lib/pq"
+)
+
+// RestrictDatabaseWrites switches a database to read-only for exceeding its storage limit: new
+// transactions default to read-only, the write role loses its write privileges on the public schema
+// and the given managed schemas, the permission set roles lose theirs on the schemas they are granted,
+// and existing sessions of non-superusers are terminated so they
+// reconnect with the read-only default. Table owners can still start a read-write transaction, e.g. to
+// delete data and get back under the limit.
+func RestrictDatabaseWrites(pgAdminDSN, dbName string, schemas []string, sets []models.PermissionSet) error {
+	safeDBName, err := sanitizeIdentifier(dbName)
+	if err != nil {
+		return fmt.Errorf("invalid database name '%s': %w", dbName, err)
+	}
+	adminDB, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer adminDB.Close()
+
+	qDB := pq.QuoteIdentifier(safeDBName)
+	qWrite := pq.QuoteIdentifier(safeDBName + "_write")
+	if _, err := adminDB.Exec(fmt.Sprintf("ALTER DATABASE %s SET default_transaction_read_only = on", qDB)); err != nil {
+		return fmt.Errorf("failed to make database %s read-only: %w", safeDBName, err)
+	}
+	if _, err := adminDB.Exec(fmt.Sprintf("REVOKE CREATE ON DATABASE %s FROM %s", qDB, qWrite)); err != nil {
+		return fmt.Errorf("failed to revoke CREATE on database from write role: %w", err)
+	}
+
+	targetDB, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, safeDBName))
+	if err != nil {
+		return fmt.Errorf("failed to connect to database %s to revoke write privileges: %w", safeDBName, err)
+	}
+	defer targetDB.Close()
+
+	for _, schema := range append([]string{"public"}, schemas...) {
+		safeSchema, err := sanitizeIdentifier(schema)
+		if err != nil {
+			return fmt.Errorf("invalid schema name '%s': %w", schema, err)
+		}
+		qSchema := pq.QuoteIdentifier(safeSchema)
+		statements := []string{
+			fmt.Sprintf("REVOKE CREATE ON SCHEMA %s FROM %s", qSchema, qWrite),
+			fmt.Sprintf("REVOKE INSERT, UPDATE, DELETE, TRUNCATE ON ALL TABLES IN SCHEMA %s FROM %s", qSchema, qWrite),
+			fmt.Sprintf("REVOKE UPDATE ON ALL SEQUENCES IN SCHEMA %s FROM %s", qSchema, qWrite),
+		}
+		for _, stmt := range statements {
+			if _, err := targetDB.Exec(stmt); err != nil {
+				return fmt.Errorf("failed to revoke write privileges on %s schema from write role: %w", safeSchema, err)
+			}
+		}
+	}
+	for _, ps := range sets {
+		if err := restrictPermissionSetWrites(targetDB, ps); err != nil {
+			return err
+		}
+	}
+
+	// The read-only default only applies to new sessions.
+	result, err := adminDB.Exec(`SELECT pg_terminate_backend(a.pid) FROM pg_stat_activity a JOIN pg_roles r ON r.rolname = a.usename
+		WHERE a.datname = $1 AND a.pid <> pg_backend_pid() AND NOT r.rolsuper`, safeDBName)
+	if err != nil {
+		log.Printf("Warning: failed to terminate sessions of read-only database %s: %v", safeDBName, err)
+	} else if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("Terminated %d session(s) of read-only database %s", n, safeDBName)
+	}
+	log.Printf("Database %s switched to read-only.", safeDBName)
+	return nil
+}
+
+// LiftDatabaseWriteRestriction undoes RestrictDatabaseWrites: the read-only default is reset, the
+// write role's privileges on the public schema and the given managed schemas are granted again and
+// the recorded grants of each permission set are applied again.
+func LiftDatabaseWriteRestriction(pgAdminDSN, dbName string, schemas []string, sets []models.PermissionSet) error {
+	safeDBName, err := sanitizeIdentifier(dbName)
+	if err != nil {
+		return fmt.Errorf("invalid database name '%s': %w", dbName, err)
+	}
+	adminDB, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer adminDB.Close()
+
+	if _, err := adminDB.Exec(fmt.Sprintf("ALTER DATABASE %s RESET default_transaction_read_only", pq.QuoteIdentifier(safeDBName))); err != nil {
+		return fmt.Errorf("failed to reset read-only default of database %s: %w", safeDBName, err)
+	}
+	if err := EnsureDatabaseRoles(pgAdminDSN, safeDBName, schemas); err != nil {
+		return err
+	}
+	if len(sets) > 0 {
+		targetDB, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, safeDBName))
+		if err != nil {
+			return fmt.Errorf("failed to connect to database %s to restore permission set grants: %w", safeDBName, err)
+		}
+		defer targetDB.Close()
+		for _, ps := range sets {
+			safeRoleName, err := sanitizeIdentifier(ps.PGRoleName)
+			if err != nil {
+				return fmt.Errorf("invalid permission set role name '%s': %w", ps.PGRoleName, err)
+			}
+			if err := applyPermissionGrants(targetDB, safeDBName, safeRoleName, ps.Grants); err != nil {
+				return fmt.Errorf("failed to restore grants of permission set role %s: %w", safeRoleName, err)
+			}
+		}
+	}
+	log.Printf("Database %s is writable again.", safeDBName)
+	return nil
+}
+
+// RestrictPermissionSetWrites revokes the write privileges of a permission set role, for a set
+// created or recreated while its database is restricted for exceeding its storage limit.
+func RestrictPermissionSetWrites(pgAdminDSN, dbName string, ps models.PermissionSet) error {
+	safeDBName, err := sanitizeIdentifier(dbName)
+	if err != nil {
+		return fmt.Errorf("invalid database name '%s': %w", dbName, err)
+	}
+	targetDB, err := connectToDB(getSpecificDatabaseDSN(pgAdminDSN, safeDBName))
+	if err != nil {
+		return fmt.Errorf("failed to connect to database %s to revoke write privileges: %w", safeDBName, err)
+	}
+	defer targetDB.Close()
+	return restrictPermissionSetWrites(targetDB, ps)
+}
+
+func restrictPermissionSetWrites(db *sql.DB, ps models.PermissionSet) error {
+	safeRoleName, err := sanitizeIdentifier(ps.PGRoleName)
+	if err != nil {
+		return fmt.Errorf("invalid permission set role name '%s': %w", ps.PGRoleName, err)
+	}
+	for _, stmt := range permissionSetRevokeStatements(safeRoleName, ps.Grants) {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to revoke write privileges from permission set role %s: %w", safeRoleName, err)
+		}
+	}
+	return nil
+}
+
+// permissionSetRevokeStatements renders the statements revoking every write privilege a permission
+// set role may hold through its grants. Revoking a table privilege also revokes it on all columns.
+func permissionSetRevokeStatements(roleName string, grants []models.PermissionGrant) []string {
+	role := pq.QuoteIdentifier(roleName)
+	seen := make(map[string]bool)
+	var statements []string
+	for _, g := range grants {
+		if seen[g.Schema] {
+			continue
+		}
+		seen[g.Schema] = true
+		schema := pq.QuoteIdentifier(g.Schema)
+		statements = append(statements,
+			fmt.Sprintf("REVOKE CREATE ON SCHEMA %s FROM %s", schema, role),
+			fmt.Sprintf("REVOKE INSERT, UPDATE, DELETE, TRUNCATE ON ALL TABLES IN SCHEMA %s FROM %s", schema, role),
+		)
+	}
+	return statements
+}
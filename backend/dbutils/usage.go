@@ -0,0 +1,38 @@
+package dbutils
+
+import (
+	"fmt"
+
+	pq "github.com/lib/pq"
+)
+
+// GetDatabaseSizes returns pg_database_size in bytes for each of the named databases that exists.
+func GetDatabaseSizes(pgAdminDSN string, dbNames []string) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	if len(dbNames) == 0 {
+		return sizes, nil
+	}
+	db, err := connectToDB(pgAdminDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT datname, pg_database_size(oid) FROM pg_database WHERE datname = ANY($1)", pq.Array(dbNames))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query database sizes: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var size int64
+		if err := rows.Scan(&name, &size); err != nil {
+			return nil, fmt.Errorf("failed to scan database size: %w", err)
+		}
+		sizes[name] = size
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate database sizes: %w", err)
+	}
+	return sizes, nil
+}
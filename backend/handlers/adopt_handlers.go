@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"pgweb-backend/dbutils"
+	"pgweb-backend/models"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AdoptRoleRequest maps an existing login role to a managed PG user.
+type AdoptRoleRequest struct {
+	PGUsername      string `json:"pg_username" binding:"required"`
+	PermissionLevel string `json:"permission_level" binding:"required,oneof=read write"`
+}
+
+// AdoptDatabaseRequest defines the request body for adopting an existing database.
+type AdoptDatabaseRequest struct {
+	PGDatabaseName      string             `json:"pg_database_name" binding:"required"`
+	OwnerEmail          string             `json:"owner_email" binding:"required"`
+	Roles               []AdoptRoleRequest `json:"roles" binding:"dive"`
+	RevokePublicConnect bool               `json:"revoke_public_connect"` // Revoke CONNECT from PUBLIC like new databases
+}
+
+// AdoptDatabaseResponse is returned after a database has been adopted.
+type AdoptDatabaseResponse struct {
+	Database models.ManagedDatabase `json:"database"`
+	PGUsers  []models.ManagedPGUser `json:"pg_users"`
+}
+
+// AdoptDatabaseHandler handles admin requests to bring an existing, unmanaged database under management.
+func AdoptDatabaseHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+
+	var req AdoptDatabaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+	pgDatabaseName := strings.ToLower(strings.TrimSpace(req.PGDatabaseName))
+	if !isDBNameValid(pgDatabaseName) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid database name. Managed names must be 3-63 chars, alphanumeric, underscores, hyphens, start/end with alphanumeric, no '__', and not use reserved prefixes."})
+		return
+	}
+
+	owner, err := store.GetApplicationUserByEmail(strings.TrimSpace(req.OwnerEmail))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Owner must be an existing user (they need to log in once first)"})
+			return
+		}
+		log.Printf("Error fetching owner %s for adoption of %s: %v", req.OwnerEmail, pgDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve owner"})
+		return
+	}
+
+	exists, err := store.CheckIfPGDatabaseNameExists(pgDatabaseName)
+	if err != nil {
+		log.Printf("Error checking if DB name %s exists: %v", pgDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate database name uniqueness"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Database '%s' is already managed", pgDatabaseName)})
+		return
+	}
+
+	roles := make([]dbutils.AdoptedRole, 0, len(req.Roles))
+	seen := make(map[string]bool)
+	for _, r := range req.Roles {
+		if seen[r.PGUsername] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Role '%s' is listed more than once", r.PGUsername)})
+			return
+		}
+		seen[r.PGUsername] = true
+		managed, err := store.CheckIfPGUsernameManaged(r.PGUsername)
+		if err != nil {
+			log.Printf("Error checking if PG username %s is managed: %v", r.PGUsername, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate roles"})
+			return
+		}
+		if managed {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Role '%s' is already a managed PG user", r.PGUsername)})
+			return
+		}
+		roles = append(roles, dbutils.AdoptedRole{Name: r.PGUsername, PermissionLevel: r.PermissionLevel})
+	}
+
+	pgAdminDSN, ok := requirePGAdminDSN(c, "AdoptDatabaseHandler", "Database adoption")
+	if !ok {
+		return
+	}
+
+	if err := dbutils.AdoptPostgresDatabase(pgAdminDSN, pgDatabaseName, roles, req.RevokePublicConnect); err != nil {
+		log.Printf("Error adopting database %s: %v", pgDatabaseName, err)
+		if errors.Is(err, dbutils.ErrAdoptionTargetNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, dbutils.ErrAdoptionTargetInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adopt database: " + err.Error()})
+		return
+	}
+
+	// Roles and grants are idempotent and data is untouched, so a failure below leaves nothing to roll back
+	// in the cluster; removing the records is enough for the adoption to be retried.
+	managedDB := &models.ManagedDatabase{
+		DatabaseID:     uuid.New(),
+		OwnerUserID:    owner.InternalUserID,
+		PGDatabaseName: pgDatabaseName,
+		Status:         "active",
+	}
+	if err := store.CreateManagedDatabase(managedDB); err != nil {
+		if errors.Is(err, store.ErrDatabaseNameTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Database '%s' is already managed", pgDatabaseName)})
+			return
+		}
+		log.Printf("Error creating ManagedDatabase record for adopted database %s: %v", pgDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save database record"})
+		return
+	}
+
+	pgUsers := make([]models.ManagedPGUser, 0, len(roles))
+	for _, role := range roles {
+		pgUser := &models.ManagedPGUser{
+			PGUserID:          uuid.New(),
+			ManagedDatabaseID: managedDB.DatabaseID,
+			PGUsername:        role.Name,
+			PermissionLevel:   role.PermissionLevel,
+			Status:            "active",
+			PGUserLimits:      models.PGUserLimits{ConnectionLimit: role.ConnectionLimit},
+			PGUserPasswordPolicy: models.PGUserPasswordPolicy{
+				PasswordValidUntil: role.ValidUntil,
+			},
+		}
+		if err := store.CreateManagedPGUser(pgUser); err != nil {
+			log.Printf("Error recording adopted PG user %s for database %s: %v", role.Name, pgDatabaseName, err)
+			log.Printf("Compensating: removing the records of adopted database %s", pgDatabaseName)
+			if delErr := store.DeleteManagedDatabase(managedDB.DatabaseID); delErr != nil {
+				log.Printf("CRITICAL: failed to remove the record of adopted database %s (ID: %s): %v", pgDatabaseName, managedDB.DatabaseID, delErr)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save PG user record for role '%s'; the adoption was rolled back and can be retried", role.Name)})
+			return
+		}
+		annotatePasswordPolicy(pgUser, time.Now())
+		pgUsers = append(pgUsers, *pgUser)
+	}
+
+	log.Printf("Database %s adopted for owner %s by admin %s", pgDatabaseName, owner.InternalUserID, currentUser.InternalUserID)
+	requestPgBouncerSync()
+	store.WriteAuditLog(&currentUser.InternalUserID, "admin.database_adopt", "database", managedDB.DatabaseID.String(), map[string]any{
+		"pg_database_name": pgDatabaseName, "owner_user_id": owner.InternalUserID.String(), "pg_users": len(pgUsers),
+	})
+	c.JSON(http.StatusCreated, AdoptDatabaseResponse{Database: *managedDB, PGUsers: pgUsers})
+}
@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"crypto"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"pgweb-backend/models"
+	"pgweb-backend/pki"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// IssueCertificateRequest defines the optional request body for issuing a client certificate.
+type IssueCertificateRequest struct {
+	ValidityDays int    `json:"validity_days" binding:"min=0"` // 0 uses PGWEB_CLIENT_CERT_VALIDITY_DAYS
+	CSR          string `json:"csr"`                           // Optional PEM CSR; a key is generated if empty
+}
+
+// IssueCertificateResponse is returned once when a certificate is issued.
+// The private key is only included when it was generated by the server, and is never stored.
+type IssueCertificateResponse struct {
+	models.PGUserCertificate
+	CertificatePEM   string `json:"certificate_pem"`
+	PrivateKeyPEM    string `json:"private_key_pem,omitempty"`
+	CACertificatePEM string `json:"ca_certificate_pem"`
+}
+
+// caValidity is the lifetime of the internal CA created on first use.
+const caValidity = 10 * 365 * 24 * time.Hour
+
+// crlValidity is the NextUpdate of generated CRLs.
+const crlValidity = 7 * 24 * time.Hour
+
+var (
+	certificateAuthority   *pki.CA
+	certificateAuthorityMu sync.Mutex
+)
+
+// loadCertificateAuthority returns the internal CA, creating and storing it on first use.
+func loadCertificateAuthority() (*pki.CA, error) {
+	certificateAuthorityMu.Lock()
+	defer certificateAuthorityMu.Unlock()
+	if certificateAuthority != nil {
+		return certificateAuthority, nil
+	}
+
+	certPEM, keyPEM, err := store.GetCertificateAuthority()
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Println("No certificate authority found; creating internal CA")
+		newCertPEM, newKeyPEM, genErr := pki.GenerateCA("pgweb internal CA", caValidity)
+		if genErr != nil {
+			return nil, genErr
+		}
+		if err := store.CreateCertificateAuthorityIfAbsent(newCertPEM, newKeyPEM); err != nil {
+			return nil, err
+		}
+		// Re-read in case another instance created the CA concurrently.
+		certPEM, keyPEM, err = store.GetCertificateAuthority()
+	}
+	if err != nil {
+		return nil, err
+	}
+	ca, err := pki.ParseCA(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	certificateAuthority = ca
+	return ca, nil
+}
+
+// clientCertValidity returns the validity for a new certificate, or an error if it exceeds the maximum.
+func clientCertValidity(requestedDays int) (time.Duration, error) {
+	maxValidity := envDuration("PGWEB_CLIENT_CERT_MAX_VALIDITY_DAYS", 24*time.Hour, 825*24*time.Hour)
+	if requestedDays == 0 {
+		validity := envDuration("PGWEB_CLIENT_CERT_VALIDITY_DAYS", 24*time.Hour, 365*24*time.Hour)
+		if validity > maxValidity {
+			validity = maxValidity
+		}
+		return validity, nil
+	}
+	validity := time.Duration(requestedDays) * 24 * time.Hour
+	if validity > maxValidity {
+		return 0, fmt.Errorf("validity_days must not exceed %d", int(maxValidity/(24*time.Hour)))
+	}
+	return validity, nil
+}
+
+// annotateCertificateStatus fills the computed Status of a certificate.
+func annotateCertificateStatus(cert *models.PGUserCertificate, now time.Time) {
+	warningWindow := envDuration("PGWEB_CLIENT_CERT_EXPIRY_WARNING_DAYS", 24*time.Hour, 30*24*time.Hour)
+	switch {
+	case cert.RevokedAt != nil:
+		cert.Status = "revoked"
+	case !cert.NotAfter.After(now):
+		cert.Status = "expired"
+	case cert.NotAfter.Sub(now) <= warningWindow:
+		cert.Status = "expiring_soon"
+	default:
+		cert.Status = "active"
+	}
+}
+
+// loadPGUserCertificate parses the :certificate_id path parameter and fetches the certificate of pgUserID.
+// On failure it writes the error response and returns false.
+func loadPGUserCertificate(c *gin.Context, pgUserID uuid.UUID) (*models.PGUserCertificate, bool) {
+	certificateID, err := uuid.Parse(c.Param("certificate_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid certificate ID format"})
+		return nil, false
+	}
+	cert, err := store.GetPGUserCertificateByID(certificateID, pgUserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Certificate not found for this PostgreSQL user"})
+			return nil, false
+		}
+		log.Printf("Error fetching certificate %s: %v", certificateID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve certificate"})
+		return nil, false
+	}
+	return cert, true
+}
+
+// IssuePGUserCertificateHandler handles requests to issue a TLS client certificate for a PG user.
+func IssuePGUserCertificateHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	pgUser, ok := loadOwnedPGUser(c, currentUser.InternalUserID, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	if pgUser.Status != "active" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("PostgreSQL user is not in active state (current state: %s)", pgUser.Status)})
+		return
+	}
+
+	// The request body is optional.
+	var req IssueCertificateRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+	validity, err := clientCertValidity(req.ValidityDays)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var publicKey crypto.PublicKey
+	var privateKeyPEM []byte
+	if req.CSR != "" {
+		publicKey, err = pki.ParseCSR([]byte(req.CSR))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	} else {
+		key, keyPEM, err := pki.GenerateKey()
+		if err != nil {
+			log.Printf("Error generating key for PG user %s certificate: %v", pgUser.PGUsername, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate private key"})
+			return
+		}
+		publicKey, privateKeyPEM = key.Public(), keyPEM
+	}
+
+	ca, err := loadCertificateAuthority()
+	if err != nil {
+		log.Printf("Error loading certificate authority: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Certificate authority is not available"})
+		return
+	}
+	issued, err := ca.IssueClientCertificate(pgUser.PGUsername, publicKey, validity)
+	if err != nil {
+		log.Printf("Error issuing certificate for PG user %s: %v", pgUser.PGUsername, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue certificate"})
+		return
+	}
+
+	cert := &models.PGUserCertificate{
+		PGUserID:       pgUser.PGUserID,
+		DatabaseID:     managedDB.DatabaseID,
+		PGUsername:     pgUser.PGUsername,
+		SerialNumber:   issued.SerialNumber,
+		Fingerprint:    issued.Fingerprint,
+		CertificatePEM: string(issued.CertPEM),
+		NotBefore:      issued.NotBefore,
+		NotAfter:       issued.NotAfter,
+	}
+	if err := store.CreatePGUserCertificate(cert); err != nil {
+		log.Printf("Error recording certificate for PG user %s: %v", pgUser.PGUsername, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save certificate record"})
+		return
+	}
+	annotateCertificateStatus(cert, time.Now())
+
+	log.Printf("Client certificate %s issued for PG user %s in DB %s by user %s", cert.SerialNumber, pgUser.PGUsername, managedDB.PGDatabaseName, currentUser.InternalUserID)
+	requestPgHbaSync()
+	store.WriteAuditLog(&currentUser.InternalUserID, "pguser.issue_certificate", "pg_user", pgUser.PGUserID.String(), map[string]string{"pg_username": pgUser.PGUsername, "database_id": managedDB.DatabaseID.String(), "serial_number": cert.SerialNumber})
+
+	c.JSON(http.StatusCreated, IssueCertificateResponse{
+		PGUserCertificate: *cert,
+		CertificatePEM:    cert.CertificatePEM,
+		PrivateKeyPEM:     string(privateKeyPEM),
+		CACertificatePEM:  string(ca.CertPEM),
+	})
+}
+
+// ListPGUserCertificatesHandler handles requests to list the certificates of a PG user with their expiry status.
+func ListPGUserCertificatesHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	pgUser, ok := loadOwnedPGUser(c, currentUser.InternalUserID, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+
+	certs, err := store.GetPGUserCertificates(pgUser.PGUserID)
+	if err != nil {
+		log.Printf("Error listing certificates for PG user %s: %v", pgUser.PGUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve certificates"})
+		return
+	}
+	if certs == nil { // Ensure we return an empty list, not null
+		certs = []models.PGUserCertificate{}
+	}
+	now := time.Now()
+	for i := range certs {
+		annotateCertificateStatus(&certs[i], now)
+	}
+	c.JSON(http.StatusOK, certs)
+}
+
+// DownloadPGUserCertificateHandler serves a certificate followed by the CA certificate as a PEM file.
+func DownloadPGUserCertificateHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	pgUser, ok := loadOwnedPGUser(c, currentUser.InternalUserID, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	cert, ok := loadPGUserCertificate(c, pgUser.PGUserID)
+	if !ok {
+		return
+	}
+	ca, err := loadCertificateAuthority()
+	if err != nil {
+		log.Printf("Error loading certificate authority: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Certificate authority is not available"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.crt"`, sanitizeFilename(pgUser.PGUsername)))
+	c.Data(http.StatusOK, "application/x-pem-file", append([]byte(cert.CertificatePEM), ca.CertPEM...))
+}
+
+// RevokePGUserCertificateHandler handles requests to revoke a certificate. Revoked certificates
+// are listed in the CRL served by GetCRLHandler.
+func RevokePGUserCertificateHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	pgUser, ok := loadOwnedPGUser(c, currentUser.InternalUserID, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	cert, ok := loadPGUserCertificate(c, pgUser.PGUserID)
+	if !ok {
+		return
+	}
+
+	if cert.RevokedAt == nil {
+		now := time.Now()
+		if err := store.RevokePGUserCertificate(cert.CertificateID, now); err != nil {
+			log.Printf("Error revoking certificate %s: %v", cert.CertificateID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke certificate"})
+			return
+		}
+		cert.RevokedAt = &now
+		requestPgHbaSync()
+		log.Printf("Client certificate %s of PG user %s revoked by user %s", cert.SerialNumber, pgUser.PGUsername, currentUser.InternalUserID)
+		store.WriteAuditLog(&currentUser.InternalUserID, "pguser.revoke_certificate", "pg_user", pgUser.PGUserID.String(), map[string]string{"pg_username": pgUser.PGUsername, "database_id": managedDB.DatabaseID.String(), "serial_number": cert.SerialNumber})
+	}
+	annotateCertificateStatus(cert, time.Now())
+	c.JSON(http.StatusOK, cert)
+}
+
+// revokeActivePGUserCertificates revokes every unrevoked certificate of a PG user, so they are
+// listed in the next CRL. It reports whether the user had any.
+func revokeActivePGUserCertificates(pgUserID uuid.UUID, now time.Time) (bool, error) {
+	certificates, err := store.GetPGUserCertificates(pgUserID)
+	if err != nil {
+		return false, err
+	}
+	for _, cert := range certificates {
+		if cert.RevokedAt == nil {
+			return true, store.RevokePGUserCertificates(pgUserID, now)
+		}
+	}
+	return false, nil
+}
+
+// GetPGUserHBALinesHandler returns the pg_hba.conf lines an operator must add so the PG user
+// can log in with its client certificates.
+func GetPGUserHBALinesHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	pgUser, ok := loadOwnedPGUser(c, currentUser.InternalUserID, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"hba_lines": pki.HBACertLines(managedDB.PGDatabaseName, pgUser.PGUsername)})
+}
+
+// GetCACertificateHandler serves the internal CA certificate, to be configured as ssl_ca_file on the server.
+func GetCACertificateHandler(c *gin.Context) {
+	if requireUser(c) == nil {
+		return
+	}
+	ca, err := loadCertificateAuthority()
+	if err != nil {
+		log.Printf("Error loading certificate authority: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Certificate authority is not available"})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="pgweb-ca.crt"`)
+	c.Data(http.StatusOK, "application/x-pem-file", ca.CertPEM)
+}
+
+// GetCRLHandler serves a freshly signed CRL of all revoked, unexpired client certificates,
+// to be configured as ssl_crl_file on the server.
+func GetCRLHandler(c *gin.Context) {
+	if requireUser(c) == nil {
+		return
+	}
+	ca, err := loadCertificateAuthority()
+	if err != nil {
+		log.Printf("Error loading certificate authority: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Certificate authority is not available"})
+		return
+	}
+	revokedCerts, err := store.GetRevokedUnexpiredCertificates(time.Now())
+	if err != nil {
+		log.Printf("Error listing revoked certificates: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve revoked certificates"})
+		return
+	}
+	revoked := make([]pki.RevokedCertificate, len(revokedCerts))
+	for i, cert := range revokedCerts {
+		revoked[i] = pki.RevokedCertificate{SerialNumber: cert.SerialNumber, RevokedAt: *cert.RevokedAt}
+	}
+	crl, err := ca.CreateCRL(revoked, crlValidity)
+	if err != nil {
+		log.Printf("Error creating CRL: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create CRL"})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="pgweb-ca.crl"`)
+	c.Data(http.StatusOK, "application/x-pem-file", crl)
+}
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"pgweb-backend/models"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// passwordPlaceholder stands in for the password in formats that cannot omit it.
+const passwordPlaceholder = "<password>"
+
+// ClusterEndpoint is where clients reach the PostgreSQL cluster.
+type ClusterEndpoint struct {
+	Host    string `json:"host"`
+	Port    int    `json:"port"`
+	SSLMode string `json:"sslmode"`
+}
+
+// ClusterHost is a host and port of a read replica.
+type ClusterHost struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+// ConnectionDetails describes how a PG user connects to its database, rendered in common formats.
+type ConnectionDetails struct {
+	ClusterEndpoint
+	Replicas           []ClusterHost `json:"replicas,omitempty"`             // Tried before the primary, for read users
+	TargetSessionAttrs string        `json:"target_session_attrs,omitempty"` // "prefer-standby" when replicas are listed
+	Database           string        `json:"database"`
+	Username           string        `json:"username"`
+	PasswordIncluded   bool          `json:"password_included"` // Only when the password was just issued
+	URI                string        `json:"uri"`
+	DSN                string        `json:"dsn"` // libpq keyword/value connection string
+	JDBC               string        `json:"jdbc"`
+	PGPass             string        `json:"pgpass"`
+	Env                string        `json:"env"`
+	KubernetesSecret   string        `json:"kubernetes_secret"`
+}
+
+// connectionFormats maps the format query parameter to a field of ConnectionDetails and its content type.
+var connectionFormats = map[string]struct {
+	contentType string
+	render      func(*ConnectionDetails) string
+}{
+	"uri":        {"text/plain; charset=utf-8", func(d *ConnectionDetails) string { return d.URI }},
+	"dsn":        {"text/plain; charset=utf-8", func(d *ConnectionDetails) string { return d.DSN }},
+	"jdbc":       {"text/plain; charset=utf-8", func(d *ConnectionDetails) string { return d.JDBC }},
+	"pgpass":     {"text/plain; charset=utf-8", func(d *ConnectionDetails) string { return d.PGPass }},
+	"env":        {"text/plain; charset=utf-8", func(d *ConnectionDetails) string { return d.Env }},
+	"kubernetes": {"application/yaml; charset=utf-8", func(d *ConnectionDetails) string { return d.KubernetesSecret }},
+}
+
+// dsnEndpoint extracts host, port and sslmode from a URL or keyword/value connection string.
+// Missing values are returned empty or zero.
+func dsnEndpoint(dsn string) ClusterEndpoint {
+	var endpoint ClusterEndpoint
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return endpoint
+		}
+		endpoint.Host = u.Hostname()
+		endpoint.Port, _ = strconv.Atoi(u.Port())
+		endpoint.SSLMode = u.Query().Get("sslmode")
+		return endpoint
+	}
+	for _, field := range strings.Fields(dsn) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, "'")
+		switch key {
+		case "host":
+			endpoint.Host = value
+		case "port":
+			endpoint.Port, _ = strconv.Atoi(value)
+		case "sslmode":
+			endpoint.SSLMode = value
+		}
+	}
+	return endpoint
+}
+
+// publicClusterEndpoint returns the endpoint given to clients: PGWEB_PUBLIC_HOST, PGWEB_PUBLIC_PORT and
+// PGWEB_PUBLIC_SSLMODE, falling back to the values of PG_ADMIN_DSN and then to libpq's defaults.
+func publicClusterEndpoint() ClusterEndpoint {
+	endpoint := dsnEndpoint(os.Getenv("PG_ADMIN_DSN"))
+	if host := os.Getenv("PGWEB_PUBLIC_HOST"); host != "" {
+		endpoint.Host = host
+	}
+	if port, err := strconv.Atoi(os.Getenv("PGWEB_PUBLIC_PORT")); err == nil && port > 0 {
+		endpoint.Port = port
+	}
+	if sslMode := os.Getenv("PGWEB_PUBLIC_SSLMODE"); sslMode != "" {
+		endpoint.SSLMode = sslMode
+	}
+	if endpoint.Host == "" {
+		endpoint.Host = "localhost"
+	}
+	if endpoint.Port == 0 {
+		endpoint.Port = 5432
+	}
+	if endpoint.SSLMode == "" {
+		endpoint.SSLMode = "prefer"
+	}
+	return endpoint
+}
+
+// replicaHosts returns the read replicas listed in PGWEB_REPLICA_ENDPOINTS as comma-separated
+// host[:port] entries. Entries without a port use defaultPort.
+func replicaHosts(defaultPort int) []ClusterHost {
+	var hosts []ClusterHost
+	for _, entry := range strings.Split(os.Getenv("PGWEB_REPLICA_ENDPOINTS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, port := entry, defaultPort
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			n, err := strconv.Atoi(p)
+			if err != nil || n <= 0 {
+				log.Printf("Warning: ignoring replica endpoint '%s' with invalid port", entry)
+				continue
+			}
+			host, port = h, n
+		}
+		hosts = append(hosts, ClusterHost{Host: strings.Trim(host, "[]"), Port: port})
+	}
+	return hosts
+}
+
+// quoteDSNValue quotes a value for a libpq keyword/value connection string.
+func quoteDSNValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// escapePGPassField escapes a field of a .pgpass line.
+func escapePGPassField(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `:`, `\:`).Replace(value)
+}
+
+// quoteShellValue quotes a value for a POSIX shell environment file.
+func quoteShellValue(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// kubernetesName turns a role name into a valid Kubernetes object name.
+func kubernetesName(name string) string {
+	name = strings.Trim(strings.ReplaceAll(strings.ToLower(name), "_", "-"), "-")
+	if len(name) > 253 {
+		name = strings.TrimRight(name[:253], "-")
+	}
+	return name
+}
+
+// buildConnectionDetails renders the connection details of a PG user. password is empty unless it was
+// just issued; without it URI, DSN, JDBC and env omit the password and .pgpass and the Secret use a placeholder.
+// If replicas are given, every rendering lists them before the primary and prefers a standby.
+func buildConnectionDetails(endpoint ClusterEndpoint, replicas []ClusterHost, database, username, password string) *ConnectionDetails {
+	d := &ConnectionDetails{ClusterEndpoint: endpoint, Database: database, Username: username, PasswordIncluded: password != ""}
+	hosts := []ClusterHost{{Host: endpoint.Host, Port: endpoint.Port}}
+	if len(replicas) > 0 {
+		d.Replicas = replicas
+		d.TargetSessionAttrs = "prefer-standby"
+		hosts = append(append([]ClusterHost{}, replicas...), hosts...)
+	}
+	var hostPorts, hostNames, ports []string
+	for _, h := range hosts {
+		hostPorts = append(hostPorts, net.JoinHostPort(h.Host, strconv.Itoa(h.Port)))
+		hostNames = append(hostNames, h.Host)
+		ports = append(ports, strconv.Itoa(h.Port))
+	}
+	hostPort := strings.Join(hostPorts, ",")
+	host, port := strings.Join(hostNames, ","), strings.Join(ports, ",")
+
+	userInfo := url.User(username)
+	if password != "" {
+		userInfo = url.UserPassword(username, password)
+	}
+	uriParams := url.Values{"sslmode": {endpoint.SSLMode}}
+	if d.TargetSessionAttrs != "" {
+		uriParams.Set("target_session_attrs", d.TargetSessionAttrs)
+	}
+	uri := url.URL{Scheme: "postgres", User: userInfo, Host: hostPort, Path: "/" + database, RawQuery: uriParams.Encode()}
+	d.URI = uri.String()
+
+	dsn := []string{
+		"host=" + quoteDSNValue(host), "port=" + quoteDSNValue(port), "dbname=" + quoteDSNValue(database), "user=" + quoteDSNValue(username),
+	}
+	if password != "" {
+		dsn = append(dsn, "password="+quoteDSNValue(password))
+	}
+	dsn = append(dsn, "sslmode="+endpoint.SSLMode)
+	if d.TargetSessionAttrs != "" {
+		dsn = append(dsn, "target_session_attrs="+d.TargetSessionAttrs)
+	}
+	d.DSN = strings.Join(dsn, " ")
+
+	jdbcParams := url.Values{"user": {username}, "sslmode": {endpoint.SSLMode}}
+	if password != "" {
+		jdbcParams.Set("password", password)
+	}
+	if d.TargetSessionAttrs != "" {
+		jdbcParams.Set("targetServerType", "preferSecondary")
+	}
+	d.JDBC = "jdbc:postgresql://" + hostPort + "/" + url.PathEscape(database) + "?" + jdbcParams.Encode()
+
+	pgpassPassword := password
+	if pgpassPassword == "" {
+		pgpassPassword = passwordPlaceholder
+	}
+	for _, h := range hosts {
+		d.PGPass += strings.Join([]string{
+			escapePGPassField(h.Host), strconv.Itoa(h.Port), escapePGPassField(database), escapePGPassField(username), escapePGPassField(pgpassPassword),
+		}, ":") + "\n"
+	}
+
+	env := []string{
+		"PGHOST=" + quoteShellValue(host), "PGPORT=" + quoteShellValue(port), "PGDATABASE=" + quoteShellValue(database), "PGUSER=" + quoteShellValue(username),
+	}
+	if password != "" {
+		env = append(env, "PGPASSWORD="+quoteShellValue(password))
+	}
+	env = append(env, "PGSSLMODE="+quoteShellValue(endpoint.SSLMode))
+	if d.TargetSessionAttrs != "" {
+		env = append(env, "PGTARGETSESSIONATTRS="+quoteShellValue(d.TargetSessionAttrs))
+	}
+	d.Env = strings.Join(env, "\n") + "\n"
+
+	// JSON strings are valid YAML double-quoted scalars, so every value is safely quoted.
+	yamlQuote := func(value string) string {
+		quoted, _ := json.Marshal(value)
+		return string(quoted)
+	}
+	var secret strings.Builder
+	secret.WriteString("apiVersion: v1\nkind: Secret\nmetadata:\n")
+	secret.WriteString("  name: " + yamlQuote(kubernetesName(username)) + "\n")
+	secret.WriteString("type: Opaque\nstringData:\n")
+	for _, kv := range [][2]string{
+		{"host", host}, {"port", port}, {"dbname", database}, {"username", username}, {"password", pgpassPassword},
+		{"sslmode", endpoint.SSLMode}, {"uri", d.URI}, {"jdbc-uri", d.JDBC}, {"pgpass", d.PGPass},
+	} {
+		secret.WriteString("  " + kv[0] + ": " + yamlQuote(kv[1]) + "\n")
+	}
+	d.KubernetesSecret = secret.String()
+	return d
+}
+
+// pgUserConnectionDetails renders the connection details of a PG user on the public cluster endpoint.
+// Read users prefer the configured replicas and fall back to the primary.
+func pgUserConnectionDetails(managedDB *models.DatabaseWithOwner, pgUser *models.ManagedPGUser, password string) *ConnectionDetails {
+	endpoint := publicClusterEndpoint()
+	var replicas []ClusterHost
+	if pgUser.PermissionLevel == "read" {
+		replicas = replicaHosts(endpoint.Port)
+	}
+	return buildConnectionDetails(endpoint, replicas, managedDB.PGDatabaseName, pgUser.PGUsername, password)
+}
+
+// GetPGUserConnectionHandler handles requests for the connection details of a PG user.
+// The password is only included when the event_id of a rotation whose password has not been
+// fetched yet is given; that claims the password like the event secret endpoint does.
+// With format=uri|dsn|jdbc|pgpass|env|kubernetes only that rendering is returned, as plain text.
+func GetPGUserConnectionHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	pgUser, ok := loadOwnedPGUser(c, currentUser.InternalUserID, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	format := c.Query("format")
+	renderer, known := connectionFormats[format]
+	if format != "" && !known {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown format '%s'; use uri, dsn, jdbc, pgpass, env or kubernetes", format)})
+		return
+	}
+	if managedDB.Status != "active" || pgUser.Status != "active" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Database and PostgreSQL user must be active (current states: %s, %s)", managedDB.Status, pgUser.Status)})
+		return
+	}
+
+	var password string
+	if eventIDStr := c.Query("event_id"); eventIDStr != "" {
+		eventID, err := uuid.Parse(eventIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID format"})
+			return
+		}
+		password, err = store.ClaimPGUserEventSecret(eventID, pgUser.PGUserID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "No secret available for this event; it was already fetched or has expired"})
+				return
+			}
+			log.Printf("Error fetching secret of event %s for PG user %s: %v", eventID, pgUser.PGUserID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve secret"})
+			return
+		}
+		store.WriteAuditLog(&currentUser.InternalUserID, "pguser.fetch_rotated_password", "pg_user", pgUser.PGUserID.String(), map[string]string{"pg_username": pgUser.PGUsername, "event_id": eventID.String()})
+	}
+
+	details := pgUserConnectionDetails(managedDB, pgUser, password)
+	if known {
+		c.Data(http.StatusOK, renderer.contentType, []byte(renderer.render(details)))
+		return
+	}
+	c.JSON(http.StatusOK, details)
+}
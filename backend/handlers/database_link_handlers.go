@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"pgweb-backend/dbutils"
+	"pgweb-backend/models"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CreateDatabaseLinkRequest defines the request body for linking a schema of another database into a database.
+type CreateDatabaseLinkRequest struct {
+	SourceDatabaseID string   `json:"source_database_id" binding:"required"`
+	RemoteSchema     string   `json:"remote_schema"` // Defaults to public
+	LocalSchema      string   `json:"local_schema"`  // Defaults to the source database name
+	Tables           []string `json:"tables"`        // Empty imports every table of the remote schema
+}
+
+// defaultLinkLocalSchema derives the schema that holds a link's foreign tables from the source database name.
+func defaultLinkLocalSchema(sourceDatabase string) string {
+	return strings.ReplaceAll(strings.ToLower(sourceDatabase), "-", "_")
+}
+
+// loadDatabaseLink fetches the :link_id of a database. On failure it writes the error response and returns false.
+func loadDatabaseLink(c *gin.Context, databaseID uuid.UUID) (*models.DatabaseLink, bool) {
+	linkID, err := uuid.Parse(c.Param("link_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link ID format"})
+		return nil, false
+	}
+	link, err := store.GetDatabaseLinkByID(linkID, databaseID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Database link not found"})
+			return nil, false
+		}
+		log.Printf("Error fetching database link %s: %v", linkID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve database link"})
+		return nil, false
+	}
+	return link, true
+}
+
+// removeLinkPGUser drops the read-only source user of a database link and its record.
+func removeLinkPGUser(pgAdminDSN, sourceDatabase string, pgUserID uuid.UUID, pgUsername string) error {
+	if err := dbutils.DeletePostgresUser(pgAdminDSN, sourceDatabase, pgUsername); err != nil {
+		return err
+	}
+	if err := store.DeleteManagedPGUser(pgUserID); err != nil {
+		return err
+	}
+	requestPgBouncerSync()
+	requestPgHbaSync()
+	return nil
+}
+
+// dropDatabaseLink drops a link's foreign server and schema from the target, its user from the source,
+// and its record.
+func dropDatabaseLink(pgAdminDSN string, link *models.DatabaseLink) error {
+	if err := dbutils.DropDatabaseLink(pgAdminDSN, link.TargetDatabase, link.ServerName, link.LocalSchema); err != nil {
+		return err
+	}
+	if err := removeLinkPGUser(pgAdminDSN, link.SourceDatabase, link.PGUserID, link.PGUsername); err != nil {
+		return err
+	}
+	return store.DeleteDatabaseLink(link.LinkID)
+}
+
+// teardownDatabaseLinks drops every database link a database is the source or target of. It is run
+// before the database is deleted.
+func teardownDatabaseLinks(pgAdminDSN string, databaseID uuid.UUID) error {
+	links, err := store.GetDatabaseLinksByDatabaseID(databaseID)
+	if err != nil {
+		return err
+	}
+	for i := range links {
+		if err := dropDatabaseLink(pgAdminDSN, &links[i]); err != nil {
+			return fmt.Errorf("failed to drop database link %s: %w", links[i].ServerName, err)
+		}
+		log.Printf("Database link %s from %s to %s dropped with database %s", links[i].ServerName, links[i].SourceDatabase, links[i].TargetDatabase, databaseID)
+	}
+	return nil
+}
+
+// updateDatabaseLinkPasswords points the user mappings of the links a PG user backs at its new password.
+func updateDatabaseLinkPasswords(pgAdminDSN string, pgUserID uuid.UUID, password string) {
+	links, err := store.GetDatabaseLinksByPGUserID(pgUserID)
+	if err != nil {
+		log.Printf("CRITICAL: failed to look up database links of PG user %s after a password change: %v", pgUserID, err)
+		return
+	}
+	for _, link := range links {
+		if err := dbutils.SetDatabaseLinkPassword(pgAdminDSN, link.TargetDatabase, link.ServerName, password); err != nil {
+			log.Printf("CRITICAL: password of PG user %s changed but database link %s could not be updated: %v", link.PGUsername, link.ServerName, err)
+		}
+	}
+}
+
+// CreateDatabaseLinkHandler handles requests to query a schema of another database owned by the same user
+// through postgres_fdw. The database in the path is the target; a PG user that can only read the linked
+// schema is generated on the source for the user mappings, and the foreign tables are imported into a new local schema.
+func CreateDatabaseLinkHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	targetDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	var req CreateDatabaseLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+	sourceID, err := uuid.Parse(req.SourceDatabaseID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid source database ID format"})
+		return
+	}
+	if sourceID == targetDB.DatabaseID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Source and target database must differ"})
+		return
+	}
+	sourceDB, err := store.GetManagedDatabaseByID(sourceID, currentUser.InternalUserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Source database not found or not owned by user"})
+			return
+		}
+		log.Printf("Error fetching source database %s for user %s: %v", sourceID, currentUser.InternalUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve source database details"})
+		return
+	}
+	if sourceDB.Status != "active" || targetDB.Status != "active" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Source and target database must be active (current states: %s, %s)", sourceDB.Status, targetDB.Status)})
+		return
+	}
+	if !rejectPendingTransfer(c, sourceDB.DatabaseID, targetDB.DatabaseID) {
+		return
+	}
+
+	remoteSchema := strings.ToLower(strings.TrimSpace(req.RemoteSchema))
+	if remoteSchema == "" {
+		remoteSchema = "public"
+	}
+	if remoteSchema != "public" {
+		managed, err := store.CheckIfSchemaNameExistsInDB(sourceDB.DatabaseID, remoteSchema)
+		if err != nil {
+			log.Printf("Error checking schema %s in DB %s: %v", remoteSchema, sourceDB.DatabaseID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check remote schema"})
+			return
+		}
+		if !managed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Schema '%s' is not a managed schema of the source database", remoteSchema)})
+			return
+		}
+	}
+	localSchema := strings.ToLower(strings.TrimSpace(req.LocalSchema))
+	if localSchema == "" {
+		localSchema = defaultLinkLocalSchema(sourceDB.PGDatabaseName)
+	}
+	if !isSchemaNameValid(localSchema) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid local schema name '%s'. Must be lowercase alphanumeric with underscores, start with a letter, and not be reserved.", localSchema)})
+		return
+	}
+	if err := dbutils.ValidateLinkTables(req.Tables); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	linkID := uuid.New()
+	suffix := strings.ReplaceAll(linkID.String(), "-", "")[:8]
+	displayName := "link_" + suffix
+	pgUsername := dbutils.NamespacedRoleName(sourceDB.PGDatabaseName, displayName)
+	if len(pgUsername) > 63 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Source database name is too long for a link role name"})
+		return
+	}
+	pgAdminDSN, ok := requirePGAdminDSN(c, "CreateDatabaseLinkHandler", "Database links")
+	if !ok {
+		return
+	}
+
+	exists, err := store.CheckIfSchemaNameExistsInDB(targetDB.DatabaseID, localSchema)
+	if err == nil && !exists {
+		exists, err = dbutils.SchemaExists(pgAdminDSN, targetDB.PGDatabaseName, localSchema)
+	}
+	if err != nil {
+		log.Printf("Error checking if schema %s exists in DB %s: %v", localSchema, targetDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check local schema"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Schema '%s' already exists in the target database; choose another local_schema.", localSchema)})
+		return
+	}
+
+	// The link role is a custom user: it may only read the linked schema, not the whole source database.
+	password, err := dbutils.CreatePostgresUserWithPassword(pgAdminDSN, sourceDB.PGDatabaseName, pgUsername, "custom", "")
+	if err == nil {
+		if err = dbutils.GrantDatabaseLinkSourceAccess(pgAdminDSN, sourceDB.PGDatabaseName, pgUsername, remoteSchema, req.Tables); err != nil {
+			if delErr := dbutils.DeletePostgresUser(pgAdminDSN, sourceDB.PGDatabaseName, pgUsername); delErr != nil {
+				log.Printf("Warning: failed to clean up provisioned link user %s: %v", pgUsername, delErr)
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("Error provisioning link user %s for DB %s: %v", pgUsername, sourceDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to provision link user: " + err.Error()})
+		return
+	}
+	now := time.Now()
+	pgUser := &models.ManagedPGUser{
+		PGUserID:             uuid.New(),
+		ManagedDatabaseID:    sourceDB.DatabaseID,
+		PGUsername:           pgUsername,
+		DisplayName:          displayName,
+		PermissionLevel:      "custom",
+		Status:               "active",
+		PGUserPasswordPolicy: models.PGUserPasswordPolicy{PasswordChangedAt: &now},
+	}
+	if err := store.CreateManagedPGUser(pgUser); err != nil {
+		log.Printf("Error creating record of link user %s in DB %s: %v", pgUsername, sourceDB.DatabaseID, err)
+		if delErr := dbutils.DeletePostgresUser(pgAdminDSN, sourceDB.PGDatabaseName, pgUsername); delErr != nil {
+			log.Printf("Warning: failed to clean up provisioned link user %s: %v", pgUsername, delErr)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save link user record"})
+		return
+	}
+
+	host, port := logicalReplicationConnEndpoint()
+	link := &models.DatabaseLink{
+		LinkID:           linkID,
+		SourceDatabaseID: sourceDB.DatabaseID,
+		TargetDatabaseID: targetDB.DatabaseID,
+		SourceDatabase:   sourceDB.PGDatabaseName,
+		TargetDatabase:   targetDB.PGDatabaseName,
+		PGUserID:         pgUser.PGUserID,
+		PGUsername:       pgUsername,
+		ServerName:       "pgweb_link_" + suffix,
+		RemoteSchema:     remoteSchema,
+		LocalSchema:      localSchema,
+		Tables:           req.Tables,
+		CreatedBy:        currentUser.InternalUserID,
+	}
+	err = dbutils.CreateDatabaseLink(pgAdminDSN, dbutils.DatabaseLink{
+		ServerName: link.ServerName, SourceDB: link.SourceDatabase, TargetDB: link.TargetDatabase, Host: host, Port: port,
+		Username: pgUsername, Password: password, RemoteSchema: remoteSchema, LocalSchema: localSchema, Tables: req.Tables,
+	})
+	if err == nil {
+		if err = store.CreateDatabaseLink(link); err != nil {
+			log.Printf("CRITICAL: database link %s was created but could not be recorded: %v. Dropping it.", link.ServerName, err)
+			if dropErr := dbutils.DropDatabaseLink(pgAdminDSN, link.TargetDatabase, link.ServerName, localSchema); dropErr != nil {
+				log.Printf("CRITICAL: failed to drop unrecorded database link %s: %v. Manual cleanup required.", link.ServerName, dropErr)
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("Error creating database link from %s to %s: %v", sourceDB.PGDatabaseName, targetDB.PGDatabaseName, err)
+		if delErr := removeLinkPGUser(pgAdminDSN, sourceDB.PGDatabaseName, pgUser.PGUserID, pgUsername); delErr != nil {
+			log.Printf("Warning: failed to clean up link user %s: %v", pgUsername, delErr)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create database link: " + err.Error()})
+		return
+	}
+
+	log.Printf("Database link %s from %s.%s to %s.%s created by user %s", link.ServerName, sourceDB.PGDatabaseName, remoteSchema,
+		targetDB.PGDatabaseName, localSchema, currentUser.InternalUserID)
+	requestPgBouncerSync()
+	store.WriteAuditLog(&currentUser.InternalUserID, "database.link_create", "database", targetDB.DatabaseID.String(), map[string]any{
+		"link_id": link.LinkID.String(), "source_database_id": sourceDB.DatabaseID.String(), "remote_schema": remoteSchema,
+		"local_schema": localSchema, "tables": link.Tables, "pg_username": pgUsername,
+	})
+	c.JSON(http.StatusCreated, link)
+}
+
+// ListDatabaseLinksHandler handles requests to list the database links a database is the source or target of.
+func ListDatabaseLinksHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	links, err := store.GetDatabaseLinksByDatabaseID(managedDB.DatabaseID)
+	if err != nil {
+		log.Printf("Error listing database links of database %s: %v", managedDB.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve database links"})
+		return
+	}
+	c.JSON(http.StatusOK, links)
+}
+
+// GetDatabaseLinkHandler handles requests for a single database link.
+func GetDatabaseLinkHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	link, ok := loadDatabaseLink(c, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, link)
+}
+
+// DeleteDatabaseLinkHandler handles requests to remove a database link. The local schema with its
+// foreign tables, the foreign server and the link user on the source are dropped.
+func DeleteDatabaseLinkHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	link, ok := loadDatabaseLink(c, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	pgAdminDSN, ok := requirePGAdminDSN(c, "DeleteDatabaseLinkHandler", "Database links")
+	if !ok {
+		return
+	}
+	if err := dropDatabaseLink(pgAdminDSN, link); err != nil {
+		log.Printf("Error dropping database link %s: %v", link.ServerName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to drop database link: " + err.Error()})
+		return
+	}
+
+	log.Printf("Database link %s deleted by user %s", link.ServerName, currentUser.InternalUserID)
+	store.WriteAuditLog(&currentUser.InternalUserID, "database.link_delete", "database", link.TargetDatabaseID.String(), map[string]string{
+		"link_id": link.LinkID.String(), "source_database_id": link.SourceDatabaseID.String(),
+	})
+	c.Status(http.StatusNoContent)
+}
@@ -6,6 +6,7 @@ import (
 	"pgweb-backend/models"
 	"pgweb-backend/store"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -37,6 +38,9 @@ func isDBNameValid(name string) bool {
 	if strings.HasPrefix(name, "pg_") || strings.HasPrefix(name, "postgres") { // Reserved prefixes
 		return false
 	}
+	if strings.Contains(name, "__") { // Separates the database name in login role names
+		return false
+	}
 	return dbNameValidator.MatchString(name)
 }
 
@@ -56,7 +60,7 @@ func CreateDatabaseHandler(c *gin.Context) {
 
 	userChosenDBName := strings.ToLower(strings.TrimSpace(req.Name))
 	if !isDBNameValid(userChosenDBName) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid database name. Name must be 3-63 chars, alphanumeric, underscores, hyphens, start/end with alphanumeric, and not use reserved prefixes."})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid database name. Name must be 3-63 chars, alphanumeric, underscores, hyphens, start/end with alphanumeric, no '__', and not use reserved prefixes."})
 		return
 	}
 
@@ -84,33 +88,70 @@ func CreateDatabaseHandler(c *gin.Context) {
 		return
 	}
 
-	// Provision the actual PostgreSQL database
-	if err := dbutils.CreatePostgresDatabase(pgAdminDSN, pgDatabaseName); err != nil {
-		log.Printf("Error provisioning database %s: %v", pgDatabaseName, err)
-		// More specific error handling could be done here (e.g. if db already exists due to race)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to provision database: " + err.Error()})
+	if !enforceDatabaseQuota(c, currentUser.InternalUserID, pgAdminDSN) {
 		return
 	}
 
-	// Create the record in the application database
+	// A database of that name outside the application must not be taken over by provisioning.
+	clusterExists, err := dbutils.PostgresDatabaseExists(pgAdminDSN, pgDatabaseName)
+	if err != nil {
+		log.Printf("Error checking if PG database %s exists: %v", pgDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate database name uniqueness"})
+		return
+	}
+	if clusterExists {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Database name '%s' is already taken. Please choose a different name.", userChosenDBName)})
+		return
+	}
+	// The database roles must not take over a role that belongs to something else.
+	for _, role := range []string{pgDatabaseName + "_read", pgDatabaseName + "_write"} {
+		recorded, err := store.CheckIfRoleNameRecorded(role)
+		if err != nil {
+			log.Printf("Error checking if role %s is recorded: %v", role, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate database name uniqueness"})
+			return
+		}
+		if recorded {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Database name '%s' conflicts with an existing role. Please choose a different name.", userChosenDBName)})
+			return
+		}
+	}
+
+	// Create the record first so provisioning progress can be recorded against it
 	managedDB := &models.ManagedDatabase{
 		DatabaseID:     uuid.New(),
 		OwnerUserID:    currentUser.InternalUserID,
 		PGDatabaseName: pgDatabaseName,
-		Status:         "active", // Or "creating" then update via a background task
+		Status:         "creating",
 	}
 
+	// The record reserves the name: its unique constraint rejects a concurrent request on any replica.
 	if err := store.CreateManagedDatabase(managedDB); err != nil {
-		log.Printf("Error creating ManagedDatabase record for %s: %v", pgDatabaseName, err)
-		// Compensating action: drop the provisioned PG database since the record failed
-		log.Printf("Compensating: dropping provisioned database %s due to record creation failure", pgDatabaseName)
-		if dropErr := dbutils.SoftDeletePostgresDatabase(pgAdminDSN, pgDatabaseName, nil); dropErr != nil {
-			log.Printf("Warning: failed to clean up provisioned database %s: %v", pgDatabaseName, dropErr)
+		if errors.Is(err, store.ErrDatabaseNameTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Database name '%s' is already taken. Please choose a different name.", userChosenDBName)})
+			return
 		}
+		log.Printf("Error creating ManagedDatabase record for %s: %v", pgDatabaseName, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save database record"})
 		return
 	}
 
+	// Provision the actual PostgreSQL database. On failure the database is left in the "error"
+	// status; the owner can resume from the failed step or roll back.
+	release, err := lockProvisioning(managedDB.DatabaseID)
+	if err != nil {
+		log.Printf("Error locking provisioning of database %s: %v", pgDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lock database provisioning", "database": managedDB})
+		return
+	}
+	defer release()
+	if failedStep, err := runProvisioning(pgAdminDSN, managedDB, ""); err != nil {
+		log.Printf("Error provisioning database %s at step %s: %v", pgDatabaseName, failedStep, err)
+		store.WriteAuditLog(&currentUser.InternalUserID, "database.create", "database", managedDB.DatabaseID.String(), map[string]string{"pg_database_name": pgDatabaseName, "failed_step": failedStep})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to provision database: " + err.Error(), "failed_step": failedStep, "database": managedDB})
+		return
+	}
+
 	log.Printf("Database %s created and record saved for user %s", managedDB.PGDatabaseName, currentUser.InternalUserID)
 	store.WriteAuditLog(&currentUser.InternalUserID, "database.create", "database", managedDB.DatabaseID.String(), map[string]string{"pg_database_name": pgDatabaseName})
 	c.JSON(http.StatusCreated, managedDB)
@@ -230,6 +271,19 @@ func DeleteDatabaseHandler(c *gin.Context) {
 		return
 	}
 
+	// Database links live in both databases; drop them, with their link users, before the soft delete.
+	if err := teardownDatabaseLinks(os.Getenv("PG_ADMIN_DSN"), databaseID); err != nil {
+		log.Printf("Error dropping database links of database %s: %v", managedDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to drop database links: " + err.Error()})
+		return
+	}
+	// Likewise for logical replications, whose slot on the source would otherwise retain WAL indefinitely.
+	if err := teardownLogicalReplications(os.Getenv("PG_ADMIN_DSN"), databaseID); err != nil {
+		log.Printf("Error dropping logical replications of database %s: %v", managedDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to drop logical replications: " + err.Error()})
+		return
+	}
+
 
 	// 2. Fetch associated ManagedPGUser records
 	pgUsers, err := store.GetManagedPGUsersByDatabaseID(databaseID)
@@ -247,7 +301,14 @@ func DeleteDatabaseHandler(c *gin.Context) {
 		return
 	}
 
-	if err := dbutils.SoftDeletePostgresDatabase(pgAdminDSN, managedDB.PGDatabaseName, pgUsers); err != nil {
+	permissionSets, err := store.GetPermissionSetsByDatabaseID(databaseID)
+	if err != nil {
+		log.Printf("Error fetching permission sets for database %s during deletion: %v", databaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve permission sets for deletion"})
+		return
+	}
+
+	if err := dbutils.SoftDeletePostgresDatabase(pgAdminDSN, managedDB.PGDatabaseName, pgUsers, permissionSetRoleNames(permissionSets)); err != nil {
 		log.Printf("Error soft-deleting PostgreSQL database %s: %v", managedDB.PGDatabaseName, err)
 		// Don't necessarily fail the whole operation if some REVOKEs fail, but log it.
 		// The app DB status update is the critical part for the application's view.
@@ -272,6 +333,7 @@ func DeleteDatabaseHandler(c *gin.Context) {
 	}
 
 	log.Printf("Database %s (ID: %s) soft-deleted by user %s", managedDB.PGDatabaseName, databaseID, currentUser.InternalUserID)
+	requestPgBouncerSync()
 	store.WriteAuditLog(&currentUser.InternalUserID, "database.delete", "database", databaseID.String(), map[string]string{"pg_database_name": managedDB.PGDatabaseName})
 	c.JSON(http.StatusOK, gin.H{"message": "Database soft-deleted successfully", "database": managedDB})
 }
@@ -325,6 +387,10 @@ func InitiateBackupHandler(c *gin.Context) {
 		return
 	}
 
+	if !enforceBackupQuota(c, currentUser.InternalUserID) {
+		return
+	}
+
 	backupDir := os.Getenv("BACKUP_DIR")
 	if backupDir == "" {
 		backupDir = "/tmp/pgweb-backups"
@@ -0,0 +1,22 @@
+package handlers
+
+import "testing"
+
+func TestIsDBNameValid(t *testing.T) {
+	tests := map[string]bool{
+		"shop":       true,
+		"shop_2024":  true,
+		"my-shop":    true,
+		"ab":         false,
+		"pg_shop":    false,
+		"postgresx":  false,
+		"shop__test": false, // Would make "shop__test_read" a login role name of database "shop"
+		"_shop":      false,
+		"Shop":       false,
+	}
+	for name, want := range tests {
+		if got := isDBNameValid(name); got != want {
+			t.Errorf("isDBNameValid(%q) = %t, want %t", name, got, want)
+		}
+	}
+}
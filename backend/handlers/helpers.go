@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+
+	"pgweb-backend/auth"
+	"pgweb-backend/models"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// requireUser returns the authenticated user, or writes a 401 response and returns nil.
+func requireUser(c *gin.Context) *auth.UserSessionInfo {
+	currentUser := auth.GetUserFromSession(c)
+	if currentUser == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil
+	}
+	return currentUser
+}
+
+// loadOwnedDatabase parses the :database_id path parameter and fetches the database, ensuring
+// it is owned by ownerUserID. On failure it writes the error response and returns false.
+func loadOwnedDatabase(c *gin.Context, ownerUserID uuid.UUID) (*models.DatabaseWithOwner, bool) {
+	databaseID, err := uuid.Parse(c.Param("database_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid database ID format"})
+		return nil, false
+	}
+	managedDB, err := store.GetManagedDatabaseByID(databaseID, ownerUserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Managed database not found or not owned by user"})
+			return nil, false
+		}
+		log.Printf("Error fetching database %s for user %s: %v", databaseID, ownerUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve database details"})
+		return nil, false
+	}
+	return managedDB, true
+}
+
+// loadOwnedPGUser parses the :pg_user_id path parameter and fetches the PG user, ensuring the
+// parent database is owned by ownerUserID and matches databaseID. On failure it writes the error
+// response and returns false.
+func loadOwnedPGUser(c *gin.Context, ownerUserID uuid.UUID, databaseID uuid.UUID) (*models.ManagedPGUser, bool) {
+	pgUserID, err := uuid.Parse(c.Param("pg_user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid PostgreSQL user ID format"})
+		return nil, false
+	}
+	pgUser, err := store.GetManagedPGUserByID(pgUserID, ownerUserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "PostgreSQL user not found or parent database not owned by user"})
+			return nil, false
+		}
+		log.Printf("Error fetching PG user %s for user %s: %v", pgUserID, ownerUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve PostgreSQL user details"})
+		return nil, false
+	}
+	if pgUser.ManagedDatabaseID != databaseID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "PostgreSQL user does not belong to the specified database"})
+		return nil, false
+	}
+	return pgUser, true
+}
+
+// requirePGAdminDSN returns PG_ADMIN_DSN, or writes a 500 response naming the unconfigured feature.
+func requirePGAdminDSN(c *gin.Context, handlerName, feature string) (string, bool) {
+	pgAdminDSN := os.Getenv("PG_ADMIN_DSN")
+	if pgAdminDSN == "" {
+		log.Printf("Error: PG_ADMIN_DSN not set for %s", handlerName)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": feature + " is not configured"})
+		return "", false
+	}
+	return pgAdminDSN, true
+}
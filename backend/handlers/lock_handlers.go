@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"pgweb-backend/dbutils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DatabaseLockSession is a session in a database's blocking tree. As for DatabaseSession, the queries of
+// sessions not belonging to the database's managed roles are hidden.
+type DatabaseLockSession struct {
+	dbutils.LockSession
+	Managed bool                  `json:"managed"`
+	Blocked []DatabaseLockSession `json:"blocked"`
+}
+
+// databaseLockSessions marks the sessions of managed roles throughout a blocking tree and hides the
+// queries of all others.
+func databaseLockSessions(nodes []dbutils.LockSession, managedRoles map[string]bool) []DatabaseLockSession {
+	result := make([]DatabaseLockSession, 0, len(nodes))
+	for _, n := range nodes {
+		managed := managedRoles[n.Username]
+		if !managed {
+			n.Query = ""
+		}
+		blocked := databaseLockSessions(n.Blocked, managedRoles)
+		n.Blocked = nil
+		result = append(result, DatabaseLockSession{LockSession: n, Managed: managed, Blocked: blocked})
+	}
+	return result
+}
+
+// countBlockedSessions returns the number of distinct blocked sessions in a blocking tree.
+func countBlockedSessions(nodes []dbutils.LockSession, seen map[int]bool) int {
+	count := 0
+	for _, n := range nodes {
+		if len(n.BlockedBy) > 0 && !seen[n.PID] {
+			seen[n.PID] = true
+			count++
+		}
+		count += countBlockedSessions(n.Blocked, seen)
+	}
+	return count
+}
+
+// GetDatabaseLocksHandler handles requests for the blocking chains among the sessions of a managed database.
+func GetDatabaseLocksHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	roles, ok := managedRoleNames(c, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	pgAdminDSN, ok := requirePGAdminDSN(c, "GetDatabaseLocksHandler", "Lock inspection")
+	if !ok {
+		return
+	}
+	tree, err := dbutils.GetDatabaseBlockingTree(pgAdminDSN, managedDB.PGDatabaseName)
+	if err != nil {
+		log.Printf("Error inspecting locks of database %s: %v", managedDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve locks"})
+		return
+	}
+	managedRoles := make(map[string]bool, len(roles))
+	for _, r := range roles {
+		managedRoles[r] = true
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"blocked_count": countBlockedSessions(tree, map[int]bool{}),
+		"sessions":      databaseLockSessions(tree, managedRoles),
+	})
+}
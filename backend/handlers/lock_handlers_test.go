@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"pgweb-backend/dbutils"
+)
+
+func TestDatabaseLockSessions(t *testing.T) {
+	tree := []dbutils.LockSession{{
+		Session: dbutils.Session{PID: 101, Username: "postgres", Query: "LOCK TABLE orders"},
+		Blocked: []dbutils.LockSession{
+			{Session: dbutils.Session{PID: 102, Username: "shop__app", Query: "SELECT * FROM orders"}, BlockedBy: []int{101}},
+			{Session: dbutils.Session{PID: 103, Username: "shop__app", Query: "UPDATE orders SET paid = true"}, BlockedBy: []int{101}},
+		},
+	}}
+
+	if got := countBlockedSessions(tree, map[int]bool{}); got != 2 {
+		t.Errorf("countBlockedSessions() = %d, want 2", got)
+	}
+	nodes := databaseLockSessions(tree, map[string]bool{"shop__app": true})
+	if len(nodes) != 1 || nodes[0].Managed || nodes[0].Query != "" {
+		t.Fatalf("root = %+v, want unmanaged with query hidden", nodes)
+	}
+	if len(nodes[0].Blocked) != 2 || !nodes[0].Blocked[0].Managed || nodes[0].Blocked[0].Query != "SELECT * FROM orders" {
+		t.Errorf("blocked = %+v, want managed sessions with queries", nodes[0].Blocked)
+	}
+
+	body, err := json.Marshal(nodes[0])
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var decoded struct {
+		Blocked []struct {
+			Managed bool `json:"managed"`
+		} `json:"blocked"`
+	}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if len(decoded.Blocked) != 2 || !decoded.Blocked[0].Managed {
+		t.Errorf("encoded blocked = %s, want the redacted children", body)
+	}
+}
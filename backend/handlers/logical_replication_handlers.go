@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"pgweb-backend/dbutils"
+	"pgweb-backend/models"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CreateLogicalReplicationRequest defines the request body for streaming tables into another database.
+type CreateLogicalReplicationRequest struct {
+	TargetDatabaseID string   `json:"target_database_id" binding:"required"`
+	Tables           []string `json:"tables" binding:"required"` // "schema.table", or "table" for public
+}
+
+// LogicalReplicationStatusResponse is a logical replication with the state of its subscription.
+type LogicalReplicationStatusResponse struct {
+	models.LogicalReplication
+	Status *dbutils.SubscriptionStatus `json:"status"` // Null if the subscription no longer exists
+}
+
+// logicalReplicationConnEndpoint returns how the cluster reaches itself for subscriptions
+// (PGWEB_LOGICAL_REPLICATION_HOST, default localhost, and PGWEB_LOGICAL_REPLICATION_PORT, default 5432).
+func logicalReplicationConnEndpoint() (string, int) {
+	host := os.Getenv("PGWEB_LOGICAL_REPLICATION_HOST")
+	if host == "" {
+		host = "localhost"
+	}
+	port, err := strconv.Atoi(os.Getenv("PGWEB_LOGICAL_REPLICATION_PORT"))
+	if err != nil || port <= 0 {
+		port = 5432
+	}
+	return host, port
+}
+
+// logicalReplicationSpec describes the PostgreSQL objects of a recorded logical replication.
+func logicalReplicationSpec(r *models.LogicalReplication) dbutils.LogicalReplication {
+	host, port := logicalReplicationConnEndpoint()
+	return dbutils.LogicalReplication{
+		Name: r.Name, SourceDB: r.SourceDatabase, TargetDB: r.TargetDatabase, RoleName: r.PGRoleName, ConnHost: host, ConnPort: port,
+	}
+}
+
+// loadDatabaseReplication fetches the :replication_id of a database. On failure it writes the error
+// response and returns false.
+func loadDatabaseReplication(c *gin.Context, databaseID uuid.UUID) (*models.LogicalReplication, bool) {
+	replicationID, err := uuid.Parse(c.Param("replication_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid replication ID format"})
+		return nil, false
+	}
+	replication, err := store.GetLogicalReplicationByID(replicationID, databaseID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Logical replication not found"})
+			return nil, false
+		}
+		log.Printf("Error fetching logical replication %s: %v", replicationID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve logical replication"})
+		return nil, false
+	}
+	return replication, true
+}
+
+// CreateLogicalReplicationHandler handles requests to stream tables of a database into another database
+// owned by the same user. A dedicated replication role is created for the subscription's connection.
+func CreateLogicalReplicationHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	sourceDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	var req CreateLogicalReplicationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+	targetID, err := uuid.Parse(req.TargetDatabaseID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target database ID format"})
+		return
+	}
+	if targetID == sourceDB.DatabaseID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Source and target database must differ"})
+		return
+	}
+	targetDB, err := store.GetManagedDatabaseByID(targetID, currentUser.InternalUserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Target database not found or not owned by user"})
+			return
+		}
+		log.Printf("Error fetching target database %s for user %s: %v", targetID, currentUser.InternalUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve target database details"})
+		return
+	}
+	if sourceDB.Status != "active" || targetDB.Status != "active" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Source and target database must be active (current states: %s, %s)", sourceDB.Status, targetDB.Status)})
+		return
+	}
+	if !rejectPendingTransfer(c, sourceDB.DatabaseID, targetDB.DatabaseID) {
+		return
+	}
+	tables, err := dbutils.ParseReplicationTables(req.Tables)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	replicationID := uuid.New()
+	suffix := strings.ReplaceAll(replicationID.String(), "-", "")[:8]
+	roleName := dbutils.NamespacedRoleName(sourceDB.PGDatabaseName, "repl_"+suffix)
+	if len(roleName) > 63 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Source database name is too long for a replication role name"})
+		return
+	}
+	pgAdminDSN, ok := requirePGAdminDSN(c, "CreateLogicalReplicationHandler", "Logical replication")
+	if !ok {
+		return
+	}
+
+	for _, side := range []struct{ label, dbName string }{{"source", sourceDB.PGDatabaseName}, {"target", targetDB.PGDatabaseName}} {
+		missing, err := dbutils.MissingTables(pgAdminDSN, side.dbName, tables)
+		if err != nil {
+			log.Printf("Error checking replication tables in %s: %v", side.dbName, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check tables"})
+			return
+		}
+		if len(missing) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Tables not found in %s database %s: %s. Subscriptions do not copy table definitions; create them first.",
+				side.label, side.dbName, strings.Join(missing, ", "))})
+			return
+		}
+	}
+
+	replication := &models.LogicalReplication{
+		ReplicationID:    replicationID,
+		SourceDatabaseID: sourceDB.DatabaseID,
+		TargetDatabaseID: targetDB.DatabaseID,
+		SourceDatabase:   sourceDB.PGDatabaseName,
+		TargetDatabase:   targetDB.PGDatabaseName,
+		Name:             "pgweb_repl_" + suffix,
+		PGRoleName:       roleName,
+		CreatedBy:        currentUser.InternalUserID,
+	}
+	for _, t := range tables {
+		replication.Tables = append(replication.Tables, t.String())
+	}
+	spec := logicalReplicationSpec(replication)
+	spec.Tables = tables
+	if err := dbutils.CreateLogicalReplication(pgAdminDSN, spec); err != nil {
+		if errors.Is(err, dbutils.ErrUnsupportedServerVersion) {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error creating logical replication from %s to %s: %v", sourceDB.PGDatabaseName, targetDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create logical replication: " + err.Error()})
+		return
+	}
+	if err := store.CreateLogicalReplication(replication); err != nil {
+		log.Printf("CRITICAL: logical replication %s was created but could not be recorded: %v. Dropping it.", replication.Name, err)
+		if dropErr := dbutils.DropLogicalReplication(pgAdminDSN, spec); dropErr != nil {
+			log.Printf("CRITICAL: failed to drop unrecorded logical replication %s: %v. Manual cleanup required.", replication.Name, dropErr)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save logical replication record"})
+		return
+	}
+
+	log.Printf("Logical replication %s from %s to %s created by user %s", replication.Name, sourceDB.PGDatabaseName, targetDB.PGDatabaseName, currentUser.InternalUserID)
+	store.WriteAuditLog(&currentUser.InternalUserID, "database.replication_create", "database", sourceDB.DatabaseID.String(), map[string]any{
+		"replication_id": replication.ReplicationID.String(), "target_database_id": targetDB.DatabaseID.String(), "tables": replication.Tables, "pg_role_name": roleName,
+	})
+	c.JSON(http.StatusCreated, replication)
+}
+
+// ListLogicalReplicationsHandler handles requests to list the logical replications a database is the source or target of.
+func ListLogicalReplicationsHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	replications, err := store.GetLogicalReplicationsByDatabaseID(managedDB.DatabaseID)
+	if err != nil {
+		log.Printf("Error listing logical replications of database %s: %v", managedDB.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve logical replications"})
+		return
+	}
+	c.JSON(http.StatusOK, replications)
+}
+
+// GetLogicalReplicationHandler handles requests for a logical replication and its status from pg_stat_subscription.
+func GetLogicalReplicationHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	replication, ok := loadDatabaseReplication(c, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	pgAdminDSN, ok := requirePGAdminDSN(c, "GetLogicalReplicationHandler", "Logical replication")
+	if !ok {
+		return
+	}
+	status, err := dbutils.GetSubscriptionStatus(pgAdminDSN, logicalReplicationSpec(replication))
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error fetching status of logical replication %s: %v", replication.Name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve replication status"})
+		return
+	}
+	c.JSON(http.StatusOK, LogicalReplicationStatusResponse{LogicalReplication: *replication, Status: status})
+}
+
+// teardownLogicalReplications drops every logical replication a database is the source or target of, so
+// no replication slot is left retaining WAL. It is run before the database is deleted.
+func teardownLogicalReplications(pgAdminDSN string, databaseID uuid.UUID) error {
+	replications, err := store.GetLogicalReplicationsByDatabaseID(databaseID)
+	if err != nil {
+		return err
+	}
+	for i := range replications {
+		r := &replications[i]
+		if err := dbutils.DropLogicalReplication(pgAdminDSN, logicalReplicationSpec(r)); err != nil {
+			return fmt.Errorf("failed to drop logical replication %s: %w", r.Name, err)
+		}
+		if err := store.DeleteLogicalReplication(r.ReplicationID); err != nil {
+			return fmt.Errorf("failed to delete record of logical replication %s: %w", r.Name, err)
+		}
+		log.Printf("Logical replication %s from %s to %s dropped with database %s", r.Name, r.SourceDatabase, r.TargetDatabase, databaseID)
+	}
+	return nil
+}
+
+// DeleteLogicalReplicationHandler handles requests to stop a logical replication. The subscription,
+// replication slot, publication and replication role are dropped; replicated rows stay in the target.
+func DeleteLogicalReplicationHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	replication, ok := loadDatabaseReplication(c, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	pgAdminDSN, ok := requirePGAdminDSN(c, "DeleteLogicalReplicationHandler", "Logical replication")
+	if !ok {
+		return
+	}
+	if err := dbutils.DropLogicalReplication(pgAdminDSN, logicalReplicationSpec(replication)); err != nil {
+		log.Printf("Error dropping logical replication %s: %v", replication.Name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to drop logical replication: " + err.Error()})
+		return
+	}
+	if err := store.DeleteLogicalReplication(replication.ReplicationID); err != nil {
+		log.Printf("Error deleting record of logical replication %s: %v", replication.Name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete logical replication record"})
+		return
+	}
+
+	log.Printf("Logical replication %s deleted by user %s", replication.Name, currentUser.InternalUserID)
+	store.WriteAuditLog(&currentUser.InternalUserID, "database.replication_delete", "database", replication.SourceDatabaseID.String(), map[string]string{
+		"replication_id": replication.ReplicationID.String(), "target_database_id": replication.TargetDatabaseID.String(),
+	})
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"pgweb-backend/dbutils"
+	"pgweb-backend/models"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maintenanceHistoryLimit is the number of maintenance jobs listed per database.
+const maintenanceHistoryLimit = 50
+
+// maintenanceStartTimeout is how long a job may stay pending before it is considered lost.
+const maintenanceStartTimeout = time.Minute
+
+// StartMaintenanceRequest defines the request body for running VACUUM, ANALYZE or REINDEX on a database.
+type StartMaintenanceRequest struct {
+	Operation    string   `json:"operation" binding:"required"` // "vacuum", "analyze" or "reindex"
+	Full         bool     `json:"full"`                         // VACUUM FULL
+	Concurrently bool     `json:"concurrently"`                 // REINDEX CONCURRENTLY
+	Tables       []string `json:"tables"`                       // "schema.table", or "table" for public; empty for the whole database
+}
+
+// MaintenanceJobResponse is a maintenance job with the progress of its running command.
+type MaintenanceJobResponse struct {
+	models.MaintenanceJob
+	Progress *dbutils.MaintenanceProgress `json:"progress,omitempty"`
+}
+
+// maintenanceOptions returns the options a job was started with.
+func maintenanceOptions(job *models.MaintenanceJob) dbutils.MaintenanceOptions {
+	return dbutils.MaintenanceOptions{Operation: job.Operation, Full: job.Full, Concurrently: job.Concurrently}
+}
+
+// failInterruptedMaintenanceJob marks an active job failed if the backend running it went away, e.g.
+// because this process restarted, so it does not block new jobs forever. It reports whether it did.
+func failInterruptedMaintenanceJob(pgAdminDSN string, job *models.MaintenanceJob) bool {
+	interrupted := false
+	switch {
+	case job.Status == "pending":
+		interrupted = time.Since(job.CreatedAt) > maintenanceStartTimeout
+	case job.Status == "in_progress" && job.BackendPID != nil:
+		running, err := dbutils.BackendRunning(pgAdminDSN, *job.BackendPID)
+		if err != nil {
+			log.Printf("Warning: failed to check backend of maintenance job %s: %v", job.MaintenanceJobID, err)
+			return false
+		}
+		interrupted = !running
+	}
+	if !interrupted {
+		return false
+	}
+	const message = "Interrupted before completion"
+	if err := store.FinishMaintenanceJob(job.MaintenanceJobID, "failed", job.Results, message); err != nil {
+		log.Printf("Error marking interrupted maintenance job %s as failed: %v", job.MaintenanceJobID, err)
+		return false
+	}
+	job.Status, job.ErrorMessage = "failed", message
+	return true
+}
+
+// runMaintenanceJob runs a job's commands and records their results. It is run in the background.
+func runMaintenanceJob(pgAdminDSN, dbName string, job *models.MaintenanceJob, statements []dbutils.MaintenanceStatement) {
+	log.Printf("Starting %s for database %s (job %s)", job.Operation, dbName, job.MaintenanceJobID)
+	results, err := dbutils.RunMaintenance(pgAdminDSN, dbName, statements, func(pid int, results []models.MaintenanceResult) {
+		if err := store.UpdateMaintenanceJobProgress(job.MaintenanceJobID, pid, results); err != nil {
+			log.Printf("Error updating maintenance job %s: %v", job.MaintenanceJobID, err)
+		}
+	})
+	status, message := "completed", ""
+	if err != nil {
+		log.Printf("Maintenance job %s on database %s failed: %v", job.MaintenanceJobID, dbName, err)
+		status, message = "failed", err.Error()
+	}
+	if err := store.FinishMaintenanceJob(job.MaintenanceJobID, status, results, message); err != nil {
+		log.Printf("Error updating maintenance job %s to %s: %v", job.MaintenanceJobID, status, err)
+	}
+	log.Printf("Maintenance job %s on database %s %s", job.MaintenanceJobID, dbName, status)
+}
+
+// StartMaintenanceHandler handles requests to run VACUUM, ANALYZE or REINDEX on a managed database or
+// some of its tables. The commands run in the background as a tracked job; one job runs per database at a time.
+func StartMaintenanceHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	if managedDB.Status != "active" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Database is not in active state (current state: %s)", managedDB.Status)})
+		return
+	}
+	var req StartMaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+	opts := dbutils.MaintenanceOptions{Operation: strings.ToLower(req.Operation), Full: req.Full, Concurrently: req.Concurrently}
+	if err := opts.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var tables []dbutils.ReplicationTable
+	if len(req.Tables) > 0 {
+		var err error
+		if tables, err = dbutils.ParseReplicationTables(req.Tables); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	pgAdminDSN, ok := requirePGAdminDSN(c, "StartMaintenanceHandler", "Database maintenance")
+	if !ok {
+		return
+	}
+
+	active, err := store.GetActiveMaintenanceJob(managedDB.DatabaseID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error checking active maintenance jobs of database %s: %v", managedDB.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check for active jobs"})
+		return
+	}
+	if active != nil && !failInterruptedMaintenanceJob(pgAdminDSN, active) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("A %s job is already in progress", active.Operation), "job": active})
+		return
+	}
+	if len(tables) > 0 {
+		missing, err := dbutils.MissingTables(pgAdminDSN, managedDB.PGDatabaseName, tables)
+		if err != nil {
+			log.Printf("Error checking maintenance tables in %s: %v", managedDB.PGDatabaseName, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check tables"})
+			return
+		}
+		if len(missing) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tables not found: " + strings.Join(missing, ", ")})
+			return
+		}
+	}
+
+	job := &models.MaintenanceJob{
+		DatabaseID:   managedDB.DatabaseID,
+		Operation:    opts.Operation,
+		Full:         opts.Full,
+		Concurrently: opts.Concurrently,
+		CreatedBy:    currentUser.InternalUserID,
+	}
+	for _, t := range tables {
+		job.Tables = append(job.Tables, t.String())
+	}
+	if err := store.CreateMaintenanceJob(job); err != nil {
+		if errors.Is(err, store.ErrMaintenanceJobActive) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Another maintenance job was started for this database"})
+			return
+		}
+		log.Printf("Error creating maintenance job for database %s: %v", managedDB.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create maintenance job"})
+		return
+	}
+	go runMaintenanceJob(pgAdminDSN, managedDB.PGDatabaseName, job, dbutils.MaintenanceStatements(managedDB.PGDatabaseName, opts, tables))
+
+	store.WriteAuditLog(&currentUser.InternalUserID, "database.maintenance", "database", managedDB.DatabaseID.String(), map[string]any{
+		"maintenance_job_id": job.MaintenanceJobID.String(), "operation": job.Operation, "full": job.Full, "concurrently": job.Concurrently, "tables": job.Tables,
+	})
+	c.JSON(http.StatusAccepted, job)
+}
+
+// ListMaintenanceJobsHandler handles requests for the maintenance job history of a database.
+func ListMaintenanceJobsHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	jobs, err := store.GetMaintenanceJobsByDatabaseID(managedDB.DatabaseID, maintenanceHistoryLimit)
+	if err != nil {
+		log.Printf("Error listing maintenance jobs of database %s: %v", managedDB.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve maintenance jobs"})
+		return
+	}
+	c.JSON(http.StatusOK, jobs)
+}
+
+// GetMaintenanceJobHandler handles requests for a maintenance job and, while it runs, the progress of
+// its current command.
+func GetMaintenanceJobHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	jobID, err := uuid.Parse(c.Param("job_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid maintenance job ID format"})
+		return
+	}
+	job, err := store.GetMaintenanceJobByID(jobID, managedDB.DatabaseID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Maintenance job not found"})
+			return
+		}
+		log.Printf("Error fetching maintenance job %s: %v", jobID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve maintenance job"})
+		return
+	}
+
+	response := MaintenanceJobResponse{MaintenanceJob: *job}
+	if job.Status == "in_progress" && job.BackendPID != nil {
+		pgAdminDSN, ok := requirePGAdminDSN(c, "GetMaintenanceJobHandler", "Database maintenance")
+		if !ok {
+			return
+		}
+		if !failInterruptedMaintenanceJob(pgAdminDSN, job) {
+			progress, err := dbutils.GetMaintenanceProgress(pgAdminDSN, managedDB.PGDatabaseName, maintenanceOptions(job), *job.BackendPID)
+			if err != nil && err != sql.ErrNoRows {
+				log.Printf("Warning: failed to fetch progress of maintenance job %s: %v", job.MaintenanceJobID, err)
+			}
+			response.Progress = progress
+		}
+		response.MaintenanceJob = *job
+	}
+	c.JSON(http.StatusOK, response)
+}
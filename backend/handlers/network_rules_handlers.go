@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"pgweb-backend/dbutils"
+	"pgweb-backend/models"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxAllowedCIDRs caps the networks of a single PG user to keep pg_hba.conf manageable.
+const maxAllowedCIDRs = 50
+
+// pgHbaSyncMu serializes writes of pg_hba.conf within this process.
+var pgHbaSyncMu sync.Mutex
+
+// UpdatePGUserNetworkRulesRequest defines the request body for restricting where a PG user may connect from.
+// An empty list with require_ssl false lifts all restrictions.
+type UpdatePGUserNetworkRulesRequest struct {
+	AllowedCIDRs []string `json:"allowed_cidrs"`
+	RequireSSL   bool     `json:"require_ssl"`
+}
+
+// PGUserNetworkRulesResponse is a PG user's network rules with the pg_hba.conf lines enforcing them.
+type PGUserNetworkRulesResponse struct {
+	models.PGUserNetworkRules
+	HBALines []string `json:"hba_lines"`
+}
+
+// pgHbaEnabled reports whether the backend maintains the managed section of pg_hba.conf (PGWEB_PG_HBA_FILE is set).
+func pgHbaEnabled() bool {
+	return os.Getenv("PGWEB_PG_HBA_FILE") != ""
+}
+
+// hbaRules converts stored network rules for rendering.
+func hbaRules(r models.PGUserNetworkRules, certAuth bool) dbutils.HBAUserRules {
+	return dbutils.HBAUserRules{Database: r.PGDatabaseName, Role: r.PGUsername, AllowedCIDRs: r.AllowedCIDRs, RequireSSL: r.RequireSSL, CertAuth: certAuth}
+}
+
+// hasActiveCertificates reports whether a PG user holds an unrevoked, unexpired client certificate.
+func hasActiveCertificates(pgUserID uuid.UUID, now time.Time) bool {
+	certificates, err := store.GetPGUserCertificates(pgUserID)
+	if err != nil {
+		log.Printf("Warning: failed to list certificates of PG user %s: %v", pgUserID, err)
+		return false
+	}
+	for _, cert := range certificates {
+		if cert.RevokedAt == nil && cert.NotAfter.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// SyncPgHba renders the network rules of all PG users into the managed section of PGWEB_PG_HBA_FILE,
+// validates the file with pg_hba_file_rules and reloads the server. A rejected file is rolled back.
+func SyncPgHba(pgAdminDSN string) error {
+	if !pgHbaEnabled() {
+		return nil
+	}
+	pgHbaSyncMu.Lock()
+	defer pgHbaSyncMu.Unlock()
+
+	rules, err := store.GetAllPGUserNetworkRules()
+	if err != nil {
+		return err
+	}
+	withCertificates, err := store.GetPGUserIDsWithActiveCertificates(time.Now())
+	if err != nil {
+		return err
+	}
+	entries := make([]dbutils.HBAUserRules, 0, len(rules))
+	for _, r := range rules {
+		entries = append(entries, hbaRules(r, withCertificates[r.PGUserID]))
+	}
+	changed, err := dbutils.ApplyManagedHBASection(pgAdminDSN, os.Getenv("PGWEB_PG_HBA_FILE"), dbutils.RenderManagedHBASection(entries))
+	if err != nil {
+		return err
+	}
+	if changed {
+		log.Printf("pg_hba.conf updated (%d restricted PG users) and configuration reloaded", len(entries))
+	}
+	return nil
+}
+
+// requestPgHbaSync syncs pg_hba.conf in the background after a restricted PG user was renamed or deleted,
+// or its client certificates changed.
+func requestPgHbaSync() {
+	if !pgHbaEnabled() {
+		return
+	}
+	go RunPgHbaSync(os.Getenv("PG_ADMIN_DSN"))
+}
+
+// RunPgHbaSync syncs pg_hba.conf and logs failures. It is run from main on startup.
+func RunPgHbaSync(pgAdminDSN string) {
+	if err := SyncPgHba(pgAdminDSN); err != nil {
+		log.Printf("Error syncing pg_hba.conf: %v", err)
+	}
+}
+
+// GetPGUserNetworkRulesHandler handles requests for the network rules of a PG user.
+// An unrestricted user reports an empty list and no lines.
+func GetPGUserNetworkRulesHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	pgUser, ok := loadOwnedPGUser(c, currentUser.InternalUserID, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	rules, err := store.GetPGUserNetworkRules(pgUser.PGUserID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, PGUserNetworkRulesResponse{
+			PGUserNetworkRules: models.PGUserNetworkRules{PGUserID: pgUser.PGUserID, AllowedCIDRs: []string{}},
+			HBALines:           []string{},
+		})
+		return
+	} else if err != nil {
+		log.Printf("Error fetching network rules of PG user %s: %v", pgUser.PGUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve network rules"})
+		return
+	}
+	rules.PGDatabaseName, rules.PGUsername = managedDB.PGDatabaseName, pgUser.PGUsername
+	c.JSON(http.StatusOK, PGUserNetworkRulesResponse{PGUserNetworkRules: *rules, HBALines: dbutils.HBAUserLines(hbaRules(*rules, hasActiveCertificates(pgUser.PGUserID, time.Now())))})
+}
+
+// UpdatePGUserNetworkRulesHandler handles requests to restrict the networks a PG user may connect from
+// and whether it must use SSL. pg_hba.conf is rewritten and reloaded before the response; if PostgreSQL
+// rejects the file, the previous rules are restored.
+func UpdatePGUserNetworkRulesHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	if !pgHbaEnabled() {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "pg_hba.conf management is not configured"})
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	pgUser, ok := loadOwnedPGUser(c, currentUser.InternalUserID, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	var req UpdatePGUserNetworkRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+	if len(req.AllowedCIDRs) > maxAllowedCIDRs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d networks may be allowed", maxAllowedCIDRs)})
+		return
+	}
+	cidrs, err := dbutils.NormalizeCIDRs(req.AllowedCIDRs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pgAdminDSN, ok := requirePGAdminDSN(c, "UpdatePGUserNetworkRulesHandler", "pg_hba.conf management")
+	if !ok {
+		return
+	}
+
+	previous, err := store.GetPGUserNetworkRules(pgUser.PGUserID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error fetching network rules of PG user %s: %v", pgUser.PGUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve network rules"})
+		return
+	}
+	rules := &models.PGUserNetworkRules{
+		PGUserID: pgUser.PGUserID, PGDatabaseName: managedDB.PGDatabaseName, PGUsername: pgUser.PGUsername,
+		AllowedCIDRs: cidrs, RequireSSL: req.RequireSSL,
+	}
+	if len(cidrs) == 0 && !req.RequireSSL {
+		err = store.DeletePGUserNetworkRules(pgUser.PGUserID)
+	} else {
+		err = store.SetPGUserNetworkRules(rules)
+	}
+	if err != nil {
+		log.Printf("Error saving network rules of PG user %s: %v", pgUser.PGUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save network rules"})
+		return
+	}
+
+	if err := SyncPgHba(pgAdminDSN); err != nil {
+		log.Printf("Error syncing pg_hba.conf after network rule change of PG user %s: %v", pgUser.PGUsername, err)
+		var restoreErr error
+		if previous != nil {
+			restoreErr = store.SetPGUserNetworkRules(previous)
+		} else {
+			restoreErr = store.DeletePGUserNetworkRules(pgUser.PGUserID)
+		}
+		if restoreErr != nil {
+			log.Printf("CRITICAL: failed to restore network rules of PG user %s: %v", pgUser.PGUsername, restoreErr)
+		}
+		status := http.StatusInternalServerError
+		if errors.Is(err, dbutils.ErrInvalidHBA) {
+			status = http.StatusUnprocessableEntity
+		}
+		c.JSON(status, gin.H{"error": "pg_hba.conf could not be updated; the previous rules remain in effect: " + err.Error()})
+		return
+	}
+
+	log.Printf("Network rules of PG user %s updated by user %s", pgUser.PGUsername, currentUser.InternalUserID)
+	store.WriteAuditLog(&currentUser.InternalUserID, "pguser.network_rules_update", "pg_user", pgUser.PGUserID.String(), map[string]any{
+		"pg_username": pgUser.PGUsername, "database_id": managedDB.DatabaseID.String(), "allowed_cidrs": cidrs, "require_ssl": req.RequireSSL,
+	})
+	hbaLines := []string{}
+	if len(cidrs) > 0 || req.RequireSSL {
+		hbaLines = dbutils.HBAUserLines(hbaRules(*rules, hasActiveCertificates(pgUser.PGUserID, time.Now())))
+	}
+	c.JSON(http.StatusOK, PGUserNetworkRulesResponse{PGUserNetworkRules: *rules, HBALines: hbaLines})
+}
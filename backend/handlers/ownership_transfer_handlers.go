@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"pgweb-backend/models"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// OwnershipTransferRequest defines the request body for proposing (or, for admins, forcing) an ownership transfer.
+type OwnershipTransferRequest struct {
+	RecipientEmail  string `json:"recipient_email" binding:"required"`
+	RotatePasswords bool   `json:"rotate_passwords"` // Rotate all PG user passwords once the recipient owns the database
+}
+
+// OwnershipTransferResponse is returned after a database changed owner.
+type OwnershipTransferResponse struct {
+	Transfer                  models.OwnershipTransfer `json:"transfer"`
+	RotatedPGUsers            []string                 `json:"rotated_pg_users"`                       // PG usernames whose new password awaits the new owner
+	RotationFailures          []string                 `json:"rotation_failures,omitempty"`            // PG usernames that could not be rotated
+	RevokedCertificatePGUsers []string                 `json:"revoked_certificate_pg_users,omitempty"` // PG usernames whose client certificates were revoked
+}
+
+// loadTransferRecipient looks up the recipient of a transfer by email. The recipient must have logged in
+// once and must not already own the database. On failure it writes the error response and returns false.
+func loadTransferRecipient(c *gin.Context, email string, currentOwnerID uuid.UUID) (*models.ApplicationUser, bool) {
+	recipient, err := store.GetApplicationUserByEmail(strings.TrimSpace(email))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Recipient must be an existing user (they need to log in once first)"})
+			return nil, false
+		}
+		log.Printf("Error fetching transfer recipient %s: %v", email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve recipient"})
+		return nil, false
+	}
+	if recipient.InternalUserID == currentOwnerID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Recipient already owns the database"})
+		return nil, false
+	}
+	return recipient, true
+}
+
+// loadReceivedTransfer parses the :transfer_id path parameter and fetches a pending transfer offered to
+// the user. On failure it writes the error response and returns false.
+func loadReceivedTransfer(c *gin.Context, toUserID uuid.UUID) (*models.OwnershipTransfer, bool) {
+	transferID, err := uuid.Parse(c.Param("transfer_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transfer ID format"})
+		return nil, false
+	}
+	transfer, err := store.GetOwnershipTransferByID(transferID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error fetching ownership transfer %s: %v", transferID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve ownership transfer"})
+		return nil, false
+	}
+	if err == sql.ErrNoRows || transfer.ToUserID != toUserID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ownership transfer not found"})
+		return nil, false
+	}
+	if transfer.Status != "pending" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Ownership transfer is no longer pending (current state: %s)", transfer.Status)})
+		return nil, false
+	}
+	return transfer, true
+}
+
+// transferBlockers describes the database links and logical replications a database takes part in. A transfer moves a single
+// database, so the other end of each would stay with the previous owner and the new owner could read
+// the previous owner's data, or the other way around.
+func transferBlockers(databaseID uuid.UUID) ([]string, error) {
+	blockers := []string{}
+	links, err := store.GetDatabaseLinksByDatabaseID(databaseID)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range links {
+		blockers = append(blockers, fmt.Sprintf("database link %s (%s.%s -> %s.%s)", l.ServerName, l.SourceDatabase, l.RemoteSchema, l.TargetDatabase, l.LocalSchema))
+	}
+	replications, err := store.GetLogicalReplicationsByDatabaseID(databaseID)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range replications {
+		blockers = append(blockers, fmt.Sprintf("logical replication %s (%s -> %s)", r.Name, r.SourceDatabase, r.TargetDatabase))
+	}
+	return blockers, nil
+}
+
+// rejectTransferWithBlockers writes a 409 response and returns false if the database cannot be transferred
+// because of transferBlockers.
+func rejectTransferWithBlockers(c *gin.Context, databaseID uuid.UUID) bool {
+	blockers, err := transferBlockers(databaseID)
+	if err != nil {
+		log.Printf("Error checking transfer blockers of database %s: %v", databaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check database dependencies"})
+		return false
+	}
+	if len(blockers) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Database is connected to other databases of the current owner; delete these first", "blockers": blockers})
+		return false
+	}
+	return true
+}
+
+// rejectPendingTransfer writes a 409 response and returns false if any of the databases has a pending
+// ownership transfer, so no new connection between databases is made while one of them may change owner.
+func rejectPendingTransfer(c *gin.Context, databaseIDs ...uuid.UUID) bool {
+	for _, id := range databaseIDs {
+		_, err := store.GetPendingOwnershipTransfer(id)
+		if err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Database has a pending ownership transfer; cancel it first"})
+			return false
+		}
+		if err != sql.ErrNoRows {
+			log.Printf("Error checking pending ownership transfer of database %s: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check pending ownership transfers"})
+			return false
+		}
+	}
+	return true
+}
+
+// completeOwnershipTransfer moves the database, audits the transfer for both parties and, if requested,
+// rotates every active PG user password so the previous owner's credentials stop working. The new
+// passwords are held as rotation events for the new owner. On failure it writes the error response and
+// returns false.
+func completeOwnershipTransfer(c *gin.Context, transfer *models.OwnershipTransfer, actorUserID uuid.UUID) (*OwnershipTransferResponse, bool) {
+	if !rejectTransferWithBlockers(c, transfer.DatabaseID) {
+		return nil, false
+	}
+	if err := store.CompleteOwnershipTransfer(transfer); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusConflict, gin.H{"error": "Ownership transfer is no longer pending or the database changed owner"})
+			return nil, false
+		}
+		log.Printf("Error completing ownership transfer of database %s: %v", transfer.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer database ownership"})
+		return nil, false
+	}
+	log.Printf("Database %s transferred from user %s to user %s (%s)", transfer.PGDatabaseName, transfer.FromUserID, transfer.ToUserID, transfer.Status)
+
+	payload := map[string]any{
+		"transfer_id": transfer.TransferID.String(), "status": transfer.Status, "actor_user_id": actorUserID.String(),
+		"from_user_id": transfer.FromUserID.String(), "to_user_id": transfer.ToUserID.String(), "rotate_passwords": transfer.RotatePasswords,
+	}
+	store.WriteAuditLog(&transfer.FromUserID, "database.ownership_transfer_out", "database", transfer.DatabaseID.String(), payload)
+	store.WriteAuditLog(&transfer.ToUserID, "database.ownership_transfer_in", "database", transfer.DatabaseID.String(), payload)
+
+	response := &OwnershipTransferResponse{Transfer: *transfer, RotatedPGUsers: []string{}}
+	if !transfer.RotatePasswords {
+		return response, true
+	}
+	pgAdminDSN := os.Getenv("PG_ADMIN_DSN")
+	pgUsers, err := store.GetManagedPGUsersByDatabaseID(transfer.DatabaseID)
+	if err != nil {
+		log.Printf("Error fetching PG users of transferred database %s: %v", transfer.PGDatabaseName, err)
+	}
+	now := time.Now()
+	for i := range pgUsers {
+		pgUser := &pgUsers[i]
+		if pgUser.Status != "active" {
+			continue
+		}
+		// The previous owner may still hold client certificates, which a new password does not invalidate.
+		if revoked, err := revokeActivePGUserCertificates(pgUser.PGUserID, now); err != nil {
+			log.Printf("Error revoking certificates of PG user %s after transfer of database %s: %v", pgUser.PGUsername, transfer.PGDatabaseName, err)
+			response.RotationFailures = append(response.RotationFailures, pgUser.PGUsername)
+			continue
+		} else if revoked {
+			response.RevokedCertificatePGUsers = append(response.RevokedCertificatePGUsers, pgUser.PGUsername)
+			store.WriteAuditLog(&actorUserID, "pguser.revoke_certificates", "pg_user", pgUser.PGUserID.String(), map[string]string{"pg_username": pgUser.PGUsername, "database_id": transfer.DatabaseID.String(), "reason": "ownership_transfer"})
+		}
+		if pgAdminDSN == "" {
+			response.RotationFailures = append(response.RotationFailures, pgUser.PGUsername)
+			continue
+		}
+		if err := rotatePGUserPassword(pgAdminDSN, transfer.PGDatabaseName, transfer.ToUserID, pgUser, &actorUserID, "ownership_transfer", now); err != nil {
+			log.Printf("Error rotating password of PG user %s after transfer of database %s: %v", pgUser.PGUsername, transfer.PGDatabaseName, err)
+			response.RotationFailures = append(response.RotationFailures, pgUser.PGUsername)
+			continue
+		}
+		response.RotatedPGUsers = append(response.RotatedPGUsers, pgUser.PGUsername)
+	}
+	if len(response.RevokedCertificatePGUsers) > 0 {
+		requestPgHbaSync()
+	}
+	return response, true
+}
+
+// ProposeOwnershipTransferHandler handles requests by the owner to offer a database to another user.
+func ProposeOwnershipTransferHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	if managedDB.Status != "active" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Database is not in active state (current state: %s)", managedDB.Status)})
+		return
+	}
+
+	var req OwnershipTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+	recipient, ok := loadTransferRecipient(c, req.RecipientEmail, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	if !rejectTransferWithBlockers(c, managedDB.DatabaseID) {
+		return
+	}
+
+	transfer := &models.OwnershipTransfer{
+		DatabaseID:      managedDB.DatabaseID,
+		PGDatabaseName:  managedDB.PGDatabaseName,
+		FromUserID:      currentUser.InternalUserID,
+		FromEmail:       managedDB.OwnerEmail,
+		ToUserID:        recipient.InternalUserID,
+		ToEmail:         recipient.Email,
+		RotatePasswords: req.RotatePasswords,
+	}
+	if err := store.CreateOwnershipTransfer(transfer); err != nil {
+		if errors.Is(err, store.ErrTransferPending) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Database already has a pending ownership transfer; cancel it first"})
+			return
+		}
+		log.Printf("Error creating ownership transfer of database %s: %v", managedDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ownership transfer"})
+		return
+	}
+
+	log.Printf("Ownership transfer of database %s to user %s proposed by user %s", managedDB.PGDatabaseName, recipient.InternalUserID, currentUser.InternalUserID)
+	store.WriteAuditLog(&currentUser.InternalUserID, "database.ownership_transfer_propose", "database", managedDB.DatabaseID.String(), map[string]any{
+		"transfer_id": transfer.TransferID.String(), "to_user_id": recipient.InternalUserID.String(), "rotate_passwords": req.RotatePasswords,
+	})
+	c.JSON(http.StatusCreated, transfer)
+}
+
+// GetOwnershipTransferHandler handles requests by the owner for the pending ownership transfer of a database.
+func GetOwnershipTransferHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	transfer, err := store.GetPendingOwnershipTransfer(managedDB.DatabaseID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No pending ownership transfer"})
+			return
+		}
+		log.Printf("Error fetching pending ownership transfer of database %s: %v", managedDB.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve ownership transfer"})
+		return
+	}
+	c.JSON(http.StatusOK, transfer)
+}
+
+// CancelOwnershipTransferHandler handles requests by the owner to withdraw a pending ownership transfer.
+func CancelOwnershipTransferHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	transfer, err := store.GetPendingOwnershipTransfer(managedDB.DatabaseID)
+	if err == nil {
+		err = store.ResolveOwnershipTransfer(transfer.TransferID, "cancelled")
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No pending ownership transfer"})
+			return
+		}
+		log.Printf("Error cancelling ownership transfer of database %s: %v", managedDB.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel ownership transfer"})
+		return
+	}
+
+	store.WriteAuditLog(&currentUser.InternalUserID, "database.ownership_transfer_cancel", "database", managedDB.DatabaseID.String(), map[string]string{"transfer_id": transfer.TransferID.String()})
+	c.Status(http.StatusNoContent)
+}
+
+// ListIncomingTransfersHandler handles requests for the ownership transfers offered to the current user.
+func ListIncomingTransfersHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	transfers, err := store.GetPendingOwnershipTransfersForRecipient(currentUser.InternalUserID)
+	if err != nil {
+		log.Printf("Error fetching ownership transfers for user %s: %v", currentUser.InternalUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve ownership transfers"})
+		return
+	}
+	if transfers == nil { // Ensure we return an empty list, not null
+		transfers = []models.OwnershipTransfer{}
+	}
+	c.JSON(http.StatusOK, transfers)
+}
+
+// AcceptOwnershipTransferHandler handles requests by the recipient to accept an ownership transfer.
+func AcceptOwnershipTransferHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	transfer, ok := loadReceivedTransfer(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	// The database counts against the recipient's quota from now on.
+	if !enforceDatabaseQuota(c, currentUser.InternalUserID, os.Getenv("PG_ADMIN_DSN")) {
+		return
+	}
+
+	transfer.Status = "accepted"
+	response, ok := completeOwnershipTransfer(c, transfer, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DeclineOwnershipTransferHandler handles requests by the recipient to decline an ownership transfer.
+func DeclineOwnershipTransferHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	transfer, ok := loadReceivedTransfer(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	if err := store.ResolveOwnershipTransfer(transfer.TransferID, "declined"); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusConflict, gin.H{"error": "Ownership transfer is no longer pending"})
+			return
+		}
+		log.Printf("Error declining ownership transfer %s: %v", transfer.TransferID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decline ownership transfer"})
+		return
+	}
+
+	store.WriteAuditLog(&currentUser.InternalUserID, "database.ownership_transfer_decline", "database", transfer.DatabaseID.String(), map[string]string{"transfer_id": transfer.TransferID.String()})
+	c.Status(http.StatusNoContent)
+}
+
+// ForceOwnershipTransferHandler handles admin requests to move a database to another user without the
+// owner's proposal or the recipient's acceptance. A pending transfer of the database is cancelled.
+func ForceOwnershipTransferHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	databaseID, err := uuid.Parse(c.Param("database_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid database ID format"})
+		return
+	}
+	var req OwnershipTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+
+	managedDB, err := store.GetManagedDatabaseByIDForAdmin(databaseID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Managed database not found"})
+			return
+		}
+		log.Printf("Error fetching database %s: %v", databaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve database details"})
+		return
+	}
+	recipient, ok := loadTransferRecipient(c, req.RecipientEmail, managedDB.OwnerUserID)
+	if !ok {
+		return
+	}
+
+	transfer := &models.OwnershipTransfer{
+		DatabaseID:      managedDB.DatabaseID,
+		PGDatabaseName:  managedDB.PGDatabaseName,
+		FromUserID:      managedDB.OwnerUserID,
+		FromEmail:       managedDB.OwnerEmail,
+		ToUserID:        recipient.InternalUserID,
+		ToEmail:         recipient.Email,
+		RotatePasswords: req.RotatePasswords,
+		Status:          "forced",
+	}
+	response, ok := completeOwnershipTransfer(c, transfer, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	store.WriteAuditLog(&currentUser.InternalUserID, "admin.database_transfer", "database", managedDB.DatabaseID.String(), map[string]any{
+		"transfer_id": transfer.TransferID.String(), "from_user_id": transfer.FromUserID.String(), "to_user_id": transfer.ToUserID.String(), "rotate_passwords": req.RotatePasswords,
+	})
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"pgweb-backend/dbutils"
+	"pgweb-backend/models"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CreatePermissionSetRequest defines the expected request body for creating a permission set.
+type CreatePermissionSetRequest struct {
+	Name   string                   `json:"name" binding:"required"`
+	Grants []models.PermissionGrant `json:"grants" binding:"required"`
+}
+
+// AssignPermissionSetRequest defines the expected request body for assigning a permission set to a PG user.
+type AssignPermissionSetRequest struct {
+	PermissionSetID uuid.UUID `json:"permission_set_id" binding:"required"`
+}
+
+// permissionSetRoleNames returns the role names of permission sets.
+func permissionSetRoleNames(sets []models.PermissionSet) []string {
+	names := make([]string, len(sets))
+	for i, ps := range sets {
+		names[i] = ps.PGRoleName
+	}
+	return names
+}
+
+// CreatePermissionSetHandler handles requests to define a new permission set on a managed database.
+func CreatePermissionSetHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	if managedDB.Status != "active" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Database is not in active state (current state: %s)", managedDB.Status)})
+		return
+	}
+
+	var req CreatePermissionSetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+
+	name := strings.ToLower(strings.TrimSpace(req.Name))
+	if !dbutils.ValidPermissionSetName(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid permission set name. Must be 2-31 chars, lowercase alphanumeric, underscores, start with letter, and not 'read' or 'write'."})
+		return
+	}
+	if err := dbutils.ValidatePermissionGrants(req.Grants); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid grants: " + err.Error()})
+		return
+	}
+
+	roleName := dbutils.PermissionSetRoleName(managedDB.PGDatabaseName, name)
+	if len(roleName) > 63 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Permission set name is too long for this database name"})
+		return
+	}
+
+	if _, err := store.GetPermissionSetByName(managedDB.DatabaseID, name); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Permission set '%s' already exists in this database.", name)})
+		return
+	} else if err != sql.ErrNoRows {
+		log.Printf("Error checking permission set %s in DB %s: %v", name, managedDB.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate permission set name uniqueness"})
+		return
+	}
+
+	pgAdminDSN, ok := requirePGAdminDSN(c, "CreatePermissionSetHandler", "Permission set provisioning")
+	if !ok {
+		return
+	}
+
+	if err := dbutils.CreatePermissionSetRole(pgAdminDSN, managedDB.PGDatabaseName, roleName, req.Grants); err != nil {
+		log.Printf("Error provisioning permission set %s for DB %s: %v", name, managedDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to provision permission set: " + err.Error()})
+		return
+	}
+
+	ps := &models.PermissionSet{
+		PermissionSetID: uuid.New(),
+		DatabaseID:      managedDB.DatabaseID,
+		Name:            name,
+		PGRoleName:      roleName,
+		Grants:          req.Grants,
+	}
+	if err := store.CreatePermissionSet(ps); err != nil {
+		log.Printf("Error creating PermissionSet record %s in DB %s: %v", name, managedDB.DatabaseID, err)
+		log.Printf("Compensating: dropping provisioned permission set role %s due to record creation failure", roleName)
+		if delErr := dbutils.DeletePermissionSetRole(pgAdminDSN, managedDB.PGDatabaseName, roleName); delErr != nil {
+			log.Printf("Warning: failed to clean up permission set role %s: %v", roleName, delErr)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save permission set record"})
+		return
+	}
+	// A set created while the database is over its storage limit must not bypass the restriction.
+	if storage, err := store.GetDatabaseStorageState(managedDB.DatabaseID); err == nil && storage.ReadOnlySince != nil {
+		if err := dbutils.RestrictPermissionSetWrites(pgAdminDSN, managedDB.PGDatabaseName, *ps); err != nil {
+			log.Printf("Warning: failed to restrict writes of permission set %s on read-only DB %s: %v", name, managedDB.PGDatabaseName, err)
+		}
+	}
+
+	log.Printf("Permission set %s created for DB %s by user %s", name, managedDB.PGDatabaseName, currentUser.InternalUserID)
+	store.WriteAuditLog(&currentUser.InternalUserID, "permission_set.create", "permission_set", ps.PermissionSetID.String(), map[string]any{"name": name, "database_id": managedDB.DatabaseID.String(), "grants": req.Grants})
+	c.JSON(http.StatusCreated, ps)
+}
+
+// ListPermissionSetsHandler handles requests to list the permission sets of a managed database.
+func ListPermissionSetsHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+
+	sets, err := store.GetPermissionSetsByDatabaseID(managedDB.DatabaseID)
+	if err != nil {
+		log.Printf("Error listing permission sets for DB %s: %v", managedDB.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve permission sets"})
+		return
+	}
+	if sets == nil { // Ensure we return an empty list, not null
+		sets = []models.PermissionSet{}
+	}
+	c.JSON(http.StatusOK, sets)
+}
+
+// DeletePermissionSetHandler handles requests to delete a permission set and its role.
+func DeletePermissionSetHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	ps, ok := loadPermissionSet(c, managedDB.DatabaseID, c.Param("permission_set_id"))
+	if !ok {
+		return
+	}
+
+	pgAdminDSN, ok := requirePGAdminDSN(c, "DeletePermissionSetHandler", "Permission set deletion")
+	if !ok {
+		return
+	}
+
+	// Dropping the role also removes it from every PG user it was granted to.
+	if err := dbutils.DeletePermissionSetRole(pgAdminDSN, managedDB.PGDatabaseName, ps.PGRoleName); err != nil {
+		log.Printf("Error deleting permission set role %s from DB %s: %v", ps.PGRoleName, managedDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete permission set from the database: " + err.Error()})
+		return
+	}
+	if err := store.DeletePermissionSet(ps.PermissionSetID); err != nil {
+		log.Printf("Error deleting PermissionSet record %s: %v", ps.PermissionSetID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete permission set record from the application. Please contact support."})
+		return
+	}
+
+	log.Printf("Permission set %s deleted from DB %s by user %s", ps.Name, managedDB.PGDatabaseName, currentUser.InternalUserID)
+	store.WriteAuditLog(&currentUser.InternalUserID, "permission_set.delete", "permission_set", ps.PermissionSetID.String(), map[string]string{"name": ps.Name, "database_id": managedDB.DatabaseID.String()})
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// AssignPermissionSetHandler handles requests to grant a permission set to a PG user.
+func AssignPermissionSetHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	pgUser, ok := loadOwnedPGUser(c, currentUser.InternalUserID, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	if pgUser.Status != "active" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("PostgreSQL user is not in active state (current state: %s)", pgUser.Status)})
+		return
+	}
+
+	var req AssignPermissionSetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+	ps, ok := loadPermissionSet(c, managedDB.DatabaseID, req.PermissionSetID.String())
+	if !ok {
+		return
+	}
+
+	pgAdminDSN, ok := requirePGAdminDSN(c, "AssignPermissionSetHandler", "Permission set assignment")
+	if !ok {
+		return
+	}
+
+	if err := dbutils.GrantPermissionSetToUser(pgAdminDSN, managedDB.PGDatabaseName, ps.PGRoleName, pgUser.PGUsername); err != nil {
+		log.Printf("Error granting permission set %s to PG user %s: %v", ps.PGRoleName, pgUser.PGUsername, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grant permission set: " + err.Error()})
+		return
+	}
+	if err := store.AssignPermissionSetToPGUser(pgUser.PGUserID, ps.PermissionSetID); err != nil {
+		log.Printf("Error recording permission set %s assignment for PG user %s: %v", ps.PermissionSetID, pgUser.PGUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save permission set assignment"})
+		return
+	}
+
+	store.WriteAuditLog(&currentUser.InternalUserID, "pguser.assign_permission_set", "pg_user", pgUser.PGUserID.String(), map[string]string{"pg_username": pgUser.PGUsername, "permission_set": ps.Name, "database_id": managedDB.DatabaseID.String()})
+	c.JSON(http.StatusOK, gin.H{"message": "Permission set assigned", "permission_set": ps})
+}
+
+// UnassignPermissionSetHandler handles requests to revoke a permission set from a PG user.
+func UnassignPermissionSetHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	pgUser, ok := loadOwnedPGUser(c, currentUser.InternalUserID, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	ps, ok := loadPermissionSet(c, managedDB.DatabaseID, c.Param("permission_set_id"))
+	if !ok {
+		return
+	}
+
+	pgAdminDSN, ok := requirePGAdminDSN(c, "UnassignPermissionSetHandler", "Permission set assignment")
+	if !ok {
+		return
+	}
+
+	if err := dbutils.RevokePermissionSetFromUser(pgAdminDSN, managedDB.PGDatabaseName, ps.PGRoleName, pgUser.PGUsername); err != nil {
+		log.Printf("Error revoking permission set %s from PG user %s: %v", ps.PGRoleName, pgUser.PGUsername, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke permission set: " + err.Error()})
+		return
+	}
+	if err := store.UnassignPermissionSetFromPGUser(pgUser.PGUserID, ps.PermissionSetID); err != nil && err != sql.ErrNoRows {
+		log.Printf("Error removing permission set %s assignment for PG user %s: %v", ps.PermissionSetID, pgUser.PGUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove permission set assignment"})
+		return
+	}
+
+	store.WriteAuditLog(&currentUser.InternalUserID, "pguser.unassign_permission_set", "pg_user", pgUser.PGUserID.String(), map[string]string{"pg_username": pgUser.PGUsername, "permission_set": ps.Name, "database_id": managedDB.DatabaseID.String()})
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// loadPermissionSet parses a permission set ID and fetches it from the given database.
+// On failure it writes the error response and returns false.
+func loadPermissionSet(c *gin.Context, databaseID uuid.UUID, permissionSetIDStr string) (*models.PermissionSet, bool) {
+	permissionSetID, err := uuid.Parse(permissionSetIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid permission set ID format"})
+		return nil, false
+	}
+	ps, err := store.GetPermissionSetByID(permissionSetID, databaseID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Permission set not found in this database"})
+			return nil, false
+		}
+		log.Printf("Error fetching permission set %s: %v", permissionSetID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve permission set"})
+		return nil, false
+	}
+	return ps, true
+}
@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -12,6 +14,7 @@ import (
 	"pgweb-backend/store"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -19,19 +22,31 @@ import (
 
 // CreatePGUserRequest defines the expected request body for creating a PG user.
 type CreatePGUserRequest struct {
-	Username        string `json:"username" binding:"required"`
-	PermissionLevel string `json:"permission_level" binding:"required,oneof=read write"` // "read" or "write"
+	Username        string   `json:"username" binding:"required"`
+	PermissionLevel string   `json:"permission_level" binding:"required,oneof=read write custom"` // "read", "write" or "custom"
+	PermissionSets  []string `json:"permission_sets"`                                             // Names of permission sets to grant; required for "custom"
+	PGUserLimitsRequest
+	ValidUntil           *time.Time `json:"valid_until"`                                     // Optional VALID UNTIL for the password
+	RotationIntervalDays int        `json:"rotation_interval_days" binding:"min=0,max=3650"` // 0 disables automatic rotation
+	Password             string     `json:"password"`                                        // Optional; generated if empty
 }
 
 // PGUserResponse defines the data sent back after creating a PG user (includes password).
 type PGUserResponse struct {
 	models.ManagedPGUser
-	Password string `json:"password,omitempty"` // Omit if not a new user creation response
+	Password   string             `json:"password,omitempty"`   // Omit if not a new user creation response
+	Connection *ConnectionDetails `json:"connection,omitempty"` // Connection details including the new password
+}
+
+// RegeneratePasswordRequest defines the optional request body for password regeneration.
+type RegeneratePasswordRequest struct {
+	Password string `json:"password"` // Optional; generated if empty
 }
 
 // RegeneratePasswordResponse defines the response for password regeneration.
 type RegeneratePasswordResponse struct {
-	NewPassword string `json:"new_password"`
+	NewPassword string             `json:"new_password"`
+	Connection  *ConnectionDetails `json:"connection"` // Connection details including the new password
 }
 
 // Basic validation for PG usernames.
@@ -43,6 +58,9 @@ func isPGUsernameValid(name string) bool {
 	if strings.HasPrefix(name, "pg_") { // Reserved prefix
 		return false
 	}
+	if dbutils.ReservedRoleSuffix(name) { // Would look like a database role
+		return false
+	}
 	return pgUsernameValidator.MatchString(name)
 }
 
@@ -76,6 +94,9 @@ func CreatePGUserHandler(c *gin.Context) {
 		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Database is not in active state (current state: %s)", managedDB.Status)})
 		return
 	}
+	if !enforcePGUserQuota(c, currentUser.InternalUserID, databaseID) {
+		return
+	}
 
 	var req CreatePGUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -83,23 +104,65 @@ func CreatePGUserHandler(c *gin.Context) {
 		return
 	}
 
-	pgUsername := strings.ToLower(strings.TrimSpace(req.Username))
-	if !isPGUsernameValid(pgUsername) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid PostgreSQL username. Must be 3-63 chars, lowercase alphanumeric, underscores, start with letter, no 'pg_' prefix."})
+	displayName := strings.ToLower(strings.TrimSpace(req.Username))
+	if !isPGUsernameValid(displayName) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid PostgreSQL username. Must be 3-63 chars, lowercase alphanumeric, underscores, start with letter, no 'pg_' prefix, not ending in '_read' or '_write' and not containing '_ps_'."})
+		return
+	}
+	// Login roles are cluster-global, so the role is namespaced by the database name.
+	pgUsername := dbutils.NamespacedRoleName(managedDB.PGDatabaseName, displayName)
+	if len(pgUsername) > 63 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("PostgreSQL username is too long for this database; use at most %d characters.", 63-len(managedDB.PGDatabaseName+"__"))})
 		return
 	}
 
 	// Check for username uniqueness within this database
-	exists, err := store.CheckIfPGUsernameExistsInDB(databaseID, pgUsername)
+	exists, err := store.CheckIfPGUsernameExistsInDB(databaseID, displayName)
 	if err != nil {
-		log.Printf("Error checking if PG username %s exists in DB %s: %v", pgUsername, databaseID, err)
+		log.Printf("Error checking if PG username %s exists in DB %s: %v", displayName, databaseID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate username uniqueness"})
 		return
 	}
 	if exists {
-		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("PostgreSQL username '%s' already exists in this database.", pgUsername)})
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("PostgreSQL username '%s' already exists in this database.", displayName)})
+		return
+	}
+
+	limits, err := resolvePGUserLimits(defaultPGUserLimits, req.PGUserLimitsRequest)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ValidUntil != nil && !req.ValidUntil.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "valid_until must be in the future"})
 		return
 	}
+	if req.Password != "" {
+		if err := dbutils.LoadPasswordPolicy().Validate(req.Password, displayName); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Password does not meet policy: " + err.Error()})
+			return
+		}
+	}
+
+	// Resolve requested permission sets before provisioning anything.
+	if req.PermissionLevel == "custom" && len(req.PermissionSets) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one permission set is required for permission level 'custom'"})
+		return
+	}
+	var permissionSets []*models.PermissionSet
+	for _, name := range req.PermissionSets {
+		ps, err := store.GetPermissionSetByName(databaseID, strings.ToLower(strings.TrimSpace(name)))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Permission set '%s' does not exist in this database", name)})
+				return
+			}
+			log.Printf("Error fetching permission set %s in DB %s: %v", name, databaseID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve permission sets"})
+			return
+		}
+		permissionSets = append(permissionSets, ps)
+	}
 
 	pgAdminDSN := os.Getenv("PG_ADMIN_DSN")
 	if pgAdminDSN == "" {
@@ -108,21 +171,78 @@ func CreatePGUserHandler(c *gin.Context) {
 		return
 	}
 
+	// The role name is reserved across the cluster, including roles pgweb does not manage.
+	roleExists, err := dbutils.PostgresRoleExists(pgAdminDSN, pgUsername)
+	if err == nil && !roleExists {
+		roleExists, err = store.CheckIfPGUsernameManaged(pgUsername)
+	}
+	if err != nil {
+		log.Printf("Error checking if role %s exists: %v", pgUsername, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate username uniqueness"})
+		return
+	}
+	if roleExists {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("PostgreSQL role '%s' already exists in the cluster.", pgUsername)})
+		return
+	}
+
 	// Provision the actual PostgreSQL user
-	generatedPassword, err := dbutils.CreatePostgresUser(pgAdminDSN, managedDB.PGDatabaseName, pgUsername, req.PermissionLevel)
+	generatedPassword, err := dbutils.CreatePostgresUserWithPassword(pgAdminDSN, managedDB.PGDatabaseName, pgUsername, req.PermissionLevel, req.Password)
 	if err != nil {
 		log.Printf("Error provisioning PG user %s for DB %s: %v", pgUsername, managedDB.PGDatabaseName, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to provision PostgreSQL user: " + err.Error()})
 		return
 	}
 
+	for _, ps := range permissionSets {
+		if err := dbutils.GrantPermissionSetToUser(pgAdminDSN, managedDB.PGDatabaseName, ps.PGRoleName, pgUsername); err != nil {
+			log.Printf("Error granting permission set %s to PG user %s: %v", ps.Name, pgUsername, err)
+			log.Printf("Compensating: deleting provisioned PG user %s due to permission set grant failure", pgUsername)
+			if delErr := dbutils.DeletePostgresUser(pgAdminDSN, managedDB.PGDatabaseName, pgUsername); delErr != nil {
+				log.Printf("Warning: failed to clean up provisioned PG user %s: %v", pgUsername, delErr)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grant permission set: " + err.Error()})
+			return
+		}
+	}
+
+	if err := dbutils.ApplyPostgresUserLimits(pgAdminDSN, managedDB.PGDatabaseName, pgUsername, limits); err != nil {
+		log.Printf("Error applying limits to PG user %s: %v", pgUsername, err)
+		log.Printf("Compensating: deleting provisioned PG user %s due to limit configuration failure", pgUsername)
+		if delErr := dbutils.DeletePostgresUser(pgAdminDSN, managedDB.PGDatabaseName, pgUsername); delErr != nil {
+			log.Printf("Warning: failed to clean up provisioned PG user %s: %v", pgUsername, delErr)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply PostgreSQL user limits: " + err.Error()})
+		return
+	}
+
+	if req.ValidUntil != nil {
+		if err := dbutils.SetPostgresUserValidUntil(pgAdminDSN, managedDB.PGDatabaseName, pgUsername, req.ValidUntil); err != nil {
+			log.Printf("Error setting password expiry for PG user %s: %v", pgUsername, err)
+			log.Printf("Compensating: deleting provisioned PG user %s due to password expiry failure", pgUsername)
+			if delErr := dbutils.DeletePostgresUser(pgAdminDSN, managedDB.PGDatabaseName, pgUsername); delErr != nil {
+				log.Printf("Warning: failed to clean up provisioned PG user %s: %v", pgUsername, delErr)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set password expiry: " + err.Error()})
+			return
+		}
+	}
+
 	// Create the ManagedPGUser record in the application database
+	now := time.Now()
 	managedPGUser := &models.ManagedPGUser{
 		PGUserID:          uuid.New(),
 		ManagedDatabaseID: databaseID,
 		PGUsername:        pgUsername,
+		DisplayName:       displayName,
 		PermissionLevel:   req.PermissionLevel,
 		Status:            "active",
+		PGUserLimits:      limits,
+		PGUserPasswordPolicy: models.PGUserPasswordPolicy{
+			PasswordValidUntil:   req.ValidUntil,
+			PasswordChangedAt:    &now,
+			RotationIntervalDays: req.RotationIntervalDays,
+		},
 	}
 
 	if err := store.CreateManagedPGUser(managedPGUser); err != nil {
@@ -136,12 +256,31 @@ func CreatePGUserHandler(c *gin.Context) {
 		return
 	}
 
+	for _, ps := range permissionSets {
+		if err := store.AssignPermissionSetToPGUser(managedPGUser.PGUserID, ps.PermissionSetID); err != nil {
+			log.Printf("Error recording permission set %s assignment for PG user %s: %v", ps.Name, pgUsername, err)
+			log.Printf("Compensating: deleting PG user %s and its record due to assignment record failure", pgUsername)
+			if delErr := store.DeleteManagedPGUser(managedPGUser.PGUserID); delErr != nil {
+				log.Printf("Warning: failed to delete record of PG user %s: %v", pgUsername, delErr)
+			}
+			if delErr := dbutils.DeletePostgresUser(pgAdminDSN, managedDB.PGDatabaseName, pgUsername); delErr != nil {
+				log.Printf("Warning: failed to clean up provisioned PG user %s: %v", pgUsername, delErr)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save permission set assignment"})
+			return
+		}
+		managedPGUser.PermissionSets = append(managedPGUser.PermissionSets, ps.Name)
+	}
+	annotatePasswordPolicy(managedPGUser, now)
+
 	log.Printf("PG User %s created for DB %s (ID: %s) by user %s", pgUsername, managedDB.PGDatabaseName, databaseID, currentUser.InternalUserID)
+	requestPgBouncerSync()
 	store.WriteAuditLog(&currentUser.InternalUserID, "pguser.create", "pg_user", managedPGUser.PGUserID.String(), map[string]string{"pg_username": pgUsername, "database_id": databaseID.String(), "permission_level": req.PermissionLevel})
 
 	response := PGUserResponse{
 		ManagedPGUser: *managedPGUser,
 		Password:      generatedPassword, // Include the generated password in the response
+		Connection:    pgUserConnectionDetails(managedDB, managedPGUser, generatedPassword),
 	}
 	c.JSON(http.StatusCreated, response)
 }
@@ -179,6 +318,16 @@ func ListPGUsersHandler(c *gin.Context) {
 		pgUsers = []models.ManagedPGUser{}
 	}
 
+	assignments, err := store.GetPermissionSetNamesByDatabaseID(databaseID)
+	if err != nil {
+		log.Printf("Warning: failed to load permission set assignments for DB %s: %v", databaseID, err)
+	}
+	now := time.Now()
+	for i := range pgUsers {
+		pgUsers[i].PermissionSets = assignments[pgUsers[i].PGUserID]
+		annotatePasswordPolicy(&pgUsers[i], now)
+	}
+
 	// Passwords are not stored in ManagedPGUser model, so they are naturally omitted.
 	c.JSON(http.StatusOK, pgUsers)
 }
@@ -237,6 +386,19 @@ func RegeneratePGPasswordHandler(c *gin.Context) {
 		return
 	}
 
+	// The request body is optional; without it a password is generated.
+	var req RegeneratePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+	if req.Password != "" {
+		if err := dbutils.LoadPasswordPolicy().Validate(req.Password, pgUser.DisplayName); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Password does not meet policy: " + err.Error()})
+			return
+		}
+	}
+
 	pgAdminDSN := os.Getenv("PG_ADMIN_DSN")
 	if pgAdminDSN == "" {
 		log.Println("Error: PG_ADMIN_DSN not set for RegeneratePGPasswordHandler")
@@ -244,22 +406,30 @@ func RegeneratePGPasswordHandler(c *gin.Context) {
 		return
 	}
 
-	newPassword, err := dbutils.RegeneratePostgresUserPassword(pgAdminDSN, managedDB.PGDatabaseName, pgUser.PGUsername)
+	newPassword, err := dbutils.SetPostgresUserPassword(pgAdminDSN, managedDB.PGDatabaseName, pgUser.PGUsername, req.Password)
 	if err != nil {
 		log.Printf("Error regenerating password for PG user %s on DB %s: %v", pgUser.PGUsername, managedDB.PGDatabaseName, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regenerate PostgreSQL user password: " + err.Error()})
 		return
 	}
 
-	// Note: We don't store the password in our app DB.
-	// We might want to update pgUser.UpdatedAt here if tracking password changes.
-	// e.g., store.UpdatePGUser(pgUser) if such a generic update function exists.
+	// Note: We don't store the password in our app DB, only when it changed.
+	if err := recordPasswordChange(pgAdminDSN, managedDB.PGDatabaseName, pgUser, time.Now()); err != nil {
+		log.Printf("Warning: password regenerated for PG user %s but its state could not be recorded: %v", pgUser.PGUsername, err)
+	}
+	updateDatabaseLinkPasswords(pgAdminDSN, pgUser.PGUserID, newPassword)
+	event := &models.PGUserEvent{PGUserID: pgUser.PGUserID, DatabaseID: managedDB.DatabaseID, EventType: "password.regenerated"}
+	if err := store.CreatePGUserEvent(event, ""); err != nil {
+		log.Printf("Warning: failed to record password regeneration event for PG user %s: %v", pgUser.PGUsername, err)
+	}
 
 	log.Printf("Password regenerated for PG User %s (ID: %s) in DB %s by user %s", pgUser.PGUsername, pgUser.PGUserID, managedDB.PGDatabaseName, currentUser.InternalUserID)
+	requestPgBouncerSync()
 	store.WriteAuditLog(&currentUser.InternalUserID, "pguser.regenerate_password", "pg_user", pgUser.PGUserID.String(), map[string]string{"pg_username": pgUser.PGUsername, "database_id": managedDB.DatabaseID.String()})
 
 	response := RegeneratePasswordResponse{
 		NewPassword: newPassword,
+		Connection:  pgUserConnectionDetails(managedDB, pgUser, newPassword),
 	}
 	c.JSON(http.StatusOK, response)
 }
@@ -303,6 +473,17 @@ func DeletePGUserHandler(c *gin.Context) {
 		return
 	}
 
+	links, err := store.GetDatabaseLinksByPGUserID(pgUserID)
+	if err != nil {
+		log.Printf("Error fetching database links of PG user %s: %v", pgUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check database links"})
+		return
+	}
+	if len(links) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("PostgreSQL user backs database link %s; delete the link instead", links[0].ServerName)})
+		return
+	}
+
 	// Get the managed database to find the actual PG database name.
 	managedDB, err := store.GetManagedDatabaseByID(databaseID, currentUser.InternalUserID)
 	if err != nil {
@@ -325,6 +506,11 @@ func DeletePGUserHandler(c *gin.Context) {
 		return
 	}
 
+	// Revoke its client certificates so a future user with the same name cannot use them.
+	if err := store.RevokePGUserCertificates(pgUserID, time.Now()); err != nil {
+		log.Printf("Warning: failed to revoke certificates of deleted PG user %s: %v", pgUser.PGUsername, err)
+	}
+
 	// Delete the user record from the application database.
 	if err := store.DeleteManagedPGUser(pgUserID); err != nil {
 		log.Printf("Error deleting ManagedPGUser record %s: %v", pgUserID, err)
@@ -335,6 +521,8 @@ func DeletePGUserHandler(c *gin.Context) {
 	}
 
 	log.Printf("PG User %s (ID: %s) in DB %s deleted by user %s", pgUser.PGUsername, pgUserID, managedDB.PGDatabaseName, currentUser.InternalUserID)
+	requestPgBouncerSync()
+	requestPgHbaSync()
 	store.WriteAuditLog(&currentUser.InternalUserID, "pguser.delete", "pg_user", pgUserID.String(), map[string]string{"pg_username": pgUser.PGUsername, "database_id": managedDB.DatabaseID.String()})
 	c.JSON(http.StatusNoContent, nil)
 }
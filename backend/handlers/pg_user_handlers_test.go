@@ -0,0 +1,23 @@
+package handlers
+
+import "testing"
+
+func TestIsPGUsernameValid(t *testing.T) {
+	tests := map[string]bool{
+		"app":          true,
+		"reader":       true,
+		"app_reads":    true,
+		"pg_app":       false,
+		"ab":           false,
+		"x_read":       false,
+		"x_write":      false,
+		"x_ps_sales":   false,
+		"1app":         false,
+		"app_readonly": true,
+	}
+	for name, want := range tests {
+		if got := isPGUsernameValid(name); got != want {
+			t.Errorf("isPGUsernameValid(%q) = %t, want %t", name, got, want)
+		}
+	}
+}
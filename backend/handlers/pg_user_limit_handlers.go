@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"pgweb-backend/dbutils"
+	"pgweb-backend/models"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PGUserLimitsRequest carries optional connection limit and timeout settings.
+// Omitted fields keep their current value (or the default for new users).
+type PGUserLimitsRequest struct {
+	ConnectionLimit                 *int `json:"connection_limit"`                    // -1 for unlimited
+	StatementTimeout                *int `json:"statement_timeout"`                   // milliseconds, 0 for server default
+	IdleInTransactionSessionTimeout *int `json:"idle_in_transaction_session_timeout"` // milliseconds, 0 for server default
+	LockTimeout                     *int `json:"lock_timeout"`                        // milliseconds, 0 for server default
+}
+
+// defaultPGUserLimits are the limits of a new PG user before maximums are applied.
+var defaultPGUserLimits = models.PGUserLimits{ConnectionLimit: -1}
+
+// pgUserLimitMaximums reads the admin-configured maximums. A value of 0 means no maximum.
+func pgUserLimitMaximums() models.PGUserLimits {
+	readMax := func(envVar string) int {
+		if v := os.Getenv(envVar); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				return n
+			}
+			log.Printf("Warning: ignoring invalid value for %s: %q", envVar, v)
+		}
+		return 0
+	}
+	return models.PGUserLimits{
+		ConnectionLimit:                 readMax("PGWEB_MAX_CONNECTION_LIMIT"),
+		StatementTimeout:                readMax("PGWEB_MAX_STATEMENT_TIMEOUT_MS"),
+		IdleInTransactionSessionTimeout: readMax("PGWEB_MAX_IDLE_IN_TRANSACTION_SESSION_TIMEOUT_MS"),
+		LockTimeout:                     readMax("PGWEB_MAX_LOCK_TIMEOUT_MS"),
+	}
+}
+
+// resolvePGUserLimits merges the requested settings into current and enforces the configured maximums.
+// Explicitly requested values above a maximum are rejected; unlimited values that were not requested
+// are capped to the maximum, so every user is bounded once an admin sets one.
+func resolvePGUserLimits(current models.PGUserLimits, req PGUserLimitsRequest) (models.PGUserLimits, error) {
+	maximums := pgUserLimitMaximums()
+	resolved := current
+
+	fields := []struct {
+		name      string
+		requested *int
+		value     *int
+		max       int
+		unlimited int
+	}{
+		{"connection_limit", req.ConnectionLimit, &resolved.ConnectionLimit, maximums.ConnectionLimit, -1},
+		{"statement_timeout", req.StatementTimeout, &resolved.StatementTimeout, maximums.StatementTimeout, 0},
+		{"idle_in_transaction_session_timeout", req.IdleInTransactionSessionTimeout, &resolved.IdleInTransactionSessionTimeout, maximums.IdleInTransactionSessionTimeout, 0},
+		{"lock_timeout", req.LockTimeout, &resolved.LockTimeout, maximums.LockTimeout, 0},
+	}
+	for _, f := range fields {
+		if f.requested != nil {
+			if *f.requested < f.unlimited {
+				return resolved, fmt.Errorf("%s must be at least %d", f.name, f.unlimited)
+			}
+			if f.max > 0 && (*f.requested == f.unlimited || *f.requested > f.max) {
+				return resolved, fmt.Errorf("%s must be between %d and %d", f.name, f.unlimited+1, f.max)
+			}
+			*f.value = *f.requested
+			continue
+		}
+		if f.max > 0 && (*f.value == f.unlimited || *f.value > f.max) {
+			*f.value = f.max
+		}
+	}
+	return resolved, nil
+}
+
+// UpdatePGUserHandler handles PATCH requests to change the connection limit and session timeouts of a PG user.
+func UpdatePGUserHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	pgUser, ok := loadOwnedPGUser(c, currentUser.InternalUserID, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	if pgUser.Status != "active" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("PostgreSQL user is not in active state (current state: %s)", pgUser.Status)})
+		return
+	}
+
+	var req PGUserLimitsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+	limits, err := resolvePGUserLimits(pgUser.PGUserLimits, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pgAdminDSN, ok := requirePGAdminDSN(c, "UpdatePGUserHandler", "PostgreSQL user configuration")
+	if !ok {
+		return
+	}
+
+	if err := dbutils.ApplyPostgresUserLimits(pgAdminDSN, managedDB.PGDatabaseName, pgUser.PGUsername, limits); err != nil {
+		log.Printf("Error applying limits to PG user %s on DB %s: %v", pgUser.PGUsername, managedDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply PostgreSQL user limits: " + err.Error()})
+		return
+	}
+	if err := store.UpdateManagedPGUserLimits(pgUser.PGUserID, limits); err != nil {
+		log.Printf("Error recording limits for PG user %s: %v", pgUser.PGUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save PostgreSQL user limits"})
+		return
+	}
+	pgUser.PGUserLimits = limits
+
+	store.WriteAuditLog(&currentUser.InternalUserID, "pguser.update_limits", "pg_user", pgUser.PGUserID.String(), map[string]any{"pg_username": pgUser.PGUsername, "database_id": managedDB.DatabaseID.String(), "limits": limits})
+	c.JSON(http.StatusOK, pgUser)
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"testing"
+
+	"pgweb-backend/models"
+)
+
+func intPtr(n int) *int { return &n }
+
+func TestResolvePGUserLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxConns  string
+		maxStmt   string
+		current   models.PGUserLimits
+		req       PGUserLimitsRequest
+		want      models.PGUserLimits
+		expectErr bool
+	}{
+		{"defaults without maximums", "", "", defaultPGUserLimits, PGUserLimitsRequest{}, models.PGUserLimits{ConnectionLimit: -1}, false},
+		{"defaults capped to maximums", "10", "30000", defaultPGUserLimits, PGUserLimitsRequest{}, models.PGUserLimits{ConnectionLimit: 10, StatementTimeout: 30000}, false},
+		{"requested within maximums", "10", "30000", defaultPGUserLimits, PGUserLimitsRequest{ConnectionLimit: intPtr(5), StatementTimeout: intPtr(1000)}, models.PGUserLimits{ConnectionLimit: 5, StatementTimeout: 1000}, false},
+		{"requested above maximum", "10", "", defaultPGUserLimits, PGUserLimitsRequest{ConnectionLimit: intPtr(11)}, models.PGUserLimits{}, true},
+		{"requested unlimited with maximum", "10", "", defaultPGUserLimits, PGUserLimitsRequest{ConnectionLimit: intPtr(-1)}, models.PGUserLimits{}, true},
+		{"requested no connections with maximum", "10", "", defaultPGUserLimits, PGUserLimitsRequest{ConnectionLimit: intPtr(0)}, models.PGUserLimits{ConnectionLimit: 0}, false},
+		{"negative timeout", "", "", defaultPGUserLimits, PGUserLimitsRequest{LockTimeout: intPtr(-5)}, models.PGUserLimits{}, true},
+		{"partial update keeps current", "", "", models.PGUserLimits{ConnectionLimit: 3, LockTimeout: 500}, PGUserLimitsRequest{StatementTimeout: intPtr(2000)}, models.PGUserLimits{ConnectionLimit: 3, StatementTimeout: 2000, LockTimeout: 500}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PGWEB_MAX_CONNECTION_LIMIT", tt.maxConns)
+			t.Setenv("PGWEB_MAX_STATEMENT_TIMEOUT_MS", tt.maxStmt)
+			t.Setenv("PGWEB_MAX_IDLE_IN_TRANSACTION_SESSION_TIMEOUT_MS", "")
+			t.Setenv("PGWEB_MAX_LOCK_TIMEOUT_MS", "")
+
+			got, err := resolvePGUserLimits(tt.current, tt.req)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("resolvePGUserLimits() expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolvePGUserLimits() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("resolvePGUserLimits() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
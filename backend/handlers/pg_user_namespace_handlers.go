@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"pgweb-backend/dbutils"
+	"pgweb-backend/models"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NamespacePGUserResponse is returned after a PG user's login role was renamed to its namespaced name.
+type NamespacePGUserResponse struct {
+	models.ManagedPGUser
+	PreviousPGUsername  string `json:"previous_pg_username"`
+	Password            string `json:"password,omitempty"`             // Set if PostgreSQL cleared the MD5 password on rename
+	RevokedCertificates bool   `json:"revoked_certificates,omitempty"` // Client certificates named the old role and were revoked
+}
+
+// NamespacePGUserHandler handles requests to migrate a PG user created before login roles were namespaced:
+// its role is renamed from the display name to "<db>__<display_name>". Clients must switch to the new
+// role name; certificates issued for the old name are revoked and an MD5 password is replaced.
+func NamespacePGUserHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	pgUser, ok := loadOwnedPGUser(c, currentUser.InternalUserID, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	if pgUser.Status != "active" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("PostgreSQL user is not in active state (current state: %s)", pgUser.Status)})
+		return
+	}
+
+	newName := dbutils.NamespacedRoleName(managedDB.PGDatabaseName, pgUser.DisplayName)
+	if pgUser.PGUsername == newName {
+		c.JSON(http.StatusConflict, gin.H{"error": "PostgreSQL user already uses a namespaced role name"})
+		return
+	}
+	if len(newName) > 63 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Namespaced role name '%s' exceeds 63 characters", newName)})
+		return
+	}
+	pgAdminDSN, ok := requirePGAdminDSN(c, "NamespacePGUserHandler", "PostgreSQL user management")
+	if !ok {
+		return
+	}
+	exists, err := dbutils.PostgresRoleExists(pgAdminDSN, newName)
+	if err != nil {
+		log.Printf("Error checking if role %s exists: %v", newName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate role name"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("PostgreSQL role '%s' already exists in the cluster.", newName)})
+		return
+	}
+
+	oldName := pgUser.PGUsername
+	passwordCleared, err := dbutils.RenamePostgresUser(pgAdminDSN, oldName, newName)
+	if err != nil {
+		log.Printf("Error renaming role %s to %s: %v", oldName, newName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename PostgreSQL role: " + err.Error()})
+		return
+	}
+	if err := store.UpdateManagedPGUserUsername(pgUser.PGUserID, newName); err != nil {
+		log.Printf("CRITICAL: role %s was renamed to %s but the PG user record could not be updated: %v", oldName, newName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save PostgreSQL user record"})
+		return
+	}
+	pgUser.PGUsername = newName
+	response := NamespacePGUserResponse{PreviousPGUsername: oldName}
+
+	now := time.Now()
+	if passwordCleared {
+		newPassword, err := dbutils.SetPostgresUserPassword(pgAdminDSN, managedDB.PGDatabaseName, newName, "")
+		if err != nil {
+			log.Printf("Error setting a new password for renamed role %s: %v", newName, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Role was renamed but its password could not be reset; regenerate it: " + err.Error()})
+			return
+		}
+		if err := recordPasswordChange(pgAdminDSN, managedDB.PGDatabaseName, pgUser, now); err != nil {
+			log.Printf("Warning: password reset for renamed role %s but its state could not be recorded: %v", newName, err)
+		}
+		updateDatabaseLinkPasswords(pgAdminDSN, pgUser.PGUserID, newPassword)
+		response.Password = newPassword
+	}
+
+	revoked, err := revokeActivePGUserCertificates(pgUser.PGUserID, now)
+	if err != nil {
+		log.Printf("Warning: failed to revoke certificates of renamed PG user %s: %v", newName, err)
+	}
+	response.RevokedCertificates = revoked
+
+	log.Printf("PG user %s (ID: %s) renamed to %s by user %s", oldName, pgUser.PGUserID, newName, currentUser.InternalUserID)
+	requestPgBouncerSync()
+	requestPgHbaSync()
+	store.WriteAuditLog(&currentUser.InternalUserID, "pguser.namespace", "pg_user", pgUser.PGUserID.String(), map[string]any{
+		"database_id": managedDB.DatabaseID.String(), "old_pg_username": oldName, "new_pg_username": newName, "password_reset": passwordCleared,
+	})
+	annotatePasswordPolicy(pgUser, now)
+	response.ManagedPGUser = *pgUser
+	c.JSON(http.StatusOK, response)
+}
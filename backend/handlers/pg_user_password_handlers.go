@@ -0,0 +1,471 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"pgweb-backend/dbutils"
+	"pgweb-backend/models"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RotationPolicyRequest defines the expected request body for configuring password expiry and rotation.
+// The request replaces the current policy: omitting valid_until removes the expiry.
+type RotationPolicyRequest struct {
+	RotationIntervalDays int        `json:"rotation_interval_days" binding:"min=0,max=3650"` // 0 disables automatic rotation
+	ValidUntil           *time.Time `json:"valid_until"`                                     // VALID UNTIL for the current password
+}
+
+// FetchSecretResponse defines the response for fetching the password of a rotation event.
+type FetchSecretResponse struct {
+	Password string `json:"password"`
+}
+
+// passwordExpiryGrace is added on top of the rotation interval when a rotated password
+// gets a new VALID UNTIL, so the scheduler rotates it before it expires.
+const passwordExpiryGrace = 24 * time.Hour
+
+// pgUserEventListLimit caps the number of events returned by ListPGUserEventsHandler.
+const pgUserEventListLimit = 100
+
+// stalePendingEventAge is how old a pending event must be before ListStalePendingPGUserEventsHandler
+// reports it. A rotation commits its event within seconds, so older pending events were interrupted.
+const stalePendingEventAge = 15 * time.Minute
+
+// envDuration reads a positive integer env var in the given unit, falling back to def.
+func envDuration(envVar string, unit time.Duration, def time.Duration) time.Duration {
+	if v := os.Getenv(envVar); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return time.Duration(n) * unit
+		}
+		log.Printf("Warning: ignoring invalid value for %s: %q", envVar, v)
+	}
+	return def
+}
+
+// passwordExpiryWarningWindow is how long before VALID UNTIL a password is reported as expiring soon.
+func passwordExpiryWarningWindow() time.Duration {
+	return envDuration("PGWEB_PASSWORD_EXPIRY_WARNING_DAYS", 24*time.Hour, 14*24*time.Hour)
+}
+
+// rotatedSecretTTL is how long the password of a rotation event can be fetched.
+func rotatedSecretTTL() time.Duration {
+	return envDuration("PGWEB_ROTATED_SECRET_TTL_HOURS", time.Hour, 72*time.Hour)
+}
+
+// PasswordRotationCheckInterval is how often RunScheduledPasswordRotations should run.
+func PasswordRotationCheckInterval() time.Duration {
+	return envDuration("PGWEB_PASSWORD_ROTATION_CHECK_INTERVAL_MINUTES", time.Minute, time.Hour)
+}
+
+// annotatePasswordPolicy fills the computed NextRotationAt and PasswordExpiryWarning fields.
+func annotatePasswordPolicy(pgUser *models.ManagedPGUser, now time.Time) {
+	if pgUser.RotationIntervalDays > 0 {
+		base := pgUser.CreatedAt
+		if pgUser.PasswordChangedAt != nil {
+			base = *pgUser.PasswordChangedAt
+		}
+		next := base.AddDate(0, 0, pgUser.RotationIntervalDays)
+		pgUser.NextRotationAt = &next
+	}
+	if pgUser.PasswordValidUntil != nil {
+		switch {
+		case !pgUser.PasswordValidUntil.After(now):
+			pgUser.PasswordExpiryWarning = "expired"
+		case pgUser.PasswordValidUntil.Sub(now) <= passwordExpiryWarningWindow():
+			pgUser.PasswordExpiryWarning = "expiring_soon"
+		}
+	}
+}
+
+// validUntilAfterPasswordChange returns the VALID UNTIL a PG user should have after its password changes.
+// Users with both an expiry and a rotation interval get their expiry pushed one interval (plus grace)
+// into the future; other users keep their current expiry.
+func validUntilAfterPasswordChange(pgUser *models.ManagedPGUser, now time.Time) *time.Time {
+	if pgUser.PasswordValidUntil == nil || pgUser.RotationIntervalDays <= 0 {
+		return pgUser.PasswordValidUntil
+	}
+	validUntil := now.AddDate(0, 0, pgUser.RotationIntervalDays).Add(passwordExpiryGrace)
+	return &validUntil
+}
+
+// recordPasswordChange updates VALID UNTIL in PostgreSQL (when it moves) and the password state in the
+// application database after a password change.
+func recordPasswordChange(pgAdminDSN, pgDatabaseName string, pgUser *models.ManagedPGUser, now time.Time) error {
+	validUntil := validUntilAfterPasswordChange(pgUser, now)
+	if validUntil != pgUser.PasswordValidUntil {
+		if err := dbutils.SetPostgresUserValidUntil(pgAdminDSN, pgDatabaseName, pgUser.PGUsername, validUntil); err != nil {
+			return err
+		}
+	}
+	if err := store.UpdateManagedPGUserPasswordState(pgUser.PGUserID, now, validUntil); err != nil {
+		return err
+	}
+	pgUser.PasswordChangedAt = &now
+	pgUser.PasswordValidUntil = validUntil
+	return nil
+}
+
+// notifyPGUserEvent posts an event to PGWEB_EVENT_WEBHOOK_URL, if configured.
+// The payload never contains the secret; receivers fetch it through the API.
+func notifyPGUserEvent(event *models.PGUserEvent, ownerUserID uuid.UUID, pgDatabaseName, pgUsername string) {
+	postEventWebhook(map[string]any{
+		"event":            event,
+		"owner_user_id":    ownerUserID,
+		"pg_database_name": pgDatabaseName,
+		"pg_username":      pgUsername,
+	}, "event "+event.EventID.String())
+}
+
+// postEventWebhook posts a JSON payload to PGWEB_EVENT_WEBHOOK_URL, if configured. Delivery is
+// best-effort; failures are logged with ref.
+func postEventWebhook(payload map[string]any, ref string) {
+	webhookURL := os.Getenv("PGWEB_EVENT_WEBHOOK_URL")
+	if webhookURL == "" {
+		return
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Warning: failed to encode webhook payload for %s: %v", ref, err)
+		return
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Warning: failed to deliver webhook for %s: %v", ref, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Warning: webhook for %s returned status %d", ref, resp.StatusCode)
+	}
+}
+
+// SetPGUserRotationPolicyHandler handles requests to configure password expiry and automatic rotation of a PG user.
+func SetPGUserRotationPolicyHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	pgUser, ok := loadOwnedPGUser(c, currentUser.InternalUserID, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	if pgUser.Status != "active" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("PostgreSQL user is not in active state (current state: %s)", pgUser.Status)})
+		return
+	}
+
+	var req RotationPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+	if req.ValidUntil != nil && !req.ValidUntil.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "valid_until must be in the future"})
+		return
+	}
+
+	pgAdminDSN, ok := requirePGAdminDSN(c, "SetPGUserRotationPolicyHandler", "PostgreSQL user configuration")
+	if !ok {
+		return
+	}
+
+	if err := dbutils.SetPostgresUserValidUntil(pgAdminDSN, managedDB.PGDatabaseName, pgUser.PGUsername, req.ValidUntil); err != nil {
+		log.Printf("Error setting password expiry for PG user %s on DB %s: %v", pgUser.PGUsername, managedDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set password expiry: " + err.Error()})
+		return
+	}
+	if err := store.UpdateManagedPGUserRotationPolicy(pgUser.PGUserID, req.RotationIntervalDays, req.ValidUntil); err != nil {
+		log.Printf("Error recording rotation policy for PG user %s: %v", pgUser.PGUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save rotation policy"})
+		return
+	}
+	pgUser.RotationIntervalDays = req.RotationIntervalDays
+	pgUser.PasswordValidUntil = req.ValidUntil
+	annotatePasswordPolicy(pgUser, time.Now())
+
+	store.WriteAuditLog(&currentUser.InternalUserID, "pguser.set_rotation_policy", "pg_user", pgUser.PGUserID.String(), map[string]any{"pg_username": pgUser.PGUsername, "database_id": managedDB.DatabaseID.String(), "rotation_interval_days": req.RotationIntervalDays, "valid_until": req.ValidUntil})
+	c.JSON(http.StatusOK, pgUser)
+}
+
+// ListPGUserEventsHandler handles requests to list the most recent events of a PG user.
+func ListPGUserEventsHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	pgUser, ok := loadOwnedPGUser(c, currentUser.InternalUserID, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+
+	events, err := store.GetPGUserEvents(pgUser.PGUserID, pgUserEventListLimit)
+	if err != nil {
+		log.Printf("Error listing events for PG user %s: %v", pgUser.PGUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve PostgreSQL user events"})
+		return
+	}
+	if events == nil { // Ensure we return an empty list, not null
+		events = []models.PGUserEvent{}
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+// FetchPGUserEventSecretHandler handles requests to fetch the password produced by a rotation event.
+// The password is removed once fetched.
+func FetchPGUserEventSecretHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	pgUser, ok := loadOwnedPGUser(c, currentUser.InternalUserID, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	eventID, err := uuid.Parse(c.Param("event_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID format"})
+		return
+	}
+
+	password, err := store.ClaimPGUserEventSecret(eventID, pgUser.PGUserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No secret available for this event; it was already fetched or has expired"})
+			return
+		}
+		log.Printf("Error fetching secret of event %s for PG user %s: %v", eventID, pgUser.PGUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve secret"})
+		return
+	}
+
+	store.WriteAuditLog(&currentUser.InternalUserID, "pguser.fetch_rotated_password", "pg_user", pgUser.PGUserID.String(), map[string]string{"pg_username": pgUser.PGUsername, "event_id": eventID.String()})
+	c.JSON(http.StatusOK, FetchSecretResponse{Password: password})
+}
+
+// rotatePGUserPassword replaces the password of a PG user, records a "password.rotated" event holding
+// the new password for the owner to fetch, audits the rotation with its reason and notifies the owner.
+// The event is stored as pending before the password is changed, so a rotated password is never lost.
+func rotatePGUserPassword(pgAdminDSN, pgDatabaseName string, ownerUserID uuid.UUID, pgUser *models.ManagedPGUser, actorUserID *uuid.UUID, reason string, now time.Time) error {
+	newPassword, err := dbutils.GeneratePassword()
+	if err != nil {
+		return err
+	}
+	event := &models.PGUserEvent{PGUserID: pgUser.PGUserID, DatabaseID: pgUser.ManagedDatabaseID, EventType: "password.rotated"}
+	if err := store.CreatePendingPGUserEvent(event, newPassword); err != nil {
+		return err
+	}
+	if _, err := dbutils.SetPostgresUserPassword(pgAdminDSN, pgDatabaseName, pgUser.PGUsername, newPassword); err != nil {
+		if delErr := store.DeletePendingPGUserEvent(event.EventID); delErr != nil {
+			log.Printf("Warning: failed to discard pending event %s of PG user %s: %v", event.EventID, pgUser.PGUsername, delErr)
+		}
+		return err
+	}
+	return completePasswordRotation(pgAdminDSN, pgDatabaseName, ownerUserID, pgUser, event, newPassword, actorUserID, reason, now)
+}
+
+// completePasswordRotation commits the pending event of a password that has been applied in PostgreSQL,
+// records the change, updates the links using the PG user, audits the rotation and notifies the owner.
+func completePasswordRotation(pgAdminDSN, pgDatabaseName string, ownerUserID uuid.UUID, pgUser *models.ManagedPGUser, event *models.PGUserEvent, newPassword string, actorUserID *uuid.UUID, reason string, now time.Time) error {
+	if err := store.CommitPGUserEvent(event.EventID); err != nil {
+		log.Printf("CRITICAL: password of PG user %s on DB %s was rotated but its event %s could not be committed: %v", pgUser.PGUsername, pgDatabaseName, event.EventID, err)
+		return err
+	}
+	if err := recordPasswordChange(pgAdminDSN, pgDatabaseName, pgUser, now); err != nil {
+		log.Printf("CRITICAL: password of PG user %s on DB %s was rotated but its state could not be recorded: %v", pgUser.PGUsername, pgDatabaseName, err)
+	}
+	updateDatabaseLinkPasswords(pgAdminDSN, pgUser.PGUserID, newPassword)
+
+	log.Printf("Password rotated for PG user %s (ID: %s) in DB %s (%s)", pgUser.PGUsername, pgUser.PGUserID, pgDatabaseName, reason)
+	requestPgBouncerSync()
+	store.WriteAuditLog(actorUserID, "pguser.rotate_password", "pg_user", pgUser.PGUserID.String(), map[string]string{"pg_username": pgUser.PGUsername, "database_id": pgUser.ManagedDatabaseID.String(), "event_id": event.EventID.String(), "reason": reason})
+	notifyPGUserEvent(event, ownerUserID, pgDatabaseName, pgUser.PGUsername)
+	return nil
+}
+
+// RunScheduledPasswordRotations rotates the passwords of all PG users whose rotation interval has
+// elapsed, records a "password.rotated" event holding the new password, and purges unfetched
+// passwords older than the configured TTL. It is run periodically from main.
+func RunScheduledPasswordRotations(pgAdminDSN string) {
+	// Every replica runs the scheduler; only one may rotate at a time or users would be rotated twice.
+	release, ok, err := store.TryAdvisoryLock("password_rotation")
+	if err != nil {
+		log.Printf("Error locking scheduled password rotation: %v", err)
+		return
+	}
+	if !ok {
+		log.Printf("Scheduled password rotation is running on another instance; skipping")
+		return
+	}
+	defer release()
+
+	if purged, err := store.PurgeExpiredPGUserEventSecrets(rotatedSecretTTL()); err != nil {
+		log.Printf("Warning: failed to purge expired rotated passwords: %v", err)
+	} else if purged > 0 {
+		log.Printf("Purged %d unfetched rotated password(s)", purged)
+	}
+
+	now := time.Now()
+	dueUsers, err := store.GetPGUsersDueForRotation(now)
+	if err != nil {
+		log.Printf("Error fetching PG users due for password rotation: %v", err)
+		return
+	}
+	for i := range dueUsers {
+		due := &dueUsers[i]
+		pgUser := &due.ManagedPGUser
+
+		if err := rotatePGUserPassword(pgAdminDSN, due.PGDatabaseName, due.OwnerUserID, pgUser, nil, "scheduled", now); err != nil {
+			log.Printf("Error rotating password for PG user %s on DB %s: %v", pgUser.PGUsername, due.PGDatabaseName, err)
+		}
+	}
+}
+
+// ListStalePendingPGUserEventsHandler handles admin requests to list pending events of interrupted
+// password rotations. Their passwords may or may not have been applied in PostgreSQL.
+func ListStalePendingPGUserEventsHandler(c *gin.Context) {
+	if currentUser := requireUser(c); currentUser == nil {
+		return
+	}
+	events, err := store.GetStalePendingPGUserEvents(time.Now().Add(-stalePendingEventAge))
+	if err != nil {
+		log.Printf("Error fetching stale pending PG user events: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pending events"})
+		return
+	}
+	if events == nil {
+		events = []models.PGUserEvent{}
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+// loadPendingPGUserEvent parses the :event_id path parameter and fetches the pending event with its secret.
+// On failure it writes the error response and returns false.
+func loadPendingPGUserEvent(c *gin.Context) (*models.PGUserEvent, string, bool) {
+	eventID, err := uuid.Parse(c.Param("event_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID format"})
+		return nil, "", false
+	}
+	event, secret, err := store.GetPendingPGUserEvent(eventID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Pending event not found"})
+			return nil, "", false
+		}
+		log.Printf("Error fetching pending event %s: %v", eventID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pending event"})
+		return nil, "", false
+	}
+	return event, secret, true
+}
+
+// RecoverPendingPGUserEventHandler handles admin requests to finish an interrupted password rotation.
+// The stored password is applied again, which is safe whether or not the rotation had applied it,
+// and the event is committed so the owner can fetch the password.
+func RecoverPendingPGUserEventHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	event, password, ok := loadPendingPGUserEvent(c)
+	if !ok {
+		return
+	}
+	if event.EventType != "password.rotated" || password == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending password rotations with a stored password can be recovered; discard this event instead"})
+		return
+	}
+	pgAdminDSN, ok := requirePGAdminDSN(c, "RecoverPendingPGUserEventHandler", "Password rotation")
+	if !ok {
+		return
+	}
+
+	managedDB, err := store.GetManagedDatabaseByIDForAdmin(event.DatabaseID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusConflict, gin.H{"error": "The database of this event no longer exists; discard the event instead"})
+			return
+		}
+		log.Printf("Error fetching database %s of pending event %s: %v", event.DatabaseID, event.EventID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve database details"})
+		return
+	}
+	pgUser, err := store.GetManagedPGUserByID(event.PGUserID, managedDB.OwnerUserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusConflict, gin.H{"error": "The PG user of this event no longer exists; discard the event instead"})
+			return
+		}
+		log.Printf("Error fetching PG user %s of pending event %s: %v", event.PGUserID, event.EventID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve PG user details"})
+		return
+	}
+	if managedDB.Status != "active" || pgUser.Status != "active" {
+		c.JSON(http.StatusConflict, gin.H{"error": "The database or PG user of this event is not active; discard the event instead"})
+		return
+	}
+
+	if _, err := dbutils.SetPostgresUserPassword(pgAdminDSN, managedDB.PGDatabaseName, pgUser.PGUsername, password); err != nil {
+		log.Printf("Error applying password of pending event %s for PG user %s: %v", event.EventID, pgUser.PGUsername, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply password"})
+		return
+	}
+	if err := completePasswordRotation(pgAdminDSN, managedDB.PGDatabaseName, managedDB.OwnerUserID, pgUser, event, password, &currentUser.InternalUserID, "recovered", time.Now()); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusConflict, gin.H{"error": "The event was committed or discarded concurrently"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password was applied but the event could not be committed"})
+		return
+	}
+	event.SecretAvailable = true
+	c.JSON(http.StatusOK, event)
+}
+
+// DiscardPendingPGUserEventHandler handles admin requests to delete a pending event whose change
+// should not be completed. If its password had been applied, the owner must regenerate the password.
+func DiscardPendingPGUserEventHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	event, _, ok := loadPendingPGUserEvent(c)
+	if !ok {
+		return
+	}
+	if err := store.DeletePendingPGUserEvent(event.EventID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Pending event not found"})
+			return
+		}
+		log.Printf("Error discarding pending event %s: %v", event.EventID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to discard pending event"})
+		return
+	}
+	store.WriteAuditLog(&currentUser.InternalUserID, "admin.discard_pending_pguser_event", "pg_user", event.PGUserID.String(), map[string]string{"event_id": event.EventID.String(), "event_type": event.EventType})
+	c.JSON(http.StatusOK, gin.H{"message": "Pending event discarded"})
+}
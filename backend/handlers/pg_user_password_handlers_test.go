@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"pgweb-backend/models"
+)
+
+func TestAnnotatePasswordPolicy(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time { ts := now.Add(d); return &ts }
+
+	tests := []struct {
+		name        string
+		policy      models.PGUserPasswordPolicy
+		wantWarning string
+		wantNext    *time.Time
+	}{
+		{"no policy", models.PGUserPasswordPolicy{}, "", nil},
+		{"expired", models.PGUserPasswordPolicy{PasswordValidUntil: at(-time.Hour)}, "expired", nil},
+		{"expiring soon", models.PGUserPasswordPolicy{PasswordValidUntil: at(3 * 24 * time.Hour)}, "expiring_soon", nil},
+		{"valid", models.PGUserPasswordPolicy{PasswordValidUntil: at(60 * 24 * time.Hour)}, "", nil},
+		{"next rotation from last change", models.PGUserPasswordPolicy{PasswordChangedAt: at(-10 * 24 * time.Hour), RotationIntervalDays: 30}, "", at(20 * 24 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PGWEB_PASSWORD_EXPIRY_WARNING_DAYS", "")
+			pgUser := models.ManagedPGUser{CreatedAt: now.Add(-100 * 24 * time.Hour), PGUserPasswordPolicy: tt.policy}
+			annotatePasswordPolicy(&pgUser, now)
+			if pgUser.PasswordExpiryWarning != tt.wantWarning {
+				t.Errorf("warning = %q, want %q", pgUser.PasswordExpiryWarning, tt.wantWarning)
+			}
+			if (pgUser.NextRotationAt == nil) != (tt.wantNext == nil) || (tt.wantNext != nil && !pgUser.NextRotationAt.Equal(*tt.wantNext)) {
+				t.Errorf("next rotation = %v, want %v", pgUser.NextRotationAt, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestValidUntilAfterPasswordChange(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	fixed := now.Add(5 * 24 * time.Hour)
+
+	pgUser := &models.ManagedPGUser{PGUserPasswordPolicy: models.PGUserPasswordPolicy{PasswordValidUntil: &fixed}}
+	if got := validUntilAfterPasswordChange(pgUser, now); got != &fixed {
+		t.Errorf("expiry without rotation should be kept, got %v", got)
+	}
+
+	pgUser.RotationIntervalDays = 90
+	want := now.AddDate(0, 0, 90).Add(passwordExpiryGrace)
+	if got := validUntilAfterPasswordChange(pgUser, now); got == nil || !got.Equal(want) {
+		t.Errorf("expiry with rotation = %v, want %v", got, want)
+	}
+}
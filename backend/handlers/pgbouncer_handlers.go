@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"pgweb-backend/dbutils"
+	"pgweb-backend/models"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pgBouncerPoolModes are the pool modes PgBouncer accepts per database.
+var pgBouncerPoolModes = map[string]bool{"session": true, "transaction": true, "statement": true}
+
+// pgBouncerSyncMu serializes writes of the PgBouncer configuration within this process.
+var pgBouncerSyncMu sync.Mutex
+
+// UpdateDatabasePoolRequest defines the request body for changing the PgBouncer pool of a database.
+// Null values reset the setting to PgBouncer's default.
+type UpdateDatabasePoolRequest struct {
+	PoolSize *int    `json:"pool_size"`
+	PoolMode *string `json:"pool_mode"`
+}
+
+// pgBouncerEnabled reports whether the backend maintains the PgBouncer configuration
+// (PGWEB_PGBOUNCER_DATABASES_FILE is set).
+func pgBouncerEnabled() bool {
+	return os.Getenv("PGWEB_PGBOUNCER_DATABASES_FILE") != ""
+}
+
+// PgBouncerSyncInterval returns the interval of the periodic PgBouncer sync, which also picks up
+// rotated passwords (PGWEB_PGBOUNCER_SYNC_INTERVAL_MINUTES, default 5, 0 disables).
+// It is 0 when PgBouncer integration is not configured.
+func PgBouncerSyncInterval() time.Duration {
+	if !pgBouncerEnabled() {
+		return 0
+	}
+	interval := 5 * time.Minute
+	if v := os.Getenv("PGWEB_PGBOUNCER_SYNC_INTERVAL_MINUTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			interval = time.Duration(n) * time.Minute
+		} else {
+			log.Printf("Warning: ignoring invalid value for PGWEB_PGBOUNCER_SYNC_INTERVAL_MINUTES: %q", v)
+		}
+	}
+	return interval
+}
+
+// maxPgBouncerPoolSize returns the largest pool size owners may request (PGWEB_PGBOUNCER_MAX_POOL_SIZE, default 100).
+func maxPgBouncerPoolSize() int {
+	if n, err := strconv.Atoi(os.Getenv("PGWEB_PGBOUNCER_MAX_POOL_SIZE")); err == nil && n > 0 {
+		return n
+	}
+	return 100
+}
+
+// pgBouncerTarget returns the server PgBouncer connects to: PGWEB_PGBOUNCER_TARGET_HOST and
+// PGWEB_PGBOUNCER_TARGET_PORT, falling back to the host and port of PG_ADMIN_DSN.
+func pgBouncerTarget() (string, int) {
+	endpoint := dsnEndpoint(os.Getenv("PG_ADMIN_DSN"))
+	if host := os.Getenv("PGWEB_PGBOUNCER_TARGET_HOST"); host != "" {
+		endpoint.Host = host
+	}
+	if port, err := strconv.Atoi(os.Getenv("PGWEB_PGBOUNCER_TARGET_PORT")); err == nil && port > 0 {
+		endpoint.Port = port
+	}
+	if endpoint.Host == "" {
+		endpoint.Host = "localhost"
+	}
+	if endpoint.Port == 0 {
+		endpoint.Port = 5432
+	}
+	return endpoint.Host, endpoint.Port
+}
+
+// validatePoolSettings checks a requested pool size and mode.
+func validatePoolSettings(req UpdateDatabasePoolRequest, maxPoolSize int) error {
+	if req.PoolSize != nil && (*req.PoolSize < 1 || *req.PoolSize > maxPoolSize) {
+		return fmt.Errorf("pool_size must be between 1 and %d", maxPoolSize)
+	}
+	if req.PoolMode != nil && !pgBouncerPoolModes[*req.PoolMode] {
+		return fmt.Errorf("pool_mode must be one of session, transaction or statement")
+	}
+	return nil
+}
+
+// SyncPgBouncer writes the [databases] entries of all active databases to PGWEB_PGBOUNCER_DATABASES_FILE
+// and, if PGWEB_PGBOUNCER_AUTH_FILE is set, the password hashes of all active PG users to that auth_file.
+// Without an auth_file PgBouncer is expected to use auth_query. If a file changed, PgBouncer is reloaded
+// through PGWEB_PGBOUNCER_ADMIN_DSN.
+func SyncPgBouncer(pgAdminDSN string) error {
+	if !pgBouncerEnabled() {
+		return nil
+	}
+	pgBouncerSyncMu.Lock()
+	defer pgBouncerSyncMu.Unlock()
+
+	databases, err := store.GetAllManagedDatabases()
+	if err != nil {
+		return err
+	}
+	poolSettings, err := store.GetAllDatabasePoolSettings()
+	if err != nil {
+		return err
+	}
+	host, port := pgBouncerTarget()
+	var entries []dbutils.PgBouncerDatabase
+	for _, db := range databases {
+		if db.Status != "active" {
+			continue
+		}
+		entry := dbutils.PgBouncerDatabase{Name: db.PGDatabaseName, Host: host, Port: port}
+		if s, ok := poolSettings[db.DatabaseID]; ok {
+			entry.PoolSize = s.PoolSize
+			if s.PoolMode != nil {
+				entry.PoolMode = *s.PoolMode
+			}
+		}
+		entries = append(entries, entry)
+	}
+	changed, err := dbutils.WriteFileAtomically(os.Getenv("PGWEB_PGBOUNCER_DATABASES_FILE"), dbutils.RenderPgBouncerDatabases(entries), 0o644)
+	if err != nil {
+		return err
+	}
+
+	if authFile := os.Getenv("PGWEB_PGBOUNCER_AUTH_FILE"); authFile != "" {
+		usernames, err := store.GetActivePGUsernames()
+		if err != nil {
+			return err
+		}
+		hashes, err := dbutils.GetRolePasswordHashes(pgAdminDSN, usernames)
+		if err != nil {
+			return err
+		}
+		authChanged, err := dbutils.WriteFileAtomically(authFile, dbutils.RenderPgBouncerAuthFile(hashes), 0o600)
+		if err != nil {
+			return err
+		}
+		changed = changed || authChanged
+	}
+
+	if !changed {
+		return nil
+	}
+	adminConsoleDSN := os.Getenv("PGWEB_PGBOUNCER_ADMIN_DSN")
+	if adminConsoleDSN == "" {
+		log.Println("Warning: PgBouncer configuration changed but PGWEB_PGBOUNCER_ADMIN_DSN is not set; PgBouncer was not reloaded")
+		return nil
+	}
+	if err := dbutils.ReloadPgBouncer(adminConsoleDSN); err != nil {
+		return err
+	}
+	log.Printf("PgBouncer configuration updated (%d databases) and reloaded", len(entries))
+	return nil
+}
+
+// requestPgBouncerSync syncs the PgBouncer configuration in the background after a database, PG user
+// or password changed. Failures are logged; the periodic sync retries them.
+func requestPgBouncerSync() {
+	if !pgBouncerEnabled() {
+		return
+	}
+	go func() {
+		if err := SyncPgBouncer(os.Getenv("PG_ADMIN_DSN")); err != nil {
+			log.Printf("Error syncing PgBouncer configuration: %v", err)
+		}
+	}()
+}
+
+// RunPgBouncerSync is the periodic PgBouncer sync.
+func RunPgBouncerSync(pgAdminDSN string) {
+	if err := SyncPgBouncer(pgAdminDSN); err != nil {
+		log.Printf("Error syncing PgBouncer configuration: %v", err)
+	}
+}
+
+// GetDatabasePoolHandler handles requests for the PgBouncer pool settings of a managed database.
+func GetDatabasePoolHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	settings, err := store.GetDatabasePoolSettings(managedDB.DatabaseID)
+	if err == sql.ErrNoRows {
+		settings = &models.DatabasePoolSettings{DatabaseID: managedDB.DatabaseID}
+	} else if err != nil {
+		log.Printf("Error fetching pool settings of database %s: %v", managedDB.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pool settings"})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateDatabasePoolHandler handles requests to change the PgBouncer pool size and mode of a managed database.
+func UpdateDatabasePoolHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	if !pgBouncerEnabled() {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "PgBouncer integration is not configured"})
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	var req UpdateDatabasePoolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+	if err := validatePoolSettings(req, maxPgBouncerPoolSize()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings := &models.DatabasePoolSettings{DatabaseID: managedDB.DatabaseID, PoolSize: req.PoolSize, PoolMode: req.PoolMode}
+	if err := store.SetDatabasePoolSettings(settings); err != nil {
+		log.Printf("Error saving pool settings of database %s: %v", managedDB.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save pool settings"})
+		return
+	}
+	if err := SyncPgBouncer(os.Getenv("PG_ADMIN_DSN")); err != nil {
+		log.Printf("Error syncing PgBouncer after pool change of database %s: %v", managedDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Pool settings were saved but PgBouncer could not be updated: " + err.Error()})
+		return
+	}
+
+	store.WriteAuditLog(&currentUser.InternalUserID, "database.pool_update", "database", managedDB.DatabaseID.String(), map[string]any{
+		"pg_database_name": managedDB.PGDatabaseName, "pool_size": req.PoolSize, "pool_mode": req.PoolMode,
+	})
+	c.JSON(http.StatusOK, settings)
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import "testing"
+
+func TestValidatePoolSettings(t *testing.T) {
+	size := func(n int) *int { return &n }
+	mode := func(m string) *string { return &m }
+
+	tests := []struct {
+		name    string
+		req     UpdateDatabasePoolRequest
+		wantErr bool
+	}{
+		{"defaults", UpdateDatabasePoolRequest{}, false},
+		{"valid", UpdateDatabasePoolRequest{PoolSize: size(20), PoolMode: mode("transaction")}, false},
+		{"at maximum", UpdateDatabasePoolRequest{PoolSize: size(50)}, false},
+		{"zero size", UpdateDatabasePoolRequest{PoolSize: size(0)}, true},
+		{"above maximum", UpdateDatabasePoolRequest{PoolSize: size(51)}, true},
+		{"unknown mode", UpdateDatabasePoolRequest{PoolMode: mode("batch")}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePoolSettings(tt.req, 50); (err != nil) != tt.wantErr {
+				t.Errorf("validatePoolSettings() error = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"pgweb-backend/dbutils"
+	"pgweb-backend/models"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// errProvisioningInProgress is returned when a database is already being provisioned or rolled back.
+var errProvisioningInProgress = errors.New("provisioning of this database is already in progress")
+
+// lockProvisioning takes the advisory lock that guards provisioning and rollback of a database
+// across all backend replicas. It returns errProvisioningInProgress if the lock is held elsewhere.
+func lockProvisioning(databaseID uuid.UUID) (func(), error) {
+	release, ok, err := store.TryAdvisoryLock("provisioning:" + databaseID.String())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errProvisioningInProgress
+	}
+	return release, nil
+}
+
+// ProvisioningStatusResponse is the provisioning progress of a managed database.
+type ProvisioningStatusResponse struct {
+	Status string                    `json:"status"`
+	Steps  []models.ProvisioningStep `json:"steps"`
+}
+
+// runProvisioning provisions a managed database from fromStep (empty for the first step), recording
+// the progress of each step. The database becomes "active" on success and "error" on failure.
+// It returns the name of the failed step with the error. The caller must hold the provisioning lock.
+func runProvisioning(pgAdminDSN string, managedDB *models.ManagedDatabase, fromStep string) (string, error) {
+	positions := make(map[string]int)
+	for i, name := range dbutils.ProvisioningStepNames() {
+		positions[name] = i
+	}
+	progress := func(step, status string, stepErr error) {
+		var err error
+		switch status {
+		case dbutils.StepRunning:
+			err = store.StartProvisioningStep(managedDB.DatabaseID, step, positions[step])
+		case dbutils.StepFailed:
+			err = store.FinishProvisioningStep(managedDB.DatabaseID, step, status, stepErr.Error())
+		default:
+			err = store.FinishProvisioningStep(managedDB.DatabaseID, step, status, "")
+		}
+		if err != nil {
+			log.Printf("Warning: failed to record provisioning step %s for database %s: %v", step, managedDB.PGDatabaseName, err)
+		}
+	}
+
+	failedStep, provisionErr := dbutils.ProvisionDatabase(pgAdminDSN, managedDB.PGDatabaseName, fromStep, progress)
+	managedDB.Status = "active"
+	if provisionErr != nil {
+		managedDB.Status = "error"
+	}
+	if err := store.UpdateManagedDatabaseStatus(managedDB.DatabaseID, managedDB.OwnerUserID, managedDB.Status); err != nil {
+		log.Printf("Warning: failed to set status of database %s to %s: %v", managedDB.PGDatabaseName, managedDB.Status, err)
+	}
+	if provisionErr == nil {
+		requestPgBouncerSync()
+	}
+	return failedStep, provisionErr
+}
+
+// resumeProvisioningStep returns the step to resume provisioning from: the first step that did
+// not complete. If every recorded step completed, provisioning restarts from the first step;
+// the steps are idempotent, so this only verifies the configuration.
+func resumeProvisioningStep(steps []models.ProvisioningStep) string {
+	completed := make(map[string]bool)
+	for _, s := range steps {
+		if s.Status == dbutils.StepCompleted {
+			completed[s.Step] = true
+		}
+	}
+	for _, name := range dbutils.ProvisioningStepNames() {
+		if !completed[name] {
+			return name
+		}
+	}
+	return ""
+}
+
+// lockUnprovisionedDatabase loads an owned database whose provisioning failed or did not finish and
+// takes its provisioning lock. The status is checked again under the lock, since another replica may
+// have finished in the meantime. On failure it writes the error response and returns false; otherwise
+// the caller must call release.
+func lockUnprovisionedDatabase(c *gin.Context, ownerUserID uuid.UUID) (managedDB *models.ManagedDatabase, release func(), ok bool) {
+	owned, ok := loadOwnedDatabase(c, ownerUserID)
+	if !ok {
+		return nil, nil, false
+	}
+	release, err := lockProvisioning(owned.DatabaseID)
+	if err != nil {
+		if errors.Is(err, errProvisioningInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return nil, nil, false
+		}
+		log.Printf("Error locking provisioning of database %s: %v", owned.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lock database provisioning"})
+		return nil, nil, false
+	}
+	current, err := store.GetManagedDatabaseByID(owned.DatabaseID, ownerUserID)
+	if err != nil {
+		release()
+		log.Printf("Error reloading database %s: %v", owned.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve database details"})
+		return nil, nil, false
+	}
+	if current.Status != "error" && current.Status != "creating" {
+		release()
+		c.JSON(http.StatusConflict, gin.H{"error": "Database provisioning has already completed"})
+		return nil, nil, false
+	}
+	return &current.ManagedDatabase, release, true
+}
+
+// GetProvisioningStatusHandler handles requests for the provisioning step log of a managed database.
+func GetProvisioningStatusHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+
+	steps, err := store.GetProvisioningSteps(managedDB.DatabaseID)
+	if err != nil {
+		log.Printf("Error fetching provisioning steps for database %s: %v", managedDB.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve provisioning steps"})
+		return
+	}
+	if steps == nil { // Ensure we return an empty list, not null
+		steps = []models.ProvisioningStep{}
+	}
+	c.JSON(http.StatusOK, ProvisioningStatusResponse{Status: managedDB.Status, Steps: steps})
+}
+
+// ResumeProvisioningHandler handles requests to resume a failed database provisioning from the failed step.
+func ResumeProvisioningHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	pgAdminDSN, ok := requirePGAdminDSN(c, "ResumeProvisioningHandler", "Database provisioning")
+	if !ok {
+		return
+	}
+	managedDB, release, ok := lockUnprovisionedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	defer release()
+
+	steps, err := store.GetProvisioningSteps(managedDB.DatabaseID)
+	if err != nil {
+		log.Printf("Error fetching provisioning steps for database %s: %v", managedDB.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve provisioning steps"})
+		return
+	}
+	fromStep := resumeProvisioningStep(steps)
+
+	failedStep, err := runProvisioning(pgAdminDSN, managedDB, fromStep)
+	store.WriteAuditLog(&currentUser.InternalUserID, "database.provisioning_resume", "database", managedDB.DatabaseID.String(), map[string]string{"from_step": fromStep, "failed_step": failedStep})
+	if err != nil {
+		log.Printf("Error resuming provisioning of database %s: %v", managedDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to provision database: " + err.Error(), "failed_step": failedStep, "database": managedDB})
+		return
+	}
+	log.Printf("Provisioning of database %s resumed from %s and completed by user %s", managedDB.PGDatabaseName, fromStep, currentUser.InternalUserID)
+	c.JSON(http.StatusOK, managedDB)
+}
+
+// RollbackProvisioningHandler handles requests to fully roll back a failed database provisioning:
+// the PostgreSQL database and roles are dropped and the database record is removed.
+func RollbackProvisioningHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	pgAdminDSN, ok := requirePGAdminDSN(c, "RollbackProvisioningHandler", "Database provisioning")
+	if !ok {
+		return
+	}
+	managedDB, release, ok := lockUnprovisionedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	defer release()
+
+	if err := dbutils.RollbackDatabaseProvisioning(pgAdminDSN, managedDB.PGDatabaseName); err != nil {
+		log.Printf("Error rolling back provisioning of database %s: %v", managedDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to roll back database provisioning: " + err.Error()})
+		return
+	}
+	if err := store.DeleteManagedDatabase(managedDB.DatabaseID); err != nil {
+		log.Printf("Error deleting record of rolled back database %s: %v", managedDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete database record"})
+		return
+	}
+
+	log.Printf("Provisioning of database %s rolled back by user %s", managedDB.PGDatabaseName, currentUser.InternalUserID)
+	store.WriteAuditLog(&currentUser.InternalUserID, "database.provisioning_rollback", "database", managedDB.DatabaseID.String(), map[string]string{"pg_database_name": managedDB.PGDatabaseName})
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"testing"
+
+	"pgweb-backend/models"
+)
+
+func TestResumeProvisioningStep(t *testing.T) {
+	step := func(name, status string) models.ProvisioningStep {
+		return models.ProvisioningStep{Step: name, Status: status}
+	}
+	tests := []struct {
+		name  string
+		steps []models.ProvisioningStep
+		want  string
+	}{
+		{"nothing recorded", nil, "create_database"},
+		{"failed step", []models.ProvisioningStep{step("create_database", "completed"), step("harden_database", "completed"), step("create_extensions", "failed")}, "create_extensions"},
+		{"interrupted step", []models.ProvisioningStep{step("create_database", "completed"), step("harden_database", "running")}, "harden_database"},
+		{"next unrecorded step", []models.ProvisioningStep{step("create_database", "completed")}, "harden_database"},
+		{"all completed", []models.ProvisioningStep{
+			step("create_database", "completed"), step("harden_database", "completed"), step("create_extensions", "completed"),
+			step("create_roles", "completed"), step("grant_database_privileges", "completed"), step("configure_public_schema", "completed"),
+		}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resumeProvisioningStep(tt.steps); got != tt.want {
+				t.Errorf("resumeProvisioningStep() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"pgweb-backend/dbutils"
+	"pgweb-backend/models"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// queryStatsDefaultLimit and queryStatsMaxLimit bound the number of statements returned by GetQueryStatsHandler.
+	queryStatsDefaultLimit = 20
+	queryStatsMaxLimit     = 100
+	// queryStatsSnapshotSize is the number of top statements by total time kept in each snapshot.
+	queryStatsSnapshotSize = 100
+	// queryStatsDefaultHistoryHours is the period returned by GetQueryStatsHistoryHandler by default.
+	queryStatsDefaultHistoryHours = 24
+)
+
+// QueryStatsEntryResponse is a statement's counters with how much they grew since the last snapshot.
+type QueryStatsEntryResponse struct {
+	models.QueryStatsEntry
+	Managed bool                       `json:"managed"`
+	Delta   *models.QueryStatsCounters `json:"delta"` // Null if the statement was not in the last snapshot
+}
+
+// QueryStatsHistoryPoint is a snapshot's totals with how much they grew since the previous snapshot.
+type QueryStatsHistoryPoint struct {
+	models.QueryStatsSnapshot
+	Delta *models.QueryStatsCounters `json:"delta"` // Null for the first snapshot of the period
+}
+
+// QueryStatsSnapshotSchedule returns the interval of query statistics snapshots
+// (PGWEB_QUERY_STATS_SNAPSHOT_INTERVAL_MINUTES, default 60, 0 disables) and how long snapshots are kept
+// (PGWEB_QUERY_STATS_RETENTION_DAYS, default 7).
+func QueryStatsSnapshotSchedule() (interval, retention time.Duration) {
+	interval, retention = time.Hour, 7*24*time.Hour
+	if v := os.Getenv("PGWEB_QUERY_STATS_SNAPSHOT_INTERVAL_MINUTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			interval = time.Duration(n) * time.Minute
+		} else {
+			log.Printf("Warning: ignoring invalid value for PGWEB_QUERY_STATS_SNAPSHOT_INTERVAL_MINUTES: %q", v)
+		}
+	}
+	if v := os.Getenv("PGWEB_QUERY_STATS_RETENTION_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			retention = time.Duration(n) * 24 * time.Hour
+		} else {
+			log.Printf("Warning: ignoring invalid value for PGWEB_QUERY_STATS_RETENTION_DAYS: %q", v)
+		}
+	}
+	return interval, retention
+}
+
+// queryStatsDelta returns how much cumulative counters grew from previous to current. Counters that went
+// down were reset in between, so the current values are the growth since the reset.
+func queryStatsDelta(current, previous models.QueryStatsCounters) models.QueryStatsCounters {
+	if current.Calls < previous.Calls || current.TotalTimeMS < previous.TotalTimeMS || current.Rows < previous.Rows {
+		return current
+	}
+	return models.QueryStatsCounters{
+		Calls:       current.Calls - previous.Calls,
+		TotalTimeMS: current.TotalTimeMS - previous.TotalTimeMS,
+		Rows:        current.Rows - previous.Rows,
+	}
+}
+
+// queryStatsEntries adds the growth since the previous snapshot (nil if there is none) to each statement,
+// marks the statements of managed roles and hides the text of all others, as for sessions.
+func queryStatsEntries(entries []models.QueryStatsEntry, previous *models.QueryStatsSnapshot, managedRoles map[string]bool) []QueryStatsEntryResponse {
+	type statementKey struct {
+		queryID  int64
+		username string
+	}
+	before := make(map[statementKey]models.QueryStatsCounters)
+	if previous != nil {
+		for _, e := range previous.Queries {
+			before[statementKey{e.QueryID, e.PGUsername}] = e.QueryStatsCounters
+		}
+	}
+	result := make([]QueryStatsEntryResponse, 0, len(entries))
+	for _, e := range entries {
+		managed := managedRoles[e.PGUsername]
+		if !managed {
+			e.Query = ""
+		}
+		entry := QueryStatsEntryResponse{QueryStatsEntry: e, Managed: managed}
+		if prev, ok := before[statementKey{e.QueryID, e.PGUsername}]; ok {
+			delta := queryStatsDelta(e.QueryStatsCounters, prev)
+			entry.Delta = &delta
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// queryStatsHistory pairs each snapshot, oldest first, with its growth since the one before.
+func queryStatsHistory(snapshots []models.QueryStatsSnapshot) []QueryStatsHistoryPoint {
+	points := make([]QueryStatsHistoryPoint, 0, len(snapshots))
+	for i, s := range snapshots {
+		point := QueryStatsHistoryPoint{QueryStatsSnapshot: s}
+		if i > 0 {
+			delta := queryStatsDelta(s.QueryStatsCounters, snapshots[i-1].QueryStatsCounters)
+			point.Delta = &delta
+		}
+		points = append(points, point)
+	}
+	return points
+}
+
+// RunQueryStatsSnapshots records a query statistics snapshot of every active managed database with
+// pg_stat_statements and deletes snapshots older than retention. Only one replica samples at a time.
+func RunQueryStatsSnapshots(pgAdminDSN string, retention time.Duration) {
+	release, ok, err := store.TryAdvisoryLock("query_stats_snapshots")
+	if err != nil {
+		log.Printf("Error taking query statistics snapshot lock: %v", err)
+		return
+	}
+	if !ok {
+		return // Another replica is sampling
+	}
+	defer release()
+
+	databases, err := store.GetAllManagedDatabases()
+	if err != nil {
+		log.Printf("Error fetching databases for query statistics snapshots: %v", err)
+		return
+	}
+	taken := 0
+	for _, managedDB := range databases {
+		if managedDB.Status != "active" {
+			continue
+		}
+		snapshot, err := dbutils.GetQueryStats(pgAdminDSN, managedDB.PGDatabaseName, "total_time", queryStatsSnapshotSize)
+		if err != nil {
+			if !errors.Is(err, dbutils.ErrPgStatStatementsUnavailable) {
+				log.Printf("Warning: failed to read query statistics of database %s: %v", managedDB.PGDatabaseName, err)
+			}
+			continue
+		}
+		snapshot.DatabaseID = managedDB.DatabaseID
+		if err := store.CreateQueryStatsSnapshot(snapshot); err != nil {
+			log.Printf("Warning: failed to record query statistics snapshot of database %s: %v", managedDB.PGDatabaseName, err)
+			continue
+		}
+		taken++
+	}
+
+	deleted, err := store.DeleteQueryStatsSnapshotsBefore(time.Now().Add(-retention))
+	if err != nil {
+		log.Printf("Error deleting old query statistics snapshots: %v", err)
+	}
+	if taken > 0 || deleted > 0 {
+		log.Printf("Query statistics: %d snapshots taken, %d expired snapshots deleted", taken, deleted)
+	}
+}
+
+// respondQueryStatsError reports an error reading or resetting query statistics.
+func respondQueryStatsError(c *gin.Context, dbName, action string, err error) {
+	if errors.Is(err, dbutils.ErrPgStatStatementsUnavailable) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Query statistics are not available: pg_stat_statements is not enabled for this database"})
+		return
+	}
+	log.Printf("Error trying to %s of database %s: %v", action, dbName, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+}
+
+// GetQueryStatsHandler handles requests for the top statements of a managed database from
+// pg_stat_statements, with their growth since the last snapshot.
+func GetQueryStatsHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	orderBy := c.DefaultQuery("sort", "total_time")
+	if !dbutils.ValidQueryStatsOrder(orderBy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be one of total_time, mean_time, calls or rows"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(queryStatsDefaultLimit)))
+	if err != nil || limit < 1 || limit > queryStatsMaxLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", queryStatsMaxLimit)})
+		return
+	}
+	roles, ok := managedRoleNames(c, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	pgAdminDSN, ok := requirePGAdminDSN(c, "GetQueryStatsHandler", "Query statistics")
+	if !ok {
+		return
+	}
+
+	stats, err := dbutils.GetQueryStats(pgAdminDSN, managedDB.PGDatabaseName, orderBy, limit)
+	if err != nil {
+		respondQueryStatsError(c, managedDB.PGDatabaseName, "retrieve query statistics", err)
+		return
+	}
+	previous, err := store.GetLatestQueryStatsSnapshot(managedDB.DatabaseID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Warning: failed to fetch last query statistics snapshot of database %s: %v", managedDB.DatabaseID, err)
+	}
+	managedRoles := make(map[string]bool, len(roles))
+	for _, r := range roles {
+		managedRoles[r] = true
+	}
+
+	response := gin.H{
+		"captured_at": stats.CapturedAt,
+		"query_count": stats.QueryCount,
+		"totals":      stats.QueryStatsCounters,
+		"queries":     queryStatsEntries(stats.Queries, previous, managedRoles),
+		"snapshot_at": nil,
+		"delta":       nil,
+	}
+	if previous != nil {
+		response["snapshot_at"] = previous.CapturedAt
+		response["delta"] = queryStatsDelta(stats.QueryStatsCounters, previous.QueryStatsCounters)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetQueryStatsHistoryHandler handles requests for the query statistics snapshots of a managed database
+// over the last ?hours (default 24), with the growth between consecutive snapshots.
+func GetQueryStatsHistoryHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", strconv.Itoa(queryStatsDefaultHistoryHours)))
+	if err != nil || hours < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "hours must be a positive integer"})
+		return
+	}
+	snapshots, err := store.GetQueryStatsSnapshots(managedDB.DatabaseID, time.Now().Add(-time.Duration(hours)*time.Hour))
+	if err != nil {
+		log.Printf("Error listing query statistics snapshots of database %s: %v", managedDB.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve query statistics history"})
+		return
+	}
+	c.JSON(http.StatusOK, queryStatsHistory(snapshots))
+}
+
+// ResetQueryStatsHandler handles requests to reset the pg_stat_statements counters of a managed database.
+// Stored snapshots are kept; growth is computed from zero after the reset.
+func ResetQueryStatsHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	pgAdminDSN, ok := requirePGAdminDSN(c, "ResetQueryStatsHandler", "Query statistics")
+	if !ok {
+		return
+	}
+	if err := dbutils.ResetQueryStats(pgAdminDSN, managedDB.PGDatabaseName); err != nil {
+		respondQueryStatsError(c, managedDB.PGDatabaseName, "reset query statistics", err)
+		return
+	}
+
+	log.Printf("Query statistics of database %s reset by user %s", managedDB.PGDatabaseName, currentUser.InternalUserID)
+	store.WriteAuditLog(&currentUser.InternalUserID, "database.query_stats_reset", "database", managedDB.DatabaseID.String(), nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Query statistics reset"})
+}
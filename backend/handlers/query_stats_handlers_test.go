@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"pgweb-backend/models"
+)
+
+func counters(calls int64, totalMS float64, rows int64) models.QueryStatsCounters {
+	return models.QueryStatsCounters{Calls: calls, TotalTimeMS: totalMS, Rows: rows}
+}
+
+func TestQueryStatsDelta(t *testing.T) {
+	if got, want := queryStatsDelta(counters(150, 90.5, 40), counters(100, 60.5, 30)), counters(50, 30, 10); got != want {
+		t.Errorf("queryStatsDelta() = %+v, want %+v", got, want)
+	}
+	// Counters going down were reset in between.
+	if got, want := queryStatsDelta(counters(5, 2, 1), counters(100, 60.5, 30)), counters(5, 2, 1); got != want {
+		t.Errorf("queryStatsDelta() after reset = %+v, want %+v", got, want)
+	}
+}
+
+func TestQueryStatsEntries(t *testing.T) {
+	previous := &models.QueryStatsSnapshot{Queries: []models.QueryStatsEntry{
+		{QueryID: 1, PGUsername: "shop__app", QueryStatsCounters: counters(10, 5, 10)},
+		{QueryID: 2, PGUsername: "postgres", QueryStatsCounters: counters(1, 1, 0)},
+	}}
+	entries := queryStatsEntries([]models.QueryStatsEntry{
+		{QueryID: 1, PGUsername: "shop__app", Query: "SELECT * FROM orders WHERE id = $1", QueryStatsCounters: counters(30, 15, 30)},
+		{QueryID: 1, PGUsername: "shop__report", Query: "SELECT * FROM orders WHERE id = $1", QueryStatsCounters: counters(3, 1, 3)},
+		{QueryID: 2, PGUsername: "postgres", Query: "ALTER ROLE x PASSWORD 'secret'", QueryStatsCounters: counters(2, 2, 0)},
+	}, previous, map[string]bool{"shop__app": true, "shop__report": true})
+
+	if len(entries) != 3 {
+		t.Fatalf("queryStatsEntries() returned %d entries, want 3", len(entries))
+	}
+	if e := entries[0]; !e.Managed || e.Query == "" || e.Delta == nil || *e.Delta != counters(20, 10, 20) {
+		t.Errorf("entry 0 = %+v, want managed with delta {20 10 20}", e)
+	}
+	if e := entries[1]; e.Delta != nil {
+		t.Errorf("entry 1 delta = %+v, want nil for a statement not in the snapshot", e.Delta)
+	}
+	if e := entries[2]; e.Managed || e.Query != "" || e.Delta == nil {
+		t.Errorf("entry 2 = %+v, want unmanaged with query hidden and a delta", e)
+	}
+
+	if got := queryStatsEntries(previous.Queries, nil, nil); got[0].Delta != nil {
+		t.Errorf("queryStatsEntries() without a snapshot delta = %+v, want nil", got[0].Delta)
+	}
+}
+
+func TestQueryStatsHistory(t *testing.T) {
+	now := time.Now()
+	points := queryStatsHistory([]models.QueryStatsSnapshot{
+		{CapturedAt: now.Add(-2 * time.Hour), QueryStatsCounters: counters(100, 50, 100)},
+		{CapturedAt: now.Add(-time.Hour), QueryStatsCounters: counters(160, 80, 130)},
+		{CapturedAt: now, QueryStatsCounters: counters(20, 10, 5)},
+	})
+	if len(points) != 3 || points[0].Delta != nil {
+		t.Fatalf("queryStatsHistory() = %+v, want 3 points, the first without delta", points)
+	}
+	if *points[1].Delta != counters(60, 30, 30) {
+		t.Errorf("point 1 delta = %+v, want {60 30 30}", *points[1].Delta)
+	}
+	if *points[2].Delta != counters(20, 10, 5) {
+		t.Errorf("point 2 delta = %+v, want {20 10 5} after a reset", *points[2].Delta)
+	}
+}
+
+func TestQueryStatsSnapshotSchedule(t *testing.T) {
+	t.Setenv("PGWEB_QUERY_STATS_SNAPSHOT_INTERVAL_MINUTES", "15")
+	t.Setenv("PGWEB_QUERY_STATS_RETENTION_DAYS", "0")
+	interval, retention := QueryStatsSnapshotSchedule()
+	if interval != 15*time.Minute || retention != 7*24*time.Hour {
+		t.Errorf("QueryStatsSnapshotSchedule() = %s, %s, want 15m and the 7 day default", interval, retention)
+	}
+}
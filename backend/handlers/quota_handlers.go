@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"pgweb-backend/dbutils"
+	"pgweb-backend/models"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// UsageResponse shows a user's resource consumption against their quota.
+type UsageResponse struct {
+	Plan   string             `json:"plan"`
+	Limits models.QuotaLimits `json:"limits"`
+	Usage  models.QuotaUsage  `json:"usage"`
+}
+
+// SetUserQuotaRequest defines the request body for assigning a quota plan and overrides to a user.
+type SetUserQuotaRequest struct {
+	Plan      string                `json:"plan"` // Empty for the default plan
+	Overrides models.QuotaOverrides `json:"overrides"`
+}
+
+// UserQuotaResponse shows a user's quota assignment and the resulting limits.
+type UserQuotaResponse struct {
+	Email     string                `json:"email"`
+	Plan      string                `json:"plan"`
+	Overrides models.QuotaOverrides `json:"overrides"`
+	Limits    models.QuotaLimits    `json:"limits"`
+}
+
+// defaultQuotaLimits reads the default limits from PGWEB_QUOTA_MAX_DATABASES,
+// PGWEB_QUOTA_MAX_PG_USERS_PER_DATABASE, PGWEB_QUOTA_MAX_STORAGE_MB and
+// PGWEB_QUOTA_MAX_BACKUP_STORAGE_MB and PGWEB_QUOTA_MAX_DATABASE_SIZE_MB. Unset or 0 means unlimited.
+func defaultQuotaLimits() models.QuotaLimits {
+	readInt := func(envVar string) int64 {
+		v := os.Getenv(envVar)
+		if v == "" {
+			return 0
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			log.Printf("Warning: ignoring invalid value for %s: %q", envVar, v)
+			return 0
+		}
+		return n
+	}
+	return models.QuotaLimits{
+		MaxDatabases:          int(readInt("PGWEB_QUOTA_MAX_DATABASES")),
+		MaxPGUsersPerDatabase: int(readInt("PGWEB_QUOTA_MAX_PG_USERS_PER_DATABASE")),
+		MaxStorageBytes:       readInt("PGWEB_QUOTA_MAX_STORAGE_MB") << 20,
+		MaxBackupStorageBytes: readInt("PGWEB_QUOTA_MAX_BACKUP_STORAGE_MB") << 20,
+		MaxDatabaseSizeBytes:  readInt("PGWEB_QUOTA_MAX_DATABASE_SIZE_MB") << 20,
+	}
+}
+
+// loadQuotaPlans parses the named quota plans in PGWEB_QUOTA_PLANS, a JSON object mapping plan
+// names to overrides of the default limits, e.g. {"team-data": {"max_databases": 20}}.
+func loadQuotaPlans() (map[string]models.QuotaOverrides, error) {
+	plans := make(map[string]models.QuotaOverrides)
+	if v := strings.TrimSpace(os.Getenv("PGWEB_QUOTA_PLANS")); v != "" {
+		if err := json.Unmarshal([]byte(v), &plans); err != nil {
+			return nil, fmt.Errorf("invalid PGWEB_QUOTA_PLANS: %w", err)
+		}
+	}
+	return plans, nil
+}
+
+// applyQuotaOverrides returns limits with the non-nil overrides applied.
+func applyQuotaOverrides(limits models.QuotaLimits, o models.QuotaOverrides) models.QuotaLimits {
+	if o.MaxDatabases != nil {
+		limits.MaxDatabases = *o.MaxDatabases
+	}
+	if o.MaxPGUsersPerDatabase != nil {
+		limits.MaxPGUsersPerDatabase = *o.MaxPGUsersPerDatabase
+	}
+	if o.MaxStorageBytes != nil {
+		limits.MaxStorageBytes = *o.MaxStorageBytes
+	}
+	if o.MaxBackupStorageBytes != nil {
+		limits.MaxBackupStorageBytes = *o.MaxBackupStorageBytes
+	}
+	if o.MaxDatabaseSizeBytes != nil {
+		limits.MaxDatabaseSizeBytes = *o.MaxDatabaseSizeBytes
+	}
+	return limits
+}
+
+// validateQuotaOverrides rejects negative limits.
+func validateQuotaOverrides(o models.QuotaOverrides) error {
+	if (o.MaxDatabases != nil && *o.MaxDatabases < 0) || (o.MaxPGUsersPerDatabase != nil && *o.MaxPGUsersPerDatabase < 0) ||
+		(o.MaxStorageBytes != nil && *o.MaxStorageBytes < 0) || (o.MaxBackupStorageBytes != nil && *o.MaxBackupStorageBytes < 0) ||
+		(o.MaxDatabaseSizeBytes != nil && *o.MaxDatabaseSizeBytes < 0) {
+		return fmt.Errorf("quota limits must not be negative (0 means unlimited)")
+	}
+	return nil
+}
+
+// resolveQuota computes the limits of a user: the defaults, overridden by the user's plan
+// (or PGWEB_QUOTA_DEFAULT_PLAN), overridden by the user's own overrides.
+func resolveQuota(assignment *models.UserQuota, plans map[string]models.QuotaOverrides) (string, models.QuotaLimits) {
+	plan := os.Getenv("PGWEB_QUOTA_DEFAULT_PLAN")
+	if assignment != nil && assignment.Plan != "" {
+		plan = assignment.Plan
+	}
+	limits := defaultQuotaLimits()
+	if plan != "" {
+		if overrides, ok := plans[plan]; ok {
+			limits = applyQuotaOverrides(limits, overrides)
+		} else {
+			log.Printf("Warning: unknown quota plan %q; using the default limits", plan)
+		}
+	}
+	if assignment != nil {
+		limits = applyQuotaOverrides(limits, assignment.Overrides)
+	}
+	return plan, limits
+}
+
+// effectiveQuota returns the plan and limits that apply to a user.
+func effectiveQuota(internalUserID uuid.UUID) (string, models.QuotaLimits, error) {
+	assignment, err := store.GetUserQuota(internalUserID)
+	if err != nil && err != sql.ErrNoRows {
+		return "", models.QuotaLimits{}, err
+	}
+	plans, err := loadQuotaPlans()
+	if err != nil {
+		return "", models.QuotaLimits{}, err
+	}
+	plan, limits := resolveQuota(assignment, plans)
+	return plan, limits, nil
+}
+
+// quotaUsage computes a user's consumption. Storage is only measured if pgAdminDSN is set.
+func quotaUsage(pgAdminDSN string, internalUserID uuid.UUID) (models.QuotaUsage, error) {
+	usage := models.QuotaUsage{PGUsersByDatabase: make(map[string]int)}
+	databases, err := store.GetManagedDatabasesByOwner(internalUserID)
+	if err != nil {
+		return usage, err
+	}
+	var names []string
+	for _, db := range databases {
+		if db.Status == "soft_deleted" {
+			continue
+		}
+		usage.Databases++
+		names = append(names, db.PGDatabaseName)
+		count, err := store.CountManagedPGUsersByDatabaseID(db.DatabaseID)
+		if err != nil {
+			return usage, err
+		}
+		usage.PGUsersByDatabase[db.PGDatabaseName] = count
+	}
+	if pgAdminDSN != "" {
+		sizes, err := dbutils.GetDatabaseSizes(pgAdminDSN, names)
+		if err != nil {
+			return usage, err
+		}
+		for _, size := range sizes {
+			usage.StorageBytes += size
+		}
+	}
+	if usage.BackupStorageBytes, err = store.GetBackupStorageBytesByOwner(internalUserID); err != nil {
+		return usage, err
+	}
+	return usage, nil
+}
+
+// quotaExceeded writes a 403 Forbidden response for an exhausted quota.
+func quotaExceeded(c *gin.Context, message string, limits models.QuotaLimits) {
+	c.JSON(http.StatusForbidden, gin.H{"error": "Quota exceeded: " + message, "limits": limits})
+}
+
+// loadEffectiveQuota returns the limits of a user. On failure it writes the error response and returns false.
+func loadEffectiveQuota(c *gin.Context, internalUserID uuid.UUID) (models.QuotaLimits, bool) {
+	_, limits, err := effectiveQuota(internalUserID)
+	if err != nil {
+		log.Printf("Error resolving quota for user %s: %v", internalUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check quota"})
+		return limits, false
+	}
+	return limits, true
+}
+
+// enforceDatabaseQuota checks that a user may create another database: below the database limit
+// and not above the storage limit. On failure it writes the error response and returns false.
+func enforceDatabaseQuota(c *gin.Context, internalUserID uuid.UUID, pgAdminDSN string) bool {
+	limits, ok := loadEffectiveQuota(c, internalUserID)
+	if !ok {
+		return false
+	}
+	if limits.MaxDatabases == 0 && limits.MaxStorageBytes == 0 {
+		return true
+	}
+	if limits.MaxDatabases > 0 {
+		count, err := store.CountManagedDatabasesByOwner(internalUserID)
+		if err != nil {
+			log.Printf("Error counting databases for user %s: %v", internalUserID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check quota"})
+			return false
+		}
+		if count >= limits.MaxDatabases {
+			quotaExceeded(c, fmt.Sprintf("you have %d of %d allowed databases", count, limits.MaxDatabases), limits)
+			return false
+		}
+	}
+	if limits.MaxStorageBytes > 0 {
+		usage, err := quotaUsage(pgAdminDSN, internalUserID)
+		if err != nil {
+			log.Printf("Error computing usage for user %s: %v", internalUserID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check quota"})
+			return false
+		}
+		if usage.StorageBytes >= limits.MaxStorageBytes {
+			quotaExceeded(c, fmt.Sprintf("your databases use %d of %d allowed bytes", usage.StorageBytes, limits.MaxStorageBytes), limits)
+			return false
+		}
+	}
+	return true
+}
+
+// enforcePGUserQuota checks that another PG user may be created in a database. On failure it writes
+// the error response and returns false.
+func enforcePGUserQuota(c *gin.Context, internalUserID uuid.UUID, databaseID uuid.UUID) bool {
+	limits, ok := loadEffectiveQuota(c, internalUserID)
+	if !ok {
+		return false
+	}
+	if limits.MaxPGUsersPerDatabase == 0 {
+		return true
+	}
+	count, err := store.CountManagedPGUsersByDatabaseID(databaseID)
+	if err != nil {
+		log.Printf("Error counting PG users of database %s: %v", databaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check quota"})
+		return false
+	}
+	if count >= limits.MaxPGUsersPerDatabase {
+		quotaExceeded(c, fmt.Sprintf("the database has %d of %d allowed PostgreSQL users", count, limits.MaxPGUsersPerDatabase), limits)
+		return false
+	}
+	return true
+}
+
+// enforceBackupQuota checks that a user's backups do not already use up the backup storage limit.
+// On failure it writes the error response and returns false.
+func enforceBackupQuota(c *gin.Context, internalUserID uuid.UUID) bool {
+	limits, ok := loadEffectiveQuota(c, internalUserID)
+	if !ok {
+		return false
+	}
+	if limits.MaxBackupStorageBytes == 0 {
+		return true
+	}
+	used, err := store.GetBackupStorageBytesByOwner(internalUserID)
+	if err != nil {
+		log.Printf("Error summing backup storage for user %s: %v", internalUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check quota"})
+		return false
+	}
+	if used >= limits.MaxBackupStorageBytes {
+		quotaExceeded(c, fmt.Sprintf("your backups use %d of %d allowed bytes", used, limits.MaxBackupStorageBytes), limits)
+		return false
+	}
+	return true
+}
+
+// MeUsageHandler handles requests for the current user's resource consumption against their quota.
+func MeUsageHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	plan, limits, err := effectiveQuota(currentUser.InternalUserID)
+	if err != nil {
+		log.Printf("Error resolving quota for user %s: %v", currentUser.InternalUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve quota"})
+		return
+	}
+	usage, err := quotaUsage(os.Getenv("PG_ADMIN_DSN"), currentUser.InternalUserID)
+	if err != nil {
+		log.Printf("Error computing usage for user %s: %v", currentUser.InternalUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve usage"})
+		return
+	}
+	c.JSON(http.StatusOK, UsageResponse{Plan: plan, Limits: limits, Usage: usage})
+}
+
+// loadUserByEmailParam fetches the application user named by the :email path parameter. On failure
+// it writes the error response and returns false.
+func loadUserByEmailParam(c *gin.Context) (*models.ApplicationUser, bool) {
+	user, err := store.GetApplicationUserByEmail(c.Param("email"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return nil, false
+		}
+		log.Printf("Error fetching user %s: %v", c.Param("email"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return nil, false
+	}
+	return user, true
+}
+
+// GetUserQuotaHandler handles admin requests for a user's quota assignment and limits.
+func GetUserQuotaHandler(c *gin.Context) {
+	if requireUser(c) == nil {
+		return
+	}
+	user, ok := loadUserByEmailParam(c)
+	if !ok {
+		return
+	}
+	assignment, err := store.GetUserQuota(user.InternalUserID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error fetching quota of user %s: %v", user.InternalUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve quota"})
+		return
+	}
+	plans, err := loadQuotaPlans()
+	if err != nil {
+		log.Printf("Error loading quota plans: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve quota"})
+		return
+	}
+	plan, limits := resolveQuota(assignment, plans)
+	response := UserQuotaResponse{Email: user.Email, Plan: plan, Limits: limits}
+	if assignment != nil {
+		response.Overrides = assignment.Overrides
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// SetUserQuotaHandler handles admin requests to assign a quota plan and overrides to a user.
+func SetUserQuotaHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	user, ok := loadUserByEmailParam(c)
+	if !ok {
+		return
+	}
+
+	var req SetUserQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+	if err := validateQuotaOverrides(req.Overrides); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	plans, err := loadQuotaPlans()
+	if err != nil {
+		log.Printf("Error loading quota plans: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load quota plans"})
+		return
+	}
+	if _, known := plans[req.Plan]; req.Plan != "" && !known {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown quota plan '%s'", req.Plan)})
+		return
+	}
+
+	assignment := &models.UserQuota{InternalUserID: user.InternalUserID, Plan: req.Plan, Overrides: req.Overrides}
+	if err := store.UpsertUserQuota(assignment); err != nil {
+		log.Printf("Error saving quota of user %s: %v", user.InternalUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save quota"})
+		return
+	}
+
+	plan, limits := resolveQuota(assignment, plans)
+	store.WriteAuditLog(&currentUser.InternalUserID, "admin.quota_update", "user", user.InternalUserID.String(), req)
+	c.JSON(http.StatusOK, UserQuotaResponse{Email: user.Email, Plan: plan, Overrides: assignment.Overrides, Limits: limits})
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"testing"
+
+	"pgweb-backend/models"
+)
+
+func TestResolveQuota(t *testing.T) {
+	t.Setenv("PGWEB_QUOTA_MAX_DATABASES", "3")
+	t.Setenv("PGWEB_QUOTA_MAX_PG_USERS_PER_DATABASE", "5")
+	t.Setenv("PGWEB_QUOTA_MAX_STORAGE_MB", "100")
+	t.Setenv("PGWEB_QUOTA_MAX_BACKUP_STORAGE_MB", "")
+	t.Setenv("PGWEB_QUOTA_MAX_DATABASE_SIZE_MB", "")
+	t.Setenv("PGWEB_QUOTA_PLANS", `{"team": {"max_databases": 10, "max_backup_storage_bytes": 1048576}, "unlimited": {"max_databases": 0, "max_storage_bytes": 0}}`)
+	t.Setenv("PGWEB_QUOTA_DEFAULT_PLAN", "")
+
+	plans, err := loadQuotaPlans()
+	if err != nil {
+		t.Fatalf("loadQuotaPlans() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		assignment *models.UserQuota
+		wantPlan   string
+		want       models.QuotaLimits
+	}{
+		{"defaults", nil, "", models.QuotaLimits{MaxDatabases: 3, MaxPGUsersPerDatabase: 5, MaxStorageBytes: 100 << 20}},
+		{"plan", &models.UserQuota{Plan: "team"}, "team", models.QuotaLimits{MaxDatabases: 10, MaxPGUsersPerDatabase: 5, MaxStorageBytes: 100 << 20, MaxBackupStorageBytes: 1 << 20}},
+		{"plan lifts limits", &models.UserQuota{Plan: "unlimited"}, "unlimited", models.QuotaLimits{MaxPGUsersPerDatabase: 5}},
+		{"user overrides plan", &models.UserQuota{Plan: "team", Overrides: models.QuotaOverrides{MaxDatabases: intPtr(12)}}, "team", models.QuotaLimits{MaxDatabases: 12, MaxPGUsersPerDatabase: 5, MaxStorageBytes: 100 << 20, MaxBackupStorageBytes: 1 << 20}},
+		{"unknown plan uses defaults", &models.UserQuota{Plan: "gone"}, "gone", models.QuotaLimits{MaxDatabases: 3, MaxPGUsersPerDatabase: 5, MaxStorageBytes: 100 << 20}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, got := resolveQuota(tt.assignment, plans)
+			if plan != tt.wantPlan || got != tt.want {
+				t.Errorf("resolveQuota() = %q, %+v, want %q, %+v", plan, got, tt.wantPlan, tt.want)
+			}
+		})
+	}
+
+	t.Run("default plan", func(t *testing.T) {
+		t.Setenv("PGWEB_QUOTA_DEFAULT_PLAN", "team")
+		if plan, got := resolveQuota(nil, plans); plan != "team" || got.MaxDatabases != 10 {
+			t.Errorf("resolveQuota() = %q, %+v, want the team plan", plan, got)
+		}
+	})
+}
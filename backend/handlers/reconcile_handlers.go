@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pgweb-backend/dbutils"
+	"pgweb-backend/models"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ReconcileRequest defines the optional request body for an on-demand reconciliation.
+type ReconcileRequest struct {
+	Repair bool `json:"repair"` // Repair the findings that can be repaired safely
+}
+
+// reconcileMu prevents overlapping reconciliations within this instance; an advisory lock
+// prevents them across replicas.
+var reconcileMu sync.Mutex
+
+// errReconciliationRunning is returned when a reconciliation is already in progress.
+var errReconciliationRunning = errors.New("a reconciliation is already running")
+
+// ReconciliationSchedule returns the interval of scheduled reconciliations (PGWEB_RECONCILE_INTERVAL_MINUTES,
+// default 360, 0 disables) and whether they repair findings (PGWEB_RECONCILE_AUTO_REPAIR).
+func ReconciliationSchedule() (interval time.Duration, repair bool) {
+	interval = 6 * time.Hour
+	if v := os.Getenv("PGWEB_RECONCILE_INTERVAL_MINUTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			interval = time.Duration(n) * time.Minute
+		} else {
+			log.Printf("Warning: ignoring invalid value for PGWEB_RECONCILE_INTERVAL_MINUTES: %q", v)
+		}
+	}
+	return interval, os.Getenv("PGWEB_RECONCILE_AUTO_REPAIR") == "true"
+}
+
+// reconcileIgnoredDatabases lists the unmanaged databases that are expected on the cluster
+// (PGWEB_RECONCILE_IGNORE_DATABASES, comma-separated), e.g. the application database itself.
+func reconcileIgnoredDatabases() map[string]bool {
+	ignored := make(map[string]bool)
+	for _, name := range strings.Split(os.Getenv("PGWEB_RECONCILE_IGNORE_DATABASES"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			ignored[name] = true
+		}
+	}
+	return ignored
+}
+
+// loadManagedDatabaseStates reads everything the application records about each managed database.
+func loadManagedDatabaseStates() ([]dbutils.ManagedDatabaseState, error) {
+	databases, err := store.GetAllManagedDatabases()
+	if err != nil {
+		return nil, err
+	}
+	states := make([]dbutils.ManagedDatabaseState, 0, len(databases))
+	for _, db := range databases {
+		state := dbutils.ManagedDatabaseState{Database: db}
+		if state.PGUsers, err = store.GetManagedPGUsersByDatabaseID(db.DatabaseID); err != nil {
+			return nil, err
+		}
+		if state.PermissionSets, err = store.GetPermissionSetsByDatabaseID(db.DatabaseID); err != nil {
+			return nil, err
+		}
+		if state.Assignments, err = store.GetPermissionSetNamesByDatabaseID(db.DatabaseID); err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// repairFinding applies the fix for a repairable finding.
+func repairFinding(pgAdminDSN string, finding *models.ReconciliationFinding, states []dbutils.ManagedDatabaseState) error {
+	var state *dbutils.ManagedDatabaseState
+	for i := range states {
+		if finding.DatabaseID != nil && states[i].Database.DatabaseID == *finding.DatabaseID {
+			state = &states[i]
+			break
+		}
+	}
+	if state == nil {
+		return errors.New("managed database no longer recorded")
+	}
+	dbName := state.Database.PGDatabaseName
+
+	switch finding.Kind {
+	case "missing_role":
+		if finding.RoleName == dbName+"_read" || finding.RoleName == dbName+"_write" {
+			schemaNames, err := managedSchemaNames(state.Database.DatabaseID)
+			if err != nil {
+				return err
+			}
+			if err := dbutils.EnsureDatabaseRoles(pgAdminDSN, dbName, schemaNames); err != nil {
+				return err
+			}
+			// Granting the write role its privileges again must not lift a storage restriction.
+			if storage, err := store.GetDatabaseStorageState(state.Database.DatabaseID); err == nil && storage.ReadOnlySince != nil {
+				return dbutils.RestrictDatabaseWrites(pgAdminDSN, dbName, schemaNames, state.PermissionSets)
+			}
+			return nil
+		}
+		for _, ps := range state.PermissionSets {
+			if ps.PGRoleName == finding.RoleName {
+				if err := dbutils.CreatePermissionSetRole(pgAdminDSN, dbName, ps.PGRoleName, ps.Grants); err != nil {
+					return err
+				}
+				if storage, err := store.GetDatabaseStorageState(state.Database.DatabaseID); err == nil && storage.ReadOnlySince != nil {
+					return dbutils.RestrictPermissionSetWrites(pgAdminDSN, dbName, ps)
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("no repair for role %s", finding.RoleName)
+	case "missing_membership":
+		for _, u := range state.PGUsers {
+			if finding.PGUserID != nil && u.PGUserID == *finding.PGUserID {
+				return dbutils.GrantRoleToUser(pgAdminDSN, dbName, finding.RoleName, u.PGUsername)
+			}
+		}
+		return errors.New("PG user no longer recorded")
+	case "stale_access":
+		return dbutils.SoftDeletePostgresDatabase(pgAdminDSN, dbName, state.PGUsers, permissionSetRoleNames(state.PermissionSets))
+	}
+	return fmt.Errorf("finding kind %s cannot be repaired", finding.Kind)
+}
+
+// RunReconciliation compares the application database with the PostgreSQL catalog, optionally repairs
+// the repairable findings, and records the run. It returns errReconciliationRunning if a run is in progress
+// on any replica.
+func RunReconciliation(pgAdminDSN, trigger string, repair bool) (*models.ReconciliationRun, error) {
+	if !reconcileMu.TryLock() {
+		return nil, errReconciliationRunning
+	}
+	defer reconcileMu.Unlock()
+	release, ok, err := store.TryAdvisoryLock("reconciliation")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errReconciliationRunning
+	}
+	defer release()
+
+	run := &models.ReconciliationRun{RunID: uuid.New(), Trigger: trigger, Repair: repair, StartedAt: time.Now()}
+	states, err := loadManagedDatabaseStates()
+	if err == nil {
+		var catalog *dbutils.ClusterCatalog
+		catalog, err = dbutils.LoadClusterCatalog(pgAdminDSN)
+		if err == nil {
+			run.Findings = dbutils.FindCatalogDrift(catalog, states, reconcileIgnoredDatabases())
+		}
+	}
+	if err != nil {
+		run.Error = err.Error()
+		log.Printf("Error during reconciliation: %v", err)
+	}
+
+	if repair {
+		// Stale access is repaired per database, so do it once even if several users are affected.
+		repairedStaleAccess := make(map[string]error)
+		for i := range run.Findings {
+			finding := &run.Findings[i]
+			if !finding.Repairable {
+				continue
+			}
+			var repairErr error
+			if prevErr, done := repairedStaleAccess[finding.DatabaseName]; done && finding.Kind == "stale_access" {
+				repairErr = prevErr
+			} else {
+				repairErr = repairFinding(pgAdminDSN, finding, states)
+				if finding.Kind == "stale_access" {
+					repairedStaleAccess[finding.DatabaseName] = repairErr
+				}
+			}
+			if repairErr != nil {
+				finding.RepairError = repairErr.Error()
+				log.Printf("Warning: failed to repair %s for %s/%s: %v", finding.Kind, finding.DatabaseName, finding.RoleName, repairErr)
+				continue
+			}
+			finding.Repaired = true
+			log.Printf("Repaired %s for %s/%s", finding.Kind, finding.DatabaseName, finding.RoleName)
+		}
+	}
+
+	run.CompletedAt = time.Now()
+	if err := store.CreateReconciliationRun(run); err != nil {
+		log.Printf("Warning: failed to record reconciliation run %s: %v", run.RunID, err)
+	}
+	log.Printf("Reconciliation %s (%s, repair: %t) completed with %d finding(s)", run.RunID, trigger, repair, len(run.Findings))
+	return run, nil
+}
+
+// ReconcileHandler handles admin requests to run a reconciliation immediately.
+func ReconcileHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+
+	// The request body is optional; without it the reconciliation only reports.
+	var req ReconcileRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+
+	pgAdminDSN, ok := requirePGAdminDSN(c, "ReconcileHandler", "Reconciliation")
+	if !ok {
+		return
+	}
+
+	run, err := RunReconciliation(pgAdminDSN, "manual", req.Repair)
+	if err != nil {
+		if errors.Is(err, errReconciliationRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error starting reconciliation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start reconciliation"})
+		return
+	}
+	if run.Findings == nil { // Ensure we return an empty list, not null
+		run.Findings = []models.ReconciliationFinding{}
+	}
+
+	store.WriteAuditLog(&currentUser.InternalUserID, "admin.reconcile", "reconciliation_run", run.RunID.String(), map[string]any{"repair": req.Repair, "findings": len(run.Findings)})
+	c.JSON(http.StatusOK, run)
+}
+
+// GetLatestReconciliationHandler handles admin requests for the most recent reconciliation report.
+func GetLatestReconciliationHandler(c *gin.Context) {
+	if requireUser(c) == nil {
+		return
+	}
+	run, err := store.GetLatestReconciliationRun()
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No reconciliation has run yet"})
+			return
+		}
+		log.Printf("Error fetching latest reconciliation run: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve reconciliation report"})
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"pgweb-backend/dbutils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReplicaLagResponse reports how far the read replicas trail the primary.
+type ReplicaLagResponse struct {
+	Endpoints           []ClusterHost           `json:"endpoints"` // Replica endpoints given to read users
+	Replicas            []dbutils.ReplicaStatus `json:"replicas"`  // Physical standbys streaming from the primary
+	MaxReplayLagSeconds *float64                `json:"max_replay_lag_seconds"`
+	MaxReplayLagBytes   int64                   `json:"max_replay_lag_bytes"`
+}
+
+// maxReplicaLag returns the largest replay lag among the replicas. A replica without a replay lag
+// has caught up and counts as zero seconds. Seconds is nil if there are no replicas.
+func maxReplicaLag(replicas []dbutils.ReplicaStatus) (seconds *float64, bytes int64) {
+	for _, r := range replicas {
+		lag := 0.0
+		if r.ReplayLagSeconds != nil {
+			lag = *r.ReplayLagSeconds
+		}
+		if seconds == nil || lag > *seconds {
+			seconds = &lag
+		}
+		if r.ReplayLagBytes > bytes {
+			bytes = r.ReplayLagBytes
+		}
+	}
+	return seconds, bytes
+}
+
+// GetDatabaseReplicaLagHandler handles requests for the replica lag of a managed database.
+// Physical replication is cluster-wide, so every database of the cluster reports the same standbys.
+func GetDatabaseReplicaLagHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	pgAdminDSN, ok := requirePGAdminDSN(c, "GetDatabaseReplicaLagHandler", "Replica monitoring")
+	if !ok {
+		return
+	}
+
+	replicas, err := dbutils.GetReplicaStatuses(pgAdminDSN)
+	if err != nil {
+		log.Printf("Error querying replica lag for database %s: %v", managedDB.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve replica lag"})
+		return
+	}
+	endpoints := replicaHosts(publicClusterEndpoint().Port)
+	if endpoints == nil {
+		endpoints = []ClusterHost{}
+	}
+	response := ReplicaLagResponse{Endpoints: endpoints, Replicas: replicas}
+	response.MaxReplayLagSeconds, response.MaxReplayLagBytes = maxReplicaLag(replicas)
+	c.JSON(http.StatusOK, response)
+}
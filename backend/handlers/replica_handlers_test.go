@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"testing"
+
+	"pgweb-backend/dbutils"
+)
+
+func TestMaxReplicaLag(t *testing.T) {
+	lag := func(v float64) *float64 { return &v }
+
+	if seconds, bytes := maxReplicaLag(nil); seconds != nil || bytes != 0 {
+		t.Errorf("maxReplicaLag(nil) = %v, %d, want nil, 0", seconds, bytes)
+	}
+
+	replicas := []dbutils.ReplicaStatus{
+		{ApplicationName: "idle", ReplayLagSeconds: nil, ReplayLagBytes: 0},
+		{ApplicationName: "behind", ReplayLagSeconds: lag(2.5), ReplayLagBytes: 4096},
+		{ApplicationName: "close", ReplayLagSeconds: lag(0.1), ReplayLagBytes: 8192},
+	}
+	seconds, bytes := maxReplicaLag(replicas)
+	if seconds == nil || *seconds != 2.5 || bytes != 8192 {
+		t.Errorf("maxReplicaLag() = %v, %d, want 2.5, 8192", seconds, bytes)
+	}
+
+	seconds, _ = maxReplicaLag(replicas[:1])
+	if seconds == nil || *seconds != 0 {
+		t.Errorf("maxReplicaLag() of a caught-up replica = %v, want 0", seconds)
+	}
+}
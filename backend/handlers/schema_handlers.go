@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"pgweb-backend/dbutils"
+	"pgweb-backend/models"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CreateSchemaRequest defines the expected request body for creating a schema.
+type CreateSchemaRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// SetSearchPathRequest defines the expected request body for configuring a PG user's search_path.
+type SetSearchPathRequest struct {
+	Schemas []string `json:"schemas"` // Empty list resets to the server default
+}
+
+// Basic validation for schema names.
+// Allows lowercase letters, numbers, underscores. Must start with letter. Length 1-63.
+var schemaNameValidator = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+
+// isSchemaNameValid checks if the user-chosen schema name is valid and not reserved.
+func isSchemaNameValid(name string) bool {
+	if strings.HasPrefix(name, "pg_") || name == "public" || name == "information_schema" {
+		return false
+	}
+	return schemaNameValidator.MatchString(name)
+}
+
+// CreateSchemaHandler handles requests to create a new schema in a managed database.
+func CreateSchemaHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	if managedDB.Status != "active" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Database is not in active state (current state: %s)", managedDB.Status)})
+		return
+	}
+
+	var req CreateSchemaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+
+	schemaName := strings.ToLower(strings.TrimSpace(req.Name))
+	if !isSchemaNameValid(schemaName) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schema name. Must be 1-63 chars, lowercase alphanumeric, underscores, start with letter, no 'pg_' prefix, and not 'public' or 'information_schema'."})
+		return
+	}
+
+	exists, err := store.CheckIfSchemaNameExistsInDB(managedDB.DatabaseID, schemaName)
+	if err != nil {
+		log.Printf("Error checking if schema %s exists in DB %s: %v", schemaName, managedDB.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate schema name uniqueness"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Schema '%s' already exists in this database.", schemaName)})
+		return
+	}
+
+	pgAdminDSN, ok := requirePGAdminDSN(c, "CreateSchemaHandler", "Schema provisioning")
+	if !ok {
+		return
+	}
+
+	if err := dbutils.CreateDatabaseSchema(pgAdminDSN, managedDB.PGDatabaseName, schemaName); err != nil {
+		log.Printf("Error provisioning schema %s in DB %s: %v", schemaName, managedDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to provision schema: " + err.Error()})
+		return
+	}
+
+	schema := &models.ManagedSchema{
+		SchemaID:   uuid.New(),
+		DatabaseID: managedDB.DatabaseID,
+		SchemaName: schemaName,
+	}
+	if err := store.CreateManagedSchema(schema); err != nil {
+		log.Printf("Error creating ManagedSchema record %s in DB %s: %v", schemaName, managedDB.DatabaseID, err)
+		log.Printf("Compensating: dropping provisioned schema %s due to record creation failure", schemaName)
+		if dropErr := dbutils.DropDatabaseSchema(pgAdminDSN, managedDB.PGDatabaseName, schemaName, false); dropErr != nil {
+			log.Printf("Warning: failed to clean up provisioned schema %s: %v", schemaName, dropErr)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save schema record"})
+		return
+	}
+
+	log.Printf("Schema %s created in DB %s by user %s", schemaName, managedDB.PGDatabaseName, currentUser.InternalUserID)
+	store.WriteAuditLog(&currentUser.InternalUserID, "schema.create", "schema", schema.SchemaID.String(), map[string]string{"schema_name": schemaName, "database_id": managedDB.DatabaseID.String()})
+	c.JSON(http.StatusCreated, schema)
+}
+
+// ListSchemasHandler handles requests to list the additional schemas of a managed database.
+// The public schema always exists and is not included.
+func ListSchemasHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+
+	schemas, err := store.GetManagedSchemasByDatabaseID(managedDB.DatabaseID)
+	if err != nil {
+		log.Printf("Error listing schemas for DB %s: %v", managedDB.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve schemas"})
+		return
+	}
+	if schemas == nil { // Ensure we return an empty list, not null
+		schemas = []models.ManagedSchema{}
+	}
+	c.JSON(http.StatusOK, schemas)
+}
+
+// DeleteSchemaHandler handles requests to drop a schema. Pass ?cascade=true to drop
+// a schema that still contains objects.
+func DeleteSchemaHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+
+	schemaID, err := uuid.Parse(c.Param("schema_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schema ID format"})
+		return
+	}
+	schema, err := store.GetManagedSchemaByID(schemaID, managedDB.DatabaseID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Schema not found in this database"})
+			return
+		}
+		log.Printf("Error fetching schema %s: %v", schemaID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve schema"})
+		return
+	}
+	cascade := c.Query("cascade") == "true"
+
+	pgAdminDSN, ok := requirePGAdminDSN(c, "DeleteSchemaHandler", "Schema deletion")
+	if !ok {
+		return
+	}
+
+	if err := dbutils.DropDatabaseSchema(pgAdminDSN, managedDB.PGDatabaseName, schema.SchemaName, cascade); err != nil {
+		log.Printf("Error dropping schema %s from DB %s: %v", schema.SchemaName, managedDB.PGDatabaseName, err)
+		if !cascade {
+			c.JSON(http.StatusConflict, gin.H{"error": "Failed to drop schema; it may still contain objects (retry with ?cascade=true): " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to drop schema: " + err.Error()})
+		return
+	}
+	if err := store.DeleteManagedSchema(schema.SchemaID); err != nil {
+		log.Printf("Error deleting ManagedSchema record %s: %v", schema.SchemaID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete schema record from the application. Please contact support."})
+		return
+	}
+
+	log.Printf("Schema %s dropped from DB %s by user %s", schema.SchemaName, managedDB.PGDatabaseName, currentUser.InternalUserID)
+	store.WriteAuditLog(&currentUser.InternalUserID, "schema.delete", "schema", schema.SchemaID.String(), map[string]any{"schema_name": schema.SchemaName, "database_id": managedDB.DatabaseID.String(), "cascade": cascade})
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// SetPGUserSearchPathHandler handles requests to configure the search_path of a PG user.
+// Only public and schemas managed in the user's database may be listed.
+func SetPGUserSearchPathHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	pgUser, ok := loadOwnedPGUser(c, currentUser.InternalUserID, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	if pgUser.Status != "active" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("PostgreSQL user is not in active state (current state: %s)", pgUser.Status)})
+		return
+	}
+
+	var req SetSearchPathRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+
+	managedSchemas, err := store.GetManagedSchemasByDatabaseID(managedDB.DatabaseID)
+	if err != nil {
+		log.Printf("Error listing schemas for DB %s: %v", managedDB.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve schemas"})
+		return
+	}
+	known := map[string]bool{"public": true}
+	for _, schema := range managedSchemas {
+		known[schema.SchemaName] = true
+	}
+	searchPath := make([]string, 0, len(req.Schemas))
+	for _, name := range req.Schemas {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !known[name] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Schema '%s' does not exist in this database", name)})
+			return
+		}
+		searchPath = append(searchPath, name)
+	}
+
+	pgAdminDSN, ok := requirePGAdminDSN(c, "SetPGUserSearchPathHandler", "PostgreSQL user configuration")
+	if !ok {
+		return
+	}
+
+	if err := dbutils.SetUserSearchPath(pgAdminDSN, managedDB.PGDatabaseName, pgUser.PGUsername, searchPath); err != nil {
+		log.Printf("Error setting search_path for PG user %s on DB %s: %v", pgUser.PGUsername, managedDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set search_path: " + err.Error()})
+		return
+	}
+	if err := store.UpdateManagedPGUserSearchPath(pgUser.PGUserID, searchPath); err != nil {
+		log.Printf("Error recording search_path for PG user %s: %v", pgUser.PGUserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save search_path"})
+		return
+	}
+	pgUser.SearchPath = searchPath
+
+	store.WriteAuditLog(&currentUser.InternalUserID, "pguser.set_search_path", "pg_user", pgUser.PGUserID.String(), map[string]any{"pg_username": pgUser.PGUsername, "database_id": managedDB.DatabaseID.String(), "search_path": searchPath})
+	c.JSON(http.StatusOK, pgUser)
+}
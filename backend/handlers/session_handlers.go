@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	"pgweb-backend/dbutils"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// DatabaseSession is a backend connected to a managed database. Only sessions of the database's managed
+// roles can be cancelled or terminated; the queries of other sessions are hidden.
+type DatabaseSession struct {
+	dbutils.Session
+	Managed bool `json:"managed"`
+}
+
+// databaseSessions marks the sessions of managed roles and hides the queries of all others, which may
+// belong to administrators or the backend itself.
+func databaseSessions(sessions []dbutils.Session, managedRoles map[string]bool) []DatabaseSession {
+	result := make([]DatabaseSession, 0, len(sessions))
+	for _, s := range sessions {
+		managed := managedRoles[s.Username]
+		if !managed {
+			s.Query = ""
+		}
+		result = append(result, DatabaseSession{Session: s, Managed: managed})
+	}
+	return result
+}
+
+// managedRoleNames returns the login roles of a database's managed PG users.
+func managedRoleNames(c *gin.Context, databaseID uuid.UUID) ([]string, bool) {
+	pgUsers, err := store.GetManagedPGUsersByDatabaseID(databaseID)
+	if err != nil {
+		log.Printf("Error fetching PG users of database %s: %v", databaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve PostgreSQL users"})
+		return nil, false
+	}
+	roles := make([]string, 0, len(pgUsers))
+	for _, u := range pgUsers {
+		roles = append(roles, u.PGUsername)
+	}
+	return roles, true
+}
+
+// ListDatabaseSessionsHandler handles requests for the sessions connected to a managed database.
+func ListDatabaseSessionsHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	roles, ok := managedRoleNames(c, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	pgAdminDSN, ok := requirePGAdminDSN(c, "ListDatabaseSessionsHandler", "Session management")
+	if !ok {
+		return
+	}
+	sessions, err := dbutils.GetDatabaseSessions(pgAdminDSN, managedDB.PGDatabaseName)
+	if err != nil {
+		log.Printf("Error listing sessions of database %s: %v", managedDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sessions"})
+		return
+	}
+	managedRoles := make(map[string]bool, len(roles))
+	for _, r := range roles {
+		managedRoles[r] = true
+	}
+	c.JSON(http.StatusOK, databaseSessions(sessions, managedRoles))
+}
+
+// CancelDatabaseSessionHandler handles requests to cancel the running query of a session (pg_cancel_backend).
+func CancelDatabaseSessionHandler(c *gin.Context) {
+	signalDatabaseSession(c, false)
+}
+
+// TerminateDatabaseSessionHandler handles requests to close a session (pg_terminate_backend).
+func TerminateDatabaseSessionHandler(c *gin.Context) {
+	signalDatabaseSession(c, true)
+}
+
+// signalDatabaseSession cancels or terminates the :pid backend if it is connected to the database as one
+// of its managed roles.
+func signalDatabaseSession(c *gin.Context, terminate bool) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	pid, err := strconv.Atoi(c.Param("pid"))
+	if err != nil || pid <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid PID"})
+		return
+	}
+	roles, ok := managedRoleNames(c, managedDB.DatabaseID)
+	if !ok {
+		return
+	}
+	pgAdminDSN, ok := requirePGAdminDSN(c, "signalDatabaseSession", "Session management")
+	if !ok {
+		return
+	}
+
+	action := "cancel"
+	if terminate {
+		action = "terminate"
+	}
+	role, sent, err := dbutils.SignalSession(pgAdminDSN, managedDB.PGDatabaseName, pid, roles, terminate)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No session with this PID is connected to the database as one of its PostgreSQL users"})
+			return
+		}
+		log.Printf("Error signalling backend %d of database %s: %v", pid, managedDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action + " session"})
+		return
+	}
+
+	log.Printf("Session %d (%s) of database %s: %s requested by user %s (sent: %t)", pid, role, managedDB.PGDatabaseName, action, currentUser.InternalUserID, sent)
+	store.WriteAuditLog(&currentUser.InternalUserID, "database.session_"+action, "database", managedDB.DatabaseID.String(), map[string]any{
+		"pid": pid, "pg_username": role, "signal_sent": sent,
+	})
+	c.JSON(http.StatusOK, gin.H{"pid": pid, "pg_username": role, "signal_sent": sent})
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"testing"
+
+	"pgweb-backend/dbutils"
+)
+
+func TestDatabaseSessions(t *testing.T) {
+	sessions := databaseSessions([]dbutils.Session{
+		{PID: 101, Username: "shop__app", Query: "SELECT 1"},
+		{PID: 102, Username: "postgres", Query: "ALTER ROLE x PASSWORD 'secret'"},
+	}, map[string]bool{"shop__app": true})
+
+	if len(sessions) != 2 {
+		t.Fatalf("databaseSessions() returned %d sessions, want 2", len(sessions))
+	}
+	if !sessions[0].Managed || sessions[0].Query != "SELECT 1" {
+		t.Errorf("managed session = %+v, want managed with query", sessions[0])
+	}
+	if sessions[1].Managed || sessions[1].Query != "" {
+		t.Errorf("unmanaged session = %+v, want unmanaged with query hidden", sessions[1])
+	}
+}
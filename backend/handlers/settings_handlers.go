@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pgweb-backend/dbutils"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DatabaseSettingRule allowlists a server parameter that database owners may override, with the
+// values they may choose.
+type DatabaseSettingRule struct {
+	Type   string   `json:"type"`             // "memory", "duration", "number", "enum" or "timezone"
+	Min    string   `json:"min,omitempty"`    // Inclusive bounds for memory, duration and number, e.g. "64kB"
+	Max    string   `json:"max,omitempty"`    // Empty for no bound
+	Values []string `json:"values,omitempty"` // Allowed values for enum
+}
+
+// DatabaseSetting is an allowlisted setting of a database.
+type DatabaseSetting struct {
+	Name string `json:"name"`
+	DatabaseSettingRule
+	Value          *string `json:"value"`           // Set for this database, nil if it inherits the server value
+	ServerValue    string  `json:"server_value"`    // Empty if the server does not know the setting
+	EffectiveValue string  `json:"effective_value"` // The value new sessions get
+}
+
+// UpdateDatabaseSettingsRequest defines the request body for overriding settings of a database.
+// A null value resets the setting to the server value; settings not listed are left unchanged.
+type UpdateDatabaseSettingsRequest struct {
+	Settings map[string]*string `json:"settings" binding:"required"`
+}
+
+// defaultDatabaseSettingRules is the allowlist used unless PGWEB_DATABASE_SETTINGS_ALLOWLIST is set.
+var defaultDatabaseSettingRules = map[string]DatabaseSettingRule{
+	"work_mem":                            {Type: "memory", Min: "64kB", Max: "1GB"},
+	"maintenance_work_mem":                {Type: "memory", Min: "1MB", Max: "2GB"},
+	"statement_timeout":                   {Type: "duration", Min: "0", Max: "1h"},
+	"lock_timeout":                        {Type: "duration", Min: "0", Max: "1h"},
+	"idle_in_transaction_session_timeout": {Type: "duration", Min: "0", Max: "24h"},
+	"timezone":                            {Type: "timezone"},
+	"default_transaction_isolation":       {Type: "enum", Values: []string{"read committed", "repeatable read", "serializable"}},
+}
+
+// reservedDatabaseSettings are set by pgweb itself and cannot be allowlisted; storage enforcement
+// relies on default_transaction_read_only.
+var reservedDatabaseSettings = map[string]bool{"default_transaction_read_only": true}
+
+// loadDatabaseSettingRules returns the settings allowlist: the JSON object in PGWEB_DATABASE_SETTINGS_ALLOWLIST
+// mapping setting names to rules, e.g. {"work_mem": {"type": "memory", "min": "1MB", "max": "256MB"}},
+// or the built-in default.
+func loadDatabaseSettingRules() (map[string]DatabaseSettingRule, error) {
+	v := strings.TrimSpace(os.Getenv("PGWEB_DATABASE_SETTINGS_ALLOWLIST"))
+	if v == "" {
+		return defaultDatabaseSettingRules, nil
+	}
+	var configured map[string]DatabaseSettingRule
+	if err := json.Unmarshal([]byte(v), &configured); err != nil {
+		return nil, fmt.Errorf("invalid PGWEB_DATABASE_SETTINGS_ALLOWLIST: %w", err)
+	}
+	rules := make(map[string]DatabaseSettingRule, len(configured))
+	for name, rule := range configured {
+		name = strings.ToLower(name)
+		if reservedDatabaseSettings[name] {
+			return nil, fmt.Errorf("invalid PGWEB_DATABASE_SETTINGS_ALLOWLIST: %s is managed by pgweb", name)
+		}
+		if err := validateSettingRule(rule); err != nil {
+			return nil, fmt.Errorf("invalid PGWEB_DATABASE_SETTINGS_ALLOWLIST entry %s: %w", name, err)
+		}
+		rules[name] = rule
+	}
+	return rules, nil
+}
+
+// validateSettingRule checks that a rule has a known type and parseable bounds.
+func validateSettingRule(rule DatabaseSettingRule) error {
+	switch rule.Type {
+	case "memory", "duration", "number":
+		for _, bound := range []string{rule.Min, rule.Max} {
+			if bound == "" {
+				continue
+			}
+			if _, err := parseSettingQuantity(rule.Type, bound); err != nil {
+				return err
+			}
+		}
+	case "enum":
+		if len(rule.Values) == 0 {
+			return fmt.Errorf("enum needs values")
+		}
+	case "timezone":
+	default:
+		return fmt.Errorf("unknown type %q", rule.Type)
+	}
+	return nil
+}
+
+var (
+	settingQuantityPattern = regexp.MustCompile(`^(-?[0-9]+(?:\.[0-9]+)?)\s*([a-zA-Z]*)$`)
+	timeZonePattern        = regexp.MustCompile(`^[A-Za-z0-9_+\-/]{1,64}$`)
+
+	// Units PostgreSQL accepts for memory (in bytes) and time (in milliseconds) settings.
+	memoryUnits   = map[string]float64{"B": 1, "kB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30, "TB": 1 << 40}
+	durationUnits = map[string]float64{"us": 0.001, "ms": 1, "s": 1000, "min": 60 * 1000, "h": 60 * 60 * 1000, "d": 24 * 60 * 60 * 1000}
+)
+
+// parseSettingQuantity converts a memory value to bytes, a duration to milliseconds or a number to itself.
+// Memory and duration values need a unit, except 0, since the base unit differs between settings.
+func parseSettingQuantity(settingType, value string) (float64, error) {
+	m := settingQuantityPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return 0, fmt.Errorf("'%s' is not a valid %s value", value, settingType)
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a valid %s value", value, settingType)
+	}
+	unit := m[2]
+	if settingType == "number" {
+		if unit != "" {
+			return 0, fmt.Errorf("'%s' must be a plain number", value)
+		}
+		return n, nil
+	}
+	if unit == "" {
+		if n == 0 {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("'%s' needs a unit", value)
+	}
+	units := memoryUnits
+	if settingType == "duration" {
+		units = durationUnits
+	}
+	factor, ok := units[unit]
+	if !ok {
+		return 0, fmt.Errorf("'%s' has an unknown %s unit '%s'", value, settingType, unit)
+	}
+	return n * factor, nil
+}
+
+// validateDatabaseSetting checks a value against its allowlist rule. Time zones are only checked for
+// their format; the caller checks that the server knows them.
+func validateDatabaseSetting(name string, rule DatabaseSettingRule, value string) error {
+	switch rule.Type {
+	case "enum":
+		for _, allowed := range rule.Values {
+			if value == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s must be one of: %s", name, strings.Join(rule.Values, ", "))
+	case "timezone":
+		if !timeZonePattern.MatchString(value) {
+			return fmt.Errorf("%s must be a time zone name like 'Europe/Berlin'", name)
+		}
+		return nil
+	}
+
+	n, err := parseSettingQuantity(rule.Type, value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if rule.Min != "" {
+		if lower, _ := parseSettingQuantity(rule.Type, rule.Min); n < lower {
+			return fmt.Errorf("%s must be at least %s", name, rule.Min)
+		}
+	}
+	if rule.Max != "" {
+		if upper, _ := parseSettingQuantity(rule.Type, rule.Max); n > upper {
+			return fmt.Errorf("%s must be at most %s", name, rule.Max)
+		}
+	}
+	return nil
+}
+
+// loadDatabaseSettings returns the allowlisted settings of a database, sorted by name.
+func loadDatabaseSettings(pgAdminDSN, dbName string, rules map[string]DatabaseSettingRule) ([]DatabaseSetting, error) {
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	overrides, err := dbutils.GetDatabaseSettingOverrides(pgAdminDSN, dbName)
+	if err != nil {
+		return nil, err
+	}
+	serverValues, err := dbutils.GetServerSettings(pgAdminDSN, names)
+	if err != nil {
+		return nil, err
+	}
+	settings := make([]DatabaseSetting, 0, len(names))
+	for _, name := range names {
+		setting := DatabaseSetting{Name: name, DatabaseSettingRule: rules[name], ServerValue: serverValues[name], EffectiveValue: serverValues[name]}
+		if value, ok := overrides[name]; ok {
+			setting.Value = &value
+			setting.EffectiveValue = value
+		}
+		settings = append(settings, setting)
+	}
+	return settings, nil
+}
+
+// GetDatabaseSettingsHandler handles requests for the allowlisted settings of a managed database.
+func GetDatabaseSettingsHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	pgAdminDSN, ok := requirePGAdminDSN(c, "GetDatabaseSettingsHandler", "Database settings")
+	if !ok {
+		return
+	}
+	rules, err := loadDatabaseSettingRules()
+	if err != nil {
+		log.Printf("Error loading database settings allowlist: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load settings allowlist"})
+		return
+	}
+
+	settings, err := loadDatabaseSettings(pgAdminDSN, managedDB.PGDatabaseName, rules)
+	if err != nil {
+		log.Printf("Error reading settings of database %s: %v", managedDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve database settings"})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateDatabaseSettingsHandler handles requests to override allowlisted settings of a managed database.
+func UpdateDatabaseSettingsHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+	if managedDB.Status != "active" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Database is not in active state (current state: %s)", managedDB.Status)})
+		return
+	}
+
+	var req UpdateDatabaseSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+	pgAdminDSN, ok := requirePGAdminDSN(c, "UpdateDatabaseSettingsHandler", "Database settings")
+	if !ok {
+		return
+	}
+	rules, err := loadDatabaseSettingRules()
+	if err != nil {
+		log.Printf("Error loading database settings allowlist: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load settings allowlist"})
+		return
+	}
+
+	changes := make(map[string]*string, len(req.Settings))
+	for name, value := range req.Settings {
+		name = strings.ToLower(strings.TrimSpace(name))
+		rule, allowed := rules[name]
+		if !allowed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Setting '%s' is not allowed", name)})
+			return
+		}
+		if value != nil {
+			if err := validateDatabaseSetting(name, rule, *value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if rule.Type == "timezone" {
+				exists, err := dbutils.TimeZoneExists(pgAdminDSN, *value)
+				if err != nil {
+					log.Printf("Error validating time zone %s: %v", *value, err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate settings"})
+					return
+				}
+				if !exists {
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown time zone '%s'", *value)})
+					return
+				}
+			}
+		}
+		changes[name] = value
+	}
+
+	previous, err := dbutils.GetDatabaseSettingOverrides(pgAdminDSN, managedDB.PGDatabaseName)
+	if err != nil {
+		log.Printf("Error reading settings of database %s: %v", managedDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve database settings"})
+		return
+	}
+	if err := dbutils.ApplyDatabaseSettings(pgAdminDSN, managedDB.PGDatabaseName, changes); err != nil {
+		log.Printf("Error applying settings to database %s: %v", managedDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply database settings: " + err.Error()})
+		return
+	}
+
+	for name, value := range changes {
+		var oldValue *string
+		if v, ok := previous[name]; ok {
+			oldValue = &v
+		}
+		if (oldValue == nil && value == nil) || (oldValue != nil && value != nil && *oldValue == *value) {
+			continue
+		}
+		store.WriteAuditLog(&currentUser.InternalUserID, "database.setting_update", "database", managedDB.DatabaseID.String(), map[string]any{
+			"setting": name, "old_value": oldValue, "new_value": value,
+		})
+	}
+	log.Printf("Settings of database %s updated by user %s", managedDB.PGDatabaseName, currentUser.InternalUserID)
+
+	settings, err := loadDatabaseSettings(pgAdminDSN, managedDB.PGDatabaseName, rules)
+	if err != nil {
+		log.Printf("Error reading settings of database %s: %v", managedDB.PGDatabaseName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve database settings"})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
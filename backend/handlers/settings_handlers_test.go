@@ -0,0 +1,60 @@
+package handlers
+
+import "testing"
+
+func TestValidateDatabaseSetting(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    DatabaseSettingRule
+		value   string
+		wantErr bool
+	}{
+		{"memory in range", DatabaseSettingRule{Type: "memory", Min: "64kB", Max: "1GB"}, "64MB", false},
+		{"memory at max", DatabaseSettingRule{Type: "memory", Min: "64kB", Max: "1GB"}, "1024MB", false},
+		{"memory above max", DatabaseSettingRule{Type: "memory", Min: "64kB", Max: "1GB"}, "2GB", true},
+		{"memory below min", DatabaseSettingRule{Type: "memory", Min: "64kB", Max: "1GB"}, "512B", true},
+		{"memory without unit", DatabaseSettingRule{Type: "memory", Max: "1GB"}, "4096", true},
+		{"memory with time unit", DatabaseSettingRule{Type: "memory"}, "5s", true},
+		{"duration disabled", DatabaseSettingRule{Type: "duration", Min: "0", Max: "1h"}, "0", false},
+		{"duration in range", DatabaseSettingRule{Type: "duration", Min: "0", Max: "1h"}, "30min", false},
+		{"duration above max", DatabaseSettingRule{Type: "duration", Min: "0", Max: "1h"}, "2h", true},
+		{"negative duration", DatabaseSettingRule{Type: "duration", Min: "0"}, "-1s", true},
+		{"number in range", DatabaseSettingRule{Type: "number", Min: "1", Max: "10"}, "1.5", false},
+		{"number with unit", DatabaseSettingRule{Type: "number"}, "2MB", true},
+		{"enum value", DatabaseSettingRule{Type: "enum", Values: []string{"read committed", "serializable"}}, "serializable", false},
+		{"enum unknown value", DatabaseSettingRule{Type: "enum", Values: []string{"read committed", "serializable"}}, "chaos", true},
+		{"time zone", DatabaseSettingRule{Type: "timezone"}, "Europe/Berlin", false},
+		{"time zone injection", DatabaseSettingRule{Type: "timezone"}, "UTC'; DROP", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDatabaseSetting("setting", tt.rule, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateDatabaseSetting(%q) error = %v, wantErr %t", tt.value, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadDatabaseSettingRules(t *testing.T) {
+	t.Setenv("PGWEB_DATABASE_SETTINGS_ALLOWLIST", `{"Work_Mem": {"type": "memory", "max": "256MB"}}`)
+	rules, err := loadDatabaseSettingRules()
+	if err != nil {
+		t.Fatalf("loadDatabaseSettingRules() error = %v", err)
+	}
+	if _, ok := rules["work_mem"]; !ok || len(rules) != 1 {
+		t.Errorf("loadDatabaseSettingRules() = %v, want only work_mem", rules)
+	}
+
+	for _, allowlist := range []string{
+		`{"default_transaction_read_only": {"type": "enum", "values": ["off"]}}`,
+		`{"work_mem": {"type": "memory", "max": "lots"}}`,
+		`{"work_mem": {"type": "size"}}`,
+	} {
+		t.Setenv("PGWEB_DATABASE_SETTINGS_ALLOWLIST", allowlist)
+		if _, err := loadDatabaseSettingRules(); err == nil {
+			t.Errorf("loadDatabaseSettingRules(%s) succeeded, want error", allowlist)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"pgweb-backend/dbutils"
+	"pgweb-backend/models"
+	"pgweb-backend/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Storage enforcement actions decided by storageAction.
+const (
+	storageRestrict = "restrict"
+	storageLift     = "lift"
+)
+
+// StorageSampleInterval returns the interval of the storage sampler that enforces the per-database
+// size limit (PGWEB_STORAGE_SAMPLE_INTERVAL_MINUTES, default 15, 0 disables).
+func StorageSampleInterval() time.Duration {
+	interval := 15 * time.Minute
+	if v := os.Getenv("PGWEB_STORAGE_SAMPLE_INTERVAL_MINUTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			interval = time.Duration(n) * time.Minute
+		} else {
+			log.Printf("Warning: ignoring invalid value for PGWEB_STORAGE_SAMPLE_INTERVAL_MINUTES: %q", v)
+		}
+	}
+	return interval
+}
+
+// storageAction decides whether a database must be switched to read-only (it exceeds its limit) or
+// made writable again (it is back under the limit, or the limit was removed). It returns "" otherwise.
+func storageAction(sizeBytes, limitBytes int64, readOnly bool) string {
+	switch {
+	case !readOnly && limitBytes > 0 && sizeBytes > limitBytes:
+		return storageRestrict
+	case readOnly && (limitBytes == 0 || sizeBytes < limitBytes):
+		return storageLift
+	}
+	return ""
+}
+
+// managedSchemaNames returns the names of the managed schemas of a database.
+func managedSchemaNames(databaseID uuid.UUID) ([]string, error) {
+	schemas, err := store.GetManagedSchemasByDatabaseID(databaseID)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(schemas))
+	for i, schema := range schemas {
+		names[i] = schema.SchemaName
+	}
+	return names, nil
+}
+
+// notifyDatabaseEvent posts a database event, e.g. a storage restriction, to PGWEB_EVENT_WEBHOOK_URL
+// so it can be forwarded to the owner.
+func notifyDatabaseEvent(event string, managedDB *models.ManagedDatabase, details map[string]any) {
+	payload := map[string]any{
+		"event":            event,
+		"database_id":      managedDB.DatabaseID,
+		"owner_user_id":    managedDB.OwnerUserID,
+		"pg_database_name": managedDB.PGDatabaseName,
+		"occurred_at":      time.Now(),
+	}
+	for k, v := range details {
+		payload[k] = v
+	}
+	postEventWebhook(payload, event+" of database "+managedDB.PGDatabaseName)
+}
+
+// enforceDatabaseStorage switches a database to read-only or back, records the new state and notifies the owner.
+func enforceDatabaseStorage(pgAdminDSN string, managedDB *models.ManagedDatabase, action string, sizeBytes, limitBytes int64) error {
+	schemas, err := managedSchemaNames(managedDB.DatabaseID)
+	if err != nil {
+		return err
+	}
+	sets, err := store.GetPermissionSetsByDatabaseID(managedDB.DatabaseID)
+	if err != nil {
+		return err
+	}
+	var readOnlySince *time.Time
+	event := "database.storage_restored"
+	if action == storageRestrict {
+		now := time.Now()
+		readOnlySince = &now
+		event = "database.storage_restricted"
+		err = dbutils.RestrictDatabaseWrites(pgAdminDSN, managedDB.PGDatabaseName, schemas, sets)
+	} else {
+		err = dbutils.LiftDatabaseWriteRestriction(pgAdminDSN, managedDB.PGDatabaseName, schemas, sets)
+	}
+	if err != nil {
+		return err
+	}
+	if err := store.SetDatabaseReadOnlySince(managedDB.DatabaseID, readOnlySince); err != nil {
+		return err
+	}
+
+	details := map[string]any{"size_bytes": sizeBytes, "limit_bytes": limitBytes}
+	store.WriteAuditLog(nil, event, "database", managedDB.DatabaseID.String(), details)
+	notifyDatabaseEvent(event, managedDB, details)
+	return nil
+}
+
+// RunStorageEnforcement samples the size of every active managed database and switches databases above
+// their owner's per-database size limit to read-only, or back once they are under it. Only one replica
+// samples at a time.
+func RunStorageEnforcement(pgAdminDSN string) {
+	release, ok, err := store.TryAdvisoryLock("storage_enforcement")
+	if err != nil {
+		log.Printf("Error taking storage enforcement lock: %v", err)
+		return
+	}
+	if !ok {
+		return // Another replica is sampling
+	}
+	defer release()
+
+	databases, err := store.GetAllManagedDatabases()
+	if err != nil {
+		log.Printf("Error fetching databases for storage sampling: %v", err)
+		return
+	}
+	states, err := store.GetDatabaseStorageStates()
+	if err != nil {
+		log.Printf("Error fetching database storage states: %v", err)
+		return
+	}
+	var names []string
+	for _, db := range databases {
+		if db.Status == "active" {
+			names = append(names, db.PGDatabaseName)
+		}
+	}
+	sizes, err := dbutils.GetDatabaseSizes(pgAdminDSN, names)
+	if err != nil {
+		log.Printf("Error sampling database sizes: %v", err)
+		return
+	}
+
+	limitsByOwner := make(map[uuid.UUID]models.QuotaLimits)
+	now := time.Now()
+	for i := range databases {
+		managedDB := &databases[i]
+		size, sampled := sizes[managedDB.PGDatabaseName]
+		if managedDB.Status != "active" || !sampled {
+			continue
+		}
+		limits, known := limitsByOwner[managedDB.OwnerUserID]
+		if !known {
+			if _, limits, err = effectiveQuota(managedDB.OwnerUserID); err != nil {
+				log.Printf("Warning: failed to resolve quota of user %s, skipping database %s: %v", managedDB.OwnerUserID, managedDB.PGDatabaseName, err)
+				continue
+			}
+			limitsByOwner[managedDB.OwnerUserID] = limits
+		}
+		if err := store.RecordDatabaseStorageSample(managedDB.DatabaseID, size, limits.MaxDatabaseSizeBytes, now); err != nil {
+			log.Printf("Warning: failed to record storage sample of database %s: %v", managedDB.PGDatabaseName, err)
+			continue
+		}
+
+		state := states[managedDB.DatabaseID]
+		action := storageAction(size, limits.MaxDatabaseSizeBytes, state.ReadOnlySince != nil)
+		if action == "" {
+			continue
+		}
+		if err := enforceDatabaseStorage(pgAdminDSN, managedDB, action, size, limits.MaxDatabaseSizeBytes); err != nil {
+			log.Printf("CRITICAL: failed to %s writes of database %s (size %d, limit %d): %v", action, managedDB.PGDatabaseName, size, limits.MaxDatabaseSizeBytes, err)
+			continue
+		}
+		log.Printf("Storage enforcement: %s writes of database %s (size %d, limit %d)", action, managedDB.PGDatabaseName, size, limits.MaxDatabaseSizeBytes)
+	}
+}
+
+// GetDatabaseStorageHandler handles requests for the last storage sample of a managed database and
+// whether it is read-only for exceeding its size limit.
+func GetDatabaseStorageHandler(c *gin.Context) {
+	currentUser := requireUser(c)
+	if currentUser == nil {
+		return
+	}
+	managedDB, ok := loadOwnedDatabase(c, currentUser.InternalUserID)
+	if !ok {
+		return
+	}
+
+	state, err := store.GetDatabaseStorageState(managedDB.DatabaseID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Database storage has not been sampled yet"})
+			return
+		}
+		log.Printf("Error fetching storage state of database %s: %v", managedDB.DatabaseID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve storage state"})
+		return
+	}
+	c.JSON(http.StatusOK, state)
+}
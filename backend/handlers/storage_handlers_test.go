@@ -0,0 +1,30 @@
+package handlers
+
+import "testing"
+
+func TestStorageAction(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int64
+		limit    int64
+		readOnly bool
+		want     string
+	}{
+		{"unlimited", 500, 0, false, ""},
+		{"under limit", 90, 100, false, ""},
+		{"at limit", 100, 100, false, ""},
+		{"over limit", 101, 100, false, storageRestrict},
+		{"still over limit", 150, 100, true, ""},
+		{"still at limit", 100, 100, true, ""},
+		{"back under limit", 99, 100, true, storageLift},
+		{"limit removed", 150, 0, true, storageLift},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := storageAction(tt.size, tt.limit, tt.readOnly); got != tt.want {
+				t.Errorf("storageAction(%d, %d, %t) = %q, want %q", tt.size, tt.limit, tt.readOnly, got, tt.want)
+			}
+		})
+	}
+}
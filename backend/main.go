@@ -26,6 +26,17 @@ const (
 	sessionName = "mysession" // Should match auth.sessionName
 )
 
+// startPeriodic runs fn every interval in the background until the returned stop function is called.
+func startPeriodic(interval time.Duration, fn func()) (stop func()) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			fn()
+		}
+	}()
+	return ticker.Stop
+}
+
 func main() {
 	// Load .env file if it exists
 	if _, err := os.Stat(".env"); err == nil {
@@ -61,15 +72,51 @@ func main() {
 
 	// Start periodic backup file janitor (replaces per-request goroutines)
 	janitorInterval := 30 * time.Minute
-	janitorTicker := time.NewTicker(janitorInterval)
-	defer janitorTicker.Stop()
-	go func() {
-		for range janitorTicker.C {
-			dbutils.CleanupOldDumpFiles(backupDir, 1*time.Hour)
-		}
-	}()
+	defer startPeriodic(janitorInterval, func() { dbutils.CleanupOldDumpFiles(backupDir, 1*time.Hour) })()
 	log.Printf("Backup file janitor started (interval: %s, max age: 1h)", janitorInterval)
 
+	// Background jobs on the PostgreSQL cluster
+	if pgAdminDSN := os.Getenv("PG_ADMIN_DSN"); pgAdminDSN != "" {
+		// Rotate the passwords of PG users with a rotation policy
+		rotationInterval := handlers.PasswordRotationCheckInterval()
+		defer startPeriodic(rotationInterval, func() { handlers.RunScheduledPasswordRotations(pgAdminDSN) })()
+		log.Printf("Password rotation scheduler started (interval: %s)", rotationInterval)
+
+		// Sample storage and switch databases above their size limit to read-only
+		if storageInterval := handlers.StorageSampleInterval(); storageInterval > 0 {
+			defer startPeriodic(storageInterval, func() { handlers.RunStorageEnforcement(pgAdminDSN) })()
+			log.Printf("Storage sampler started (interval: %s)", storageInterval)
+		}
+
+		// Snapshot query statistics of databases with pg_stat_statements
+		if dbutils.PgStatStatementsEnabled() {
+			if queryStatsInterval, queryStatsRetention := handlers.QueryStatsSnapshotSchedule(); queryStatsInterval > 0 {
+				defer startPeriodic(queryStatsInterval, func() { handlers.RunQueryStatsSnapshots(pgAdminDSN, queryStatsRetention) })()
+				log.Printf("Query statistics snapshots started (interval: %s, retention: %s)", queryStatsInterval, queryStatsRetention)
+			}
+		}
+
+		// Keep the PgBouncer configuration in sync with the managed databases and PG users
+		if pgBouncerInterval := handlers.PgBouncerSyncInterval(); pgBouncerInterval > 0 {
+			go handlers.RunPgBouncerSync(pgAdminDSN)
+			defer startPeriodic(pgBouncerInterval, func() { handlers.RunPgBouncerSync(pgAdminDSN) })()
+			log.Printf("PgBouncer sync started (interval: %s)", pgBouncerInterval)
+		}
+
+		// Bring the managed section of pg_hba.conf up to date with the stored network rules
+		go handlers.RunPgHbaSync(pgAdminDSN)
+
+		// Reconcile the application database with the cluster catalog
+		if reconcileInterval, reconcileRepair := handlers.ReconciliationSchedule(); reconcileInterval > 0 {
+			defer startPeriodic(reconcileInterval, func() {
+				if _, err := handlers.RunReconciliation(pgAdminDSN, "scheduled", reconcileRepair); err != nil {
+					log.Printf("Scheduled reconciliation skipped: %v", err)
+				}
+			})()
+			log.Printf("Reconciliation scheduler started (interval: %s, repair: %t)", reconcileInterval, reconcileRepair)
+		}
+	}
+
 	r := gin.Default()
 
 	// Health check endpoint (public)
@@ -147,6 +194,31 @@ func main() {
 	{
 		// User profile
 		apiProtected.GET("/me", handlers.MeHandler)
+		apiProtected.GET("/me/usage", handlers.MeUsageHandler)
+		apiProtected.GET("/me/transfers", handlers.ListIncomingTransfersHandler)
+
+		// Ownership transfers offered to the current user
+		apiProtected.POST("/transfers/:transfer_id/accept", handlers.AcceptOwnershipTransferHandler)
+		apiProtected.POST("/transfers/:transfer_id/decline", handlers.DeclineOwnershipTransferHandler)
+
+		// Internal CA for PG user client certificates
+		apiProtected.GET("/pki/ca.crt", handlers.GetCACertificateHandler)
+		apiProtected.GET("/pki/crl.pem", handlers.GetCRLHandler)
+
+		// Administration (PGWEB_ADMIN_EMAILS)
+		adminGroup := apiProtected.Group("/admin")
+		adminGroup.Use(auth.AdminMiddleware())
+		{
+			adminGroup.POST("/reconcile", handlers.ReconcileHandler)
+			adminGroup.GET("/reconcile/latest", handlers.GetLatestReconciliationHandler)
+			adminGroup.POST("/databases/adopt", handlers.AdoptDatabaseHandler)
+			adminGroup.POST("/databases/:database_id/transfer", handlers.ForceOwnershipTransferHandler)
+			adminGroup.GET("/users/:email/quota", handlers.GetUserQuotaHandler)
+			adminGroup.PUT("/users/:email/quota", handlers.SetUserQuotaHandler)
+			adminGroup.GET("/pg-user-events/pending", handlers.ListStalePendingPGUserEventsHandler)
+			adminGroup.POST("/pg-user-events/:event_id/recover", handlers.RecoverPendingPGUserEventHandler)
+			adminGroup.DELETE("/pg-user-events/:event_id", handlers.DiscardPendingPGUserEventHandler)
+		}
 
 		// Managed Databases
 		databasesGroup := apiProtected.Group("/databases")
@@ -155,6 +227,36 @@ func main() {
 			databasesGroup.GET("", handlers.ListDatabasesHandler)
 			databasesGroup.GET("/:database_id", handlers.GetDatabaseHandler)
 			databasesGroup.DELETE("/:database_id", handlers.DeleteDatabaseHandler)
+			databasesGroup.GET("/:database_id/provisioning", handlers.GetProvisioningStatusHandler)
+			databasesGroup.POST("/:database_id/provisioning/resume", handlers.ResumeProvisioningHandler)
+			databasesGroup.POST("/:database_id/provisioning/rollback", handlers.RollbackProvisioningHandler)
+			databasesGroup.GET("/:database_id/storage", handlers.GetDatabaseStorageHandler)
+			databasesGroup.GET("/:database_id/replicas", handlers.GetDatabaseReplicaLagHandler)
+			databasesGroup.POST("/:database_id/replications", handlers.CreateLogicalReplicationHandler)
+			databasesGroup.GET("/:database_id/replications", handlers.ListLogicalReplicationsHandler)
+			databasesGroup.GET("/:database_id/replications/:replication_id", handlers.GetLogicalReplicationHandler)
+			databasesGroup.DELETE("/:database_id/replications/:replication_id", handlers.DeleteLogicalReplicationHandler)
+			databasesGroup.POST("/:database_id/links", handlers.CreateDatabaseLinkHandler)
+			databasesGroup.GET("/:database_id/links", handlers.ListDatabaseLinksHandler)
+			databasesGroup.GET("/:database_id/links/:link_id", handlers.GetDatabaseLinkHandler)
+			databasesGroup.DELETE("/:database_id/links/:link_id", handlers.DeleteDatabaseLinkHandler)
+			databasesGroup.POST("/:database_id/maintenance", handlers.StartMaintenanceHandler)
+			databasesGroup.GET("/:database_id/maintenance", handlers.ListMaintenanceJobsHandler)
+			databasesGroup.GET("/:database_id/maintenance/:job_id", handlers.GetMaintenanceJobHandler)
+			databasesGroup.GET("/:database_id/sessions", handlers.ListDatabaseSessionsHandler)
+			databasesGroup.POST("/:database_id/sessions/:pid/cancel", handlers.CancelDatabaseSessionHandler)
+			databasesGroup.POST("/:database_id/sessions/:pid/terminate", handlers.TerminateDatabaseSessionHandler)
+			databasesGroup.GET("/:database_id/locks", handlers.GetDatabaseLocksHandler)
+			databasesGroup.GET("/:database_id/query-stats", handlers.GetQueryStatsHandler)
+			databasesGroup.GET("/:database_id/query-stats/history", handlers.GetQueryStatsHistoryHandler)
+			databasesGroup.POST("/:database_id/query-stats/reset", handlers.ResetQueryStatsHandler)
+			databasesGroup.GET("/:database_id/pool", handlers.GetDatabasePoolHandler)
+			databasesGroup.PUT("/:database_id/pool", handlers.UpdateDatabasePoolHandler)
+			databasesGroup.GET("/:database_id/settings", handlers.GetDatabaseSettingsHandler)
+			databasesGroup.PUT("/:database_id/settings", handlers.UpdateDatabaseSettingsHandler)
+			databasesGroup.POST("/:database_id/transfer", handlers.ProposeOwnershipTransferHandler)
+			databasesGroup.GET("/:database_id/transfer", handlers.GetOwnershipTransferHandler)
+			databasesGroup.DELETE("/:database_id/transfer", handlers.CancelOwnershipTransferHandler)
 			databasesGroup.POST("/:database_id/backup", handlers.InitiateBackupHandler)
 			databasesGroup.GET("/:database_id/backup/:job_id", handlers.BackupStatusHandler)
 			databasesGroup.GET("/:database_id/backup/:job_id/download", handlers.DownloadBackupHandler)
@@ -166,8 +268,40 @@ func main() {
 			{
 				pgUserRoutes.POST("", handlers.CreatePGUserHandler)
 				pgUserRoutes.GET("", handlers.ListPGUsersHandler)
+				pgUserRoutes.PATCH("/:pg_user_id", handlers.UpdatePGUserHandler)
 				pgUserRoutes.POST("/:pg_user_id/regenerate-password", handlers.RegeneratePGPasswordHandler)
+				pgUserRoutes.POST("/:pg_user_id/namespace", handlers.NamespacePGUserHandler)
+				pgUserRoutes.GET("/:pg_user_id/connection", handlers.GetPGUserConnectionHandler)
+				pgUserRoutes.GET("/:pg_user_id/network-rules", handlers.GetPGUserNetworkRulesHandler)
+				pgUserRoutes.PUT("/:pg_user_id/network-rules", handlers.UpdatePGUserNetworkRulesHandler)
 				pgUserRoutes.DELETE("/:pg_user_id", handlers.DeletePGUserHandler)
+				pgUserRoutes.POST("/:pg_user_id/permission-sets", handlers.AssignPermissionSetHandler)
+				pgUserRoutes.DELETE("/:pg_user_id/permission-sets/:permission_set_id", handlers.UnassignPermissionSetHandler)
+				pgUserRoutes.PUT("/:pg_user_id/search-path", handlers.SetPGUserSearchPathHandler)
+				pgUserRoutes.PUT("/:pg_user_id/rotation-policy", handlers.SetPGUserRotationPolicyHandler)
+				pgUserRoutes.GET("/:pg_user_id/events", handlers.ListPGUserEventsHandler)
+				pgUserRoutes.POST("/:pg_user_id/events/:event_id/secret", handlers.FetchPGUserEventSecretHandler)
+				pgUserRoutes.POST("/:pg_user_id/certificates", handlers.IssuePGUserCertificateHandler)
+				pgUserRoutes.GET("/:pg_user_id/certificates", handlers.ListPGUserCertificatesHandler)
+				pgUserRoutes.GET("/:pg_user_id/certificates/hba", handlers.GetPGUserHBALinesHandler)
+				pgUserRoutes.GET("/:pg_user_id/certificates/:certificate_id/download", handlers.DownloadPGUserCertificateHandler)
+				pgUserRoutes.DELETE("/:pg_user_id/certificates/:certificate_id", handlers.RevokePGUserCertificateHandler)
+			}
+
+			// Additional schemas within a database
+			schemaRoutes := databasesGroup.Group("/:database_id/schemas")
+			{
+				schemaRoutes.POST("", handlers.CreateSchemaHandler)
+				schemaRoutes.GET("", handlers.ListSchemasHandler)
+				schemaRoutes.DELETE("/:schema_id", handlers.DeleteSchemaHandler)
+			}
+
+			// Custom permission sets (scoped NOLOGIN roles) within a database
+			permissionSetRoutes := databasesGroup.Group("/:database_id/permission-sets")
+			{
+				permissionSetRoutes.POST("", handlers.CreatePermissionSetHandler)
+				permissionSetRoutes.GET("", handlers.ListPermissionSetsHandler)
+				permissionSetRoutes.DELETE("/:permission_set_id", handlers.DeletePermissionSetHandler)
 			}
 		}
 	}
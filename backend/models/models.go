@@ -35,7 +35,7 @@ type DatabaseWithOwner struct {
 type BackupJob struct {
 	BackupJobID  uuid.UUID  `json:"backup_job_id" db:"backup_job_id"`
 	DatabaseID   uuid.UUID  `json:"database_id" db:"database_id"`
-	Type         string     `json:"type" db:"type"` // "backup" or "restore"
+	Type         string     `json:"type" db:"type"`     // "backup" or "restore"
 	Status       string     `json:"status" db:"status"` // "pending", "in_progress", "completed", "failed"
 	FilePath     string     `json:"-" db:"file_path"`
 	FileSize     int64      `json:"file_size" db:"file_size"`
@@ -48,9 +48,299 @@ type BackupJob struct {
 type ManagedPGUser struct {
 	PGUserID          uuid.UUID `json:"pg_user_id" db:"pg_user_id"`
 	ManagedDatabaseID uuid.UUID `json:"managed_database_id" db:"managed_database_id"` // Foreign key to ManagedDatabase
-	PGUsername        string    `json:"pg_username" db:"pg_username"`
-	PermissionLevel   string    `json:"permission_level" db:"permission_level"` // e.g., "readonly", "readwrite"
-	Status            string    `json:"status" db:"status"`                     // e.g., "creating", "active", "deleting", "error"
+	PGUsername        string    `json:"pg_username" db:"pg_username"`                 // Cluster-wide login role name, e.g. "<db>__<display_name>"
+	DisplayName       string    `json:"display_name" db:"display_name"`               // Name chosen by the owner, unique within the database
+	PermissionLevel   string    `json:"permission_level" db:"permission_level"`       // "read", "write" or "custom" (permission sets only)
+	Status            string    `json:"status" db:"status"`                           // e.g., "creating", "active", "deleting", "error"
 	CreatedAt         time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at" db:"updated_at"`
+	SearchPath        []string  `json:"search_path,omitempty" db:"search_path"` // Schemas set as the user's search_path in its database
+	PermissionSets    []string  `json:"permission_sets,omitempty" db:"-"`       // Names of assigned PermissionSets
+	PGUserLimits
+	PGUserPasswordPolicy
+}
+
+// PGUserPasswordPolicy tracks password expiry (VALID UNTIL) and automatic rotation for a PG user.
+type PGUserPasswordPolicy struct {
+	PasswordValidUntil    *time.Time `json:"password_valid_until,omitempty" db:"password_valid_until"`
+	PasswordChangedAt     *time.Time `json:"password_changed_at,omitempty" db:"password_changed_at"`
+	RotationIntervalDays  int        `json:"rotation_interval_days" db:"rotation_interval_days"` // 0 disables automatic rotation
+	NextRotationAt        *time.Time `json:"next_rotation_at,omitempty" db:"-"`
+	PasswordExpiryWarning string     `json:"password_expiry_warning,omitempty" db:"-"` // "expired" or "expiring_soon"
+}
+
+// PGUserWithDatabase extends ManagedPGUser with the parent database details needed by background jobs.
+type PGUserWithDatabase struct {
+	ManagedPGUser
+	PGDatabaseName string    `json:"pg_database_name" db:"pg_database_name"`
+	OwnerUserID    uuid.UUID `json:"owner_user_id" db:"owner_user_id"`
+}
+
+// PGUserEvent records a lifecycle event of a PG user, such as an automatic password rotation.
+// For rotations the new password is kept encrypted until it is fetched once or expires.
+type PGUserEvent struct {
+	EventID         uuid.UUID  `json:"event_id" db:"event_id"`
+	PGUserID        uuid.UUID  `json:"pg_user_id" db:"pg_user_id"`
+	DatabaseID      uuid.UUID  `json:"database_id" db:"database_id"`
+	EventType       string     `json:"event_type" db:"event_type"` // e.g., "password.rotated", "password.regenerated"
+	SecretAvailable bool       `json:"secret_available" db:"-"`
+	SecretFetchedAt *time.Time `json:"secret_fetched_at,omitempty" db:"secret_fetched_at"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+}
+
+// PGUserCertificate is a TLS client certificate issued by the internal CA for a PG user.
+// The certificate's common name is the PG username; the private key is never stored.
+type PGUserCertificate struct {
+	CertificateID  uuid.UUID  `json:"certificate_id" db:"certificate_id"`
+	PGUserID       uuid.UUID  `json:"pg_user_id" db:"pg_user_id"`
+	DatabaseID     uuid.UUID  `json:"database_id" db:"database_id"`
+	PGUsername     string     `json:"pg_username" db:"pg_username"` // Certificate common name
+	SerialNumber   string     `json:"serial_number" db:"serial_number"`
+	Fingerprint    string     `json:"fingerprint" db:"fingerprint"` // SHA-256 of the DER certificate
+	CertificatePEM string     `json:"-" db:"cert_pem"`
+	NotBefore      time.Time  `json:"not_before" db:"not_before"`
+	NotAfter       time.Time  `json:"not_after" db:"not_after"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	Status         string     `json:"status" db:"-"` // "active", "expiring_soon", "expired" or "revoked"
+}
+
+// ManagedSchema represents an additional schema created in a ManagedDatabase besides public.
+type ManagedSchema struct {
+	SchemaID   uuid.UUID `json:"schema_id" db:"schema_id"`
+	DatabaseID uuid.UUID `json:"database_id" db:"database_id"` // Foreign key to ManagedDatabase
+	SchemaName string    `json:"schema_name" db:"schema_name"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// PermissionGrant describes a single grant inside a PermissionSet.
+type PermissionGrant struct {
+	ObjectType string   `json:"object_type"`       // "schema", "table" or "column"
+	Schema     string   `json:"schema"`            // Schema the grant applies to
+	Table      string   `json:"table,omitempty"`   // Required for "table" and "column" grants
+	Columns    []string `json:"columns,omitempty"` // Required for "column" grants
+	Privileges []string `json:"privileges"`        // e.g., "SELECT", "INSERT", "USAGE"
+}
+
+// PermissionSet is a named, NOLOGIN PostgreSQL role scoped to specific schemas, tables or columns
+// of a ManagedDatabase. It can be granted to ManagedPGUsers in addition to the read/write roles.
+type PermissionSet struct {
+	PermissionSetID uuid.UUID         `json:"permission_set_id" db:"permission_set_id"`
+	DatabaseID      uuid.UUID         `json:"database_id" db:"database_id"` // Foreign key to ManagedDatabase
+	Name            string            `json:"name" db:"name"`
+	PGRoleName      string            `json:"pg_role_name" db:"pg_role_name"`
+	Grants          []PermissionGrant `json:"grants" db:"grants"`
+	CreatedAt       time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time         `json:"updated_at" db:"updated_at"`
+}
+
+// PGUserLimits holds the per-role connection limit and session timeouts applied via ALTER ROLE.
+// Timeouts are in milliseconds; 0 leaves the server default in place.
+type PGUserLimits struct {
+	ConnectionLimit                 int `json:"connection_limit" db:"connection_limit"` // -1 means unlimited
+	StatementTimeout                int `json:"statement_timeout" db:"statement_timeout"`
+	IdleInTransactionSessionTimeout int `json:"idle_in_transaction_session_timeout" db:"idle_in_transaction_session_timeout"`
+	LockTimeout                     int `json:"lock_timeout" db:"lock_timeout"`
+}
+
+// ReconciliationFinding is a difference between the application database and the PostgreSQL catalog.
+type ReconciliationFinding struct {
+	Kind         string     `json:"kind"` // e.g., "missing_database", "missing_role", "missing_membership", "orphan_database", "orphan_role", "orphan_login_role", "stale_access"
+	DatabaseName string     `json:"database_name,omitempty"`
+	RoleName     string     `json:"role_name,omitempty"`
+	DatabaseID   *uuid.UUID `json:"database_id,omitempty"`
+	PGUserID     *uuid.UUID `json:"pg_user_id,omitempty"`
+	Detail       string     `json:"detail"`
+	Repairable   bool       `json:"repairable"`
+	Repaired     bool       `json:"repaired"`
+	RepairError  string     `json:"repair_error,omitempty"`
+}
+
+// ReconciliationRun records one comparison of the application database with the PostgreSQL catalog.
+type ReconciliationRun struct {
+	RunID       uuid.UUID               `json:"run_id" db:"run_id"`
+	Trigger     string                  `json:"trigger" db:"trigger"` // "scheduled" or "manual"
+	Repair      bool                    `json:"repair" db:"repair"`
+	Findings    []ReconciliationFinding `json:"findings" db:"findings"` // Stored as JSONB
+	Error       string                  `json:"error,omitempty" db:"error"`
+	StartedAt   time.Time               `json:"started_at" db:"started_at"`
+	CompletedAt time.Time               `json:"completed_at" db:"completed_at"`
+}
+
+// ProvisioningStep is the progress record of one step of provisioning a managed database.
+type ProvisioningStep struct {
+	DatabaseID  uuid.UUID  `json:"database_id" db:"database_id"`
+	Step        string     `json:"step" db:"step"`
+	Position    int        `json:"position" db:"position"` // Order of the step in the provisioning run
+	Status      string     `json:"status" db:"status"`     // "running", "completed" or "failed"
+	Error       string     `json:"error,omitempty" db:"error"`
+	Attempts    int        `json:"attempts" db:"attempts"`
+	StartedAt   time.Time  `json:"started_at" db:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+}
+
+// OwnershipTransfer hands a managed database from one application user to another. The current
+// owner proposes it and the recipient accepts; admins can force a transfer without a proposal.
+type OwnershipTransfer struct {
+	TransferID      uuid.UUID  `json:"transfer_id" db:"transfer_id"`
+	DatabaseID      uuid.UUID  `json:"database_id" db:"database_id"`
+	PGDatabaseName  string     `json:"pg_database_name" db:"pg_database_name"` // Joined from managed_databases
+	FromUserID      uuid.UUID  `json:"from_user_id" db:"from_user_id"`
+	FromEmail       string     `json:"from_email" db:"from_email"` // Joined from application_users
+	ToUserID        uuid.UUID  `json:"to_user_id" db:"to_user_id"`
+	ToEmail         string     `json:"to_email" db:"to_email"` // Joined from application_users
+	RotatePasswords bool       `json:"rotate_passwords" db:"rotate_passwords"`
+	Status          string     `json:"status" db:"status"` // "pending", "accepted", "declined", "cancelled" or "forced"
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty" db:"resolved_at"`
+}
+
+// QuotaLimits are the resource limits of an application user. 0 means unlimited.
+type QuotaLimits struct {
+	MaxDatabases          int   `json:"max_databases"`
+	MaxPGUsersPerDatabase int   `json:"max_pg_users_per_database"`
+	MaxStorageBytes       int64 `json:"max_storage_bytes"`        // Total pg_database_size of the user's databases
+	MaxBackupStorageBytes int64 `json:"max_backup_storage_bytes"` // Total size of the user's backup files
+	MaxDatabaseSizeBytes  int64 `json:"max_database_size_bytes"`  // Hard limit per database; larger databases become read-only
+}
+
+// QuotaOverrides replace individual limits of a plan or of the defaults; nil fields are inherited.
+type QuotaOverrides struct {
+	MaxDatabases          *int   `json:"max_databases,omitempty"`
+	MaxPGUsersPerDatabase *int   `json:"max_pg_users_per_database,omitempty"`
+	MaxStorageBytes       *int64 `json:"max_storage_bytes,omitempty"`
+	MaxBackupStorageBytes *int64 `json:"max_backup_storage_bytes,omitempty"`
+	MaxDatabaseSizeBytes  *int64 `json:"max_database_size_bytes,omitempty"`
+}
+
+// UserQuota assigns a quota plan and per-user overrides to an application user.
+type UserQuota struct {
+	InternalUserID uuid.UUID      `json:"internal_user_id" db:"internal_user_id"`
+	Plan           string         `json:"plan" db:"plan"`           // Empty for the default plan
+	Overrides      QuotaOverrides `json:"overrides" db:"overrides"` // Stored as JSONB
+	UpdatedAt      time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// QuotaUsage is the consumption of an application user's resources.
+type QuotaUsage struct {
+	Databases          int            `json:"databases"`
+	PGUsersByDatabase  map[string]int `json:"pg_users_by_database"` // Keyed by pg_database_name
+	StorageBytes       int64          `json:"storage_bytes"`
+	BackupStorageBytes int64          `json:"backup_storage_bytes"`
+}
+
+// DatabaseStorageState is the last storage sample of a managed database and whether it has been
+// switched to read-only for exceeding its size limit.
+type DatabaseStorageState struct {
+	DatabaseID    uuid.UUID  `json:"database_id" db:"database_id"`
+	SizeBytes     int64      `json:"size_bytes" db:"size_bytes"`
+	LimitBytes    int64      `json:"limit_bytes" db:"limit_bytes"` // 0 means unlimited
+	SampledAt     time.Time  `json:"sampled_at" db:"sampled_at"`
+	ReadOnlySince *time.Time `json:"read_only_since,omitempty" db:"read_only_since"`
+}
+
+// DatabasePoolSettings are the PgBouncer pool settings of a managed database.
+// Nil values use PgBouncer's defaults.
+type DatabasePoolSettings struct {
+	DatabaseID uuid.UUID `json:"database_id" db:"database_id"`
+	PoolSize   *int      `json:"pool_size" db:"pool_size"`
+	PoolMode   *string   `json:"pool_mode" db:"pool_mode"` // "session", "transaction" or "statement"
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// LogicalReplication streams tables of a source database into a target database of the same owner
+// through a publication and a subscription of the same name.
+type LogicalReplication struct {
+	ReplicationID    uuid.UUID `json:"replication_id" db:"replication_id"`
+	SourceDatabaseID uuid.UUID `json:"source_database_id" db:"source_database_id"`
+	TargetDatabaseID uuid.UUID `json:"target_database_id" db:"target_database_id"`
+	SourceDatabase   string    `json:"source_database" db:"-"`
+	TargetDatabase   string    `json:"target_database" db:"-"`
+	Name             string    `json:"name" db:"name"`                 // Publication, slot and subscription name
+	PGRoleName       string    `json:"pg_role_name" db:"pg_role_name"` // Replication login role the subscription connects as
+	Tables           []string  `json:"tables" db:"tables"`             // Schema-qualified table names
+	CreatedBy        uuid.UUID `json:"created_by" db:"created_by"`
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+}
+
+// DatabaseLink exposes a schema of a source database as foreign tables in a target database of the
+// same owner through a postgres_fdw foreign server. The user mapping connects as a generated read-only
+// PG user of the source.
+type DatabaseLink struct {
+	LinkID           uuid.UUID `json:"link_id" db:"link_id"`
+	SourceDatabaseID uuid.UUID `json:"source_database_id" db:"source_database_id"`
+	TargetDatabaseID uuid.UUID `json:"target_database_id" db:"target_database_id"`
+	SourceDatabase   string    `json:"source_database" db:"-"`
+	TargetDatabase   string    `json:"target_database" db:"-"`
+	PGUserID         uuid.UUID `json:"pg_user_id" db:"pg_user_id"` // Read-only PG user of the source
+	PGUsername       string    `json:"pg_username" db:"-"`
+	ServerName       string    `json:"server_name" db:"server_name"`     // Foreign server in the target
+	RemoteSchema     string    `json:"remote_schema" db:"remote_schema"` // Imported schema of the source
+	LocalSchema      string    `json:"local_schema" db:"local_schema"`   // Schema of the foreign tables in the target
+	Tables           []string  `json:"tables" db:"tables"`               // Imported tables; empty imports the whole schema
+	CreatedBy        uuid.UUID `json:"created_by" db:"created_by"`
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+}
+
+// PGUserNetworkRules restrict where a managed PG user may connect from. They are enforced through
+// the managed section of pg_hba.conf.
+type PGUserNetworkRules struct {
+	PGUserID       uuid.UUID `json:"pg_user_id" db:"pg_user_id"`
+	PGDatabaseName string    `json:"-" db:"-"`
+	PGUsername     string    `json:"-" db:"-"`
+	AllowedCIDRs   []string  `json:"allowed_cidrs" db:"allowed_cidrs"` // Empty allows every address
+	RequireSSL     bool      `json:"require_ssl" db:"require_ssl"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// MaintenanceJob is an asynchronous VACUUM, ANALYZE or REINDEX run on a managed database.
+type MaintenanceJob struct {
+	MaintenanceJobID uuid.UUID           `json:"maintenance_job_id" db:"maintenance_job_id"`
+	DatabaseID       uuid.UUID           `json:"database_id" db:"database_id"`
+	Operation        string              `json:"operation" db:"operation"` // "vacuum", "analyze" or "reindex"
+	Full             bool                `json:"full" db:"full_vacuum"`
+	Concurrently     bool                `json:"concurrently" db:"concurrently"`
+	Tables           []string            `json:"tables" db:"tables"` // Schema-qualified table names; empty for the whole database
+	Status           string              `json:"status" db:"status"` // "pending", "in_progress", "completed", "failed"
+	BackendPID       *int                `json:"-" db:"backend_pid"` // Server process running the commands
+	Results          []MaintenanceResult `json:"results" db:"results"`
+	ErrorMessage     string              `json:"error_message,omitempty" db:"error_message"`
+	CreatedBy        uuid.UUID           `json:"created_by" db:"created_by"`
+	CreatedAt        time.Time           `json:"created_at" db:"created_at"`
+	StartedAt        *time.Time          `json:"started_at,omitempty" db:"started_at"`
+	CompletedAt      *time.Time          `json:"completed_at,omitempty" db:"completed_at"`
+}
+
+// MaintenanceResult is the outcome of one maintenance command of a job.
+type MaintenanceResult struct {
+	Target     string `json:"target"` // "schema.table", or the database name
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// QueryStatsCounters are cumulative pg_stat_statements counters.
+type QueryStatsCounters struct {
+	Calls       int64   `json:"calls" db:"calls"`
+	TotalTimeMS float64 `json:"total_time_ms" db:"total_time_ms"`
+	Rows        int64   `json:"rows" db:"rows"`
+}
+
+// QueryStatsSnapshot is a sample of the pg_stat_statements counters of a managed database: totals over
+// all its statements and the top statements by total time.
+type QueryStatsSnapshot struct {
+	SnapshotID uuid.UUID `json:"snapshot_id" db:"snapshot_id"`
+	DatabaseID uuid.UUID `json:"database_id" db:"database_id"`
+	CapturedAt time.Time `json:"captured_at" db:"captured_at"`
+	QueryCount int       `json:"query_count" db:"query_count"` // Number of distinct statements
+	QueryStatsCounters
+	Queries []QueryStatsEntry `json:"queries,omitempty" db:"-"`
+}
+
+// QueryStatsEntry is the counters of one normalized statement run by one role.
+type QueryStatsEntry struct {
+	QueryID    int64  `json:"query_id" db:"query_id"`
+	PGUsername string `json:"pg_username" db:"pg_username"`
+	Query      string `json:"query" db:"query"`
+	QueryStatsCounters
+	MeanTimeMS float64 `json:"mean_time_ms" db:"mean_time_ms"`
 }
@@ -0,0 +1,59 @@
+package pki
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+func TestIssueClientCertificate(t *testing.T) {
+	caCertPEM, caKeyPEM, err := GenerateCA("test CA", 24*time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateCA failed: %v", err)
+	}
+	ca, err := ParseCA(caCertPEM, caKeyPEM)
+	if err != nil {
+		t.Fatalf("ParseCA failed: %v", err)
+	}
+	key, _, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	// Validity beyond the CA lifetime is clamped to the CA's NotAfter.
+	issued, err := ca.IssueClientCertificate("app_user", key.Public(), 48*time.Hour)
+	if err != nil {
+		t.Fatalf("IssueClientCertificate failed: %v", err)
+	}
+	if !issued.NotAfter.Equal(ca.Cert.NotAfter) {
+		t.Errorf("NotAfter = %v, want CA NotAfter %v", issued.NotAfter, ca.Cert.NotAfter)
+	}
+
+	block, _ := pem.Decode(issued.CertPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse issued certificate: %v", err)
+	}
+	if cert.Subject.CommonName != "app_user" {
+		t.Errorf("CommonName = %q, want app_user", cert.Subject.CommonName)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("issued certificate does not verify against CA: %v", err)
+	}
+
+	crlPEM, err := ca.CreateCRL([]RevokedCertificate{{SerialNumber: issued.SerialNumber, RevokedAt: time.Now()}}, time.Hour)
+	if err != nil {
+		t.Fatalf("CreateCRL failed: %v", err)
+	}
+	crlBlock, _ := pem.Decode(crlPEM)
+	crl, err := x509.ParseRevocationList(crlBlock.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse CRL: %v", err)
+	}
+	if len(crl.RevokedCertificateEntries) != 1 || crl.RevokedCertificateEntries[0].SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		t.Errorf("CRL does not list the revoked certificate")
+	}
+}
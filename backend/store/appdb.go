@@ -2,23 +2,29 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"pgweb-backend/models" // Assuming 'backend' is the module name
 
 	"github.com/google/uuid"
-	_ "github.com/lib/pq" // PostgreSQL driver
+	"github.com/lib/pq" // PostgreSQL driver
 )
 
 var (
 	AppDB *sql.DB
 )
 
+// ErrDatabaseNameTaken is returned by CreateManagedDatabase when another record already uses the name.
+// The unique constraint makes the record a reservation that is safe across backend replicas.
+var ErrDatabaseNameTaken = errors.New("database name already taken")
+
 func InitAppDB(dataSourceName string) error {
 	if dataSourceName == "" {
 		return errors.New("database DSN (dataSourceName) must be provided")
@@ -169,6 +175,367 @@ CREATE TABLE IF NOT EXISTS audit_log (
 			name: "idx_audit_log_actor",
 			sql: `CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor_user_id)`,
 		},
+		{
+			name: "managed_schemas",
+			sql: `
+CREATE TABLE IF NOT EXISTS managed_schemas (
+	schema_id UUID PRIMARY KEY,
+	database_id UUID NOT NULL,
+	schema_name TEXT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	CONSTRAINT fk_managed_database
+		FOREIGN KEY(database_id)
+		REFERENCES managed_databases(database_id)
+		ON DELETE CASCADE,
+	UNIQUE (database_id, schema_name)
+);`,
+		},
+		{
+			name: "managed_pg_users_search_path_column_migration",
+			sql: `ALTER TABLE managed_pg_users ADD COLUMN IF NOT EXISTS search_path TEXT NOT NULL DEFAULT ''`,
+		},
+		{
+			name: "managed_pg_users_limits_columns_migration",
+			sql: `
+ALTER TABLE managed_pg_users
+	ADD COLUMN IF NOT EXISTS connection_limit INT NOT NULL DEFAULT -1,
+	ADD COLUMN IF NOT EXISTS statement_timeout INT NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS idle_in_transaction_session_timeout INT NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS lock_timeout INT NOT NULL DEFAULT 0`,
+		},
+		{
+			name: "managed_pg_users_password_policy_columns_migration",
+			sql: `
+ALTER TABLE managed_pg_users
+	ADD COLUMN IF NOT EXISTS password_valid_until TIMESTAMP WITH TIME ZONE,
+	ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMP WITH TIME ZONE,
+	ADD COLUMN IF NOT EXISTS rotation_interval_days INT NOT NULL DEFAULT 0`,
+		},
+		{
+			name: "pg_user_events",
+			sql: `
+CREATE TABLE IF NOT EXISTS pg_user_events (
+	event_id UUID PRIMARY KEY,
+	pg_user_id UUID NOT NULL,
+	database_id UUID NOT NULL,
+	event_type TEXT NOT NULL,
+	secret_ciphertext BYTEA,
+	secret_fetched_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	CONSTRAINT fk_managed_pg_user
+		FOREIGN KEY(pg_user_id)
+		REFERENCES managed_pg_users(pg_user_id)
+		ON DELETE CASCADE
+);`,
+		},
+		{
+			name: "idx_pg_user_events_user_created",
+			sql: `CREATE INDEX IF NOT EXISTS idx_pg_user_events_user_created ON pg_user_events(pg_user_id, created_at DESC)`,
+		},
+		{
+			name: "certificate_authority",
+			sql: `
+CREATE TABLE IF NOT EXISTS certificate_authority (
+	ca_id INT PRIMARY KEY DEFAULT 1 CHECK (ca_id = 1),
+	cert_pem TEXT NOT NULL,
+	key_ciphertext BYTEA NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);`,
+		},
+		{
+			name: "pg_user_certificates",
+			sql: `
+CREATE TABLE IF NOT EXISTS pg_user_certificates (
+	certificate_id UUID PRIMARY KEY,
+	pg_user_id UUID NOT NULL, -- No foreign key: records outlive the PG user so revocations stay in the CRL
+	database_id UUID NOT NULL,
+	pg_username TEXT NOT NULL,
+	serial_number TEXT NOT NULL UNIQUE,
+	fingerprint TEXT NOT NULL,
+	cert_pem TEXT NOT NULL,
+	not_before TIMESTAMP WITH TIME ZONE NOT NULL,
+	not_after TIMESTAMP WITH TIME ZONE NOT NULL,
+	revoked_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);`,
+		},
+		{
+			name: "idx_pg_user_certificates_pg_user",
+			sql:  `CREATE INDEX IF NOT EXISTS idx_pg_user_certificates_pg_user ON pg_user_certificates(pg_user_id)`,
+		},
+		{
+			name: "reconciliation_runs",
+			sql: `
+CREATE TABLE IF NOT EXISTS reconciliation_runs (
+	run_id UUID PRIMARY KEY,
+	trigger TEXT NOT NULL,
+	repair BOOLEAN NOT NULL DEFAULT FALSE,
+	findings JSONB NOT NULL DEFAULT '[]',
+	error TEXT NOT NULL DEFAULT '',
+	started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	completed_at TIMESTAMP WITH TIME ZONE NOT NULL
+);`,
+		},
+		{
+			name: "database_provisioning_steps",
+			sql: `
+CREATE TABLE IF NOT EXISTS database_provisioning_steps (
+	database_id UUID NOT NULL,
+	step TEXT NOT NULL,
+	position INT NOT NULL,
+	status TEXT NOT NULL,
+	error TEXT NOT NULL DEFAULT '',
+	attempts INT NOT NULL DEFAULT 0,
+	started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	completed_at TIMESTAMP WITH TIME ZONE,
+	PRIMARY KEY (database_id, step),
+	CONSTRAINT fk_managed_database
+		FOREIGN KEY(database_id)
+		REFERENCES managed_databases(database_id)
+		ON DELETE CASCADE
+);`,
+		},
+		{
+			name: "user_quotas",
+			sql: `
+CREATE TABLE IF NOT EXISTS user_quotas (
+	internal_user_id UUID PRIMARY KEY,
+	plan TEXT NOT NULL DEFAULT '',
+	overrides JSONB NOT NULL DEFAULT '{}',
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	CONSTRAINT fk_application_user
+		FOREIGN KEY(internal_user_id)
+		REFERENCES application_users(internal_user_id)
+		ON DELETE CASCADE
+);`,
+		},
+		{
+			name: "database_storage_state",
+			sql: `
+CREATE TABLE IF NOT EXISTS database_storage_state (
+	database_id UUID PRIMARY KEY,
+	size_bytes BIGINT NOT NULL,
+	limit_bytes BIGINT NOT NULL DEFAULT 0,
+	sampled_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	read_only_since TIMESTAMP WITH TIME ZONE,
+	CONSTRAINT fk_managed_database
+		FOREIGN KEY(database_id)
+		REFERENCES managed_databases(database_id)
+		ON DELETE CASCADE
+);`,
+		},
+		{
+			name: "database_ownership_transfers",
+			sql: `
+CREATE TABLE IF NOT EXISTS database_ownership_transfers (
+	transfer_id UUID PRIMARY KEY,
+	database_id UUID NOT NULL,
+	from_user_id UUID NOT NULL REFERENCES application_users(internal_user_id) ON DELETE CASCADE,
+	to_user_id UUID NOT NULL REFERENCES application_users(internal_user_id) ON DELETE CASCADE,
+	rotate_passwords BOOLEAN NOT NULL DEFAULT FALSE,
+	status TEXT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	resolved_at TIMESTAMP WITH TIME ZONE,
+	CONSTRAINT fk_managed_database
+		FOREIGN KEY(database_id)
+		REFERENCES managed_databases(database_id)
+		ON DELETE CASCADE
+);`,
+		},
+		{
+			name: "idx_database_ownership_transfers_pending",
+			sql:  `CREATE UNIQUE INDEX IF NOT EXISTS idx_database_ownership_transfers_pending ON database_ownership_transfers(database_id) WHERE status = 'pending'`,
+		},
+		{
+			name: "managed_pg_users_display_name",
+			sql: `
+ALTER TABLE managed_pg_users ADD COLUMN IF NOT EXISTS display_name TEXT NOT NULL DEFAULT '';
+UPDATE managed_pg_users SET display_name = pg_username WHERE display_name = '';`,
+		},
+		{
+			name: "idx_managed_pg_users_display_name",
+			sql:  `CREATE UNIQUE INDEX IF NOT EXISTS idx_managed_pg_users_display_name ON managed_pg_users(managed_database_id, display_name)`,
+		},
+		{
+			// Login roles are cluster-global, so their names are reserved across all databases.
+			name: "idx_managed_pg_users_pg_username",
+			sql:  `CREATE UNIQUE INDEX IF NOT EXISTS idx_managed_pg_users_pg_username ON managed_pg_users(pg_username)`,
+		},
+		{
+			name: "database_pool_settings",
+			sql: `
+CREATE TABLE IF NOT EXISTS database_pool_settings (
+	database_id UUID PRIMARY KEY,
+	pool_size INTEGER,
+	pool_mode TEXT,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	CONSTRAINT fk_managed_database
+		FOREIGN KEY(database_id)
+		REFERENCES managed_databases(database_id)
+		ON DELETE CASCADE
+);`,
+		},
+		{
+			name: "logical_replications",
+			sql: `
+CREATE TABLE IF NOT EXISTS logical_replications (
+	replication_id UUID PRIMARY KEY,
+	source_database_id UUID NOT NULL REFERENCES managed_databases(database_id) ON DELETE CASCADE,
+	target_database_id UUID NOT NULL REFERENCES managed_databases(database_id) ON DELETE CASCADE,
+	name TEXT NOT NULL UNIQUE,
+	pg_role_name TEXT NOT NULL,
+	tables TEXT[] NOT NULL,
+	created_by UUID NOT NULL REFERENCES application_users(internal_user_id) ON DELETE CASCADE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);`,
+		},
+		{
+			name: "database_links",
+			sql: `
+CREATE TABLE IF NOT EXISTS database_links (
+	link_id UUID PRIMARY KEY,
+	source_database_id UUID NOT NULL REFERENCES managed_databases(database_id) ON DELETE CASCADE,
+	target_database_id UUID NOT NULL REFERENCES managed_databases(database_id) ON DELETE CASCADE,
+	pg_user_id UUID NOT NULL REFERENCES managed_pg_users(pg_user_id) ON DELETE CASCADE,
+	server_name TEXT NOT NULL UNIQUE,
+	remote_schema TEXT NOT NULL,
+	local_schema TEXT NOT NULL,
+	tables TEXT[] NOT NULL,
+	created_by UUID NOT NULL REFERENCES application_users(internal_user_id) ON DELETE CASCADE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);`,
+		},
+		{
+			name: "pg_user_network_rules",
+			sql: `
+CREATE TABLE IF NOT EXISTS pg_user_network_rules (
+	pg_user_id UUID PRIMARY KEY,
+	allowed_cidrs TEXT[] NOT NULL,
+	require_ssl BOOLEAN NOT NULL DEFAULT FALSE,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	CONSTRAINT fk_managed_pg_user
+		FOREIGN KEY(pg_user_id)
+		REFERENCES managed_pg_users(pg_user_id)
+		ON DELETE CASCADE
+);`,
+		},
+		{
+			name: "maintenance_jobs",
+			sql: `
+CREATE TABLE IF NOT EXISTS maintenance_jobs (
+	maintenance_job_id UUID PRIMARY KEY,
+	database_id UUID NOT NULL,
+	operation TEXT NOT NULL,
+	full_vacuum BOOLEAN NOT NULL DEFAULT FALSE,
+	concurrently BOOLEAN NOT NULL DEFAULT FALSE,
+	tables TEXT[] NOT NULL,
+	status TEXT NOT NULL,
+	backend_pid INTEGER,
+	results JSONB NOT NULL DEFAULT '[]',
+	error_message TEXT NOT NULL DEFAULT '',
+	created_by UUID NOT NULL REFERENCES application_users(internal_user_id) ON DELETE CASCADE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	started_at TIMESTAMP WITH TIME ZONE,
+	completed_at TIMESTAMP WITH TIME ZONE,
+	CONSTRAINT fk_managed_database
+		FOREIGN KEY(database_id)
+		REFERENCES managed_databases(database_id)
+		ON DELETE CASCADE
+);`,
+		},
+		{
+			name: "idx_maintenance_jobs_database_created",
+			sql: `CREATE INDEX IF NOT EXISTS idx_maintenance_jobs_database_created ON maintenance_jobs(database_id, created_at DESC)`,
+		},
+		{
+			name: "query_stats_snapshots",
+			sql: `
+CREATE TABLE IF NOT EXISTS query_stats_snapshots (
+	snapshot_id UUID PRIMARY KEY,
+	database_id UUID NOT NULL,
+	captured_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	query_count INTEGER NOT NULL,
+	calls BIGINT NOT NULL,
+	total_time_ms DOUBLE PRECISION NOT NULL,
+	rows BIGINT NOT NULL,
+	CONSTRAINT fk_managed_database
+		FOREIGN KEY(database_id)
+		REFERENCES managed_databases(database_id)
+		ON DELETE CASCADE
+);`,
+		},
+		{
+			name: "idx_query_stats_snapshots_database_captured",
+			sql: `CREATE INDEX IF NOT EXISTS idx_query_stats_snapshots_database_captured ON query_stats_snapshots(database_id, captured_at DESC)`,
+		},
+		{
+			name: "query_stats_snapshot_entries",
+			sql: `
+CREATE TABLE IF NOT EXISTS query_stats_snapshot_entries (
+	snapshot_id UUID NOT NULL,
+	query_id BIGINT NOT NULL,
+	pg_username TEXT NOT NULL,
+	query TEXT NOT NULL,
+	calls BIGINT NOT NULL,
+	total_time_ms DOUBLE PRECISION NOT NULL,
+	rows BIGINT NOT NULL,
+	mean_time_ms DOUBLE PRECISION NOT NULL,
+	PRIMARY KEY (snapshot_id, query_id, pg_username),
+	CONSTRAINT fk_query_stats_snapshot
+		FOREIGN KEY(snapshot_id)
+		REFERENCES query_stats_snapshots(snapshot_id)
+		ON DELETE CASCADE
+);`,
+		},
+		{
+			name: "pg_user_events_status_column_migration",
+			sql: `ALTER TABLE pg_user_events ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'committed'`,
+		},
+		{
+			name: "idx_maintenance_jobs_one_active",
+			sql: `
+UPDATE maintenance_jobs j SET status = 'failed', error_message = 'superseded by a concurrent job', completed_at = now()
+WHERE status IN ('pending', 'in_progress') AND EXISTS (
+	SELECT 1 FROM maintenance_jobs n WHERE n.database_id = j.database_id AND n.status IN ('pending', 'in_progress') AND n.created_at > j.created_at
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_maintenance_jobs_one_active ON maintenance_jobs(database_id) WHERE status IN ('pending', 'in_progress');`,
+		},
+		{
+			name: "permission_sets",
+			sql: `
+CREATE TABLE IF NOT EXISTS permission_sets (
+	permission_set_id UUID PRIMARY KEY,
+	database_id UUID NOT NULL,
+	name TEXT NOT NULL,
+	pg_role_name TEXT UNIQUE NOT NULL,
+	grants JSONB NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	CONSTRAINT fk_managed_database
+		FOREIGN KEY(database_id)
+		REFERENCES managed_databases(database_id)
+		ON DELETE CASCADE,
+	UNIQUE (database_id, name)
+);`,
+		},
+		{
+			name: "managed_pg_user_permission_sets",
+			sql: `
+CREATE TABLE IF NOT EXISTS managed_pg_user_permission_sets (
+	pg_user_id UUID NOT NULL,
+	permission_set_id UUID NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	PRIMARY KEY (pg_user_id, permission_set_id),
+	CONSTRAINT fk_managed_pg_user
+		FOREIGN KEY(pg_user_id)
+		REFERENCES managed_pg_users(pg_user_id)
+		ON DELETE CASCADE,
+	CONSTRAINT fk_permission_set
+		FOREIGN KEY(permission_set_id)
+		REFERENCES permission_sets(permission_set_id)
+		ON DELETE CASCADE
+);`,
+		},
 	}
 
 	for _, m := range migrations {
@@ -276,6 +643,10 @@ func CreateManagedDatabase(db *models.ManagedDatabase) error {
 	           VALUES ($1, $2, $3, $4, $5, $6)`
 	_, err := AppDB.Exec(query, db.DatabaseID, db.OwnerUserID, db.PGDatabaseName, db.Status, db.CreatedAt, db.UpdatedAt)
 	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+			return ErrDatabaseNameTaken
+		}
 		return fmt.Errorf("error creating managed_database record for %s: %w", db.PGDatabaseName, err)
 	}
 	return nil
@@ -379,6 +750,43 @@ func CheckIfManagedDatabaseExists(databaseID uuid.UUID) (bool, error) {
 
 // --- ManagedPGUser CRUD & related functions ---
 
+// managedPGUserColumns lists the managed_pg_users columns read by scanManagedPGUser.
+// Queries must alias managed_pg_users as "u".
+const managedPGUserColumns = `u.pg_user_id, u.managed_database_id, u.pg_username, u.display_name, u.permission_level, u.status, u.created_at, u.updated_at,
+	u.search_path, u.connection_limit, u.statement_timeout, u.idle_in_transaction_session_timeout, u.lock_timeout,
+	u.password_valid_until, u.password_changed_at, u.rotation_interval_days`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanManagedPGUser scans a row selected with managedPGUserColumns.
+func scanManagedPGUser(row rowScanner) (*models.ManagedPGUser, error) {
+	pgUser := &models.ManagedPGUser{}
+	var searchPath string
+	var validUntil, changedAt sql.NullTime
+	err := row.Scan(
+		&pgUser.PGUserID, &pgUser.ManagedDatabaseID, &pgUser.PGUsername, &pgUser.DisplayName,
+		&pgUser.PermissionLevel, &pgUser.Status, &pgUser.CreatedAt, &pgUser.UpdatedAt,
+		&searchPath, &pgUser.ConnectionLimit, &pgUser.StatementTimeout, &pgUser.IdleInTransactionSessionTimeout, &pgUser.LockTimeout,
+		&validUntil, &changedAt, &pgUser.RotationIntervalDays,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if validUntil.Valid {
+		pgUser.PasswordValidUntil = &validUntil.Time
+	}
+	if changedAt.Valid {
+		pgUser.PasswordChangedAt = &changedAt.Time
+	}
+	if searchPath != "" {
+		pgUser.SearchPath = strings.Split(searchPath, ",")
+	}
+	return pgUser, nil
+}
+
 // CreateManagedPGUser creates a new PostgreSQL user record associated with a managed database.
 func CreateManagedPGUser(pgUser *models.ManagedPGUser) error {
 	if AppDB == nil {
@@ -390,11 +798,18 @@ func CreateManagedPGUser(pgUser *models.ManagedPGUser) error {
 	if pgUser.PGUserID == uuid.Nil {
 		pgUser.PGUserID = uuid.New()
 	}
+	if pgUser.DisplayName == "" {
+		pgUser.DisplayName = pgUser.PGUsername
+	}
 	pgUser.CreatedAt = time.Now()
 	pgUser.UpdatedAt = time.Now()
-	query := `INSERT INTO managed_pg_users (pg_user_id, managed_database_id, pg_username, permission_level, status, created_at, updated_at)
-	           VALUES ($1, $2, $3, $4, $5, $6, $7)`
-	_, err := AppDB.Exec(query, pgUser.PGUserID, pgUser.ManagedDatabaseID, pgUser.PGUsername, pgUser.PermissionLevel, pgUser.Status, pgUser.CreatedAt, pgUser.UpdatedAt)
+	query := `INSERT INTO managed_pg_users (pg_user_id, managed_database_id, pg_username, display_name, permission_level, status, created_at, updated_at,
+	           connection_limit, statement_timeout, idle_in_transaction_session_timeout, lock_timeout,
+	           password_valid_until, password_changed_at, rotation_interval_days)
+	           VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`
+	_, err := AppDB.Exec(query, pgUser.PGUserID, pgUser.ManagedDatabaseID, pgUser.PGUsername, pgUser.DisplayName, pgUser.PermissionLevel, pgUser.Status, pgUser.CreatedAt, pgUser.UpdatedAt,
+		pgUser.ConnectionLimit, pgUser.StatementTimeout, pgUser.IdleInTransactionSessionTimeout, pgUser.LockTimeout,
+		pgUser.PasswordValidUntil, pgUser.PasswordChangedAt, pgUser.RotationIntervalDays)
 	if err != nil {
 		return fmt.Errorf("error creating managed_pg_user record for %s in db %s: %w", pgUser.PGUsername, pgUser.ManagedDatabaseID, err)
 	}
@@ -425,16 +840,12 @@ func GetManagedPGUserByID(pgUserID uuid.UUID, ownerUserID uuid.UUID) (*models.Ma
 		return nil, errors.New("database not initialized")
 	}
 	query := `
-        SELECT u.pg_user_id, u.managed_database_id, u.pg_username, u.permission_level, u.status, u.created_at, u.updated_at
+        SELECT ` + managedPGUserColumns + `
         FROM managed_pg_users u
         JOIN managed_databases d ON u.managed_database_id = d.database_id
         WHERE u.pg_user_id = $1 AND d.owner_user_id = $2`
 
-	pgUser := &models.ManagedPGUser{}
-	err := AppDB.QueryRow(query, pgUserID, ownerUserID).Scan(
-		&pgUser.PGUserID, &pgUser.ManagedDatabaseID, &pgUser.PGUsername,
-		&pgUser.PermissionLevel, &pgUser.Status, &pgUser.CreatedAt, &pgUser.UpdatedAt,
-	)
+	pgUser, err := scanManagedPGUser(AppDB.QueryRow(query, pgUserID, ownerUserID))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, sql.ErrNoRows // PGUser not found or parent DB not owned by user
@@ -444,12 +855,13 @@ func GetManagedPGUserByID(pgUserID uuid.UUID, ownerUserID uuid.UUID) (*models.Ma
 	return pgUser, nil
 }
 
-// CheckIfPGUsernameExistsInDB checks if a PostgreSQL username already exists within a specific managed database.
+// CheckIfPGUsernameExistsInDB checks if a PostgreSQL username already exists within a specific managed database,
+// either as a display name or as a login role name.
 func CheckIfPGUsernameExistsInDB(databaseID uuid.UUID, pgUsername string) (bool, error) {
 	if AppDB == nil {
 		return false, errors.New("database not initialized")
 	}
-	query := `SELECT EXISTS(SELECT 1 FROM managed_pg_users WHERE managed_database_id = $1 AND pg_username = $2)`
+	query := `SELECT EXISTS(SELECT 1 FROM managed_pg_users WHERE managed_database_id = $1 AND (pg_username = $2 OR display_name = $2))`
 	var exists bool
 	err := AppDB.QueryRow(query, databaseID, pgUsername).Scan(&exists)
 	if err != nil {
@@ -458,14 +870,45 @@ func CheckIfPGUsernameExistsInDB(databaseID uuid.UUID, pgUsername string) (bool,
 	return exists, nil
 }
 
+// CheckIfPGUsernameManaged checks if a PostgreSQL username is recorded for any managed database.
+// Roles are cluster-wide, so a login role can only back one managed PG user.
+func CheckIfPGUsernameManaged(pgUsername string) (bool, error) {
+	if AppDB == nil {
+		return false, errors.New("database not initialized")
+	}
+	query := `SELECT EXISTS(SELECT 1 FROM managed_pg_users WHERE pg_username = $1)`
+	var exists bool
+	err := AppDB.QueryRow(query, pgUsername).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error checking if pg_username %s is managed: %w", pgUsername, err)
+	}
+	return exists, nil
+}
+
+// CheckIfRoleNameRecorded checks if a role name is recorded anywhere in the application: as a managed PG
+// user's login role, a permission set role or a logical replication role.
+func CheckIfRoleNameRecorded(roleName string) (bool, error) {
+	if AppDB == nil {
+		return false, errors.New("database not initialized")
+	}
+	query := `SELECT EXISTS(SELECT 1 FROM managed_pg_users WHERE pg_username = $1)
+		OR EXISTS(SELECT 1 FROM permission_sets WHERE pg_role_name = $1)
+		OR EXISTS(SELECT 1 FROM logical_replications WHERE pg_role_name = $1)`
+	var recorded bool
+	if err := AppDB.QueryRow(query, roleName).Scan(&recorded); err != nil {
+		return false, fmt.Errorf("error checking if role %s is recorded: %w", roleName, err)
+	}
+	return recorded, nil
+}
+
 // GetManagedPGUsersByDatabaseID retrieves all PostgreSQL users associated with a specific managed database.
 // This function does NOT check ownership of the database.
 func GetManagedPGUsersByDatabaseID(databaseID uuid.UUID) ([]models.ManagedPGUser, error) {
 	if AppDB == nil {
 		return nil, errors.New("database not initialized")
 	}
-	query := `SELECT pg_user_id, managed_database_id, pg_username, permission_level, status, created_at, updated_at
-	           FROM managed_pg_users WHERE managed_database_id = $1 ORDER BY created_at DESC`
+	query := `SELECT ` + managedPGUserColumns + `
+	           FROM managed_pg_users u WHERE u.managed_database_id = $1 ORDER BY u.created_at DESC`
 	rows, err := AppDB.Query(query, databaseID)
 	if err != nil {
 		return nil, fmt.Errorf("error querying managed PG users for database %s: %w", databaseID, err)
@@ -473,15 +916,12 @@ func GetManagedPGUsersByDatabaseID(databaseID uuid.UUID) ([]models.ManagedPGUser
 	defer rows.Close()
 	var users []models.ManagedPGUser
 	for rows.Next() {
-		var user models.ManagedPGUser
-		if err := rows.Scan(
-			&user.PGUserID, &user.ManagedDatabaseID, &user.PGUsername,
-			&user.PermissionLevel, &user.Status, &user.CreatedAt, &user.UpdatedAt,
-		); err != nil {
+		user, err := scanManagedPGUser(rows)
+		if err != nil {
 			log.Printf("Error scanning managed PG user row for database %s: %v", databaseID, err)
 			continue
 		}
-		users = append(users, user)
+		users = append(users, *user)
 	}
 	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating managed PG user rows for database %s: %w", databaseID, err)
@@ -516,6 +956,45 @@ func DeleteManagedPGUser(pgUserID uuid.UUID) error {
 	return nil
 }
 
+// UpdateManagedPGUserUsername records a new login role name for a PG user after the role was renamed.
+func UpdateManagedPGUserUsername(pgUserID uuid.UUID, pgUsername string) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	query := `UPDATE managed_pg_users SET pg_username = $1, updated_at = $2 WHERE pg_user_id = $3`
+	if _, err := AppDB.Exec(query, pgUsername, time.Now(), pgUserID); err != nil {
+		return fmt.Errorf("error updating pg_username for PG user %s: %w", pgUserID, err)
+	}
+	return nil
+}
+
+// UpdateManagedPGUserSearchPath records the search_path configured for a PG user.
+func UpdateManagedPGUserSearchPath(pgUserID uuid.UUID, searchPath []string) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	query := `UPDATE managed_pg_users SET search_path = $1, updated_at = $2 WHERE pg_user_id = $3`
+	_, err := AppDB.Exec(query, strings.Join(searchPath, ","), time.Now(), pgUserID)
+	if err != nil {
+		return fmt.Errorf("error updating search_path for PG user %s: %w", pgUserID, err)
+	}
+	return nil
+}
+
+// UpdateManagedPGUserLimits records the connection limit and session timeouts applied to a PG user.
+func UpdateManagedPGUserLimits(pgUserID uuid.UUID, limits models.PGUserLimits) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	query := `UPDATE managed_pg_users SET connection_limit = $1, statement_timeout = $2, idle_in_transaction_session_timeout = $3,
+	           lock_timeout = $4, updated_at = $5 WHERE pg_user_id = $6`
+	_, err := AppDB.Exec(query, limits.ConnectionLimit, limits.StatementTimeout, limits.IdleInTransactionSessionTimeout, limits.LockTimeout, time.Now(), pgUserID)
+	if err != nil {
+		return fmt.Errorf("error updating limits for PG user %s: %w", pgUserID, err)
+	}
+	return nil
+}
+
 func UpdateManagedPGUserStatusForDB(databaseID uuid.UUID, newStatus string) error {
 	if AppDB == nil {
 		return errors.New("database not initialized")
@@ -693,7 +1172,12 @@ func WriteAuditLog(actorUserID *uuid.UUID, action, targetType, targetID string,
 	           VALUES ($1, $2, $3, $4, $5, $6, $7)`
 	var payloadVal interface{}
 	if payload != nil {
-		payloadVal = payload
+		payloadJSON, err := json.Marshal(payload)
+		if err != nil {
+			log.Printf("Warning: failed to encode audit log payload (action=%s, target=%s/%s): %v", action, targetType, targetID, err)
+			return err
+		}
+		payloadVal = payloadJSON
 	}
 	_, err := AppDB.Exec(query, uuid.New(), actorUserID, action, targetType, targetID, payloadVal, time.Now())
 	if err != nil {
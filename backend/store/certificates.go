@@ -0,0 +1,209 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"pgweb-backend/models"
+
+	"github.com/google/uuid"
+)
+
+// --- Certificate authority ---
+
+// GetCertificateAuthority returns the PEM-encoded certificate and decrypted key of the internal CA.
+// Returns sql.ErrNoRows if no CA has been created yet.
+func GetCertificateAuthority() (certPEM, keyPEM []byte, err error) {
+	if AppDB == nil {
+		return nil, nil, errors.New("database not initialized")
+	}
+	var cert string
+	var keyCiphertext []byte
+	err = AppDB.QueryRow(`SELECT cert_pem, key_ciphertext FROM certificate_authority WHERE ca_id = 1`).Scan(&cert, &keyCiphertext)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, sql.ErrNoRows
+		}
+		return nil, nil, fmt.Errorf("error fetching certificate authority: %w", err)
+	}
+	keyPEM, err = DecryptSecret(keyCiphertext)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decrypting certificate authority key: %w", err)
+	}
+	return []byte(cert), keyPEM, nil
+}
+
+// CreateCertificateAuthorityIfAbsent stores a CA with its key encrypted. If another instance
+// created the CA first, the existing one is kept; callers should re-read it.
+func CreateCertificateAuthorityIfAbsent(certPEM, keyPEM []byte) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	keyCiphertext, err := EncryptSecret(keyPEM)
+	if err != nil {
+		return fmt.Errorf("error encrypting certificate authority key: %w", err)
+	}
+	query := `INSERT INTO certificate_authority (ca_id, cert_pem, key_ciphertext, created_at) VALUES (1, $1, $2, $3)
+	           ON CONFLICT (ca_id) DO NOTHING`
+	if _, err := AppDB.Exec(query, string(certPEM), keyCiphertext, time.Now()); err != nil {
+		return fmt.Errorf("error creating certificate authority: %w", err)
+	}
+	return nil
+}
+
+// --- PGUserCertificate ---
+
+const pgUserCertificateColumns = `certificate_id, pg_user_id, database_id, pg_username, serial_number, fingerprint, cert_pem, not_before, not_after, revoked_at, created_at`
+
+func scanPGUserCertificate(row rowScanner) (*models.PGUserCertificate, error) {
+	cert := &models.PGUserCertificate{}
+	var revokedAt sql.NullTime
+	if err := row.Scan(&cert.CertificateID, &cert.PGUserID, &cert.DatabaseID, &cert.PGUsername, &cert.SerialNumber, &cert.Fingerprint,
+		&cert.CertificatePEM, &cert.NotBefore, &cert.NotAfter, &revokedAt, &cert.CreatedAt); err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		cert.RevokedAt = &revokedAt.Time
+	}
+	return cert, nil
+}
+
+// CreatePGUserCertificate records an issued client certificate.
+func CreatePGUserCertificate(cert *models.PGUserCertificate) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	if cert.CertificateID == uuid.Nil {
+		cert.CertificateID = uuid.New()
+	}
+	cert.CreatedAt = time.Now()
+	query := `INSERT INTO pg_user_certificates (` + pgUserCertificateColumns + `)
+	           VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULL, $10)`
+	_, err := AppDB.Exec(query, cert.CertificateID, cert.PGUserID, cert.DatabaseID, cert.PGUsername, cert.SerialNumber, cert.Fingerprint,
+		cert.CertificatePEM, cert.NotBefore, cert.NotAfter, cert.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating certificate record for PG user %s: %w", cert.PGUserID, err)
+	}
+	return nil
+}
+
+// GetPGUserCertificates lists the certificates issued for a PG user, newest first.
+func GetPGUserCertificates(pgUserID uuid.UUID) ([]models.PGUserCertificate, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT ` + pgUserCertificateColumns + ` FROM pg_user_certificates WHERE pg_user_id = $1 ORDER BY created_at DESC`
+	rows, err := AppDB.Query(query, pgUserID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying certificates for PG user %s: %w", pgUserID, err)
+	}
+	defer rows.Close()
+	var certs []models.PGUserCertificate
+	for rows.Next() {
+		cert, err := scanPGUserCertificate(rows)
+		if err != nil {
+			log.Printf("Error scanning certificate row for PG user %s: %v", pgUserID, err)
+			continue
+		}
+		certs = append(certs, *cert)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating certificate rows for PG user %s: %w", pgUserID, err)
+	}
+	return certs, nil
+}
+
+// GetPGUserCertificateByID fetches a certificate, ensuring it belongs to pgUserID.
+func GetPGUserCertificateByID(certificateID uuid.UUID, pgUserID uuid.UUID) (*models.PGUserCertificate, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT ` + pgUserCertificateColumns + ` FROM pg_user_certificates WHERE certificate_id = $1 AND pg_user_id = $2`
+	cert, err := scanPGUserCertificate(AppDB.QueryRow(query, certificateID, pgUserID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("error fetching certificate %s: %w", certificateID, err)
+	}
+	return cert, nil
+}
+
+// RevokePGUserCertificate marks a certificate as revoked. Revoking twice keeps the first revocation time.
+func RevokePGUserCertificate(certificateID uuid.UUID, revokedAt time.Time) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	query := `UPDATE pg_user_certificates SET revoked_at = COALESCE(revoked_at, $1) WHERE certificate_id = $2`
+	if _, err := AppDB.Exec(query, revokedAt, certificateID); err != nil {
+		return fmt.Errorf("error revoking certificate %s: %w", certificateID, err)
+	}
+	return nil
+}
+
+// RevokePGUserCertificates revokes all certificates of a PG user, e.g. when the user is deleted,
+// so a later user with the same name cannot log in with them.
+func RevokePGUserCertificates(pgUserID uuid.UUID, revokedAt time.Time) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	query := `UPDATE pg_user_certificates SET revoked_at = $1 WHERE pg_user_id = $2 AND revoked_at IS NULL`
+	if _, err := AppDB.Exec(query, revokedAt, pgUserID); err != nil {
+		return fmt.Errorf("error revoking certificates of PG user %s: %w", pgUserID, err)
+	}
+	return nil
+}
+
+// GetPGUserIDsWithActiveCertificates returns the PG users holding an unrevoked, unexpired certificate.
+func GetPGUserIDsWithActiveCertificates(now time.Time) (map[uuid.UUID]bool, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	rows, err := AppDB.Query(`SELECT DISTINCT pg_user_id FROM pg_user_certificates WHERE revoked_at IS NULL AND not_after > $1`, now)
+	if err != nil {
+		return nil, fmt.Errorf("error querying PG users with active certificates: %w", err)
+	}
+	defer rows.Close()
+	ids := make(map[uuid.UUID]bool)
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning PG user with active certificates: %w", err)
+		}
+		ids[id] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating PG users with active certificates: %w", err)
+	}
+	return ids, nil
+}
+
+// GetRevokedUnexpiredCertificates returns revoked certificates that have not yet expired, for the CRL.
+func GetRevokedUnexpiredCertificates(now time.Time) ([]models.PGUserCertificate, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT ` + pgUserCertificateColumns + ` FROM pg_user_certificates
+	           WHERE revoked_at IS NOT NULL AND not_after > $1 ORDER BY revoked_at`
+	rows, err := AppDB.Query(query, now)
+	if err != nil {
+		return nil, fmt.Errorf("error querying revoked certificates: %w", err)
+	}
+	defer rows.Close()
+	var certs []models.PGUserCertificate
+	for rows.Next() {
+		cert, err := scanPGUserCertificate(rows)
+		if err != nil {
+			log.Printf("Error scanning revoked certificate row: %v", err)
+			continue
+		}
+		certs = append(certs, *cert)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating revoked certificate rows: %w", err)
+	}
+	return certs, nil
+}
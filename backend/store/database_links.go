@@ -0,0 +1,118 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"pgweb-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const databaseLinkColumns = `l.link_id, l.source_database_id, l.target_database_id, s.pg_database_name, t.pg_database_name,
+	l.pg_user_id, u.pg_username, l.server_name, l.remote_schema, l.local_schema, l.tables, l.created_by, l.created_at`
+
+const databaseLinkJoins = `FROM database_links l
+	JOIN managed_databases s ON l.source_database_id = s.database_id
+	JOIN managed_databases t ON l.target_database_id = t.database_id
+	JOIN managed_pg_users u ON l.pg_user_id = u.pg_user_id`
+
+func scanDatabaseLink(row rowScanner) (*models.DatabaseLink, error) {
+	l := &models.DatabaseLink{}
+	err := row.Scan(&l.LinkID, &l.SourceDatabaseID, &l.TargetDatabaseID, &l.SourceDatabase, &l.TargetDatabase,
+		&l.PGUserID, &l.PGUsername, &l.ServerName, &l.RemoteSchema, &l.LocalSchema, pq.Array(&l.Tables), &l.CreatedBy, &l.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// queryDatabaseLinks runs a database link query and collects the rows.
+func queryDatabaseLinks(where string, args ...any) ([]models.DatabaseLink, error) {
+	rows, err := AppDB.Query(`SELECT `+databaseLinkColumns+` `+databaseLinkJoins+` WHERE `+where+` ORDER BY l.created_at`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database links: %w", err)
+	}
+	defer rows.Close()
+	links := []models.DatabaseLink{}
+	for rows.Next() {
+		l, err := scanDatabaseLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning database link: %w", err)
+		}
+		links = append(links, *l)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating database links: %w", err)
+	}
+	return links, nil
+}
+
+// CreateDatabaseLink records a database link whose PostgreSQL objects were created.
+func CreateDatabaseLink(l *models.DatabaseLink) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	if l.LinkID == uuid.Nil {
+		l.LinkID = uuid.New()
+	}
+	if l.Tables == nil {
+		l.Tables = []string{}
+	}
+	l.CreatedAt = time.Now()
+	query := `INSERT INTO database_links (link_id, source_database_id, target_database_id, pg_user_id, server_name, remote_schema, local_schema, tables, created_by, created_at)
+	           VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	_, err := AppDB.Exec(query, l.LinkID, l.SourceDatabaseID, l.TargetDatabaseID, l.PGUserID, l.ServerName, l.RemoteSchema, l.LocalSchema,
+		pq.Array(l.Tables), l.CreatedBy, l.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating database link %s: %w", l.ServerName, err)
+	}
+	return nil
+}
+
+// GetDatabaseLinksByDatabaseID lists the database links a database is the source or target of.
+func GetDatabaseLinksByDatabaseID(databaseID uuid.UUID) ([]models.DatabaseLink, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	return queryDatabaseLinks(`l.source_database_id = $1 OR l.target_database_id = $1`, databaseID)
+}
+
+// GetDatabaseLinksByPGUserID lists the database links whose user mapping connects as a PG user.
+func GetDatabaseLinksByPGUserID(pgUserID uuid.UUID) ([]models.DatabaseLink, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	return queryDatabaseLinks(`l.pg_user_id = $1`, pgUserID)
+}
+
+// GetDatabaseLinkByID returns a database link the database is the source or target of, or sql.ErrNoRows.
+func GetDatabaseLinkByID(linkID, databaseID uuid.UUID) (*models.DatabaseLink, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT ` + databaseLinkColumns + ` ` + databaseLinkJoins + `
+	           WHERE l.link_id = $1 AND (l.source_database_id = $2 OR l.target_database_id = $2)`
+	l, err := scanDatabaseLink(AppDB.QueryRow(query, linkID, databaseID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("error querying database link %s: %w", linkID, err)
+	}
+	return l, nil
+}
+
+// DeleteDatabaseLink removes the record of a database link.
+func DeleteDatabaseLink(linkID uuid.UUID) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	if _, err := AppDB.Exec(`DELETE FROM database_links WHERE link_id = $1`, linkID); err != nil {
+		return fmt.Errorf("error deleting database link %s: %w", linkID, err)
+	}
+	return nil
+}
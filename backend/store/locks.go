@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// TryAdvisoryLock takes the session-level advisory lock named key on the application database
+// without waiting. Every backend replica shares the application database, so the lock is held
+// cluster-wide. ok is false if another session holds the lock; otherwise release must be called
+// to unlock. The lock is also released if the connection is lost.
+func TryAdvisoryLock(key string) (release func(), ok bool, err error) {
+	if AppDB == nil {
+		return nil, false, errors.New("database not initialized")
+	}
+	ctx := context.Background()
+	// Advisory locks belong to a session, so the lock and unlock must use the same connection.
+	conn, err := AppDB.Conn(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("error acquiring connection for advisory lock %s: %w", key, err)
+	}
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", key).Scan(&ok); err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("error taking advisory lock %s: %w", key, err)
+	}
+	if !ok {
+		conn.Close()
+		return nil, false, nil
+	}
+	return func() {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtext($1))", key); err != nil {
+			log.Printf("Warning: failed to release advisory lock %s: %v", key, err)
+			// Discard the connection instead of returning it to the pool still holding the lock.
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}, true, nil
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"pgweb-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const logicalReplicationColumns = `r.replication_id, r.source_database_id, r.target_database_id, s.pg_database_name, t.pg_database_name,
+	r.name, r.pg_role_name, r.tables, r.created_by, r.created_at`
+
+const logicalReplicationJoins = `FROM logical_replications r
+	JOIN managed_databases s ON r.source_database_id = s.database_id
+	JOIN managed_databases t ON r.target_database_id = t.database_id`
+
+func scanLogicalReplication(row rowScanner) (*models.LogicalReplication, error) {
+	r := &models.LogicalReplication{}
+	err := row.Scan(&r.ReplicationID, &r.SourceDatabaseID, &r.TargetDatabaseID, &r.SourceDatabase, &r.TargetDatabase,
+		&r.Name, &r.PGRoleName, pq.Array(&r.Tables), &r.CreatedBy, &r.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// CreateLogicalReplication records a logical replication whose PostgreSQL objects were created.
+func CreateLogicalReplication(r *models.LogicalReplication) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	if r.ReplicationID == uuid.Nil {
+		r.ReplicationID = uuid.New()
+	}
+	r.CreatedAt = time.Now()
+	query := `INSERT INTO logical_replications (replication_id, source_database_id, target_database_id, name, pg_role_name, tables, created_by, created_at)
+	           VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := AppDB.Exec(query, r.ReplicationID, r.SourceDatabaseID, r.TargetDatabaseID, r.Name, r.PGRoleName, pq.Array(r.Tables), r.CreatedBy, r.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating logical replication %s: %w", r.Name, err)
+	}
+	return nil
+}
+
+// GetLogicalReplicationsByDatabaseID lists the logical replications a database is the source or target of.
+func GetLogicalReplicationsByDatabaseID(databaseID uuid.UUID) ([]models.LogicalReplication, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT ` + logicalReplicationColumns + ` ` + logicalReplicationJoins + `
+	           WHERE r.source_database_id = $1 OR r.target_database_id = $1 ORDER BY r.created_at`
+	rows, err := AppDB.Query(query, databaseID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying logical replications of database %s: %w", databaseID, err)
+	}
+	defer rows.Close()
+	replications := []models.LogicalReplication{}
+	for rows.Next() {
+		r, err := scanLogicalReplication(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning logical replication: %w", err)
+		}
+		replications = append(replications, *r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating logical replications: %w", err)
+	}
+	return replications, nil
+}
+
+// GetLogicalReplicationByID returns a logical replication the database is the source or target of,
+// or sql.ErrNoRows.
+func GetLogicalReplicationByID(replicationID, databaseID uuid.UUID) (*models.LogicalReplication, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT ` + logicalReplicationColumns + ` ` + logicalReplicationJoins + `
+	           WHERE r.replication_id = $1 AND (r.source_database_id = $2 OR r.target_database_id = $2)`
+	r, err := scanLogicalReplication(AppDB.QueryRow(query, replicationID, databaseID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("error querying logical replication %s: %w", replicationID, err)
+	}
+	return r, nil
+}
+
+// DeleteLogicalReplication removes the record of a logical replication.
+func DeleteLogicalReplication(replicationID uuid.UUID) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	if _, err := AppDB.Exec(`DELETE FROM logical_replications WHERE replication_id = $1`, replicationID); err != nil {
+		return fmt.Errorf("error deleting logical replication %s: %w", replicationID, err)
+	}
+	return nil
+}
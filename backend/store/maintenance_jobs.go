@@ -0,0 +1,168 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"pgweb-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ErrMaintenanceJobActive is returned by CreateMaintenanceJob when the database already has a pending or running job.
+var ErrMaintenanceJobActive = errors.New("database already has an active maintenance job")
+
+const maintenanceJobColumns = `maintenance_job_id, database_id, operation, full_vacuum, concurrently, tables, status, backend_pid,
+	results, error_message, created_by, created_at, started_at, completed_at`
+
+func scanMaintenanceJob(row rowScanner) (*models.MaintenanceJob, error) {
+	job := &models.MaintenanceJob{}
+	var backendPID sql.NullInt64
+	var results []byte
+	var startedAt, completedAt sql.NullTime
+	err := row.Scan(&job.MaintenanceJobID, &job.DatabaseID, &job.Operation, &job.Full, &job.Concurrently, pq.Array(&job.Tables),
+		&job.Status, &backendPID, &results, &job.ErrorMessage, &job.CreatedBy, &job.CreatedAt, &startedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(results, &job.Results); err != nil {
+		return nil, fmt.Errorf("error decoding results of maintenance job %s: %w", job.MaintenanceJobID, err)
+	}
+	if backendPID.Valid {
+		pid := int(backendPID.Int64)
+		job.BackendPID = &pid
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	return job, nil
+}
+
+// CreateMaintenanceJob records a new pending maintenance job.
+func CreateMaintenanceJob(job *models.MaintenanceJob) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	if job.MaintenanceJobID == uuid.Nil {
+		job.MaintenanceJobID = uuid.New()
+	}
+	if job.Tables == nil {
+		job.Tables = []string{}
+	}
+	job.Results = []models.MaintenanceResult{}
+	job.Status = "pending"
+	job.CreatedAt = time.Now()
+	query := `INSERT INTO maintenance_jobs (maintenance_job_id, database_id, operation, full_vacuum, concurrently, tables, status, created_by, created_at)
+	           VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err := AppDB.Exec(query, job.MaintenanceJobID, job.DatabaseID, job.Operation, job.Full, job.Concurrently, pq.Array(job.Tables),
+		job.Status, job.CreatedBy, job.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation on the active job index
+			return ErrMaintenanceJobActive
+		}
+		return fmt.Errorf("error creating maintenance job for database %s: %w", job.DatabaseID, err)
+	}
+	return nil
+}
+
+// GetMaintenanceJobByID returns a maintenance job of a database, or sql.ErrNoRows.
+func GetMaintenanceJobByID(jobID, databaseID uuid.UUID) (*models.MaintenanceJob, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT ` + maintenanceJobColumns + ` FROM maintenance_jobs WHERE maintenance_job_id = $1 AND database_id = $2`
+	job, err := scanMaintenanceJob(AppDB.QueryRow(query, jobID, databaseID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("error querying maintenance job %s: %w", jobID, err)
+	}
+	return job, nil
+}
+
+// GetMaintenanceJobsByDatabaseID lists the most recent maintenance jobs of a database, newest first.
+func GetMaintenanceJobsByDatabaseID(databaseID uuid.UUID, limit int) ([]models.MaintenanceJob, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT ` + maintenanceJobColumns + ` FROM maintenance_jobs WHERE database_id = $1 ORDER BY created_at DESC LIMIT $2`
+	rows, err := AppDB.Query(query, databaseID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying maintenance jobs of database %s: %w", databaseID, err)
+	}
+	defer rows.Close()
+	jobs := []models.MaintenanceJob{}
+	for rows.Next() {
+		job, err := scanMaintenanceJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning maintenance job: %w", err)
+		}
+		jobs = append(jobs, *job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating maintenance jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// GetActiveMaintenanceJob returns the pending or in-progress maintenance job of a database, or sql.ErrNoRows.
+func GetActiveMaintenanceJob(databaseID uuid.UUID) (*models.MaintenanceJob, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT ` + maintenanceJobColumns + ` FROM maintenance_jobs
+	           WHERE database_id = $1 AND status IN ('pending', 'in_progress') ORDER BY created_at DESC LIMIT 1`
+	job, err := scanMaintenanceJob(AppDB.QueryRow(query, databaseID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("error querying active maintenance job of database %s: %w", databaseID, err)
+	}
+	return job, nil
+}
+
+// UpdateMaintenanceJobProgress marks a maintenance job in progress on a server process and stores its results so far.
+func UpdateMaintenanceJobProgress(jobID uuid.UUID, backendPID int, results []models.MaintenanceResult) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	resultsJSON, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("error encoding results of maintenance job %s: %w", jobID, err)
+	}
+	query := `UPDATE maintenance_jobs SET status = 'in_progress', backend_pid = $1, results = $2, started_at = COALESCE(started_at, $3)
+	           WHERE maintenance_job_id = $4`
+	if _, err := AppDB.Exec(query, backendPID, resultsJSON, time.Now(), jobID); err != nil {
+		return fmt.Errorf("error updating maintenance job %s: %w", jobID, err)
+	}
+	return nil
+}
+
+// FinishMaintenanceJob marks a maintenance job completed or failed with its final results.
+func FinishMaintenanceJob(jobID uuid.UUID, status string, results []models.MaintenanceResult, errorMessage string) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	if results == nil {
+		results = []models.MaintenanceResult{}
+	}
+	resultsJSON, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("error encoding results of maintenance job %s: %w", jobID, err)
+	}
+	query := `UPDATE maintenance_jobs SET status = $1, results = $2, error_message = $3, completed_at = $4 WHERE maintenance_job_id = $5`
+	if _, err := AppDB.Exec(query, status, resultsJSON, errorMessage, time.Now(), jobID); err != nil {
+		return fmt.Errorf("error updating maintenance job %s: %w", jobID, err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"pgweb-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// GetPGUserNetworkRules returns the network rules of a PG user, or sql.ErrNoRows if it is unrestricted.
+func GetPGUserNetworkRules(pgUserID uuid.UUID) (*models.PGUserNetworkRules, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	r := &models.PGUserNetworkRules{}
+	row := AppDB.QueryRow(`SELECT pg_user_id, allowed_cidrs, require_ssl, updated_at FROM pg_user_network_rules WHERE pg_user_id = $1`, pgUserID)
+	if err := row.Scan(&r.PGUserID, pq.Array(&r.AllowedCIDRs), &r.RequireSSL, &r.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("error querying network rules of PG user %s: %w", pgUserID, err)
+	}
+	return r, nil
+}
+
+// GetAllPGUserNetworkRules returns the network rules of every PG user that has them, with the
+// user's role and database name.
+func GetAllPGUserNetworkRules() ([]models.PGUserNetworkRules, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT r.pg_user_id, d.pg_database_name, u.pg_username, r.allowed_cidrs, r.require_ssl, r.updated_at
+	           FROM pg_user_network_rules r
+	           JOIN managed_pg_users u ON r.pg_user_id = u.pg_user_id
+	           JOIN managed_databases d ON u.managed_database_id = d.database_id
+	           ORDER BY u.pg_username`
+	rows, err := AppDB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error querying network rules: %w", err)
+	}
+	defer rows.Close()
+	rules := []models.PGUserNetworkRules{}
+	for rows.Next() {
+		var r models.PGUserNetworkRules
+		if err := rows.Scan(&r.PGUserID, &r.PGDatabaseName, &r.PGUsername, pq.Array(&r.AllowedCIDRs), &r.RequireSSL, &r.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning network rules: %w", err)
+		}
+		rules = append(rules, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating network rules: %w", err)
+	}
+	return rules, nil
+}
+
+// SetPGUserNetworkRules creates or replaces the network rules of a PG user.
+func SetPGUserNetworkRules(r *models.PGUserNetworkRules) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	if r.AllowedCIDRs == nil {
+		r.AllowedCIDRs = []string{}
+	}
+	r.UpdatedAt = time.Now()
+	query := `INSERT INTO pg_user_network_rules (pg_user_id, allowed_cidrs, require_ssl, updated_at) VALUES ($1, $2, $3, $4)
+	           ON CONFLICT (pg_user_id) DO UPDATE SET allowed_cidrs = EXCLUDED.allowed_cidrs, require_ssl = EXCLUDED.require_ssl, updated_at = EXCLUDED.updated_at`
+	if _, err := AppDB.Exec(query, r.PGUserID, pq.Array(r.AllowedCIDRs), r.RequireSSL, r.UpdatedAt); err != nil {
+		return fmt.Errorf("error saving network rules of PG user %s: %w", r.PGUserID, err)
+	}
+	return nil
+}
+
+// DeletePGUserNetworkRules removes the network rules of a PG user, lifting its restrictions.
+func DeletePGUserNetworkRules(pgUserID uuid.UUID) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	if _, err := AppDB.Exec(`DELETE FROM pg_user_network_rules WHERE pg_user_id = $1`, pgUserID); err != nil {
+		return fmt.Errorf("error deleting network rules of PG user %s: %w", pgUserID, err)
+	}
+	return nil
+}
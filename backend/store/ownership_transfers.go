@@ -0,0 +1,217 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"pgweb-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ErrTransferPending is returned by CreateOwnershipTransfer when the database already has a pending transfer.
+var ErrTransferPending = errors.New("database already has a pending ownership transfer")
+
+const ownershipTransferColumns = `t.transfer_id, t.database_id, d.pg_database_name, t.from_user_id, f.email, t.to_user_id, r.email,
+	t.rotate_passwords, t.status, t.created_at, t.resolved_at`
+
+const ownershipTransferJoins = `FROM database_ownership_transfers t
+	JOIN managed_databases d ON t.database_id = d.database_id
+	JOIN application_users f ON t.from_user_id = f.internal_user_id
+	JOIN application_users r ON t.to_user_id = r.internal_user_id`
+
+func scanOwnershipTransfer(row rowScanner) (*models.OwnershipTransfer, error) {
+	t := &models.OwnershipTransfer{}
+	var resolvedAt sql.NullTime
+	err := row.Scan(&t.TransferID, &t.DatabaseID, &t.PGDatabaseName, &t.FromUserID, &t.FromEmail, &t.ToUserID, &t.ToEmail,
+		&t.RotatePasswords, &t.Status, &t.CreatedAt, &resolvedAt)
+	if err != nil {
+		return nil, err
+	}
+	if resolvedAt.Valid {
+		t.ResolvedAt = &resolvedAt.Time
+	}
+	return t, nil
+}
+
+// CreateOwnershipTransfer records a pending ownership transfer proposed by the current owner.
+func CreateOwnershipTransfer(t *models.OwnershipTransfer) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	if t.TransferID == uuid.Nil {
+		t.TransferID = uuid.New()
+	}
+	t.Status = "pending"
+	t.CreatedAt = time.Now()
+	query := `INSERT INTO database_ownership_transfers (transfer_id, database_id, from_user_id, to_user_id, rotate_passwords, status, created_at)
+	           VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := AppDB.Exec(query, t.TransferID, t.DatabaseID, t.FromUserID, t.ToUserID, t.RotatePasswords, t.Status, t.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation on the pending index
+			return ErrTransferPending
+		}
+		return fmt.Errorf("error creating ownership transfer for database %s: %w", t.DatabaseID, err)
+	}
+	return nil
+}
+
+// GetOwnershipTransferByID returns an ownership transfer, or sql.ErrNoRows if it does not exist.
+func GetOwnershipTransferByID(transferID uuid.UUID) (*models.OwnershipTransfer, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT ` + ownershipTransferColumns + ` ` + ownershipTransferJoins + ` WHERE t.transfer_id = $1`
+	t, err := scanOwnershipTransfer(AppDB.QueryRow(query, transferID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("error querying ownership transfer %s: %w", transferID, err)
+	}
+	return t, nil
+}
+
+// GetPendingOwnershipTransfer returns the pending ownership transfer of a database, or sql.ErrNoRows if there is none.
+func GetPendingOwnershipTransfer(databaseID uuid.UUID) (*models.OwnershipTransfer, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT ` + ownershipTransferColumns + ` ` + ownershipTransferJoins + ` WHERE t.database_id = $1 AND t.status = 'pending'`
+	t, err := scanOwnershipTransfer(AppDB.QueryRow(query, databaseID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("error querying pending ownership transfer of database %s: %w", databaseID, err)
+	}
+	return t, nil
+}
+
+// GetPendingOwnershipTransfersForRecipient returns the pending ownership transfers offered to a user, newest first.
+func GetPendingOwnershipTransfersForRecipient(toUserID uuid.UUID) ([]models.OwnershipTransfer, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT ` + ownershipTransferColumns + ` ` + ownershipTransferJoins + `
+	           WHERE t.to_user_id = $1 AND t.status = 'pending' ORDER BY t.created_at DESC`
+	rows, err := AppDB.Query(query, toUserID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying ownership transfers for user %s: %w", toUserID, err)
+	}
+	defer rows.Close()
+
+	var transfers []models.OwnershipTransfer
+	for rows.Next() {
+		t, err := scanOwnershipTransfer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning ownership transfer: %w", err)
+		}
+		transfers = append(transfers, *t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating ownership transfers: %w", err)
+	}
+	return transfers, nil
+}
+
+// ResolveOwnershipTransfer marks a pending transfer as declined or cancelled without moving the database.
+// It returns sql.ErrNoRows if the transfer is no longer pending.
+func ResolveOwnershipTransfer(transferID uuid.UUID, status string) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	result, err := AppDB.Exec(`UPDATE database_ownership_transfers SET status = $1, resolved_at = $2 WHERE transfer_id = $3 AND status = 'pending'`,
+		status, time.Now(), transferID)
+	if err != nil {
+		return fmt.Errorf("error resolving ownership transfer %s: %w", transferID, err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CompleteOwnershipTransfer moves a database to the transfer's recipient in one transaction. An "accepted"
+// transfer must still be pending; a "forced" transfer is recorded as a new, resolved transfer and cancels
+// any pending one. It returns sql.ErrNoRows if the transfer is no longer pending or the database is no
+// longer owned by the transfer's sender.
+func CompleteOwnershipTransfer(t *models.OwnershipTransfer) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	tx, err := AppDB.Begin()
+	if err != nil {
+		return fmt.Errorf("error beginning ownership transfer: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	switch t.Status {
+	case "accepted":
+		result, err := tx.Exec(`UPDATE database_ownership_transfers SET status = 'accepted', resolved_at = $1 WHERE transfer_id = $2 AND status = 'pending'`,
+			now, t.TransferID)
+		if err != nil {
+			return fmt.Errorf("error accepting ownership transfer %s: %w", t.TransferID, err)
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return sql.ErrNoRows
+		}
+	case "forced":
+		if _, err := tx.Exec(`UPDATE database_ownership_transfers SET status = 'cancelled', resolved_at = $1 WHERE database_id = $2 AND status = 'pending'`,
+			now, t.DatabaseID); err != nil {
+			return fmt.Errorf("error cancelling pending ownership transfers of database %s: %w", t.DatabaseID, err)
+		}
+		if t.TransferID == uuid.Nil {
+			t.TransferID = uuid.New()
+		}
+		t.CreatedAt = now
+		if _, err := tx.Exec(`INSERT INTO database_ownership_transfers (transfer_id, database_id, from_user_id, to_user_id, rotate_passwords, status, created_at, resolved_at)
+		           VALUES ($1, $2, $3, $4, $5, 'forced', $6, $6)`,
+			t.TransferID, t.DatabaseID, t.FromUserID, t.ToUserID, t.RotatePasswords, now); err != nil {
+			return fmt.Errorf("error recording forced ownership transfer of database %s: %w", t.DatabaseID, err)
+		}
+	default:
+		return fmt.Errorf("invalid ownership transfer status %q", t.Status)
+	}
+
+	result, err := tx.Exec(`UPDATE managed_databases SET owner_user_id = $1, updated_at = $2 WHERE database_id = $3 AND owner_user_id = $4`,
+		t.ToUserID, now, t.DatabaseID, t.FromUserID)
+	if err != nil {
+		return fmt.Errorf("error changing owner of database %s: %w", t.DatabaseID, err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing ownership transfer of database %s: %w", t.DatabaseID, err)
+	}
+	t.ResolvedAt = &now
+	return nil
+}
+
+// GetManagedDatabaseByIDForAdmin returns a managed database regardless of its owner, or sql.ErrNoRows.
+func GetManagedDatabaseByIDForAdmin(databaseID uuid.UUID) (*models.DatabaseWithOwner, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT d.database_id, d.owner_user_id, d.pg_database_name, d.status, d.created_at, d.updated_at, u.email AS owner_email
+	           FROM managed_databases d
+	           JOIN application_users u ON d.owner_user_id = u.internal_user_id
+	           WHERE d.database_id = $1`
+	db := &models.DatabaseWithOwner{}
+	err := AppDB.QueryRow(query, databaseID).Scan(
+		&db.DatabaseID, &db.OwnerUserID, &db.PGDatabaseName, &db.Status, &db.CreatedAt, &db.UpdatedAt, &db.OwnerEmail,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("error querying managed database ID %s: %w", databaseID, err)
+	}
+	return db, nil
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"pgweb-backend/models"
+
+	"github.com/google/uuid"
+)
+
+// --- PermissionSet CRUD ---
+
+// CreatePermissionSet inserts a new permission set record.
+func CreatePermissionSet(ps *models.PermissionSet) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	if ps == nil {
+		return errors.New("permission set model must not be nil")
+	}
+	if ps.PermissionSetID == uuid.Nil {
+		ps.PermissionSetID = uuid.New()
+	}
+	ps.CreatedAt = time.Now()
+	ps.UpdatedAt = time.Now()
+	grants, err := json.Marshal(ps.Grants)
+	if err != nil {
+		return fmt.Errorf("error encoding grants for permission set %s: %w", ps.Name, err)
+	}
+	query := `INSERT INTO permission_sets (permission_set_id, database_id, name, pg_role_name, grants, created_at, updated_at)
+	           VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err = AppDB.Exec(query, ps.PermissionSetID, ps.DatabaseID, ps.Name, ps.PGRoleName, grants, ps.CreatedAt, ps.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating permission_set record %s in db %s: %w", ps.Name, ps.DatabaseID, err)
+	}
+	return nil
+}
+
+// GetPermissionSetsByDatabaseID retrieves all permission sets defined for a managed database.
+// This function does NOT check ownership of the database.
+func GetPermissionSetsByDatabaseID(databaseID uuid.UUID) ([]models.PermissionSet, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT permission_set_id, database_id, name, pg_role_name, grants, created_at, updated_at
+	           FROM permission_sets WHERE database_id = $1 ORDER BY name`
+	rows, err := AppDB.Query(query, databaseID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying permission sets for database %s: %w", databaseID, err)
+	}
+	defer rows.Close()
+	var sets []models.PermissionSet
+	for rows.Next() {
+		var ps models.PermissionSet
+		var grants []byte
+		if err := rows.Scan(&ps.PermissionSetID, &ps.DatabaseID, &ps.Name, &ps.PGRoleName, &grants, &ps.CreatedAt, &ps.UpdatedAt); err != nil {
+			log.Printf("Error scanning permission set row for database %s: %v", databaseID, err)
+			continue
+		}
+		if err := json.Unmarshal(grants, &ps.Grants); err != nil {
+			log.Printf("Error decoding grants for permission set %s: %v", ps.PermissionSetID, err)
+		}
+		sets = append(sets, ps)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating permission set rows for database %s: %w", databaseID, err)
+	}
+	return sets, nil
+}
+
+// GetPermissionSetByID retrieves a permission set belonging to the given database.
+func GetPermissionSetByID(permissionSetID uuid.UUID, databaseID uuid.UUID) (*models.PermissionSet, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT permission_set_id, database_id, name, pg_role_name, grants, created_at, updated_at
+	           FROM permission_sets WHERE permission_set_id = $1 AND database_id = $2`
+	return scanPermissionSet(AppDB.QueryRow(query, permissionSetID, databaseID), permissionSetID.String())
+}
+
+// GetPermissionSetByName retrieves a permission set by its name within the given database.
+func GetPermissionSetByName(databaseID uuid.UUID, name string) (*models.PermissionSet, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT permission_set_id, database_id, name, pg_role_name, grants, created_at, updated_at
+	           FROM permission_sets WHERE database_id = $1 AND name = $2`
+	return scanPermissionSet(AppDB.QueryRow(query, databaseID, name), name)
+}
+
+// scanPermissionSet is a shared helper that scans a single permission set row.
+func scanPermissionSet(row *sql.Row, ref string) (*models.PermissionSet, error) {
+	ps := &models.PermissionSet{}
+	var grants []byte
+	err := row.Scan(&ps.PermissionSetID, &ps.DatabaseID, &ps.Name, &ps.PGRoleName, &grants, &ps.CreatedAt, &ps.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("error querying permission set %s: %w", ref, err)
+	}
+	if err := json.Unmarshal(grants, &ps.Grants); err != nil {
+		return nil, fmt.Errorf("error decoding grants for permission set %s: %w", ref, err)
+	}
+	return ps, nil
+}
+
+// DeletePermissionSet deletes a permission set record. Assignments are removed by cascade.
+func DeletePermissionSet(permissionSetID uuid.UUID) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	result, err := AppDB.Exec(`DELETE FROM permission_sets WHERE permission_set_id = $1`, permissionSetID)
+	if err != nil {
+		return fmt.Errorf("error deleting permission set %s: %w", permissionSetID, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected after deleting permission set %s: %w", permissionSetID, err)
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// --- PermissionSet assignments ---
+
+// AssignPermissionSetToPGUser records that a permission set has been granted to a PG user.
+func AssignPermissionSetToPGUser(pgUserID uuid.UUID, permissionSetID uuid.UUID) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	query := `INSERT INTO managed_pg_user_permission_sets (pg_user_id, permission_set_id, created_at)
+	           VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+	if _, err := AppDB.Exec(query, pgUserID, permissionSetID, time.Now()); err != nil {
+		return fmt.Errorf("error assigning permission set %s to PG user %s: %w", permissionSetID, pgUserID, err)
+	}
+	return nil
+}
+
+// UnassignPermissionSetFromPGUser removes a permission set assignment from a PG user.
+func UnassignPermissionSetFromPGUser(pgUserID uuid.UUID, permissionSetID uuid.UUID) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	query := `DELETE FROM managed_pg_user_permission_sets WHERE pg_user_id = $1 AND permission_set_id = $2`
+	result, err := AppDB.Exec(query, pgUserID, permissionSetID)
+	if err != nil {
+		return fmt.Errorf("error unassigning permission set %s from PG user %s: %w", permissionSetID, pgUserID, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected after unassigning permission set %s: %w", permissionSetID, err)
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetPermissionSetNamesByDatabaseID returns the names of the permission sets assigned to each PG user
+// of a managed database, keyed by pg_user_id.
+func GetPermissionSetNamesByDatabaseID(databaseID uuid.UUID) (map[uuid.UUID][]string, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT a.pg_user_id, ps.name
+	           FROM managed_pg_user_permission_sets a
+	           JOIN permission_sets ps ON a.permission_set_id = ps.permission_set_id
+	           WHERE ps.database_id = $1 ORDER BY ps.name`
+	rows, err := AppDB.Query(query, databaseID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying permission set assignments for database %s: %w", databaseID, err)
+	}
+	defer rows.Close()
+	assignments := make(map[uuid.UUID][]string)
+	for rows.Next() {
+		var pgUserID uuid.UUID
+		var name string
+		if err := rows.Scan(&pgUserID, &name); err != nil {
+			log.Printf("Error scanning permission set assignment row for database %s: %v", databaseID, err)
+			continue
+		}
+		assignments[pgUserID] = append(assignments[pgUserID], name)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating permission set assignment rows for database %s: %w", databaseID, err)
+	}
+	return assignments, nil
+}
@@ -0,0 +1,280 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"pgweb-backend/models"
+
+	"github.com/google/uuid"
+)
+
+// --- PGUser password state ---
+
+// UpdateManagedPGUserPasswordState records a password change and the resulting VALID UNTIL.
+func UpdateManagedPGUserPasswordState(pgUserID uuid.UUID, changedAt time.Time, validUntil *time.Time) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	query := `UPDATE managed_pg_users SET password_changed_at = $1, password_valid_until = $2, updated_at = $3 WHERE pg_user_id = $4`
+	if _, err := AppDB.Exec(query, changedAt, validUntil, time.Now(), pgUserID); err != nil {
+		return fmt.Errorf("error updating password state for PG user %s: %w", pgUserID, err)
+	}
+	return nil
+}
+
+// UpdateManagedPGUserRotationPolicy records the rotation interval and VALID UNTIL of a PG user.
+func UpdateManagedPGUserRotationPolicy(pgUserID uuid.UUID, rotationIntervalDays int, validUntil *time.Time) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	query := `UPDATE managed_pg_users SET rotation_interval_days = $1, password_valid_until = $2, updated_at = $3 WHERE pg_user_id = $4`
+	if _, err := AppDB.Exec(query, rotationIntervalDays, validUntil, time.Now(), pgUserID); err != nil {
+		return fmt.Errorf("error updating rotation policy for PG user %s: %w", pgUserID, err)
+	}
+	return nil
+}
+
+// GetPGUsersDueForRotation returns active PG users of active databases whose rotation interval has elapsed.
+func GetPGUsersDueForRotation(now time.Time) ([]models.PGUserWithDatabase, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT ` + managedPGUserColumns + `, d.pg_database_name, d.owner_user_id
+	           FROM managed_pg_users u
+	           JOIN managed_databases d ON u.managed_database_id = d.database_id
+	           WHERE u.status = 'active' AND d.status = 'active' AND u.rotation_interval_days > 0
+	             AND COALESCE(u.password_changed_at, u.created_at) + make_interval(days => u.rotation_interval_days) <= $1
+	           ORDER BY u.created_at`
+	rows, err := AppDB.Query(query, now)
+	if err != nil {
+		return nil, fmt.Errorf("error querying PG users due for rotation: %w", err)
+	}
+	defer rows.Close()
+	var users []models.PGUserWithDatabase
+	for rows.Next() {
+		var dbName string
+		var ownerID uuid.UUID
+		pgUser, err := scanManagedPGUser(scannerWithExtra{rows, []any{&dbName, &ownerID}})
+		if err != nil {
+			log.Printf("Error scanning PG user due for rotation: %v", err)
+			continue
+		}
+		users = append(users, models.PGUserWithDatabase{ManagedPGUser: *pgUser, PGDatabaseName: dbName, OwnerUserID: ownerID})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating PG users due for rotation: %w", err)
+	}
+	return users, nil
+}
+
+// scannerWithExtra appends extra destinations after the managed_pg_users columns,
+// so scanManagedPGUser can be reused for joined queries.
+type scannerWithExtra struct {
+	row   rowScanner
+	extra []any
+}
+
+func (s scannerWithExtra) Scan(dest ...any) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
+
+// --- PGUserEvent ---
+
+// CreatePGUserEvent inserts an event. If secret is non-empty it is stored encrypted until fetched.
+func CreatePGUserEvent(event *models.PGUserEvent, secret string) error {
+	return insertPGUserEvent(event, secret, "committed")
+}
+
+// CreatePendingPGUserEvent inserts an event that stays hidden until CommitPGUserEvent is called,
+// so a new password can be stored before it is applied and discarded if applying it fails.
+func CreatePendingPGUserEvent(event *models.PGUserEvent, secret string) error {
+	return insertPGUserEvent(event, secret, "pending")
+}
+
+func insertPGUserEvent(event *models.PGUserEvent, secret, status string) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	if event.EventID == uuid.Nil {
+		event.EventID = uuid.New()
+	}
+	event.CreatedAt = time.Now()
+	var ciphertext []byte
+	if secret != "" {
+		var err error
+		ciphertext, err = EncryptSecret([]byte(secret))
+		if err != nil {
+			return fmt.Errorf("error encrypting secret for PG user event: %w", err)
+		}
+		event.SecretAvailable = true
+	}
+	query := `INSERT INTO pg_user_events (event_id, pg_user_id, database_id, event_type, secret_ciphertext, status, created_at)
+	           VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	if _, err := AppDB.Exec(query, event.EventID, event.PGUserID, event.DatabaseID, event.EventType, ciphertext, status, event.CreatedAt); err != nil {
+		return fmt.Errorf("error creating PG user event for %s: %w", event.PGUserID, err)
+	}
+	return nil
+}
+
+// CommitPGUserEvent makes a pending event visible. Returns sql.ErrNoRows if no pending event matches.
+func CommitPGUserEvent(eventID uuid.UUID) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	result, err := AppDB.Exec(`UPDATE pg_user_events SET status = 'committed' WHERE event_id = $1 AND status = 'pending'`, eventID)
+	if err != nil {
+		return fmt.Errorf("error committing PG user event %s: %w", eventID, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeletePendingPGUserEvent removes a pending event whose change was not applied.
+// Returns sql.ErrNoRows if no pending event matches.
+func DeletePendingPGUserEvent(eventID uuid.UUID) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	result, err := AppDB.Exec(`DELETE FROM pg_user_events WHERE event_id = $1 AND status = 'pending'`, eventID)
+	if err != nil {
+		return fmt.Errorf("error deleting pending PG user event %s: %w", eventID, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetPGUserEvents lists the most recent events of a PG user.
+func GetPGUserEvents(pgUserID uuid.UUID, limit int) ([]models.PGUserEvent, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT event_id, pg_user_id, database_id, event_type, secret_ciphertext IS NOT NULL, secret_fetched_at, created_at
+	           FROM pg_user_events WHERE pg_user_id = $1 AND status = 'committed' ORDER BY created_at DESC LIMIT $2`
+	rows, err := AppDB.Query(query, pgUserID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying events for PG user %s: %w", pgUserID, err)
+	}
+	defer rows.Close()
+	var events []models.PGUserEvent
+	for rows.Next() {
+		var event models.PGUserEvent
+		var fetchedAt sql.NullTime
+		if err := rows.Scan(&event.EventID, &event.PGUserID, &event.DatabaseID, &event.EventType, &event.SecretAvailable, &fetchedAt, &event.CreatedAt); err != nil {
+			log.Printf("Error scanning event row for PG user %s: %v", pgUserID, err)
+			continue
+		}
+		if fetchedAt.Valid {
+			event.SecretFetchedAt = &fetchedAt.Time
+		}
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating event rows for PG user %s: %w", pgUserID, err)
+	}
+	return events, nil
+}
+
+// ClaimPGUserEventSecret returns the decrypted secret of an event and removes it, so each
+// secret can be fetched only once. Returns sql.ErrNoRows if there is no secret to claim.
+func ClaimPGUserEventSecret(eventID uuid.UUID, pgUserID uuid.UUID) (string, error) {
+	if AppDB == nil {
+		return "", errors.New("database not initialized")
+	}
+	query := `WITH claimed AS (
+	              SELECT event_id, secret_ciphertext FROM pg_user_events
+	              WHERE event_id = $1 AND pg_user_id = $2 AND status = 'committed' AND secret_ciphertext IS NOT NULL
+	              FOR UPDATE
+	          )
+	          UPDATE pg_user_events e SET secret_ciphertext = NULL, secret_fetched_at = $3
+	          FROM claimed WHERE e.event_id = claimed.event_id
+	          RETURNING claimed.secret_ciphertext`
+	var ciphertext []byte
+	if err := AppDB.QueryRow(query, eventID, pgUserID, time.Now()).Scan(&ciphertext); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", sql.ErrNoRows
+		}
+		return "", fmt.Errorf("error claiming secret for event %s: %w", eventID, err)
+	}
+	plaintext, err := DecryptSecret(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// GetStalePendingPGUserEvents lists pending events created before olderThan. They belong to changes that
+// were interrupted between storing the secret and committing the event.
+func GetStalePendingPGUserEvents(olderThan time.Time) ([]models.PGUserEvent, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT event_id, pg_user_id, database_id, event_type, secret_ciphertext IS NOT NULL, created_at
+	           FROM pg_user_events WHERE status = 'pending' AND created_at < $1 ORDER BY created_at`
+	rows, err := AppDB.Query(query, olderThan)
+	if err != nil {
+		return nil, fmt.Errorf("error querying stale pending PG user events: %w", err)
+	}
+	defer rows.Close()
+	var events []models.PGUserEvent
+	for rows.Next() {
+		var event models.PGUserEvent
+		if err := rows.Scan(&event.EventID, &event.PGUserID, &event.DatabaseID, &event.EventType, &event.SecretAvailable, &event.CreatedAt); err != nil {
+			log.Printf("Error scanning stale pending PG user event row: %v", err)
+			continue
+		}
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating stale pending PG user event rows: %w", err)
+	}
+	return events, nil
+}
+
+// GetPendingPGUserEvent returns a pending event with its decrypted secret.
+// Returns sql.ErrNoRows if no pending event matches.
+func GetPendingPGUserEvent(eventID uuid.UUID) (*models.PGUserEvent, string, error) {
+	if AppDB == nil {
+		return nil, "", errors.New("database not initialized")
+	}
+	query := `SELECT event_id, pg_user_id, database_id, event_type, secret_ciphertext, created_at
+	           FROM pg_user_events WHERE event_id = $1 AND status = 'pending'`
+	var event models.PGUserEvent
+	var ciphertext []byte
+	if err := AppDB.QueryRow(query, eventID).Scan(&event.EventID, &event.PGUserID, &event.DatabaseID, &event.EventType, &ciphertext, &event.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, "", sql.ErrNoRows
+		}
+		return nil, "", fmt.Errorf("error querying pending PG user event %s: %w", eventID, err)
+	}
+	if ciphertext == nil {
+		return &event, "", nil
+	}
+	event.SecretAvailable = true
+	plaintext, err := DecryptSecret(ciphertext)
+	if err != nil {
+		return nil, "", err
+	}
+	return &event, string(plaintext), nil
+}
+
+// PurgeExpiredPGUserEventSecrets removes unfetched secrets of committed events older than maxAge.
+// Pending events keep their secret so an interrupted change can still be recovered.
+func PurgeExpiredPGUserEventSecrets(maxAge time.Duration) (int64, error) {
+	if AppDB == nil {
+		return 0, errors.New("database not initialized")
+	}
+	query := `UPDATE pg_user_events SET secret_ciphertext = NULL WHERE secret_ciphertext IS NOT NULL AND status = 'committed' AND created_at < $1`
+	result, err := AppDB.Exec(query, time.Now().Add(-maxAge))
+	if err != nil {
+		return 0, fmt.Errorf("error purging expired PG user event secrets: %w", err)
+	}
+	return result.RowsAffected()
+}
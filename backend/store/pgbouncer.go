@@ -0,0 +1,109 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"pgweb-backend/models"
+
+	"github.com/google/uuid"
+)
+
+func scanDatabasePoolSettings(row rowScanner) (*models.DatabasePoolSettings, error) {
+	s := &models.DatabasePoolSettings{}
+	var poolSize sql.NullInt64
+	var poolMode sql.NullString
+	if err := row.Scan(&s.DatabaseID, &poolSize, &poolMode, &s.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if poolSize.Valid {
+		size := int(poolSize.Int64)
+		s.PoolSize = &size
+	}
+	if poolMode.Valid {
+		s.PoolMode = &poolMode.String
+	}
+	return s, nil
+}
+
+// GetDatabasePoolSettings returns the pool settings of a database, or sql.ErrNoRows if none were set.
+func GetDatabasePoolSettings(databaseID uuid.UUID) (*models.DatabasePoolSettings, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	row := AppDB.QueryRow(`SELECT database_id, pool_size, pool_mode, updated_at FROM database_pool_settings WHERE database_id = $1`, databaseID)
+	s, err := scanDatabasePoolSettings(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("error querying pool settings of database %s: %w", databaseID, err)
+	}
+	return s, nil
+}
+
+// GetAllDatabasePoolSettings returns the pool settings of every database that has them, keyed by database ID.
+func GetAllDatabasePoolSettings() (map[uuid.UUID]models.DatabasePoolSettings, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	rows, err := AppDB.Query(`SELECT database_id, pool_size, pool_mode, updated_at FROM database_pool_settings`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying pool settings: %w", err)
+	}
+	defer rows.Close()
+	settings := make(map[uuid.UUID]models.DatabasePoolSettings)
+	for rows.Next() {
+		s, err := scanDatabasePoolSettings(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning pool settings: %w", err)
+		}
+		settings[s.DatabaseID] = *s
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating pool settings: %w", err)
+	}
+	return settings, nil
+}
+
+// SetDatabasePoolSettings creates or replaces the pool settings of a database.
+func SetDatabasePoolSettings(s *models.DatabasePoolSettings) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	s.UpdatedAt = time.Now()
+	query := `INSERT INTO database_pool_settings (database_id, pool_size, pool_mode, updated_at) VALUES ($1, $2, $3, $4)
+	           ON CONFLICT (database_id) DO UPDATE SET pool_size = EXCLUDED.pool_size, pool_mode = EXCLUDED.pool_mode, updated_at = EXCLUDED.updated_at`
+	if _, err := AppDB.Exec(query, s.DatabaseID, s.PoolSize, s.PoolMode, s.UpdatedAt); err != nil {
+		return fmt.Errorf("error saving pool settings of database %s: %w", s.DatabaseID, err)
+	}
+	return nil
+}
+
+// GetActivePGUsernames returns the login roles of active PG users of active databases, sorted by name.
+func GetActivePGUsernames() ([]string, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	rows, err := AppDB.Query(`SELECT u.pg_username FROM managed_pg_users u
+	           JOIN managed_databases d ON u.managed_database_id = d.database_id
+	           WHERE u.status = 'active' AND d.status = 'active' ORDER BY u.pg_username`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying active PG usernames: %w", err)
+	}
+	defer rows.Close()
+	var usernames []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error scanning PG username: %w", err)
+		}
+		usernames = append(usernames, name)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating active PG usernames: %w", err)
+	}
+	return usernames, nil
+}
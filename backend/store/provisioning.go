@@ -0,0 +1,89 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"pgweb-backend/models"
+
+	"github.com/google/uuid"
+)
+
+// StartProvisioningStep records that a provisioning step of a database has started, counting the attempt.
+func StartProvisioningStep(databaseID uuid.UUID, step string, position int) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	query := `INSERT INTO database_provisioning_steps (database_id, step, position, status, error, attempts, started_at, completed_at)
+	           VALUES ($1, $2, $3, 'running', '', 1, $4, NULL)
+	           ON CONFLICT (database_id, step) DO UPDATE
+	           SET status = 'running', error = '', attempts = database_provisioning_steps.attempts + 1,
+	               started_at = EXCLUDED.started_at, completed_at = NULL`
+	if _, err := AppDB.Exec(query, databaseID, step, position, time.Now()); err != nil {
+		return fmt.Errorf("error recording start of provisioning step %s for database %s: %w", step, databaseID, err)
+	}
+	return nil
+}
+
+// FinishProvisioningStep records the outcome ("completed" or "failed") of a provisioning step.
+func FinishProvisioningStep(databaseID uuid.UUID, step, status, errorMessage string) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	query := `UPDATE database_provisioning_steps SET status = $1, error = $2, completed_at = $3
+	           WHERE database_id = $4 AND step = $5`
+	if _, err := AppDB.Exec(query, status, errorMessage, time.Now(), databaseID, step); err != nil {
+		return fmt.Errorf("error recording outcome of provisioning step %s for database %s: %w", step, databaseID, err)
+	}
+	return nil
+}
+
+// GetProvisioningSteps returns the provisioning step log of a database in execution order.
+func GetProvisioningSteps(databaseID uuid.UUID) ([]models.ProvisioningStep, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT database_id, step, position, status, error, attempts, started_at, completed_at
+	           FROM database_provisioning_steps WHERE database_id = $1 ORDER BY position`
+	rows, err := AppDB.Query(query, databaseID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying provisioning steps for database %s: %w", databaseID, err)
+	}
+	defer rows.Close()
+	var steps []models.ProvisioningStep
+	for rows.Next() {
+		var s models.ProvisioningStep
+		if err := rows.Scan(&s.DatabaseID, &s.Step, &s.Position, &s.Status, &s.Error, &s.Attempts, &s.StartedAt, &s.CompletedAt); err != nil {
+			log.Printf("Error scanning provisioning step row: %v", err)
+			continue
+		}
+		steps = append(steps, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating provisioning step rows for database %s: %w", databaseID, err)
+	}
+	return steps, nil
+}
+
+// DeleteManagedDatabase removes a managed database record and, through cascades, everything attached to it.
+// It is used when the provisioning of a database that never became active is rolled back.
+func DeleteManagedDatabase(databaseID uuid.UUID) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	result, err := AppDB.Exec(`DELETE FROM managed_databases WHERE database_id = $1`, databaseID)
+	if err != nil {
+		return fmt.Errorf("error deleting managed database %s: %w", databaseID, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected for managed database %s deletion: %w", databaseID, err)
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
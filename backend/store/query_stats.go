@@ -0,0 +1,123 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"pgweb-backend/models"
+
+	"github.com/google/uuid"
+)
+
+// CreateQueryStatsSnapshot records a query statistics snapshot of a database with its top statements.
+func CreateQueryStatsSnapshot(snapshot *models.QueryStatsSnapshot) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	if snapshot.SnapshotID == uuid.Nil {
+		snapshot.SnapshotID = uuid.New()
+	}
+	tx, err := AppDB.Begin()
+	if err != nil {
+		return fmt.Errorf("error beginning query statistics snapshot: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO query_stats_snapshots (snapshot_id, database_id, captured_at, query_count, calls, total_time_ms, rows)
+	           VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		snapshot.SnapshotID, snapshot.DatabaseID, snapshot.CapturedAt, snapshot.QueryCount, snapshot.Calls, snapshot.TotalTimeMS, snapshot.Rows)
+	if err != nil {
+		return fmt.Errorf("error inserting query statistics snapshot of database %s: %w", snapshot.DatabaseID, err)
+	}
+	for _, e := range snapshot.Queries {
+		_, err := tx.Exec(`INSERT INTO query_stats_snapshot_entries (snapshot_id, query_id, pg_username, query, calls, total_time_ms, rows, mean_time_ms)
+		           VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT DO NOTHING`,
+			snapshot.SnapshotID, e.QueryID, e.PGUsername, e.Query, e.Calls, e.TotalTimeMS, e.Rows, e.MeanTimeMS)
+		if err != nil {
+			return fmt.Errorf("error inserting query statistics of snapshot %s: %w", snapshot.SnapshotID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing query statistics snapshot: %w", err)
+	}
+	return nil
+}
+
+// GetLatestQueryStatsSnapshot returns the most recent snapshot of a database with its statements, or
+// sql.ErrNoRows if none was taken.
+func GetLatestQueryStatsSnapshot(databaseID uuid.UUID) (*models.QueryStatsSnapshot, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	s := &models.QueryStatsSnapshot{Queries: []models.QueryStatsEntry{}}
+	err := AppDB.QueryRow(`SELECT snapshot_id, database_id, captured_at, query_count, calls, total_time_ms, rows FROM query_stats_snapshots
+		WHERE database_id = $1 ORDER BY captured_at DESC LIMIT 1`, databaseID).
+		Scan(&s.SnapshotID, &s.DatabaseID, &s.CapturedAt, &s.QueryCount, &s.Calls, &s.TotalTimeMS, &s.Rows)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("error querying latest query statistics snapshot of database %s: %w", databaseID, err)
+	}
+
+	rows, err := AppDB.Query(`SELECT query_id, pg_username, query, calls, total_time_ms, rows, mean_time_ms
+		FROM query_stats_snapshot_entries WHERE snapshot_id = $1 ORDER BY total_time_ms DESC`, s.SnapshotID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying statements of snapshot %s: %w", s.SnapshotID, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e models.QueryStatsEntry
+		if err := rows.Scan(&e.QueryID, &e.PGUsername, &e.Query, &e.Calls, &e.TotalTimeMS, &e.Rows, &e.MeanTimeMS); err != nil {
+			return nil, fmt.Errorf("error scanning statement of snapshot %s: %w", s.SnapshotID, err)
+		}
+		s.Queries = append(s.Queries, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating statements of snapshot %s: %w", s.SnapshotID, err)
+	}
+	return s, nil
+}
+
+// GetQueryStatsSnapshots returns the snapshots of a database taken since the given time, oldest first,
+// without their statements.
+func GetQueryStatsSnapshots(databaseID uuid.UUID, since time.Time) ([]models.QueryStatsSnapshot, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	rows, err := AppDB.Query(`SELECT snapshot_id, database_id, captured_at, query_count, calls, total_time_ms, rows FROM query_stats_snapshots
+		WHERE database_id = $1 AND captured_at >= $2 ORDER BY captured_at`, databaseID, since)
+	if err != nil {
+		return nil, fmt.Errorf("error querying query statistics snapshots of database %s: %w", databaseID, err)
+	}
+	defer rows.Close()
+
+	snapshots := []models.QueryStatsSnapshot{}
+	for rows.Next() {
+		var s models.QueryStatsSnapshot
+		if err := rows.Scan(&s.SnapshotID, &s.DatabaseID, &s.CapturedAt, &s.QueryCount, &s.Calls, &s.TotalTimeMS, &s.Rows); err != nil {
+			return nil, fmt.Errorf("error scanning query statistics snapshot: %w", err)
+		}
+		snapshots = append(snapshots, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating query statistics snapshots: %w", err)
+	}
+	return snapshots, nil
+}
+
+// DeleteQueryStatsSnapshotsBefore deletes the snapshots of all databases taken before cutoff and returns
+// how many were deleted.
+func DeleteQueryStatsSnapshotsBefore(cutoff time.Time) (int64, error) {
+	if AppDB == nil {
+		return 0, errors.New("database not initialized")
+	}
+	result, err := AppDB.Exec(`DELETE FROM query_stats_snapshots WHERE captured_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting query statistics snapshots: %w", err)
+	}
+	deleted, _ := result.RowsAffected()
+	return deleted, nil
+}
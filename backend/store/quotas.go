@@ -0,0 +1,94 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"pgweb-backend/models"
+
+	"github.com/google/uuid"
+)
+
+// GetUserQuota returns the quota assignment of a user, or sql.ErrNoRows if the user has none.
+func GetUserQuota(internalUserID uuid.UUID) (*models.UserQuota, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT internal_user_id, plan, overrides, updated_at FROM user_quotas WHERE internal_user_id = $1`
+	quota := &models.UserQuota{}
+	var overridesJSON []byte
+	err := AppDB.QueryRow(query, internalUserID).Scan(&quota.InternalUserID, &quota.Plan, &overridesJSON, &quota.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("error querying quota of user %s: %w", internalUserID, err)
+	}
+	if err := json.Unmarshal(overridesJSON, &quota.Overrides); err != nil {
+		return nil, fmt.Errorf("error decoding quota overrides of user %s: %w", internalUserID, err)
+	}
+	return quota, nil
+}
+
+// UpsertUserQuota creates or replaces the quota assignment of a user.
+func UpsertUserQuota(quota *models.UserQuota) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	overridesJSON, err := json.Marshal(quota.Overrides)
+	if err != nil {
+		return fmt.Errorf("error encoding quota overrides: %w", err)
+	}
+	quota.UpdatedAt = time.Now()
+	query := `INSERT INTO user_quotas (internal_user_id, plan, overrides, updated_at) VALUES ($1, $2, $3, $4)
+	           ON CONFLICT (internal_user_id) DO UPDATE SET plan = EXCLUDED.plan, overrides = EXCLUDED.overrides, updated_at = EXCLUDED.updated_at`
+	if _, err := AppDB.Exec(query, quota.InternalUserID, quota.Plan, overridesJSON, quota.UpdatedAt); err != nil {
+		return fmt.Errorf("error saving quota of user %s: %w", quota.InternalUserID, err)
+	}
+	return nil
+}
+
+// CountManagedDatabasesByOwner counts the databases of a user that count against the quota (not soft-deleted).
+func CountManagedDatabasesByOwner(ownerUserID uuid.UUID) (int, error) {
+	if AppDB == nil {
+		return 0, errors.New("database not initialized")
+	}
+	var count int
+	query := `SELECT COUNT(*) FROM managed_databases WHERE owner_user_id = $1 AND status != 'soft_deleted'`
+	if err := AppDB.QueryRow(query, ownerUserID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting databases of user %s: %w", ownerUserID, err)
+	}
+	return count, nil
+}
+
+// CountManagedPGUsersByDatabaseID counts the PG users of a managed database.
+func CountManagedPGUsersByDatabaseID(databaseID uuid.UUID) (int, error) {
+	if AppDB == nil {
+		return 0, errors.New("database not initialized")
+	}
+	var count int
+	query := `SELECT COUNT(*) FROM managed_pg_users WHERE managed_database_id = $1`
+	if err := AppDB.QueryRow(query, databaseID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting PG users of database %s: %w", databaseID, err)
+	}
+	return count, nil
+}
+
+// GetBackupStorageBytesByOwner sums the size of the completed backups of a user's databases.
+func GetBackupStorageBytesByOwner(ownerUserID uuid.UUID) (int64, error) {
+	if AppDB == nil {
+		return 0, errors.New("database not initialized")
+	}
+	var total int64
+	query := `SELECT COALESCE(SUM(bj.file_size), 0)
+	           FROM backup_jobs bj
+	           JOIN managed_databases d ON bj.database_id = d.database_id
+	           WHERE d.owner_user_id = $1 AND bj.type = 'backup' AND bj.status = 'completed'`
+	if err := AppDB.QueryRow(query, ownerUserID).Scan(&total); err != nil {
+		return 0, fmt.Errorf("error summing backup storage of user %s: %w", ownerUserID, err)
+	}
+	return total, nil
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"pgweb-backend/models"
+)
+
+// GetAllManagedDatabases returns every managed database regardless of owner or status.
+func GetAllManagedDatabases() ([]models.ManagedDatabase, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT database_id, owner_user_id, pg_database_name, status, created_at, updated_at
+	           FROM managed_databases ORDER BY created_at`
+	rows, err := AppDB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error querying all managed databases: %w", err)
+	}
+	defer rows.Close()
+	var databases []models.ManagedDatabase
+	for rows.Next() {
+		var db models.ManagedDatabase
+		if err := rows.Scan(&db.DatabaseID, &db.OwnerUserID, &db.PGDatabaseName, &db.Status, &db.CreatedAt, &db.UpdatedAt); err != nil {
+			log.Printf("Error scanning managed database row: %v", err)
+			continue
+		}
+		databases = append(databases, db)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating all managed database rows: %w", err)
+	}
+	return databases, nil
+}
+
+// CreateReconciliationRun records the result of a reconciliation.
+func CreateReconciliationRun(run *models.ReconciliationRun) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	findings := run.Findings
+	if findings == nil {
+		findings = []models.ReconciliationFinding{}
+	}
+	findingsJSON, err := json.Marshal(findings)
+	if err != nil {
+		return fmt.Errorf("error encoding reconciliation findings: %w", err)
+	}
+	query := `INSERT INTO reconciliation_runs (run_id, trigger, repair, findings, error, started_at, completed_at)
+	           VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err = AppDB.Exec(query, run.RunID, run.Trigger, run.Repair, findingsJSON, run.Error, run.StartedAt, run.CompletedAt)
+	if err != nil {
+		return fmt.Errorf("error creating reconciliation run %s: %w", run.RunID, err)
+	}
+	return nil
+}
+
+// GetLatestReconciliationRun returns the most recent reconciliation, or sql.ErrNoRows if none has run.
+func GetLatestReconciliationRun() (*models.ReconciliationRun, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT run_id, trigger, repair, findings, error, started_at, completed_at
+	           FROM reconciliation_runs ORDER BY started_at DESC LIMIT 1`
+	run := &models.ReconciliationRun{}
+	var findingsJSON []byte
+	err := AppDB.QueryRow(query).Scan(&run.RunID, &run.Trigger, &run.Repair, &findingsJSON, &run.Error, &run.StartedAt, &run.CompletedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("error fetching latest reconciliation run: %w", err)
+	}
+	if err := json.Unmarshal(findingsJSON, &run.Findings); err != nil {
+		return nil, fmt.Errorf("error decoding reconciliation findings: %w", err)
+	}
+	return run, nil
+}
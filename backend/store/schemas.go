@@ -0,0 +1,110 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"pgweb-backend/models"
+
+	"github.com/google/uuid"
+)
+
+// --- ManagedSchema CRUD ---
+
+// CreateManagedSchema inserts a new managed schema record.
+func CreateManagedSchema(schema *models.ManagedSchema) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	if schema == nil {
+		return errors.New("schema model must not be nil")
+	}
+	if schema.SchemaID == uuid.Nil {
+		schema.SchemaID = uuid.New()
+	}
+	schema.CreatedAt = time.Now()
+	query := `INSERT INTO managed_schemas (schema_id, database_id, schema_name, created_at) VALUES ($1, $2, $3, $4)`
+	if _, err := AppDB.Exec(query, schema.SchemaID, schema.DatabaseID, schema.SchemaName, schema.CreatedAt); err != nil {
+		return fmt.Errorf("error creating managed_schema record %s in db %s: %w", schema.SchemaName, schema.DatabaseID, err)
+	}
+	return nil
+}
+
+// GetManagedSchemasByDatabaseID retrieves all additional schemas of a managed database.
+// This function does NOT check ownership of the database.
+func GetManagedSchemasByDatabaseID(databaseID uuid.UUID) ([]models.ManagedSchema, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT schema_id, database_id, schema_name, created_at FROM managed_schemas WHERE database_id = $1 ORDER BY schema_name`
+	rows, err := AppDB.Query(query, databaseID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying managed schemas for database %s: %w", databaseID, err)
+	}
+	defer rows.Close()
+	var schemas []models.ManagedSchema
+	for rows.Next() {
+		var schema models.ManagedSchema
+		if err := rows.Scan(&schema.SchemaID, &schema.DatabaseID, &schema.SchemaName, &schema.CreatedAt); err != nil {
+			log.Printf("Error scanning managed schema row for database %s: %v", databaseID, err)
+			continue
+		}
+		schemas = append(schemas, schema)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating managed schema rows for database %s: %w", databaseID, err)
+	}
+	return schemas, nil
+}
+
+// GetManagedSchemaByID retrieves a managed schema belonging to the given database.
+func GetManagedSchemaByID(schemaID uuid.UUID, databaseID uuid.UUID) (*models.ManagedSchema, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT schema_id, database_id, schema_name, created_at FROM managed_schemas WHERE schema_id = $1 AND database_id = $2`
+	schema := &models.ManagedSchema{}
+	err := AppDB.QueryRow(query, schemaID, databaseID).Scan(&schema.SchemaID, &schema.DatabaseID, &schema.SchemaName, &schema.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("error querying managed schema %s: %w", schemaID, err)
+	}
+	return schema, nil
+}
+
+// CheckIfSchemaNameExistsInDB checks if a schema with the given name is managed in a database.
+func CheckIfSchemaNameExistsInDB(databaseID uuid.UUID, schemaName string) (bool, error) {
+	if AppDB == nil {
+		return false, errors.New("database not initialized")
+	}
+	query := `SELECT EXISTS(SELECT 1 FROM managed_schemas WHERE database_id = $1 AND schema_name = $2)`
+	var exists bool
+	if err := AppDB.QueryRow(query, databaseID, schemaName).Scan(&exists); err != nil {
+		return false, fmt.Errorf("error checking existence of schema %s in database %s: %w", schemaName, databaseID, err)
+	}
+	return exists, nil
+}
+
+// DeleteManagedSchema deletes a managed schema record.
+func DeleteManagedSchema(schemaID uuid.UUID) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	result, err := AppDB.Exec(`DELETE FROM managed_schemas WHERE schema_id = $1`, schemaID)
+	if err != nil {
+		return fmt.Errorf("error deleting managed schema %s: %w", schemaID, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected after deleting managed schema %s: %w", schemaID, err)
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// secretEncryptionKey derives the AES-256 key used for secrets kept in the application database.
+// PGWEB_SECRET_ENCRYPTION_KEY is preferred; SESSION_SECRET_KEY is used as a fallback so existing
+// deployments work without extra configuration.
+func secretEncryptionKey() ([]byte, error) {
+	material := os.Getenv("PGWEB_SECRET_ENCRYPTION_KEY")
+	if material == "" {
+		material = os.Getenv("SESSION_SECRET_KEY")
+	}
+	if material == "" {
+		return nil, errors.New("no secret encryption key configured (set PGWEB_SECRET_ENCRYPTION_KEY)")
+	}
+	key := sha256.Sum256([]byte(material))
+	return key[:], nil
+}
+
+// EncryptSecret encrypts plaintext with AES-GCM. The nonce is prepended to the ciphertext.
+func EncryptSecret(plaintext []byte) ([]byte, error) {
+	key, err := secretEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// DecryptSecret reverses EncryptSecret.
+func DecryptSecret(ciphertext []byte) ([]byte, error) {
+	key, err := secretEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return plaintext, nil
+}
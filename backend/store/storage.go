@@ -0,0 +1,94 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"pgweb-backend/models"
+
+	"github.com/google/uuid"
+)
+
+// RecordDatabaseStorageSample saves the latest size of a database and the limit it was checked against.
+// The read-only state is left unchanged.
+func RecordDatabaseStorageSample(databaseID uuid.UUID, sizeBytes, limitBytes int64, sampledAt time.Time) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	query := `INSERT INTO database_storage_state (database_id, size_bytes, limit_bytes, sampled_at) VALUES ($1, $2, $3, $4)
+	           ON CONFLICT (database_id) DO UPDATE SET size_bytes = EXCLUDED.size_bytes, limit_bytes = EXCLUDED.limit_bytes, sampled_at = EXCLUDED.sampled_at`
+	if _, err := AppDB.Exec(query, databaseID, sizeBytes, limitBytes, sampledAt); err != nil {
+		return fmt.Errorf("error recording storage sample of database %s: %w", databaseID, err)
+	}
+	return nil
+}
+
+// SetDatabaseReadOnlySince marks a sampled database as read-only since the given time, or as writable if nil.
+func SetDatabaseReadOnlySince(databaseID uuid.UUID, since *time.Time) error {
+	if AppDB == nil {
+		return errors.New("database not initialized")
+	}
+	result, err := AppDB.Exec(`UPDATE database_storage_state SET read_only_since = $1 WHERE database_id = $2`, since, databaseID)
+	if err != nil {
+		return fmt.Errorf("error updating read-only state of database %s: %w", databaseID, err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func scanDatabaseStorageState(row rowScanner) (*models.DatabaseStorageState, error) {
+	state := &models.DatabaseStorageState{}
+	var readOnlySince sql.NullTime
+	if err := row.Scan(&state.DatabaseID, &state.SizeBytes, &state.LimitBytes, &state.SampledAt, &readOnlySince); err != nil {
+		return nil, err
+	}
+	if readOnlySince.Valid {
+		state.ReadOnlySince = &readOnlySince.Time
+	}
+	return state, nil
+}
+
+// GetDatabaseStorageState returns the storage state of a database, or sql.ErrNoRows if it was never sampled.
+func GetDatabaseStorageState(databaseID uuid.UUID) (*models.DatabaseStorageState, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	query := `SELECT database_id, size_bytes, limit_bytes, sampled_at, read_only_since FROM database_storage_state WHERE database_id = $1`
+	state, err := scanDatabaseStorageState(AppDB.QueryRow(query, databaseID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("error querying storage state of database %s: %w", databaseID, err)
+	}
+	return state, nil
+}
+
+// GetDatabaseStorageStates returns the storage state of every sampled database, keyed by database ID.
+func GetDatabaseStorageStates() (map[uuid.UUID]models.DatabaseStorageState, error) {
+	if AppDB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	rows, err := AppDB.Query(`SELECT database_id, size_bytes, limit_bytes, sampled_at, read_only_since FROM database_storage_state`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying database storage states: %w", err)
+	}
+	defer rows.Close()
+
+	states := make(map[uuid.UUID]models.DatabaseStorageState)
+	for rows.Next() {
+		state, err := scanDatabaseStorageState(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning database storage state: %w", err)
+		}
+		states[state.DatabaseID] = *state
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating database storage states: %w", err)
+	}
+	return states, nil
+}